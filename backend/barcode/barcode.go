@@ -0,0 +1,85 @@
+package barcode
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Format of a barcode symbol
+type Format string
+
+const (
+	FormatCode128 Format = "code128"
+	FormatEAN13   Format = "ean13"
+	FormatQR      Format = "qr"
+)
+
+// Symbol is an encoded barcode: rows of dark (true) and light modules, without quiet zone.
+// Linear barcodes have a single row that is drawn as tall bars
+type Symbol struct {
+	Format  Format
+	Text    string // Human readable text, e.g. the EAN-13 digits with their check digit
+	Modules [][]bool
+}
+
+// Is2D reports whether the symbol is a matrix code
+func (s *Symbol) Is2D() bool {
+	return len(s.Modules) > 1
+}
+
+// Width is the number of modules across
+func (s *Symbol) Width() int {
+	if len(s.Modules) == 0 {
+		return 0
+	}
+	return len(s.Modules[0])
+}
+
+// QuietZone is the light margin, in modules, that scanners need around the symbol
+func (s *Symbol) QuietZone() int {
+	if s.Is2D() {
+		return 4
+	}
+	return 10
+}
+
+// Encode encodes data in a barcode format
+func Encode(format Format, data string) (*Symbol, error) {
+	switch format {
+	case FormatCode128:
+		return Code128(data)
+	case FormatEAN13:
+		return EAN13(data)
+	case FormatQR:
+		return QR(data)
+	default:
+		return nil, fmt.Errorf("unknown barcode format %q", format)
+	}
+}
+
+// ParseFormat reads a format name, accepting the usual spellings
+func ParseFormat(name string) (Format, error) {
+	switch strings.ToLower(strings.ReplaceAll(strings.ReplaceAll(name, "-", ""), "_", "")) {
+	case "code128", "":
+		return FormatCode128, nil
+	case "ean13", "ean":
+		return FormatEAN13, nil
+	case "qr", "qrcode":
+		return FormatQR, nil
+	default:
+		return "", fmt.Errorf("format must be code128, ean13 or qr")
+	}
+}
+
+// widthsToModules expands bar/space widths, starting with a bar, into modules
+func widthsToModules(widths string) []bool {
+	var modules []bool
+	dark := true
+	for _, w := range widths {
+		for i := 0; i < int(w-'0'); i++ {
+			modules = append(modules, dark)
+		}
+		dark = !dark
+	}
+	return modules
+}
@@ -0,0 +1,93 @@
+package barcode
+
+import (
+	"fmt"
+)
+
+// code128Patterns are the bar/space widths of symbol values 0-106; 103-105 are the
+// start codes A, B and C and 106 is the stop pattern
+var code128Patterns = [107]string{
+	"212222", "222122", "222221", "121223", "121322", "131222", "122213", "122312", "132212", "221213",
+	"221312", "231212", "112232", "122132", "122231", "113222", "123122", "123221", "223211", "221132",
+	"221231", "213212", "223112", "312131", "311222", "321122", "321221", "312212", "322112", "322211",
+	"212123", "212321", "232121", "111323", "131123", "131321", "112313", "132113", "132311", "211313",
+	"231113", "231311", "112133", "112331", "132131", "113123", "113321", "133121", "313121", "211331",
+	"231131", "213113", "213311", "213131", "311123", "311321", "331121", "312113", "312311", "332111",
+	"314111", "221411", "431111", "111224", "111422", "121124", "121421", "141122", "141221", "112214",
+	"112412", "122114", "122411", "142112", "142211", "241211", "221114", "413111", "241112", "134111",
+	"111242", "121142", "121241", "114212", "124112", "124211", "411212", "421112", "421211", "212141",
+	"214121", "412121", "111143", "111341", "131141", "114113", "114311", "411113", "411311", "113141",
+	"114131", "311141", "411131", "211412", "211214", "211232", "2331112",
+}
+
+const (
+	code128CodeC  = 99
+	code128CodeB  = 100
+	code128StartB = 104
+	code128StartC = 105
+	code128Stop   = 106
+)
+
+// digitRun counts the digits at the start of s
+func digitRun(s string) int {
+	n := 0
+	for n < len(s) && s[n] >= '0' && s[n] <= '9' {
+		n++
+	}
+	return n
+}
+
+// Code128 encodes printable ASCII in Code 128, using code set C for runs of digits
+func Code128(data string) (*Symbol, error) {
+	if data == "" {
+		return nil, fmt.Errorf("nothing to encode")
+	}
+	for i := 0; i < len(data); i++ {
+		if data[i] < 32 || data[i] > 126 {
+			return nil, fmt.Errorf("Code 128 cannot encode %q", data[i])
+		}
+	}
+
+	var values []int
+	setC := digitRun(data) >= 4 || (len(data) == 2 && digitRun(data) == 2)
+	if setC {
+		values = append(values, code128StartC)
+	} else {
+		values = append(values, code128StartB)
+	}
+
+	for i := 0; i < len(data); {
+		run := digitRun(data[i:])
+		switch {
+		case setC && run >= 2:
+			values = append(values, int(data[i]-'0')*10+int(data[i+1]-'0'))
+			i += 2
+		case setC:
+			values = append(values, code128CodeB)
+			setC = false
+		case run >= 6 || (run >= 4 && run == len(data)-i):
+			// Switching pays off for longer runs; an odd digit goes out in set B first
+			if run%2 == 1 {
+				values = append(values, int(data[i])-32)
+				i++
+			}
+			values = append(values, code128CodeC)
+			setC = true
+		default:
+			values = append(values, int(data[i])-32)
+			i++
+		}
+	}
+
+	checksum := values[0]
+	for i := 1; i < len(values); i++ {
+		checksum += i * values[i]
+	}
+	values = append(values, checksum%103, code128Stop)
+
+	var modules []bool
+	for _, value := range values {
+		modules = append(modules, widthsToModules(code128Patterns[value])...)
+	}
+	return &Symbol{Format: FormatCode128, Text: data, Modules: [][]bool{modules}}, nil
+}
@@ -0,0 +1,79 @@
+package barcode
+
+import (
+	"fmt"
+)
+
+// eanL are the left-hand odd parity digit patterns; even parity and right-hand patterns derive from them
+var eanL = [10]string{"0001101", "0011001", "0010011", "0111101", "0100011", "0110001", "0101111", "0111011", "0110111", "0001011"}
+
+// eanParity gives the parity of the six left digits, selected by the first digit; G is even parity
+var eanParity = [10]string{"LLLLLL", "LLGLGG", "LLGGLG", "LLGGGL", "LGLLGG", "LGGLLG", "LGGGLL", "LGLGLG", "LGLGGL", "LGGLGL"}
+
+// EANCheckDigit computes the check digit of the first 12 digits of an EAN-13 code
+func EANCheckDigit(digits string) byte {
+	sum := 0
+	for i := 0; i < 12; i++ {
+		digit := int(digits[i] - '0')
+		if i%2 == 1 {
+			digit *= 3
+		}
+		sum += digit
+	}
+	return byte('0' + (10-sum%10)%10)
+}
+
+// EAN13 encodes 12 digits, adding the check digit, or 13 digits whose check digit is verified
+func EAN13(data string) (*Symbol, error) {
+	if len(data) != 12 && len(data) != 13 {
+		return nil, fmt.Errorf("EAN-13 needs 12 or 13 digits")
+	}
+	for i := 0; i < len(data); i++ {
+		if data[i] < '0' || data[i] > '9' {
+			return nil, fmt.Errorf("EAN-13 needs 12 or 13 digits")
+		}
+	}
+	check := EANCheckDigit(data)
+	if len(data) == 13 && data[12] != check {
+		return nil, fmt.Errorf("EAN-13 check digit of %s should be %c", data, check)
+	}
+	code := data[:12] + string(check)
+
+	pattern := "101"
+	parity := eanParity[code[0]-'0']
+	for i := 1; i <= 6; i++ {
+		l := eanL[code[i]-'0']
+		if parity[i-1] == 'G' {
+			pattern += reverse(invert(l))
+		} else {
+			pattern += l
+		}
+	}
+	pattern += "01010"
+	for i := 7; i <= 12; i++ {
+		pattern += invert(eanL[code[i]-'0'])
+	}
+	pattern += "101"
+
+	modules := make([]bool, len(pattern))
+	for i := range pattern {
+		modules[i] = pattern[i] == '1'
+	}
+	return &Symbol{Format: FormatEAN13, Text: code, Modules: [][]bool{modules}}, nil
+}
+
+func invert(bits string) string {
+	out := []byte(bits)
+	for i := range out {
+		out[i] = '0' + '1' - out[i]
+	}
+	return string(out)
+}
+
+func reverse(bits string) string {
+	out := []byte(bits)
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	return string(out)
+}
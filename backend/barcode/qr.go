@@ -0,0 +1,424 @@
+package barcode
+
+import (
+	"fmt"
+)
+
+// qrVersion holds the error correction layout of a QR version at level M
+type qrVersion struct {
+	ecPerBlock int
+	blocks     [2][2]int // {count, data codewords} of the short and long block groups
+	alignment  []int     // Centre coordinates of alignment patterns
+	remainder  int       // Bits left over after the codewords
+}
+
+// qrVersions at error correction level M, versions 1 to 10 (up to 213 bytes)
+var qrVersions = []qrVersion{
+	{10, [2][2]int{{1, 16}, {0, 0}}, nil, 0},
+	{16, [2][2]int{{1, 28}, {0, 0}}, []int{6, 18}, 7},
+	{26, [2][2]int{{1, 44}, {0, 0}}, []int{6, 22}, 7},
+	{18, [2][2]int{{2, 32}, {0, 0}}, []int{6, 26}, 7},
+	{24, [2][2]int{{2, 43}, {0, 0}}, []int{6, 30}, 7},
+	{16, [2][2]int{{4, 27}, {0, 0}}, []int{6, 34}, 7},
+	{18, [2][2]int{{4, 31}, {0, 0}}, []int{6, 22, 38}, 0},
+	{22, [2][2]int{{2, 38}, {2, 39}}, []int{6, 24, 42}, 0},
+	{22, [2][2]int{{3, 36}, {2, 37}}, []int{6, 26, 46}, 0},
+	{26, [2][2]int{{4, 43}, {1, 44}}, []int{6, 28, 50}, 0},
+}
+
+func (v qrVersion) dataCodewords() int {
+	return v.blocks[0][0]*v.blocks[0][1] + v.blocks[1][0]*v.blocks[1][1]
+}
+
+// qrMatrix is a QR symbol under construction; function modules are kept out of the data area
+type qrMatrix struct {
+	size       int
+	modules    [][]bool
+	isFunction [][]bool
+}
+
+func (m *qrMatrix) setFunction(x, y int, dark bool) {
+	m.modules[y][x] = dark
+	m.isFunction[y][x] = true
+}
+
+// QR encodes data as a QR code in byte mode at error correction level M
+func QR(data string) (*Symbol, error) {
+	if data == "" {
+		return nil, fmt.Errorf("nothing to encode")
+	}
+
+	// Smallest version that holds the data: mode, length, the bytes and room for the terminator
+	version := 0
+	for v := range qrVersions {
+		countBits := 8
+		if v+1 >= 10 {
+			countBits = 16
+		}
+		if 4+countBits+8*len(data) <= qrVersions[v].dataCodewords()*8 {
+			version = v + 1
+			break
+		}
+	}
+	if version == 0 {
+		return nil, fmt.Errorf("QR code data is too long (%d bytes)", len(data))
+	}
+	layout := qrVersions[version-1]
+
+	codewords := qrInterleave(layout, qrDataCodewords(version, layout, []byte(data)))
+
+	size := version*4 + 17
+	m := &qrMatrix{size: size, modules: make([][]bool, size), isFunction: make([][]bool, size)}
+	for i := range m.modules {
+		m.modules[i] = make([]bool, size)
+		m.isFunction[i] = make([]bool, size)
+	}
+	m.drawFunctionPatterns(version, layout)
+	m.drawCodewords(codewords)
+
+	// Keep the mask that leaves the fewest patterns that confuse scanners
+	best, bestPenalty := 0, -1
+	for mask := 0; mask < 8; mask++ {
+		m.applyMask(mask)
+		m.drawFormatBits(mask)
+		if penalty := m.penalty(); bestPenalty < 0 || penalty < bestPenalty {
+			best, bestPenalty = mask, penalty
+		}
+		m.applyMask(mask)
+	}
+	m.applyMask(best)
+	m.drawFormatBits(best)
+
+	return &Symbol{Format: FormatQR, Text: data, Modules: m.modules}, nil
+}
+
+// qrDataCodewords packs the byte mode segment and pads it to the version's data capacity
+func qrDataCodewords(version int, layout qrVersion, data []byte) []byte {
+	var bits []bool
+	appendBits := func(value, length int) {
+		for i := length - 1; i >= 0; i-- {
+			bits = append(bits, (value>>i)&1 == 1)
+		}
+	}
+
+	countBits := 8
+	if version >= 10 {
+		countBits = 16
+	}
+	appendBits(0x4, 4) // Byte mode
+	appendBits(len(data), countBits)
+	for _, b := range data {
+		appendBits(int(b), 8)
+	}
+
+	capacity := layout.dataCodewords() * 8
+	for i := 0; i < 4 && len(bits) < capacity; i++ {
+		bits = append(bits, false)
+	}
+	for len(bits)%8 != 0 {
+		bits = append(bits, false)
+	}
+	for pad := 0xEC; len(bits) < capacity; pad ^= 0xEC ^ 0x11 {
+		appendBits(pad, 8)
+	}
+
+	codewords := make([]byte, len(bits)/8)
+	for i, bit := range bits {
+		if bit {
+			codewords[i/8] |= 1 << (7 - i%8)
+		}
+	}
+	return codewords
+}
+
+// qrInterleave splits the data into blocks, adds each block's error correction and interleaves them
+func qrInterleave(layout qrVersion, data []byte) []byte {
+	var blocks, ecBlocks [][]byte
+	divisor := rsDivisor(layout.ecPerBlock)
+	for _, group := range layout.blocks {
+		for i := 0; i < group[0]; i++ {
+			block := data[:group[1]]
+			data = data[group[1]:]
+			blocks = append(blocks, block)
+			ecBlocks = append(ecBlocks, rsRemainder(block, divisor))
+		}
+	}
+
+	var result []byte
+	longest := layout.blocks[0][1]
+	if layout.blocks[1][0] > 0 {
+		longest = layout.blocks[1][1]
+	}
+	for i := 0; i < longest; i++ {
+		for _, block := range blocks {
+			if i < len(block) {
+				result = append(result, block[i])
+			}
+		}
+	}
+	for i := 0; i < layout.ecPerBlock; i++ {
+		for _, block := range ecBlocks {
+			result = append(result, block[i])
+		}
+	}
+	return result
+}
+
+// gfMultiply multiplies in GF(2^8) modulo x^8 + x^4 + x^3 + x^2 + 1
+func gfMultiply(x, y byte) byte {
+	z := 0
+	for i := 7; i >= 0; i-- {
+		z = (z << 1) ^ ((z >> 7) * 0x11D)
+		z ^= int((y>>i)&1) * int(x)
+	}
+	return byte(z)
+}
+
+// rsDivisor returns the Reed-Solomon generator polynomial of a degree, highest term first and
+// its leading 1 left out
+func rsDivisor(degree int) []byte {
+	result := make([]byte, degree)
+	result[degree-1] = 1
+	root := byte(1)
+	for i := 0; i < degree; i++ {
+		for j := range result {
+			result[j] = gfMultiply(result[j], root)
+			if j+1 < len(result) {
+				result[j] ^= result[j+1]
+			}
+		}
+		root = gfMultiply(root, 0x02)
+	}
+	return result
+}
+
+// rsRemainder computes the error correction codewords of a block
+func rsRemainder(data, divisor []byte) []byte {
+	result := make([]byte, len(divisor))
+	for _, b := range data {
+		factor := b ^ result[0]
+		copy(result, result[1:])
+		result[len(result)-1] = 0
+		for i := range result {
+			result[i] ^= gfMultiply(divisor[i], factor)
+		}
+	}
+	return result
+}
+
+func (m *qrMatrix) drawFunctionPatterns(version int, layout qrVersion) {
+	for i := 0; i < m.size; i++ {
+		m.setFunction(6, i, i%2 == 0)
+		m.setFunction(i, 6, i%2 == 0)
+	}
+
+	m.drawFinder(3, 3)
+	m.drawFinder(m.size-4, 3)
+	m.drawFinder(3, m.size-4)
+
+	last := len(layout.alignment) - 1
+	for i, x := range layout.alignment {
+		for j, y := range layout.alignment {
+			// The corners taken by finder patterns get none
+			if (i == 0 && j == 0) || (i == 0 && j == last) || (i == last && j == 0) {
+				continue
+			}
+			m.drawAlignment(x, y)
+		}
+	}
+
+	// Reserve the format areas; the real bits are drawn once the mask is chosen
+	m.drawFormatBits(0)
+
+	if version >= 7 {
+		rem := version
+		for i := 0; i < 12; i++ {
+			rem = (rem << 1) ^ ((rem >> 11) * 0x1F25)
+		}
+		bits := version<<12 | rem
+		for i := 0; i < 18; i++ {
+			dark := (bits>>i)&1 == 1
+			a, b := m.size-11+i%3, i/3
+			m.setFunction(a, b, dark)
+			m.setFunction(b, a, dark)
+		}
+	}
+}
+
+// drawFinder draws a finder pattern and its separator around a centre
+func (m *qrMatrix) drawFinder(cx, cy int) {
+	for dy := -4; dy <= 4; dy++ {
+		for dx := -4; dx <= 4; dx++ {
+			x, y := cx+dx, cy+dy
+			if x < 0 || x >= m.size || y < 0 || y >= m.size {
+				continue
+			}
+			dist := max(abs(dx), abs(dy))
+			m.setFunction(x, y, dist != 2 && dist != 4)
+		}
+	}
+}
+
+func (m *qrMatrix) drawAlignment(cx, cy int) {
+	for dy := -2; dy <= 2; dy++ {
+		for dx := -2; dx <= 2; dx++ {
+			m.setFunction(cx+dx, cy+dy, max(abs(dx), abs(dy)) != 1)
+		}
+	}
+}
+
+// drawFormatBits draws the error correction level (M) and mask, twice
+func (m *qrMatrix) drawFormatBits(mask int) {
+	data := 0<<3 | mask // Level M is 00
+	rem := data
+	for i := 0; i < 10; i++ {
+		rem = (rem << 1) ^ ((rem >> 9) * 0x537)
+	}
+	bits := (data<<10 | rem) ^ 0x5412
+	bit := func(i int) bool { return (bits>>i)&1 == 1 }
+
+	for i := 0; i <= 5; i++ {
+		m.setFunction(8, i, bit(i))
+	}
+	m.setFunction(8, 7, bit(6))
+	m.setFunction(8, 8, bit(7))
+	m.setFunction(7, 8, bit(8))
+	for i := 9; i < 15; i++ {
+		m.setFunction(14-i, 8, bit(i))
+	}
+
+	for i := 0; i < 8; i++ {
+		m.setFunction(m.size-1-i, 8, bit(i))
+	}
+	for i := 8; i < 15; i++ {
+		m.setFunction(8, m.size-15+i, bit(i))
+	}
+	m.setFunction(8, m.size-8, true)
+}
+
+// drawCodewords fills the data area in the zigzag order, two columns at a time from the right
+func (m *qrMatrix) drawCodewords(data []byte) {
+	i := 0
+	for right := m.size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		for vert := 0; vert < m.size; vert++ {
+			for j := 0; j < 2; j++ {
+				x := right - j
+				y := vert
+				if (right+1)&2 == 0 {
+					y = m.size - 1 - vert
+				}
+				if !m.isFunction[y][x] && i < len(data)*8 {
+					m.modules[y][x] = (data[i>>3]>>(7-i&7))&1 == 1
+					i++
+				}
+			}
+		}
+	}
+}
+
+// applyMask flips the data modules selected by a mask; applying it twice undoes it
+func (m *qrMatrix) applyMask(mask int) {
+	for y := 0; y < m.size; y++ {
+		for x := 0; x < m.size; x++ {
+			var flip bool
+			switch mask {
+			case 0:
+				flip = (x+y)%2 == 0
+			case 1:
+				flip = y%2 == 0
+			case 2:
+				flip = x%3 == 0
+			case 3:
+				flip = (x+y)%3 == 0
+			case 4:
+				flip = (x/3+y/2)%2 == 0
+			case 5:
+				flip = x*y%2+x*y%3 == 0
+			case 6:
+				flip = (x*y%2+x*y%3)%2 == 0
+			case 7:
+				flip = ((x+y)%2+x*y%3)%2 == 0
+			}
+			if flip && !m.isFunction[y][x] {
+				m.modules[y][x] = !m.modules[y][x]
+			}
+		}
+	}
+}
+
+// penalty scores a masked symbol by the four rules of the QR specification
+func (m *qrMatrix) penalty() int {
+	score := 0
+	at := func(x, y int, vertical bool) bool {
+		if vertical {
+			return m.modules[x][y]
+		}
+		return m.modules[y][x]
+	}
+
+	for _, vertical := range []bool{false, true} {
+		for y := 0; y < m.size; y++ {
+			// Runs of five or more modules of one colour
+			run := 1
+			for x := 1; x <= m.size; x++ {
+				if x < m.size && at(x, y, vertical) == at(x-1, y, vertical) {
+					run++
+					continue
+				}
+				if run >= 5 {
+					score += 3 + run - 5
+				}
+				run = 1
+			}
+
+			// Patterns looking like a finder: 1011101 with four light modules on one side
+			for x := 0; x+11 <= m.size; x++ {
+				var line [11]bool
+				for k := range line {
+					line[k] = at(x+k, y, vertical)
+				}
+				core := line[4] && !line[5] && line[6] && line[7] && line[8] && !line[9] && line[10]
+				if core && !line[0] && !line[1] && !line[2] && !line[3] {
+					score += 40
+				}
+				core = line[0] && !line[1] && line[2] && line[3] && line[4] && !line[5] && line[6]
+				if core && !line[7] && !line[8] && !line[9] && !line[10] {
+					score += 40
+				}
+			}
+		}
+	}
+
+	// 2x2 blocks of one colour
+	for y := 0; y+1 < m.size; y++ {
+		for x := 0; x+1 < m.size; x++ {
+			c := m.modules[y][x]
+			if c == m.modules[y][x+1] && c == m.modules[y+1][x] && c == m.modules[y+1][x+1] {
+				score += 3
+			}
+		}
+	}
+
+	// Balance of dark and light modules
+	dark := 0
+	for y := 0; y < m.size; y++ {
+		for x := 0; x < m.size; x++ {
+			if m.modules[y][x] {
+				dark++
+			}
+		}
+	}
+	total := m.size * m.size
+	score += abs(dark*20-total*10) / total * 10
+	return score
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
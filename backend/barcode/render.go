@@ -0,0 +1,126 @@
+package barcode
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"image"
+	"image/color"
+	"image/png"
+	"strings"
+)
+
+// bar is a run of dark modules in a row: start and width in modules
+type bar struct {
+	x, width int
+}
+
+// bars merges the dark modules of a row into runs so renderers draw one rectangle per bar
+func bars(row []bool) []bar {
+	var out []bar
+	for x := 0; x < len(row); x++ {
+		if !row[x] {
+			continue
+		}
+		start := x
+		for x < len(row) && row[x] {
+			x++
+		}
+		out = append(out, bar{start, x - start})
+	}
+	return out
+}
+
+// SVG draws the symbol with a quiet zone. Module is the size of one module in pixels; height is
+// the bar height of linear symbols, whose text is printed below the bars when showText is set
+func SVG(s *Symbol, module, height int, showText bool) string {
+	quiet := s.QuietZone()
+	width := (s.Width() + 2*quiet) * module
+	rows := len(s.Modules)
+	rowHeight := module
+	total := (rows + 2*quiet) * module
+	top := quiet * module
+	fontSize := 0
+	if !s.Is2D() {
+		rowHeight = height
+		top = module * 2
+		total = height + 4*module
+		if showText {
+			fontSize = max(10, module*8)
+			total += fontSize + module
+		}
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`, width, total, width, total)
+	fmt.Fprintf(&b, `<rect width="%d" height="%d" fill="#fff"/><path fill="#000" d="`, width, total)
+	for y, row := range s.Modules {
+		for _, r := range bars(row) {
+			fmt.Fprintf(&b, "M%d %dh%dv%dh-%dz", (quiet+r.x)*module, top+y*rowHeight, r.width*module, rowHeight, r.width*module)
+		}
+	}
+	b.WriteString(`"/>`)
+	if fontSize > 0 {
+		fmt.Fprintf(&b, `<text x="%d" y="%d" font-family="monospace" font-size="%d" text-anchor="middle">%s</text>`,
+			width/2, top+height+module+fontSize, fontSize, html.EscapeString(s.Text))
+	}
+	b.WriteString("</svg>\n")
+	return b.String()
+}
+
+// PNG draws the symbol with a quiet zone as a black and white image, scaled like SVG
+func PNG(s *Symbol, module, height int) ([]byte, error) {
+	quiet := s.QuietZone()
+	width := (s.Width() + 2*quiet) * module
+	rowHeight, top, total := module, quiet*module, (len(s.Modules)+2*quiet)*module
+	if !s.Is2D() {
+		rowHeight, top, total = height, module*2, height+4*module
+	}
+
+	img := image.NewPaletted(image.Rect(0, 0, width, total), color.Palette{color.White, color.Black})
+	for y, row := range s.Modules {
+		for _, r := range bars(row) {
+			for py := top + y*rowHeight; py < top+(y+1)*rowHeight; py++ {
+				for px := (quiet + r.x) * module; px < (quiet+r.x+r.width)*module; px++ {
+					img.SetColorIndex(px, py, 1)
+				}
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// PDF returns content stream operators filling the symbol's dark modules inside a box, in points
+// from the bottom left of the page. The quiet zone is left inside the box; matrix symbols stay
+// square and centred
+func PDF(s *Symbol, x, y, width, height float64) string {
+	quiet := s.QuietZone()
+	module := width / float64(s.Width()+2*quiet)
+	rowHeight := height
+	if s.Is2D() {
+		module = min(width, height) / float64(s.Width()+2*quiet)
+		rowHeight = module
+		side := module * float64(s.Width()+2*quiet)
+		x += (width - side) / 2
+		y += (height - side) / 2
+		y += module * float64(quiet)
+	}
+
+	var b strings.Builder
+	b.WriteString("0 g\n")
+	rows := len(s.Modules)
+	for i, row := range s.Modules {
+		// PDF y grows upwards, so the first row is drawn on top
+		rowY := y + float64(rows-1-i)*rowHeight
+		for _, r := range bars(row) {
+			fmt.Fprintf(&b, "%.3f %.3f %.3f %.3f re\n", x+float64(quiet+r.x)*module, rowY, float64(r.width)*module, rowHeight)
+		}
+	}
+	b.WriteString("f\n")
+	return b.String()
+}
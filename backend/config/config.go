@@ -4,12 +4,17 @@ import (
 	"os"
 )
 
+// DevPaymentMockSecret signs mock payment callbacks in debug mode when no secret is set
+const DevPaymentMockSecret = "mock-secret"
+
 type Config struct {
 	DatabaseDSN string
 	JWTSecret   string
 	ServerPort  string
 	GinMode     string
 	FrontendURL string
+
+	PaymentMockSecret string // Empty unless set; the mock provider is then only registered in debug mode
 }
 
 func Load() *Config {
@@ -19,6 +24,8 @@ func Load() *Config {
 		ServerPort:  getEnv("SERVER_PORT", "8080"),
 		GinMode:     getEnv("GIN_MODE", "debug"),
 		FrontendURL: getEnv("FRONTEND_URL", "http://localhost:5173"),
+
+		PaymentMockSecret: getEnv("PAYMENT_MOCK_SECRET", ""),
 	}
 }
 
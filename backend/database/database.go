@@ -32,10 +32,18 @@ func Migrate() error {
 		&models.Role{},
 		&models.Permission{},
 		&models.Setting{},
-		&models.Category{},
+		&models.TaxClass{},
+		&models.UnitOfMeasure{},
+		&models.BarcodeSchema{},
+		&models.LabelTemplate{},
+		&models.Category{}, // Depends on TaxClass (optional)
 		&models.Supplier{},
-		&models.Customer{},
+		&models.LoyaltyTier{},
+		&models.Customer{}, // Depends on LoyaltyTier (optional)
 		&models.FinancialAccount{},
+		&models.DocumentSequence{},
+		&models.DocumentCounter{},
+		&models.CatalogDeletion{},
 	)
 	if err != nil {
 		return err
@@ -72,9 +80,17 @@ func Migrate() error {
 	// 5. Tables depending on Product
 	err = DB.AutoMigrate(
 		&models.ProductVariant{},
+		&models.ProductUnit{},          // Depends on Product
+		&models.LabelQueueItem{},       // Depends on Product, ProductVariant, User
+		&models.ProductComponent{},     // Depends on Product, ProductVariant
+		&models.StorePrice{},           // Depends on Store, Product, ProductVariant
+		&models.PriceChange{},          // Depends on Product, ProductVariant, Store, User
+		&models.PriceHistory{},         // Depends on Product, ProductVariant, Store, PriceChange, User
 		&models.Inventory{},            // Depends on Product, Warehouse
 		&models.StoreInventory{},       // Depends on Product, Store
 		&models.InventoryTransaction{}, // Depends on Product, Warehouse
+		&models.DiscountItem{},         // Depends on Discount, Product
+		&models.DiscountTier{},         // Depends on Discount
 	)
 	if err != nil {
 		return err
@@ -82,16 +98,35 @@ func Migrate() error {
 
 	// 6. Order/Transaction tables
 	err = DB.AutoMigrate(
-		&models.PurchaseOrder{},     // Depends on Warehouse, Supplier, User
-		&models.PurchaseOrderItem{}, // Depends on PurchaseOrder, Product
-		&models.StockTransfer{},     // Depends on Warehouse
-		&models.StockTransferItem{}, // Depends on StockTransfer, Product
-		&models.Sale{},              // Depends on Store, Customer, User
-		&models.SaleItem{},          // Depends on Sale, Product
-		&models.SalePayment{},       // Depends on Sale
-		&models.JournalEntry{},      // Depends on User
-		&models.JournalEntryLine{},  // Depends on JournalEntry, FinancialAccount
-		&models.DiscountUsage{},     // Depends on Discount, Sale, Customer
+		&models.PurchaseOrder{},             // Depends on Warehouse, Supplier, User
+		&models.PurchaseOrderItem{},         // Depends on PurchaseOrder, Product
+		&models.StockTransfer{},             // Depends on Warehouse
+		&models.StockTransferItem{},         // Depends on StockTransfer, Product
+		&models.RegisterSession{},           // Depends on Store, User
+		&models.CashMovement{},              // Depends on RegisterSession, User
+		&models.Sale{},                      // Depends on Store, Customer, User, RegisterSession
+		&models.SaleItem{},                  // Depends on Sale, Product
+		&models.SaleItemReservation{},       // Depends on Sale, SaleItem, Product
+		&models.SaleItemTax{},               // Depends on SaleItem, TaxClass
+		&models.SalePayment{},               // Depends on Sale
+		&models.JournalEntry{},              // Depends on User
+		&models.JournalEntryLine{},          // Depends on JournalEntry, FinancialAccount
+		&models.DiscountUsage{},             // Depends on Discount, Sale, Customer
+		&models.SaleReturn{},                // Depends on Sale, Store, Customer, User
+		&models.SaleReturnItem{},            // Depends on SaleReturn, SaleItem, Product
+		&models.SaleReturnRefund{},          // Depends on SaleReturn
+		&models.CustomerPayment{},           // Depends on Customer, Store, RegisterSession, User
+		&models.CustomerPaymentAllocation{}, // Depends on CustomerPayment, Sale
+		&models.CustomerLedgerEntry{},       // Depends on Customer, Sale, CustomerPayment
+		&models.GiftCard{},                  // Depends on Store, Sale, SaleReturn, Customer
+		&models.GiftCardTransaction{},       // Depends on GiftCard, Sale, SaleReturn
+		&models.LoyaltyTransaction{},        // Depends on Customer, Sale, SaleReturn
+		&models.StockLot{},                  // Depends on Product, Warehouse, Store, PurchaseOrder
+		&models.StockLotMovement{},          // Depends on StockLot
+		&models.SerialNumber{},              // Depends on Product, Warehouse, Store, Sale, Customer
+		&models.SerialNumberEvent{},         // Depends on SerialNumber
+		&models.SaleItemComponent{},         // Depends on Sale, SaleItem, Product
+		&models.KitAssembly{},               // Depends on Store, Product, User
 	)
 	if err != nil {
 		return err
@@ -139,6 +174,13 @@ func SeedData() error {
 		{Name: "sales.create", Module: "Penjualan", Category: "create", Description: "Buat transaksi penjualan", Actions: `["create"]`},
 		{Name: "sales.update", Module: "Penjualan", Category: "edit", Description: "Edit transaksi penjualan", Actions: `["update"]`},
 		{Name: "sales.delete", Module: "Penjualan", Category: "delete", Description: "Hapus transaksi penjualan", Actions: `["delete"]`},
+		{Name: "sales.void", Module: "Penjualan", Category: "edit", Description: "Batalkan (void) transaksi penjualan", Actions: `["void"]`},
+		{Name: "sales.return", Module: "Penjualan", Category: "create", Description: "Proses retur dan refund penjualan", Actions: `["return"]`},
+		{Name: "sales.price_override", Module: "Penjualan", Category: "edit", Description: "Setujui perubahan harga dan diskon manual di kasir", Actions: `["override"]`},
+
+		// Register sessions (Shift kasir)
+		{Name: "registers.view", Module: "Shift Kasir", Category: "view", Description: "Lihat shift kasir dan laporan X/Z", Actions: `["view"]`},
+		{Name: "registers.manage", Module: "Shift Kasir", Category: "edit", Description: "Kelola dan tutup shift kasir lain", Actions: `["manage"]`},
 
 		// Discounts
 		{Name: "discounts.view", Module: "Diskon", Category: "view", Description: "Lihat daftar diskon", Actions: `["view"]`},
@@ -169,6 +211,15 @@ func SeedData() error {
 		{Name: "customers.create", Module: "Pelanggan", Category: "create", Description: "Tambah pelanggan baru", Actions: `["create"]`},
 		{Name: "customers.update", Module: "Pelanggan", Category: "edit", Description: "Edit pelanggan", Actions: `["update"]`},
 		{Name: "customers.delete", Module: "Pelanggan", Category: "delete", Description: "Hapus pelanggan", Actions: `["delete"]`},
+		{Name: "customers.credit", Module: "Pelanggan", Category: "edit", Description: "Atur limit kredit pelanggan", Actions: `["credit"]`},
+		{Name: "customers.payment", Module: "Pelanggan", Category: "create", Description: "Terima pembayaran piutang pelanggan", Actions: `["payment"]`},
+
+		// Gift cards
+		{Name: "giftcards.view", Module: "Kartu Hadiah", Category: "view", Description: "Lihat kartu hadiah dan kredit toko", Actions: `["view"]`},
+		{Name: "giftcards.manage", Module: "Kartu Hadiah", Category: "edit", Description: "Blokir atau aktifkan kartu hadiah", Actions: `["manage"]`},
+
+		// Loyalty
+		{Name: "loyalty.manage", Module: "Loyalitas", Category: "edit", Description: "Atur tier member dan sesuaikan poin pelanggan", Actions: `["manage"]`},
 
 		// Inventory
 		{Name: "inventory.view", Module: "Inventori", Category: "view", Description: "Lihat ringkasan stok", Actions: `["view"]`},
@@ -280,17 +331,19 @@ func SeedData() error {
 	// Assign manager permissions via raw SQL (tanpa updated_at)
 	DB.Exec(`INSERT INTO role_permissions (role_id, permission_id, created_at) 
 		SELECT ?, id, NOW() FROM permissions WHERE name IN (
-			'dashboard.view','sales.view','sales.create','sales.update',
+			'dashboard.view','sales.view','sales.create','sales.update','sales.void','sales.return','sales.price_override',
 			'discounts.view','discounts.create','discounts.update',
 			'products.view','products.create','products.update',
 			'categories.view','categories.create','categories.update',
 			'suppliers.view','suppliers.create','suppliers.update',
-			'customers.view','customers.create','customers.update',
+			'customers.view','customers.create','customers.update','customers.credit','customers.payment',
+			'giftcards.view','giftcards.manage','loyalty.manage',
 			'inventory.view','inventory.update',
 			'storage_locations.view','storage_locations.create','storage_locations.update',
 			'purchase_orders.view','purchase_orders.create','purchase_orders.update',
 			'stock_transfers.view','stock_transfers.create','stock_transfers.update',
-			'stores.view','warehouses.view','users.view','reports.view'
+			'stores.view','warehouses.view','users.view','reports.view',
+			'registers.view','registers.manage'
 		) ON CONFLICT DO NOTHING`, managerRole.ID)
 
 	// Assign cashier permissions via raw SQL (tanpa updated_at)
@@ -298,7 +351,8 @@ func SeedData() error {
 	// without exposing those menus in the sidebar (sidebar checks specific permissions like stores.view)
 	DB.Exec(`INSERT INTO role_permissions (role_id, permission_id, created_at) 
 		SELECT ?, id, NOW() FROM permissions WHERE name IN (
-			'dashboard.view','pos.view','pos.create','reports.view'
+			'dashboard.view','pos.view','pos.create','sales.return','reports.view','customers.payment',
+			'giftcards.view'
 		) ON CONFLICT DO NOTHING`, cashierRole.ID)
 
 	// Assign warehouse permissions via raw SQL (tanpa updated_at)
@@ -386,10 +440,17 @@ func SeedData() error {
 		{Key: "currency_symbol", Value: "Rp"},
 		{Key: "currency_code", Value: "IDR"},
 		{Key: "tax_rate", Value: "10"},
+		{Key: "tax_enabled", Value: "true"},
+		{Key: "prices_include_tax", Value: "false"},
+		{Key: "payment_timeout_minutes", Value: "15"},
+		{Key: "draft_expiry_minutes", Value: "240"},
+		{Key: "gift_card_expiry_months", Value: "12"},
+		{Key: "loyalty_points_expiry_months", Value: "12"},
 		{Key: "receipt_header", Value: "Thank you for your purchase!"},
 		{Key: "receipt_footer", Value: "Please come again"},
 		{Key: "inventory_auto_adjustment", Value: "true"},
 		{Key: "low_stock_threshold", Value: "10"},
+		{Key: "expiry_warning_days", Value: "30"},
 		{Key: "enable_barcode_scanner", Value: "true"},
 		{Key: "default_payment_method", Value: "cash"},
 		{Key: "allow_negative_inventory", Value: "false"},
@@ -400,6 +461,65 @@ func SeedData() error {
 		DB.Where(models.Setting{Key: setting.Key}).FirstOrCreate(&setting)
 	}
 
+	// Default tax classes; products without a class use the tax_rate setting
+	defaultTaxClasses := []models.TaxClass{
+		{Code: "PPN", Name: "PPN", Rate: 11, Description: "Pajak Pertambahan Nilai"},
+		{Code: "BEBAS", Name: "Bebas PPN", Rate: 0, Description: "Barang kebutuhan pokok yang dibebaskan dari PPN"},
+	}
+
+	for _, taxClass := range defaultTaxClasses {
+		DB.Where(models.TaxClass{Code: taxClass.Code}).FirstOrCreate(&taxClass)
+	}
+
+	// Default units of measure; packs convert to a product's base unit through ProductUnit
+	defaultUnits := []models.UnitOfMeasure{
+		{Code: "pcs", Name: "Pieces", Description: "Satuan dasar per buah"},
+		{Code: "pack", Name: "Pack", Description: "Kemasan isi beberapa buah"},
+		{Code: "dus", Name: "Dus", Description: "Karton isi beberapa pack atau buah"},
+		{Code: "kg", Name: "Kilogram", Description: "Barang timbangan"},
+		{Code: "g", Name: "Gram", Description: "Barang timbangan"},
+		{Code: "l", Name: "Liter", Description: "Barang cair"},
+		{Code: "ml", Name: "Mililiter", Description: "Barang cair"},
+	}
+
+	for _, unit := range defaultUnits {
+		DB.Where(models.UnitOfMeasure{Code: unit.Code}).FirstOrCreate(&unit)
+	}
+
+	// Default scale label schemas: EAN-13 2P IIIII VVVVV C with the weight in grams or the price in rupiah
+	defaultBarcodeSchemas := []models.BarcodeSchema{
+		{Name: "Timbangan (berat)", Prefix: "20", Length: 13, ItemCodeStart: 2, ItemCodeLength: 5, ValueStart: 7, ValueLength: 5,
+			ValueType: "weight", ValueDecimals: 3, HasCheckDigit: true},
+		{Name: "Timbangan (harga)", Prefix: "21", Length: 13, ItemCodeStart: 2, ItemCodeLength: 5, ValueStart: 7, ValueLength: 5,
+			ValueType: "price", ValueDecimals: 0, HasCheckDigit: true},
+	}
+
+	for _, schema := range defaultBarcodeSchemas {
+		DB.Where(models.BarcodeSchema{Prefix: schema.Prefix}).FirstOrCreate(&schema)
+	}
+
+	// Default label layouts: an A4 sheet of 3 x 8 labels and a single label roll for thermal printers
+	defaultLabelTemplates := []models.LabelTemplate{
+		{Name: "A4 3 x 8 (63,5 x 33,9 mm)", PageWidth: 210, PageHeight: 297, Columns: 3, Rows: 8, LabelWidth: 63.5, LabelHeight: 33.9,
+			MarginTop: 12.9, MarginLeft: 7.2, GapX: 2.5, FontSize: 8, ShowName: true, ShowPrice: true, ShowUnitPrice: true, ShowBarcode: true, IsDefault: true},
+		{Name: "Roll 50 x 30 mm", PageWidth: 50, PageHeight: 30, Columns: 1, Rows: 1, LabelWidth: 50, LabelHeight: 30,
+			FontSize: 7, ShowName: true, ShowPrice: true, ShowUnitPrice: true, ShowBarcode: true},
+	}
+
+	for _, template := range defaultLabelTemplates {
+		DB.Where(models.LabelTemplate{Name: template.Name}).FirstOrCreate(&template)
+	}
+
+	// Default member tiers; members below Silver earn the base rate
+	defaultLoyaltyTiers := []models.LoyaltyTier{
+		{Name: "Silver", MinTotalSpent: 5000000, EarnMultiplier: 1.25, Description: "Belanja minimal Rp 5.000.000"},
+		{Name: "Gold", MinTotalSpent: 20000000, EarnMultiplier: 1.5, Description: "Belanja minimal Rp 20.000.000"},
+	}
+
+	for _, tier := range defaultLoyaltyTiers {
+		DB.Where(models.LoyaltyTier{Name: tier.Name}).FirstOrCreate(&tier)
+	}
+
 	log.Println("Seed data created successfully with comprehensive permissions and roles")
 
 	// Seed demo data for POS system
@@ -0,0 +1,333 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"starter/backend/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type BarcodeHandler struct {
+	DB *gorm.DB
+}
+
+func NewBarcodeHandler(db *gorm.DB) *BarcodeHandler {
+	return &BarcodeHandler{DB: db}
+}
+
+// barcodeMatch is what a scanned code resolves to, ready to be put on a POS cart line
+type barcodeMatch struct {
+	Code           string                 `json:"code"`
+	Product        models.Product         `json:"product"`
+	ProductVariant *models.ProductVariant `json:"product_variant,omitempty"`
+	Unit           string                 `json:"unit,omitempty"`          // Pack the barcode is printed on, empty for the base unit
+	UnitQuantity   float64                `json:"unit_quantity,omitempty"` // Packs scanned, set with Unit
+	Quantity       float64                `json:"quantity"`                // In the product's base unit
+	UnitPrice      float64                `json:"unit_price"`              // Catalog price per base unit
+	Price          float64                `json:"price"`                   // Line amount, the embedded price for price labels
+	Embedded       bool                   `json:"embedded"`                // Quantity or price was read from the code
+	Schema         *models.BarcodeSchema  `json:"schema,omitempty"`
+	ItemCode       string                 `json:"item_code,omitempty"` // Part of an embedded code matched against barcodes
+}
+
+// barcodeItem finds the active product, variant or pack printed with a code. Product and
+// variant barcodes are searched together; a code on more than one of them cannot be resolved
+func barcodeItem(db *gorm.DB, code string, includePacks bool) (*barcodeMatch, error) {
+	var products []models.Product
+	if err := db.Where("barcode = ? AND is_active = ?", code, true).Find(&products).Error; err != nil {
+		return nil, err
+	}
+	var variants []models.ProductVariant
+	if err := db.Preload("Product").Where("barcode = ? AND is_active = ?", code, true).Find(&variants).Error; err != nil {
+		return nil, err
+	}
+	var packs []models.ProductUnit
+	if includePacks {
+		if err := db.Preload("Product").Where("barcode = ?", code).Find(&packs).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	var matches []barcodeMatch
+	for _, product := range products {
+		matches = append(matches, barcodeMatch{Product: product, Quantity: 1, UnitPrice: product.SellingPrice})
+	}
+	for i := range variants {
+		variant := variants[i]
+		if variant.Product == nil || !variant.Product.IsActive {
+			continue
+		}
+		match := barcodeMatch{Product: *variant.Product, ProductVariant: &variant, Quantity: 1, UnitPrice: variant.Product.SellingPrice}
+		if variant.SellingPrice > 0 {
+			match.UnitPrice = variant.SellingPrice
+		}
+		match.ProductVariant.Product = nil
+		matches = append(matches, match)
+	}
+	for _, pack := range packs {
+		if pack.Product == nil || !pack.Product.IsActive {
+			continue
+		}
+		matches = append(matches, barcodeMatch{
+			Product:      *pack.Product,
+			Unit:         pack.Unit,
+			UnitQuantity: 1,
+			Quantity:     pack.ConversionFactor,
+			UnitPrice:    pack.Product.SellingPrice,
+		})
+	}
+
+	switch len(matches) {
+	case 0:
+		return nil, nil
+	case 1:
+		match := matches[0]
+		match.Code = code
+		match.Price = roundCurrency(match.UnitPrice * match.Quantity)
+		return &match, nil
+	default:
+		return nil, newSaleError(http.StatusConflict, "barcode_ambiguous", fmt.Sprintf("Barcode %s is used by more than one product", code))
+	}
+}
+
+// eanCheckDigitValid verifies the last digit of an EAN-8, UPC-A or EAN-13 code
+func eanCheckDigitValid(code string) bool {
+	if len(code) < 2 {
+		return false
+	}
+	sum := 0
+	body := code[:len(code)-1]
+	for i := len(body) - 1; i >= 0; i-- {
+		digit := int(body[i] - '0')
+		// Weights 3 and 1 alternate from the digit next to the check digit
+		if (len(body)-1-i)%2 == 0 {
+			digit *= 3
+		}
+		sum += digit
+	}
+	return (10-sum%10)%10 == int(code[len(code)-1]-'0')
+}
+
+// isDigits reports whether s is made of decimal digits only
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// resolveBarcode turns a scanned code into a product and quantity. Printed product, variant
+// and pack barcodes win; otherwise the active embedded schemas are tried, longest prefix first.
+// A code nothing matches is a barcode_not_found error
+func resolveBarcode(db *gorm.DB, code string) (*barcodeMatch, error) {
+	code = strings.TrimSpace(code)
+	if code == "" {
+		return nil, newSaleError(http.StatusBadRequest, "invalid_barcode", "code is required")
+	}
+
+	match, err := barcodeItem(db, code, true)
+	if err != nil || match != nil {
+		return match, err
+	}
+
+	var schemas []models.BarcodeSchema
+	if err := db.Where("is_active = ?", true).Find(&schemas).Error; err != nil {
+		return nil, err
+	}
+	sort.SliceStable(schemas, func(i, j int) bool { return len(schemas[i].Prefix) > len(schemas[j].Prefix) })
+
+	for i := range schemas {
+		schema := schemas[i]
+		if len(code) != schema.Length || !strings.HasPrefix(code, schema.Prefix) || !isDigits(code) {
+			continue
+		}
+		if schema.HasCheckDigit && !eanCheckDigitValid(code) {
+			return nil, newSaleError(http.StatusBadRequest, "invalid_barcode", fmt.Sprintf("Barcode %s has a wrong check digit", code))
+		}
+
+		itemCode := code[schema.ItemCodeStart : schema.ItemCodeStart+schema.ItemCodeLength]
+		raw, _ := strconv.ParseFloat(code[schema.ValueStart:schema.ValueStart+schema.ValueLength], 64)
+		value := raw / math.Pow10(schema.ValueDecimals)
+
+		match, err := barcodeItem(db, itemCode, false)
+		if err != nil {
+			return nil, err
+		}
+		if match == nil {
+			return nil, newSaleError(http.StatusNotFound, "barcode_not_found", fmt.Sprintf("No product with item code %s (%s)", itemCode, schema.Name))
+		}
+		if value <= 0 {
+			return nil, newSaleError(http.StatusBadRequest, "invalid_barcode", fmt.Sprintf("Barcode %s carries no %s", code, schema.ValueType))
+		}
+
+		match.Code = code
+		match.ItemCode = itemCode
+		match.Embedded = true
+		match.Schema = &schema
+		switch schema.ValueType {
+		case "price":
+			// The label price is what the customer pays; the quantity is worked back from it
+			if match.UnitPrice <= 0 {
+				return nil, newSaleError(http.StatusBadRequest, "invalid_barcode", fmt.Sprintf("%s has no selling price", match.Product.Name))
+			}
+			match.Price = roundCurrency(value)
+			match.Quantity = math.Round(value/match.UnitPrice*1000) / 1000
+		default:
+			match.Quantity = value
+			match.Price = roundCurrency(value * match.UnitPrice)
+		}
+		return match, nil
+	}
+
+	return nil, newSaleError(http.StatusNotFound, "barcode_not_found", fmt.Sprintf("No product with barcode %s", code))
+}
+
+// validateBarcodeSchema checks that the parts of a schema fit inside its length
+func validateBarcodeSchema(schema models.BarcodeSchema) string {
+	if schema.Name == "" || schema.Prefix == "" {
+		return "Name and prefix are required"
+	}
+	if !isDigits(schema.Prefix) {
+		return "Prefix must be digits"
+	}
+	if schema.ValueType != "weight" && schema.ValueType != "price" && schema.ValueType != "quantity" {
+		return "Value type must be weight, price or quantity"
+	}
+	if schema.ValueDecimals < 0 || schema.ValueDecimals > 6 {
+		return "Value decimals must be between 0 and 6"
+	}
+
+	end := schema.Length
+	if schema.HasCheckDigit {
+		end--
+	}
+	if schema.Length <= len(schema.Prefix) || end < len(schema.Prefix) {
+		return "Length must be longer than the prefix"
+	}
+	fits := func(start, length int) bool {
+		return start >= len(schema.Prefix) && length > 0 && start+length <= end
+	}
+	if !fits(schema.ItemCodeStart, schema.ItemCodeLength) {
+		return "Item code must lie between the prefix and the check digit"
+	}
+	if !fits(schema.ValueStart, schema.ValueLength) {
+		return "Value must lie between the prefix and the check digit"
+	}
+	if schema.ItemCodeStart < schema.ValueStart+schema.ValueLength && schema.ValueStart < schema.ItemCodeStart+schema.ItemCodeLength {
+		return "Item code and value must not overlap"
+	}
+	return ""
+}
+
+// LookupProduct resolves a scanned code for the POS cart
+func (h *BarcodeHandler) LookupProduct(c *gin.Context) {
+	match, err := resolveBarcode(h.DB, c.Query("code"))
+	if err != nil {
+		var saleErr *saleError
+		if errors.As(err, &saleErr) {
+			c.JSON(saleErr.Status, gin.H{"error": saleErr.Message, "code": saleErr.Code})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": match})
+}
+
+// GetBarcodeSchemas retrieves all embedded barcode schemas
+func (h *BarcodeHandler) GetBarcodeSchemas(c *gin.Context) {
+	var schemas []models.BarcodeSchema
+	if err := h.DB.Order("prefix").Find(&schemas).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": schemas})
+}
+
+// CreateBarcodeSchema creates a new embedded barcode schema
+func (h *BarcodeHandler) CreateBarcodeSchema(c *gin.Context) {
+	var schema models.BarcodeSchema
+	if err := c.ShouldBindJSON(&schema); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if schema.Length == 0 {
+		schema.Length = 13
+	}
+
+	if msg := validateBarcodeSchema(schema); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	if err := h.DB.Create(&schema).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"data": schema})
+}
+
+// UpdateBarcodeSchema updates an embedded barcode schema
+func (h *BarcodeHandler) UpdateBarcodeSchema(c *gin.Context) {
+	var schema models.BarcodeSchema
+	if err := h.DB.First(&schema, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Barcode schema not found"})
+		return
+	}
+
+	var updateData models.BarcodeSchema
+	if err := c.ShouldBindJSON(&updateData); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if updateData.Length == 0 {
+		updateData.Length = 13
+	}
+
+	if msg := validateBarcodeSchema(updateData); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	schema.Name = updateData.Name
+	schema.Prefix = updateData.Prefix
+	schema.Length = updateData.Length
+	schema.ItemCodeStart = updateData.ItemCodeStart
+	schema.ItemCodeLength = updateData.ItemCodeLength
+	schema.ValueStart = updateData.ValueStart
+	schema.ValueLength = updateData.ValueLength
+	schema.ValueType = updateData.ValueType
+	schema.ValueDecimals = updateData.ValueDecimals
+	schema.HasCheckDigit = updateData.HasCheckDigit
+	schema.IsActive = updateData.IsActive
+
+	if err := h.DB.Save(&schema).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": schema})
+}
+
+// DeleteBarcodeSchema deletes an embedded barcode schema
+func (h *BarcodeHandler) DeleteBarcodeSchema(c *gin.Context) {
+	if err := h.DB.Delete(&models.BarcodeSchema{}, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Barcode schema deleted successfully"})
+}
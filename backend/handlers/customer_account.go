@@ -0,0 +1,462 @@
+package handlers
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"starter/backend/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type CustomerAccountHandler struct {
+	DB *gorm.DB
+}
+
+func NewCustomerAccountHandler(db *gorm.DB) *CustomerAccountHandler {
+	return &CustomerAccountHandler{DB: db}
+}
+
+// postCustomerLedger records a movement on a customer's account and moves the balance with it.
+// The customer row is locked so concurrent charges and payments cannot lose an update
+func postCustomerLedger(tx *gorm.DB, entry models.CustomerLedgerEntry) (*models.CustomerLedgerEntry, error) {
+	var customer models.Customer
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&customer, entry.CustomerID).Error; err != nil {
+		return nil, err
+	}
+
+	entry.Amount = roundCurrency(entry.Amount)
+	entry.BalanceAfter = roundCurrency(customer.Balance + entry.Amount)
+	if entry.EntryDate.IsZero() {
+		entry.EntryDate = time.Now()
+	}
+
+	if err := tx.Model(&customer).Update("balance", entry.BalanceAfter).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Create(&entry).Error; err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// chargeCustomerAccount puts the credit part of a new sale on the customer's account,
+// refusing it when the customer has no credit or it would go over their limit
+func chargeCustomerAccount(tx *gorm.DB, sale models.Sale, userID uint) error {
+	if sale.CustomerID == nil {
+		return newSaleError(http.StatusBadRequest, "credit_requires_customer", "A customer is required to sell on credit")
+	}
+
+	var customer models.Customer
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&customer, *sale.CustomerID).Error; err != nil {
+		return err
+	}
+	if customer.Status != "" && customer.Status != "active" {
+		return newSaleError(http.StatusBadRequest, "credit_not_allowed", "Customer is not active")
+	}
+	if customer.CreditLimit <= 0 {
+		return newSaleError(http.StatusBadRequest, "credit_not_allowed", "Customer is not allowed to buy on credit")
+	}
+	if roundCurrency(customer.Balance+sale.CreditAmount) > customer.CreditLimit {
+		return newSaleError(http.StatusBadRequest, "credit_limit_exceeded",
+			fmt.Sprintf("Credit limit exceeded: available %.2f, requested %.2f",
+				math.Max(customer.CreditLimit-customer.Balance, 0), sale.CreditAmount))
+	}
+
+	_, err := postCustomerLedger(tx, models.CustomerLedgerEntry{
+		CustomerID:  customer.ID,
+		EntryType:   "charge",
+		SaleID:      &sale.ID,
+		Amount:      sale.CreditAmount,
+		Description: fmt.Sprintf("Credit sale %s", sale.SaleNumber),
+		CreatedBy:   userID,
+		EntryDate:   sale.SaleDate,
+	})
+	return err
+}
+
+// creditSalePaymentStatus is the payment status of a sale with money still owed on account
+func creditSalePaymentStatus(sale models.Sale) string {
+	switch {
+	case sale.BalanceDue <= 0:
+		return "paid"
+	case sale.BalanceDue < sale.TotalAmount:
+		return "partial"
+	default:
+		return "unpaid"
+	}
+}
+
+// CreateCustomerPayment receives money on a customer's account and settles their open
+// credit sales, the sales listed in sale_ids first and then the oldest
+func (h *CustomerAccountHandler) CreateCustomerPayment(c *gin.Context) {
+	customerID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid customer ID"})
+		return
+	}
+
+	var req struct {
+		StoreID         uint    `json:"store_id" binding:"required"`
+		Amount          float64 `json:"amount" binding:"required,gt=0"`
+		PaymentMethod   string  `json:"payment_method"`
+		ReferenceNumber string  `json:"reference_number"`
+		Notes           string  `json:"notes"`
+		SaleIDs         []uint  `json:"sale_ids"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.PaymentMethod == "" {
+		req.PaymentMethod = "cash"
+	}
+	if req.PaymentMethod == "credit" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "An account cannot be paid on credit"})
+		return
+	}
+	req.Amount = roundCurrency(req.Amount)
+
+	var store models.Store
+	if err := h.DB.First(&store, req.StoreID).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid store ID"})
+		return
+	}
+
+	userID := getUserIDFromContext(c)
+	now := time.Now()
+
+	tx := h.DB.Begin()
+
+	// Sales are locked before the customer, in id order, as voids and releases lock them
+	var openSales []models.Sale
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("customer_id = ? AND balance_due > 0 AND sale_status IN ?", customerID, []string{"completed", "refunded"}).
+		Order("id").Find(&openSales).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Requested sales first, then the oldest open sales
+	requested := make(map[uint]bool, len(req.SaleIDs))
+	for _, id := range req.SaleIDs {
+		requested[id] = true
+	}
+	sort.SliceStable(openSales, func(a, b int) bool {
+		if requested[openSales[a].ID] != requested[openSales[b].ID] {
+			return requested[openSales[a].ID]
+		}
+		return openSales[a].SaleDate.Before(openSales[b].SaleDate)
+	})
+
+	var customer models.Customer
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&customer, customerID).Error; err != nil {
+		tx.Rollback()
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Customer not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	if req.Amount > customer.Balance {
+		tx.Rollback()
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Payment (%.2f) exceeds the outstanding balance (%.2f)", req.Amount, customer.Balance)})
+		return
+	}
+
+	paymentNumber, err := nextDocumentNumber(tx, DocumentTypeCustomerPayment, documentLocation{Type: "store", ID: req.StoreID}, now)
+	if err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	payment := models.CustomerPayment{
+		PaymentNumber:   paymentNumber,
+		CustomerID:      customer.ID,
+		StoreID:         req.StoreID,
+		PaymentMethod:   req.PaymentMethod,
+		Amount:          req.Amount,
+		ReferenceNumber: req.ReferenceNumber,
+		Notes:           req.Notes,
+		ReceivedBy:      userID,
+		PaymentDate:     now,
+	}
+
+	// Money taken at the till goes into the receiver's drawer
+	if session, err := findOpenRegisterSession(tx, req.StoreID, userID); err == nil {
+		payment.RegisterSessionID = &session.ID
+	}
+
+	if err := tx.Create(&payment).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	remaining := req.Amount
+	for _, sale := range openSales {
+		if remaining <= 0 {
+			break
+		}
+
+		allocated := math.Min(remaining, sale.BalanceDue)
+		remaining = roundCurrency(remaining - allocated)
+		sale.BalanceDue = roundCurrency(sale.BalanceDue - allocated)
+
+		if err := tx.Create(&models.CustomerPaymentAllocation{
+			CustomerPaymentID: payment.ID,
+			SaleID:            sale.ID,
+			Amount:            allocated,
+		}).Error; err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		updates := map[string]interface{}{"balance_due": sale.BalanceDue}
+		if sale.SaleStatus == "completed" {
+			updates["payment_status"] = creditSalePaymentStatus(sale)
+		}
+		if err := tx.Model(&sale).Updates(updates).Error; err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	if _, err := postCustomerLedger(tx, models.CustomerLedgerEntry{
+		CustomerID:        customer.ID,
+		EntryType:         "payment",
+		CustomerPaymentID: &payment.ID,
+		Amount:            -req.Amount,
+		Description:       fmt.Sprintf("Payment %s (%s)", payment.PaymentNumber, payment.PaymentMethod),
+		CreatedBy:         userID,
+		EntryDate:         now,
+	}); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.DB.Preload("Customer").Preload("Store").Preload("ReceivedByUser").
+		Preload("Allocations").Preload("Allocations.Sale").First(&payment, payment.ID)
+
+	c.JSON(http.StatusCreated, gin.H{"data": payment})
+}
+
+// GetCustomerPayments retrieves the account payments of a customer with pagination
+func (h *CustomerAccountHandler) GetCustomerPayments(c *gin.Context) {
+	var payments []models.CustomerPayment
+	var total int64
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10"))
+	offset := (page - 1) * limit
+
+	query := h.DB.Model(&models.CustomerPayment{}).Where("customer_id = ?", c.Param("id"))
+	query.Count(&total)
+
+	if err := query.Preload("Store").Preload("ReceivedByUser").Preload("Allocations").
+		Order("payment_date DESC").Limit(limit).Offset(offset).Find(&payments).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": payments,
+		"pagination": gin.H{
+			"current_page": page,
+			"per_page":     limit,
+			"total":        total,
+			"total_pages":  (total + int64(limit) - 1) / int64(limit),
+		},
+	})
+}
+
+// GetCustomerStatement lists the account movements of a customer over a period
+// with opening and closing balances, plus the sales still open
+func (h *CustomerAccountHandler) GetCustomerStatement(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid customer ID"})
+		return
+	}
+
+	var customer models.Customer
+	if err := h.DB.First(&customer, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Customer not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	now := time.Now()
+	dateFrom := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	dateTo := now
+	if from := c.Query("date_from"); from != "" {
+		parsed, err := time.ParseInLocation("2006-01-02", from, now.Location())
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "date_from must be YYYY-MM-DD"})
+			return
+		}
+		dateFrom = parsed
+	}
+	if to := c.Query("date_to"); to != "" {
+		parsed, err := time.ParseInLocation("2006-01-02", to, now.Location())
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "date_to must be YYYY-MM-DD"})
+			return
+		}
+		dateTo = parsed.AddDate(0, 0, 1).Add(-time.Nanosecond)
+	}
+
+	var openingBalance float64
+	if err := h.DB.Model(&models.CustomerLedgerEntry{}).
+		Where("customer_id = ? AND entry_date < ?", customer.ID, dateFrom).
+		Select("COALESCE(SUM(amount), 0)").Scan(&openingBalance).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var entries []models.CustomerLedgerEntry
+	if err := h.DB.Preload("Sale").Preload("CustomerPayment").
+		Where("customer_id = ? AND entry_date BETWEEN ? AND ?", customer.ID, dateFrom, dateTo).
+		Order("entry_date, id").Find(&entries).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Offline sales are entered at their sale date, so the running balance is recomputed in date order
+	balance := roundCurrency(openingBalance)
+	var charges, credits float64
+	for i := range entries {
+		balance = roundCurrency(balance + entries[i].Amount)
+		entries[i].BalanceAfter = balance
+		if entries[i].Amount > 0 {
+			charges += entries[i].Amount
+		} else {
+			credits -= entries[i].Amount
+		}
+	}
+
+	var openSales []models.Sale
+	h.DB.Where("customer_id = ? AND balance_due > 0 AND sale_status IN ?", customer.ID, []string{"completed", "refunded"}).
+		Order("sale_date").Find(&openSales)
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": gin.H{
+			"customer":        customer,
+			"date_from":       dateFrom,
+			"date_to":         dateTo,
+			"opening_balance": roundCurrency(openingBalance),
+			"total_charges":   roundCurrency(charges),
+			"total_credits":   roundCurrency(credits),
+			"closing_balance": balance,
+			"entries":         entries,
+			"open_sales":      openSales,
+		},
+	})
+}
+
+// AgingBucket is the outstanding amount of one customer split by the age of the sales
+type AgingBucket struct {
+	CustomerID   uint    `json:"customer_id"`
+	CustomerName string  `json:"customer_name"`
+	CreditLimit  float64 `json:"credit_limit"`
+	Current      float64 `json:"days_0_30" gorm:"column:days_0_30"`
+	Days31To60   float64 `json:"days_31_60" gorm:"column:days_31_60"`
+	Days61To90   float64 `json:"days_61_90" gorm:"column:days_61_90"`
+	Over90       float64 `json:"days_over_90" gorm:"column:days_over_90"`
+	Total        float64 `json:"total"`
+	OldestSale   *string `json:"oldest_sale_date" gorm:"column:oldest_sale_date"`
+}
+
+// GetAgingReport groups the outstanding balances of credit sales by age: 0-30, 31-60, 61-90 and 90+ days.
+// Balances are taken from the customer ledger as they stood at the end of as_of
+func (h *CustomerAccountHandler) GetAgingReport(c *gin.Context) {
+	asOf := time.Now()
+	if asOfParam := c.Query("as_of"); asOfParam != "" {
+		parsed, err := time.ParseInLocation("2006-01-02", asOfParam, asOf.Location())
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "as_of must be YYYY-MM-DD"})
+			return
+		}
+		asOf = parsed.AddDate(0, 0, 1).Add(-time.Nanosecond)
+	}
+
+	// What each credit sale still owed at as_of: its charges, returns and reversals on the
+	// customer ledger up to then, less the customer payments allocated to it by then
+	balances := h.DB.Table("sales AS s").
+		Select(`s.id, s.customer_id, s.sale_date,
+			COALESCE((SELECT SUM(le.amount) FROM customer_ledger_entries le
+				WHERE le.sale_id = s.id AND le.entry_date <= ?), 0)
+			- COALESCE((SELECT SUM(a.amount) FROM customer_payment_allocations a
+				JOIN customer_payments cp ON cp.id = a.customer_payment_id
+				WHERE a.sale_id = s.id AND cp.payment_date <= ?), 0) AS balance_due`, asOf, asOf).
+		Where("s.customer_id IS NOT NULL AND s.sale_date <= ?", asOf)
+	if storeID := c.Query("store_id"); storeID != "" {
+		balances = balances.Where("s.store_id = ?", storeID)
+	}
+
+	query := h.DB.Table("(?) AS s", balances).
+		Select(`s.customer_id, cu.name AS customer_name, cu.credit_limit,
+			COALESCE(SUM(CASE WHEN DATE_PART('day', ? - s.sale_date) <= 30 THEN s.balance_due END), 0) AS days_0_30,
+			COALESCE(SUM(CASE WHEN DATE_PART('day', ? - s.sale_date) BETWEEN 31 AND 60 THEN s.balance_due END), 0) AS days_31_60,
+			COALESCE(SUM(CASE WHEN DATE_PART('day', ? - s.sale_date) BETWEEN 61 AND 90 THEN s.balance_due END), 0) AS days_61_90,
+			COALESCE(SUM(CASE WHEN DATE_PART('day', ? - s.sale_date) > 90 THEN s.balance_due END), 0) AS days_over_90,
+			COALESCE(SUM(s.balance_due), 0) AS total,
+			TO_CHAR(MIN(s.sale_date), 'YYYY-MM-DD') AS oldest_sale_date`, asOf, asOf, asOf, asOf).
+		Joins("JOIN customers cu ON cu.id = s.customer_id").
+		Where("s.balance_due >= 0.01")
+
+	var rows []AgingBucket
+	if err := query.Group("s.customer_id, cu.name, cu.credit_limit").
+		Order("total DESC").Scan(&rows).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	summary := AgingBucket{}
+	for i := range rows {
+		rows[i].Current = roundCurrency(rows[i].Current)
+		rows[i].Days31To60 = roundCurrency(rows[i].Days31To60)
+		rows[i].Days61To90 = roundCurrency(rows[i].Days61To90)
+		rows[i].Over90 = roundCurrency(rows[i].Over90)
+		rows[i].Total = roundCurrency(rows[i].Total)
+		summary.Current += rows[i].Current
+		summary.Days31To60 += rows[i].Days31To60
+		summary.Days61To90 += rows[i].Days61To90
+		summary.Over90 += rows[i].Over90
+		summary.Total += rows[i].Total
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": rows,
+		"summary": gin.H{
+			"as_of":        asOf.Format("2006-01-02"),
+			"customers":    len(rows),
+			"days_0_30":    roundCurrency(summary.Current),
+			"days_31_60":   roundCurrency(summary.Days31To60),
+			"days_61_90":   roundCurrency(summary.Days61To90),
+			"days_over_90": roundCurrency(summary.Over90),
+			"total":        roundCurrency(summary.Total),
+		},
+	})
+}
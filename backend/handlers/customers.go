@@ -4,6 +4,7 @@ import (
 	"net/http"
 	"strconv"
 
+	"starter/backend/middleware"
 	"starter/backend/models"
 
 	"github.com/gin-gonic/gin"
@@ -18,6 +19,15 @@ func NewCustomerHandler(db *gorm.DB) *CustomerHandler {
 	return &CustomerHandler{DB: db}
 }
 
+// canManageCredit reports whether the current user may set customer credit limits
+func (h *CustomerHandler) canManageCredit(c *gin.Context) bool {
+	var user models.User
+	if err := h.DB.First(&user, getUserIDFromContext(c)).Error; err != nil {
+		return false
+	}
+	return middleware.UserHasPermission(&user, "customers.credit")
+}
+
 // GetCustomers retrieves all customers with pagination
 func (h *CustomerHandler) GetCustomers(c *gin.Context) {
 	var customers []models.Customer
@@ -64,7 +74,7 @@ func (h *CustomerHandler) GetCustomer(c *gin.Context) {
 	}
 
 	var customer models.Customer
-	if err := h.DB.First(&customer, id).Error; err != nil {
+	if err := h.DB.Preload("LoyaltyTier").First(&customer, id).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Customer not found"})
 			return
@@ -90,6 +100,17 @@ func (h *CustomerHandler) CreateCustomer(c *gin.Context) {
 		return
 	}
 
+	// The balance only moves through the account ledger
+	customer.Balance = 0
+	if customer.CreditLimit != 0 && !h.canManageCredit(c) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Not allowed to set a credit limit"})
+		return
+	}
+	if customer.CreditLimit < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Credit limit cannot be negative"})
+		return
+	}
+
 	// Check if email already exists (if provided)
 	if customer.Email != "" {
 		var existingCustomer models.Customer
@@ -125,11 +146,16 @@ func (h *CustomerHandler) UpdateCustomer(c *gin.Context) {
 		return
 	}
 
-	var updateData models.Customer
-	if err := c.ShouldBindJSON(&updateData); err != nil {
+	// credit_limit is a pointer so a form without it leaves the limit alone
+	var req struct {
+		models.Customer
+		CreditLimit *float64 `json:"credit_limit"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	updateData := req.Customer
 
 	// Check if email is being changed and already exists
 	if updateData.Email != "" && updateData.Email != customer.Email {
@@ -141,7 +167,23 @@ func (h *CustomerHandler) UpdateCustomer(c *gin.Context) {
 	}
 
 	// Use Select to explicitly update is_member field (GORM ignores zero values by default)
-	if err := h.DB.Model(&customer).Select("name", "email", "phone", "address", "date_of_birth", "gender", "status", "is_member").Updates(updateData).Error; err != nil {
+	fields := []string{"name", "email", "phone", "address", "date_of_birth", "gender", "status", "is_member"}
+
+	// The credit limit is only changed by users allowed to manage credit
+	if req.CreditLimit != nil && *req.CreditLimit != customer.CreditLimit {
+		if !h.canManageCredit(c) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Not allowed to change the credit limit"})
+			return
+		}
+		if *req.CreditLimit < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Credit limit cannot be negative"})
+			return
+		}
+		updateData.CreditLimit = *req.CreditLimit
+		fields = append(fields, "credit_limit")
+	}
+
+	if err := h.DB.Model(&customer).Select(fields).Updates(updateData).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -1,14 +1,18 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
+	"sort"
 	"strconv"
+	"strings"
 	"time"
 
 	"starter/backend/models"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type DiscountHandler struct {
@@ -45,6 +49,19 @@ type DiscountRequest struct {
 	EndDate          *string `json:"end_date"`
 	IsActive         *bool   `json:"is_active"`
 	StoreID          *uint   `json:"store_id"`
+
+	// Promotions
+	IsAutomatic *bool                 `json:"is_automatic"`
+	BuyQuantity float64               `json:"buy_quantity"`
+	GetQuantity float64               `json:"get_quantity"`
+	BundlePrice float64               `json:"bundle_price"`
+	Items       []models.DiscountItem `json:"items"` // nil leaves the bundle items unchanged on update
+	Tiers       []models.DiscountTier `json:"tiers"` // nil leaves the quantity breaks unchanged on update
+
+	// Stacking
+	Priority       int    `json:"priority"`
+	Stackable      *bool  `json:"stackable"`
+	ExclusiveGroup string `json:"exclusive_group"`
 }
 
 // parseDate parses date string in multiple formats
@@ -86,7 +103,7 @@ func (h *DiscountHandler) GetDiscounts(c *gin.Context) {
 
 	offset := (page - 1) * limit
 
-	query := h.DB.Preload("Store").Preload("Customer").Preload("CreatedByUser")
+	query := h.DB.Preload("Store").Preload("Customer").Preload("CreatedByUser").Preload("Items").Preload("Tiers")
 
 	if search != "" {
 		query = query.Where("name LIKE ? OR code LIKE ?", "%"+search+"%", "%"+search+"%")
@@ -125,7 +142,8 @@ func (h *DiscountHandler) GetDiscount(c *gin.Context) {
 	}
 
 	var discount models.Discount
-	if err := h.DB.Preload("Store").Preload("Customer").Preload("CreatedByUser").First(&discount, id).Error; err != nil {
+	if err := h.DB.Preload("Store").Preload("Customer").Preload("CreatedByUser").
+		Preload("Items").Preload("Items.Product").Preload("Tiers").First(&discount, id).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Discount not found"})
 			return
@@ -145,18 +163,6 @@ func (h *DiscountHandler) CreateDiscount(c *gin.Context) {
 		return
 	}
 
-	// Validate discount type
-	if req.DiscountType != "percentage" && req.DiscountType != "fixed" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid discount type. Must be 'percentage' or 'fixed'"})
-		return
-	}
-
-	// Validate percentage value
-	if req.DiscountType == "percentage" && req.DiscountValue > 100 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Percentage discount cannot exceed 100%"})
-		return
-	}
-
 	// Parse dates
 	var startDate, endDate *time.Time
 	if req.StartDate != nil {
@@ -171,6 +177,7 @@ func (h *DiscountHandler) CreateDiscount(c *gin.Context) {
 	if req.IsActive != nil {
 		isActive = *req.IsActive
 	}
+	isAutomatic := req.IsAutomatic != nil && *req.IsAutomatic
 
 	discount := models.Discount{
 		Name:             req.Name,
@@ -191,16 +198,32 @@ func (h *DiscountHandler) CreateDiscount(c *gin.Context) {
 		EndDate:          endDate,
 		IsActive:         isActive,
 		StoreID:          req.StoreID,
+		IsAutomatic:      isAutomatic,
+		BuyQuantity:      req.BuyQuantity,
+		GetQuantity:      req.GetQuantity,
+		BundlePrice:      req.BundlePrice,
+		Priority:         req.Priority,
+		Stackable:        req.Stackable != nil && *req.Stackable,
+		ExclusiveGroup:   strings.TrimSpace(req.ExclusiveGroup),
+		Items:            resetDiscountItems(req.Items),
+		Tiers:            resetDiscountTiers(req.Tiers),
 		CreatedBy:        getUserIDFromContext(c),
 	}
 
+	if err := validateDiscountSetup(&discount); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Creates the bundle items and quantity breaks along with the discount
 	if err := h.DB.Create(&discount).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
 	// Reload with relations
-	h.DB.Preload("Store").Preload("Customer").Preload("CreatedByUser").First(&discount, discount.ID)
+	h.DB.Preload("Store").Preload("Customer").Preload("CreatedByUser").
+		Preload("Items").Preload("Items.Product").Preload("Tiers").First(&discount, discount.ID)
 
 	c.JSON(http.StatusCreated, gin.H{"data": discount})
 }
@@ -214,7 +237,7 @@ func (h *DiscountHandler) UpdateDiscount(c *gin.Context) {
 	}
 
 	var discount models.Discount
-	if err := h.DB.First(&discount, id).Error; err != nil {
+	if err := h.DB.Preload("Items").Preload("Tiers").First(&discount, id).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Discount not found"})
 			return
@@ -229,12 +252,6 @@ func (h *DiscountHandler) UpdateDiscount(c *gin.Context) {
 		return
 	}
 
-	// Validate discount type
-	if req.DiscountType != "" && req.DiscountType != "percentage" && req.DiscountType != "fixed" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid discount type"})
-		return
-	}
-
 	// Parse dates
 	if req.StartDate != nil {
 		discount.StartDate, _ = parseDate(*req.StartDate)
@@ -274,18 +291,149 @@ func (h *DiscountHandler) UpdateDiscount(c *gin.Context) {
 		discount.IsActive = *req.IsActive
 	}
 	discount.StoreID = req.StoreID
+	if req.IsAutomatic != nil {
+		discount.IsAutomatic = *req.IsAutomatic
+	}
+	discount.BuyQuantity = req.BuyQuantity
+	discount.GetQuantity = req.GetQuantity
+	discount.BundlePrice = req.BundlePrice
+	discount.Priority = req.Priority
+	if req.Stackable != nil {
+		discount.Stackable = *req.Stackable
+	}
+	discount.ExclusiveGroup = strings.TrimSpace(req.ExclusiveGroup)
+	if req.Items != nil {
+		discount.Items = resetDiscountItems(req.Items)
+	}
+	if req.Tiers != nil {
+		discount.Tiers = resetDiscountTiers(req.Tiers)
+	}
+
+	if err := validateDiscountSetup(&discount); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tx := h.DB.Begin()
+
+	if err := tx.Omit(clause.Associations).Save(&discount).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Bundle items and quantity breaks are replaced as a whole
+	if req.Items != nil {
+		if err := tx.Where("discount_id = ?", discount.ID).Delete(&models.DiscountItem{}).Error; err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if len(discount.Items) > 0 {
+			if err := tx.Model(&discount).Association("Items").Append(discount.Items); err != nil {
+				tx.Rollback()
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+		}
+	}
+	if req.Tiers != nil {
+		if err := tx.Where("discount_id = ?", discount.ID).Delete(&models.DiscountTier{}).Error; err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if len(discount.Tiers) > 0 {
+			if err := tx.Model(&discount).Association("Tiers").Append(discount.Tiers); err != nil {
+				tx.Rollback()
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+		}
+	}
 
-	if err := h.DB.Save(&discount).Error; err != nil {
+	if err := tx.Commit().Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
 	// Reload with relations
-	h.DB.Preload("Store").Preload("Customer").Preload("CreatedByUser").First(&discount, id)
+	h.DB.Preload("Store").Preload("Customer").Preload("CreatedByUser").
+		Preload("Items").Preload("Items.Product").Preload("Tiers").First(&discount, id)
 
 	c.JSON(http.StatusOK, gin.H{"data": discount})
 }
 
+// discountTypes are the supported values of Discount.DiscountType
+var discountTypes = map[string]bool{
+	"percentage": true, "fixed": true, "buy_x_get_y": true, "bundle": true, "quantity_break": true,
+}
+
+// validateDiscountSetup checks that a discount has the settings its type needs
+func validateDiscountSetup(discount *models.Discount) error {
+	if !discountTypes[discount.DiscountType] {
+		return errors.New("Invalid discount type. Must be 'percentage', 'fixed', 'buy_x_get_y', 'bundle' or 'quantity_break'")
+	}
+	if discount.IsAutomatic && discount.Code != "" {
+		return errors.New("Automatic promotions cannot have a code")
+	}
+
+	switch discount.DiscountType {
+	case "percentage":
+		if discount.DiscountValue > 100 {
+			return errors.New("Percentage discount cannot exceed 100%")
+		}
+	case "buy_x_get_y":
+		if discount.BuyQuantity < 1 || discount.GetQuantity < 1 {
+			return errors.New("Buy X get Y needs a buy_quantity and get_quantity of at least 1")
+		}
+		if discount.DiscountValue < 0 || discount.DiscountValue > 100 {
+			return errors.New("Buy X get Y discount_value is the percent off the free units, up to 100")
+		}
+	case "bundle":
+		if discount.BundlePrice <= 0 {
+			return errors.New("Bundle needs a bundle_price")
+		}
+		if len(discount.Items) == 0 {
+			return errors.New("Bundle needs at least one item")
+		}
+		for _, item := range discount.Items {
+			if item.ProductID == 0 || item.Quantity <= 0 {
+				return errors.New("Bundle items need a product_id and a quantity greater than zero")
+			}
+		}
+	case "quantity_break":
+		if len(discount.Tiers) == 0 {
+			return errors.New("Quantity break needs at least one tier")
+		}
+		for _, tier := range discount.Tiers {
+			if tier.MinQuantity <= 0 || tier.UnitPrice < 0 {
+				return errors.New("Quantity break tiers need a min_quantity greater than zero and a unit_price")
+			}
+		}
+	}
+	return nil
+}
+
+// resetDiscountItems drops client supplied IDs so the items are always inserted
+func resetDiscountItems(items []models.DiscountItem) []models.DiscountItem {
+	for i := range items {
+		items[i].ID = 0
+		items[i].DiscountID = 0
+		items[i].Product = nil
+	}
+	return items
+}
+
+// resetDiscountTiers drops client supplied IDs so the tiers are always inserted
+func resetDiscountTiers(tiers []models.DiscountTier) []models.DiscountTier {
+	for i := range tiers {
+		tiers[i].ID = 0
+		tiers[i].DiscountID = 0
+	}
+	return tiers
+}
+
 // DeleteDiscount soft deletes a discount
 func (h *DiscountHandler) DeleteDiscount(c *gin.Context) {
 	id, err := strconv.Atoi(c.Param("id"))
@@ -330,94 +478,128 @@ func (h *DiscountHandler) ValidateDiscount(c *gin.Context) {
 		return
 	}
 
-	now := time.Now()
+	check := discountCheck{}
+	if storeID != "" {
+		storeIDInt, _ := strconv.Atoi(storeID)
+		check.StoreID = uint(storeIDInt)
+	}
+	if customerID != "" {
+		customerIDInt, _ := strconv.Atoi(customerID)
+		id := uint(customerIDInt)
+		check.CustomerID = &id
+	}
+	var purchaseAmount float64
+	if amount != "" {
+		purchaseAmount, _ = strconv.ParseFloat(amount, 64)
+		check.Amount = &purchaseAmount
+	}
+
+	if err := checkDiscountRules(h.DB, &discount, check, time.Now()); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Calculate discount amount
+	var discountAmount float64
+	if amount != "" {
+		discountAmount = calculateDiscountAmount(&discount, purchaseAmount)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"valid":           true,
+		"discount":        discount,
+		"discount_amount": discountAmount,
+	})
+}
+
+// discountCheck is the sale context a discount is validated against
+type discountCheck struct {
+	StoreID    uint     // 0 skips the store restriction check
+	CustomerID *uint    // nil means walk-in customer
+	Amount     *float64 // nil skips the minimum purchase check
+}
+
+// checkDiscountRules applies the eligibility rules shared by ValidateDiscount and CreateSale
+func checkDiscountRules(db *gorm.DB, discount *models.Discount, check discountCheck, now time.Time) error {
+	if !discount.IsActive {
+		return errors.New("Discount is not active")
+	}
 
 	// Check date validity
 	if discount.StartDate != nil && now.Before(*discount.StartDate) {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Discount not yet active"})
-		return
+		return errors.New("Discount not yet active")
 	}
 	if discount.EndDate != nil && now.After(*discount.EndDate) {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Discount has expired"})
-		return
+		return errors.New("Discount has expired")
 	}
 
 	// Check usage limit
 	if discount.UsageLimit > 0 && discount.UsageCount >= discount.UsageLimit {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Discount usage limit reached"})
-		return
+		return errors.New("Discount usage limit reached")
 	}
 
 	// Check store restriction
-	if discount.StoreID != nil && storeID != "" {
-		storeIDInt, _ := strconv.Atoi(storeID)
-		if uint(storeIDInt) != *discount.StoreID {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Discount not valid for this store"})
-			return
-		}
+	if discount.StoreID != nil && check.StoreID != 0 && check.StoreID != *discount.StoreID {
+		return errors.New("Discount not valid for this store")
 	}
 
 	// Check minimum purchase
-	if amount != "" {
-		purchaseAmount, _ := strconv.ParseFloat(amount, 64)
-		if purchaseAmount < discount.MinPurchase {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Minimum purchase amount not met"})
-			return
-		}
+	if check.Amount != nil && *check.Amount < discount.MinPurchase {
+		return errors.New("Minimum purchase amount not met")
 	}
 
 	// Check customer restriction
-	if discount.ApplicableTo == "member" && customerID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Discount only for members"})
-		return
+	if discount.ApplicableTo == "member" {
+		if check.CustomerID == nil {
+			return errors.New("Discount only for members")
+		}
+		var customer models.Customer
+		if err := db.First(&customer, *check.CustomerID).Error; err != nil || !customer.IsMember {
+			return errors.New("Discount only for members")
+		}
 	}
 
 	if discount.ApplicableTo == "specific_customer" && discount.CustomerID != nil {
-		if customerID == "" {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Discount only for specific customer"})
-			return
+		if check.CustomerID == nil {
+			return errors.New("Discount only for specific customer")
 		}
-		customerIDInt, _ := strconv.Atoi(customerID)
-		if uint(customerIDInt) != *discount.CustomerID {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Discount not valid for this customer"})
-			return
+		if *check.CustomerID != *discount.CustomerID {
+			return errors.New("Discount not valid for this customer")
 		}
 	}
 
 	// Check per-customer usage limit
-	if discount.UsagePerCustomer > 0 && customerID != "" {
+	if discount.UsagePerCustomer > 0 && check.CustomerID != nil {
 		var usageCount int64
-		h.DB.Model(&models.DiscountUsage{}).
-			Where("discount_id = ? AND customer_id = ?", discount.ID, customerID).
+		db.Model(&models.DiscountUsage{}).
+			Where("discount_id = ? AND customer_id = ?", discount.ID, *check.CustomerID).
 			Count(&usageCount)
 
 		if int(usageCount) >= discount.UsagePerCustomer {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "You have reached the usage limit for this discount"})
-			return
+			return errors.New("You have reached the usage limit for this discount")
 		}
 	}
 
-	// Calculate discount amount
+	return nil
+}
+
+// calculateDiscountAmount applies the discount type and max discount cap to a purchase amount.
+// Promotions depend on the cart lines and are worked out by discountLineAmounts instead
+func calculateDiscountAmount(discount *models.Discount, amount float64) float64 {
 	var discountAmount float64
-	if amount != "" {
-		purchaseAmount, _ := strconv.ParseFloat(amount, 64)
-		if discount.DiscountType == "percentage" {
-			discountAmount = purchaseAmount * (discount.DiscountValue / 100)
-		} else {
-			discountAmount = discount.DiscountValue
-		}
+	switch discount.DiscountType {
+	case "percentage":
+		discountAmount = amount * (discount.DiscountValue / 100)
+	case "fixed":
+		discountAmount = discount.DiscountValue
+	}
 
-		// Apply max discount cap
-		if discount.MaxDiscount > 0 && discountAmount > discount.MaxDiscount {
-			discountAmount = discount.MaxDiscount
-		}
+	// Apply max discount cap
+	if discount.MaxDiscount > 0 && discountAmount > discount.MaxDiscount {
+		discountAmount = discount.MaxDiscount
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"valid":           true,
-		"discount":        discount,
-		"discount_amount": discountAmount,
-	})
+	return discountAmount
 }
 
 // GetActiveDiscounts retrieves all currently active discounts
@@ -442,10 +624,195 @@ func (h *DiscountHandler) GetActiveDiscounts(c *gin.Context) {
 	// If no customer_id provided, still load 'all' and 'member' discounts for POS use
 	// The frontend will filter based on customer selection
 
-	if err := query.Preload("Store").Find(&discounts).Error; err != nil {
+	if err := query.Preload("Store").Preload("Items").Preload("Tiers").Order("priority DESC, id").Find(&discounts).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"data": discounts})
 }
+
+// DiscountEvaluateRequest is a cart to find the best discounts for
+type DiscountEvaluateRequest struct {
+	StoreID     uint              `json:"store_id" binding:"required"`
+	CustomerID  *uint             `json:"customer_id"`
+	Items       []models.SaleItem `json:"items" binding:"required,min=1"`
+	DiscountIDs []uint            `json:"discount_ids"` // Discounts to consider; empty considers every active discount of the store
+}
+
+// evaluatedLine is one cart line with the discounts taken off it
+type evaluatedLine struct {
+	ProductID        uint    `json:"product_id"`
+	ProductVariantID *uint   `json:"product_variant_id"`
+	Quantity         float64 `json:"quantity"`
+	UnitPrice        float64 `json:"unit_price"`
+	GrossAmount      float64 `json:"gross_amount"`
+	DiscountAmount   float64 `json:"discount_amount"`
+	TotalPrice       float64 `json:"total_price"`
+}
+
+// EvaluateDiscounts prices a cart with its automatic promotions and picks the combination of
+// selectable discounts that lowers the total the most, explaining why the others do not apply
+func (h *DiscountHandler) EvaluateDiscounts(c *gin.Context) {
+	var req DiscountEvaluateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Nothing is written; the transaction only keeps the locks quoteSale takes short lived
+	tx := h.DB.Begin()
+	defer tx.Rollback()
+
+	var candidates []models.Discount
+	query := tx.Where("is_automatic = ?", false)
+	if len(req.DiscountIDs) > 0 {
+		query = query.Where("id IN ?", req.DiscountIDs)
+	} else {
+		query = query.Where("is_active = ?", true).Where("store_id IS NULL OR store_id = ?", req.StoreID)
+	}
+	if err := query.Find(&candidates).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	sortDiscounts(candidates)
+
+	items := make([]models.SaleItem, len(req.Items))
+	for i, item := range req.Items {
+		items[i] = models.SaleItem{
+			ProductID:        item.ProductID,
+			ProductVariantID: item.ProductVariantID,
+			Quantity:         item.Quantity,
+			Unit:             item.Unit,
+			UnitQuantity:     item.UnitQuantity,
+			UnitPrice:        item.UnitPrice,
+			GiftCardCode:     item.GiftCardCode,
+		}
+	}
+
+	now := time.Now()
+	quote := func(discountIDs []uint) (*saleQuote, error) {
+		return quoteSale(tx, saleQuoteRequest{
+			StoreID:      req.StoreID,
+			CustomerID:   req.CustomerID,
+			DiscountIDs:  discountIDs,
+			Items:        items,
+			KeepRejected: true,
+		}, now)
+	}
+	rejectionOf := func(q *saleQuote, discountID uint) *rejectedDiscount {
+		for i := range q.Rejected {
+			if q.Rejected[i].DiscountID == discountID {
+				return &q.Rejected[i]
+			}
+		}
+		return nil
+	}
+
+	best, err := quote(nil)
+	if err != nil {
+		var saleErr *saleError
+		if errors.As(err, &saleErr) {
+			c.JSON(saleErr.Status, gin.H{"error": saleErr.Message, "code": saleErr.Code})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Try each discount on its own first, then add them greedily from the largest saving down
+	type option struct {
+		discount models.Discount
+		saving   float64
+	}
+	var options []option
+	var rejected []rejectedDiscount
+	for _, discount := range candidates {
+		q, err := quote([]uint{discount.ID})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if r := rejectionOf(q, discount.ID); r != nil {
+			rejected = append(rejected, *r)
+			continue
+		}
+		options = append(options, option{discount: discount, saving: roundCurrency(best.TotalAmount - q.TotalAmount)})
+	}
+	sort.SliceStable(options, func(a, b int) bool { return options[a].saving > options[b].saving })
+
+	var chosen []uint
+	for _, opt := range options {
+		ids := append(append([]uint{}, chosen...), opt.discount.ID)
+		q, err := quote(ids)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		reason := ""
+		for _, id := range ids {
+			if r := rejectionOf(q, id); r != nil {
+				reason = r.Reason
+				break
+			}
+		}
+		if reason == "" && q.TotalAmount >= best.TotalAmount {
+			reason = "Does not lower the total any further"
+		}
+		if reason != "" {
+			rejected = append(rejected, rejectedDiscount{DiscountID: opt.discount.ID, Name: opt.discount.Name, Reason: reason})
+			continue
+		}
+		chosen = ids
+		best = q
+	}
+
+	// Automatic promotions that did not apply to the chosen combination
+	for _, r := range best.Rejected {
+		if r.Automatic {
+			rejected = append(rejected, r)
+		}
+	}
+
+	lines := make([]evaluatedLine, len(best.Items))
+	for i, item := range best.Items {
+		discount := item.DiscountAmount
+		for _, applied := range best.Applied {
+			if !applied.Automatic && i < len(applied.Lines) {
+				discount += applied.Lines[i]
+			}
+		}
+		gross := roundCurrency(item.UnitPrice * item.Quantity)
+		lines[i] = evaluatedLine{
+			ProductID:        item.ProductID,
+			ProductVariantID: item.ProductVariantID,
+			Quantity:         item.Quantity,
+			UnitPrice:        item.UnitPrice,
+			GrossAmount:      gross,
+			DiscountAmount:   roundCurrency(discount),
+			TotalPrice:       roundCurrency(gross - discount),
+		}
+	}
+
+	var discountTotal float64
+	for _, applied := range best.Applied {
+		discountTotal += applied.Amount
+	}
+
+	if chosen == nil {
+		chosen = []uint{}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"data": gin.H{
+			"discount_ids":   chosen,
+			"applied":        best.Applied,
+			"rejected":       rejected,
+			"lines":          lines,
+			"subtotal":       best.Subtotal,
+			"discount_total": roundCurrency(discountTotal),
+			"tax_amount":     best.TaxAmount,
+			"total_amount":   best.TotalAmount,
+		},
+	})
+}
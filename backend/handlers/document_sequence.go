@@ -0,0 +1,375 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"starter/backend/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Document types numbered by nextDocumentNumber
+const (
+	DocumentTypeSale            = "sale"
+	DocumentTypeSaleReturn      = "sale_return"
+	DocumentTypePurchaseOrder   = "purchase_order"
+	DocumentTypeStockTransfer   = "stock_transfer"
+	DocumentTypeJournalEntry    = "journal_entry"
+	DocumentTypeCustomerPayment = "customer_payment"
+)
+
+// defaultDocumentSequences is used for a document type until a sequence is configured
+var defaultDocumentSequences = map[string]models.DocumentSequence{
+	DocumentTypeSale:            {Prefix: "TRX", Format: "{PREFIX}-{STORE}-{YYYY}{MM}{DD}-{SEQ}", ResetPeriod: "daily", Padding: 4},
+	DocumentTypeSaleReturn:      {Prefix: "RET", Format: "{PREFIX}-{STORE}-{YYYY}{MM}{DD}-{SEQ}", ResetPeriod: "daily", Padding: 4},
+	DocumentTypePurchaseOrder:   {Prefix: "PO", Format: "{PREFIX}-{STORE}-{YYYY}-{SEQ}", ResetPeriod: "yearly", Padding: 5},
+	DocumentTypeStockTransfer:   {Prefix: "ST", Format: "{PREFIX}-{STORE}-{YYYY}-{SEQ}", ResetPeriod: "yearly", Padding: 5},
+	DocumentTypeJournalEntry:    {Prefix: "JE", Format: "{PREFIX}-{YYYY}-{SEQ}", ResetPeriod: "yearly", Padding: 6},
+	DocumentTypeCustomerPayment: {Prefix: "PAY", Format: "{PREFIX}-{STORE}-{YYYY}{MM}-{SEQ}", ResetPeriod: "monthly", Padding: 4},
+}
+
+// documentLocation is the store or warehouse issuing a document; journal entries have none
+type documentLocation struct {
+	Type string // store, warehouse
+	ID   uint
+}
+
+// nextDocumentNumber issues the next number of a document type for a location.
+// Must run inside the transaction that creates the document: the counter row stays
+// locked until commit and a rollback releases the number, so sequences are gap-free
+func nextDocumentNumber(tx *gorm.DB, documentType string, location documentLocation, date time.Time) (string, error) {
+	sequence, err := findDocumentSequence(tx, documentType, location)
+	if err != nil {
+		return "", err
+	}
+
+	locationCode := ""
+	switch location.Type {
+	case "store":
+		var store models.Store
+		if err := tx.Select("code").First(&store, location.ID).Error; err != nil {
+			return "", fmt.Errorf("store %d not found for document numbering", location.ID)
+		}
+		locationCode = store.Code
+	case "warehouse":
+		var warehouse models.Warehouse
+		if err := tx.Select("code").First(&warehouse, location.ID).Error; err != nil {
+			return "", fmt.Errorf("warehouse %d not found for document numbering", location.ID)
+		}
+		locationCode = warehouse.Code
+	}
+
+	var value int64
+	if err := tx.Raw(`INSERT INTO document_counters (document_type, location_type, location_id, period_key, last_value, updated_at)
+		VALUES (?, ?, ?, ?, 1, NOW())
+		ON CONFLICT (document_type, location_type, location_id, period_key)
+		DO UPDATE SET last_value = document_counters.last_value + 1, updated_at = NOW()
+		RETURNING last_value`,
+		documentType, location.Type, location.ID, documentPeriodKey(sequence.ResetPeriod, date)).
+		Scan(&value).Error; err != nil {
+		return "", err
+	}
+
+	return formatDocumentNumber(sequence, locationCode, date, value), nil
+}
+
+// findDocumentSequence picks the location specific sequence, then the configured default, then the built-in one
+func findDocumentSequence(db *gorm.DB, documentType string, location documentLocation) (models.DocumentSequence, error) {
+	var sequences []models.DocumentSequence
+	if err := db.Where("document_type = ? AND ((location_type = ? AND location_id = ?) OR location_type = '')",
+		documentType, location.Type, location.ID).
+		Order("location_type DESC").Limit(1).Find(&sequences).Error; err != nil {
+		return models.DocumentSequence{}, err
+	}
+	if len(sequences) > 0 {
+		return sequences[0], nil
+	}
+
+	sequence, ok := defaultDocumentSequences[documentType]
+	if !ok {
+		return models.DocumentSequence{}, fmt.Errorf("unknown document type %s", documentType)
+	}
+	sequence.DocumentType = documentType
+	return sequence, nil
+}
+
+// documentPeriodKey is the counter bucket of a date for a reset period
+func documentPeriodKey(resetPeriod string, date time.Time) string {
+	switch resetPeriod {
+	case "daily":
+		return date.Format("20060102")
+	case "monthly":
+		return date.Format("200601")
+	case "yearly":
+		return date.Format("2006")
+	default:
+		return "all"
+	}
+}
+
+// formatDocumentNumber fills the format tokens of a sequence
+func formatDocumentNumber(sequence models.DocumentSequence, locationCode string, date time.Time, value int64) string {
+	padding := sequence.Padding
+	if padding < 1 {
+		padding = 1
+	}
+
+	return strings.NewReplacer(
+		"{PREFIX}", sequence.Prefix,
+		"{STORE}", locationCode,
+		"{YYYY}", date.Format("2006"),
+		"{YY}", date.Format("06"),
+		"{MM}", date.Format("01"),
+		"{DD}", date.Format("02"),
+		"{SEQ}", fmt.Sprintf("%0*d", padding, value),
+	).Replace(sequence.Format)
+}
+
+// validateDocumentSequence makes sure a format can only produce unique numbers
+func validateDocumentSequence(sequence models.DocumentSequence) error {
+	if _, ok := defaultDocumentSequences[sequence.DocumentType]; !ok {
+		return fmt.Errorf("unknown document type %s", sequence.DocumentType)
+	}
+	if sequence.LocationType != "" && sequence.LocationType != "store" && sequence.LocationType != "warehouse" {
+		return errors.New("location_type must be store, warehouse or empty")
+	}
+	if sequence.Padding < 1 || sequence.Padding > 12 {
+		return errors.New("padding must be between 1 and 12")
+	}
+
+	format := sequence.Format
+	if !strings.Contains(format, "{SEQ}") {
+		return errors.New("format must contain {SEQ}")
+	}
+	// Counters are kept per location, so numbers need the location code to stay unique
+	if sequence.DocumentType != DocumentTypeJournalEntry && !strings.Contains(format, "{STORE}") {
+		return errors.New("format must contain {STORE}")
+	}
+
+	hasYear := strings.Contains(format, "{YYYY}") || strings.Contains(format, "{YY}")
+	switch sequence.ResetPeriod {
+	case "daily":
+		if !hasYear || !strings.Contains(format, "{MM}") || !strings.Contains(format, "{DD}") {
+			return errors.New("daily sequences must contain year, {MM} and {DD}")
+		}
+	case "monthly":
+		if !hasYear || !strings.Contains(format, "{MM}") {
+			return errors.New("monthly sequences must contain year and {MM}")
+		}
+	case "yearly":
+		if !hasYear {
+			return errors.New("yearly sequences must contain {YYYY} or {YY}")
+		}
+	case "never":
+	default:
+		return errors.New("reset_period must be daily, monthly, yearly or never")
+	}
+
+	return nil
+}
+
+// checkNumberingChange refuses a new format or reset period for a scope that has already issued
+// numbers: the counters would restart, or carry on under another pattern, and issue numbers again
+func checkNumberingChange(db *gorm.DB, before, after models.DocumentSequence) error {
+	if before.Format == after.Format && before.ResetPeriod == after.ResetPeriod {
+		return nil
+	}
+	// A default sequence numbers every location without one of its own
+	query := db.Model(&models.DocumentCounter{}).Where("document_type = ?", after.DocumentType)
+	if after.LocationType != "" {
+		query = query.Where("location_type = ? AND location_id = ?", after.LocationType, after.LocationID)
+	}
+	var count int64
+	if err := query.Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return errors.New("format and reset_period cannot change once numbers have been issued")
+	}
+	return nil
+}
+
+type DocumentSequenceHandler struct {
+	DB *gorm.DB
+}
+
+func NewDocumentSequenceHandler(db *gorm.DB) *DocumentSequenceHandler {
+	return &DocumentSequenceHandler{DB: db}
+}
+
+// GetDocumentSequences lists configured sequences together with the built-in defaults
+func (h *DocumentSequenceHandler) GetDocumentSequences(c *gin.Context) {
+	var sequences []models.DocumentSequence
+	if err := h.DB.Order("document_type, location_type, location_id").Find(&sequences).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	defaults := make([]models.DocumentSequence, 0, len(defaultDocumentSequences))
+	for _, documentType := range []string{DocumentTypeSale, DocumentTypeSaleReturn, DocumentTypePurchaseOrder, DocumentTypeStockTransfer, DocumentTypeJournalEntry, DocumentTypeCustomerPayment} {
+		sequence := defaultDocumentSequences[documentType]
+		sequence.DocumentType = documentType
+		defaults = append(defaults, sequence)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": sequences, "defaults": defaults})
+}
+
+// CreateDocumentSequence configures numbering for a document type, optionally for one location
+func (h *DocumentSequenceHandler) CreateDocumentSequence(c *gin.Context) {
+	var sequence models.DocumentSequence
+	if err := c.ShouldBindJSON(&sequence); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	sequence.ID = 0
+	if sequence.LocationType == "" {
+		sequence.LocationID = 0
+	}
+
+	if err := validateDocumentSequence(sequence); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	current, err := findDocumentSequence(h.DB, sequence.DocumentType, documentLocation{Type: sequence.LocationType, ID: sequence.LocationID})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if err := checkNumberingChange(h.DB, current, sequence); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var count int64
+	h.DB.Model(&models.DocumentSequence{}).
+		Where("document_type = ? AND location_type = ? AND location_id = ?", sequence.DocumentType, sequence.LocationType, sequence.LocationID).
+		Count(&count)
+	if count > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A sequence for this document type and location already exists"})
+		return
+	}
+
+	if err := h.DB.Create(&sequence).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"data": sequence})
+}
+
+// UpdateDocumentSequence changes the prefix, format, padding or reset period of a sequence
+func (h *DocumentSequenceHandler) UpdateDocumentSequence(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid document sequence ID"})
+		return
+	}
+
+	var sequence models.DocumentSequence
+	if err := h.DB.First(&sequence, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Document sequence not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var req struct {
+		Prefix      *string `json:"prefix"`
+		Format      *string `json:"format"`
+		ResetPeriod *string `json:"reset_period"`
+		Padding     *int    `json:"padding"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	before := sequence
+	if req.Prefix != nil {
+		sequence.Prefix = *req.Prefix
+	}
+	if req.Format != nil {
+		sequence.Format = *req.Format
+	}
+	if req.ResetPeriod != nil {
+		sequence.ResetPeriod = *req.ResetPeriod
+	}
+	if req.Padding != nil {
+		sequence.Padding = *req.Padding
+	}
+
+	if err := validateDocumentSequence(sequence); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := checkNumberingChange(h.DB, before, sequence); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.DB.Save(&sequence).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": sequence})
+}
+
+// DeleteDocumentSequence removes a sequence so the document type falls back to the default
+func (h *DocumentSequenceHandler) DeleteDocumentSequence(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid document sequence ID"})
+		return
+	}
+
+	var sequence models.DocumentSequence
+	if err := h.DB.First(&sequence, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Document sequence not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	tx := h.DB.Begin()
+
+	if err := tx.Delete(&sequence).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// The sequence the scope falls back to must number the same way
+	fallback, err := findDocumentSequence(tx, sequence.DocumentType, documentLocation{Type: sequence.LocationType, ID: sequence.LocationID})
+	if err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	fallback.LocationType, fallback.LocationID = sequence.LocationType, sequence.LocationID
+	if err := checkNumberingChange(tx, sequence, fallback); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Document sequence deleted successfully"})
+}
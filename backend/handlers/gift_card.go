@@ -0,0 +1,405 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"starter/backend/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type GiftCardHandler struct {
+	DB *gorm.DB
+}
+
+func NewGiftCardHandler(db *gorm.DB) *GiftCardHandler {
+	return &GiftCardHandler{DB: db}
+}
+
+// generateGiftCardCode returns an unused card code: the prefix and 16 random digits
+func generateGiftCardCode(tx *gorm.DB, prefix string) (string, error) {
+	limit := new(big.Int).Exp(big.NewInt(10), big.NewInt(16), nil)
+	for attempt := 0; attempt < 5; attempt++ {
+		n, err := rand.Int(rand.Reader, limit)
+		if err != nil {
+			return "", err
+		}
+		code := fmt.Sprintf("%s%016d", prefix, n)
+
+		var count int64
+		tx.Model(&models.GiftCard{}).Where("code = ?", code).Count(&count)
+		if count == 0 {
+			return code, nil
+		}
+	}
+	return "", fmt.Errorf("could not generate a unique gift card code")
+}
+
+// giftCardExpiry is when a card issued now expires; nil when gift_card_expiry_months is 0
+func giftCardExpiry(db *gorm.DB) *time.Time {
+	months := int(getSettingFloat(db, "gift_card_expiry_months", 12))
+	if months <= 0 {
+		return nil
+	}
+	expiresAt := time.Now().AddDate(0, months, 0)
+	return &expiresAt
+}
+
+// lockGiftCard loads a card by code and locks it for a balance change
+func lockGiftCard(tx *gorm.DB, code string) (*models.GiftCard, error) {
+	var card models.GiftCard
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("code = ?", strings.TrimSpace(code)).First(&card).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, newSaleError(http.StatusBadRequest, "gift_card_invalid", fmt.Sprintf("Gift card %s not found", code))
+		}
+		return nil, err
+	}
+	return &card, nil
+}
+
+// checkGiftCardUsable rejects cards that cannot take or give money right now
+func checkGiftCardUsable(card *models.GiftCard) error {
+	if card.Status != "active" {
+		return newSaleError(http.StatusBadRequest, "gift_card_invalid", fmt.Sprintf("Gift card %s is %s", card.Code, card.Status))
+	}
+	if card.ExpiresAt != nil && card.ExpiresAt.Before(time.Now()) {
+		return newSaleError(http.StatusBadRequest, "gift_card_invalid", fmt.Sprintf("Gift card %s has expired", card.Code))
+	}
+	return nil
+}
+
+// moveGiftCardBalance changes the balance of a locked card and records the movement
+func moveGiftCardBalance(tx *gorm.DB, card *models.GiftCard, entry models.GiftCardTransaction) error {
+	entry.GiftCardID = card.ID
+	entry.Amount = roundCurrency(entry.Amount)
+	card.Balance = roundCurrency(card.Balance + entry.Amount)
+	if card.Balance < 0 {
+		return newSaleError(http.StatusBadRequest, "gift_card_insufficient", fmt.Sprintf("Insufficient balance on gift card %s", card.Code))
+	}
+	entry.BalanceAfter = card.Balance
+
+	if err := tx.Model(card).Update("balance", card.Balance).Error; err != nil {
+		return err
+	}
+	return tx.Create(&entry).Error
+}
+
+// issueGiftCard creates a new card with an opening balance
+func issueGiftCard(tx *gorm.DB, card models.GiftCard, entry models.GiftCardTransaction) (*models.GiftCard, error) {
+	prefix := "GC"
+	if card.Type == "store_credit" {
+		prefix = "SC"
+	}
+	code, err := generateGiftCardCode(tx, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	card.Code = code
+	card.InitialBalance = roundCurrency(entry.Amount)
+	card.Balance = 0
+	card.ExpiresAt = giftCardExpiry(tx)
+	if err := tx.Create(&card).Error; err != nil {
+		return nil, err
+	}
+
+	entry.Type = "issue"
+	if err := moveGiftCardBalance(tx, &card, entry); err != nil {
+		return nil, err
+	}
+	return &card, nil
+}
+
+// issueSaleGiftCard issues the card sold on a sale line, or loads the card the line names.
+// Cards of a sale awaiting a provider payment stay pending until it completes
+func issueSaleGiftCard(tx *gorm.DB, sale models.Sale, item *models.SaleItem, userID uint) error {
+	entry := models.GiftCardTransaction{
+		Type:      "load",
+		Amount:    item.TotalPrice,
+		StoreID:   &sale.StoreID,
+		SaleID:    &sale.ID,
+		Notes:     fmt.Sprintf("Sale %s", sale.SaleNumber),
+		CreatedBy: userID,
+	}
+
+	if item.GiftCardCode == "" {
+		status := "active"
+		if sale.SaleStatus == "pending" {
+			status = "pending"
+		}
+		card, err := issueGiftCard(tx, models.GiftCard{
+			Type:          "gift_card",
+			Status:        status,
+			IssuedStoreID: sale.StoreID,
+			IssuedSaleID:  &sale.ID,
+			CustomerID:    sale.CustomerID,
+			CreatedBy:     userID,
+		}, entry)
+		if err != nil {
+			return err
+		}
+		item.GiftCardID = &card.ID
+		item.GiftCardCode = card.Code
+		return nil
+	}
+
+	if sale.SaleStatus == "pending" {
+		return newSaleError(http.StatusBadRequest, "invalid_sale", "Existing gift cards can only be loaded with payments confirmed at the till")
+	}
+	card, err := lockGiftCard(tx, item.GiftCardCode)
+	if err != nil {
+		return err
+	}
+	if err := checkGiftCardUsable(card); err != nil {
+		return err
+	}
+	if err := moveGiftCardBalance(tx, card, entry); err != nil {
+		return err
+	}
+	item.GiftCardID = &card.ID
+	return nil
+}
+
+// redeemGiftCardPayment takes a gift_card payment off the card named in its reference number
+func redeemGiftCardPayment(tx *gorm.DB, sale models.Sale, payment *models.SalePayment, userID uint) error {
+	if payment.ReferenceNumber == "" {
+		return newSaleError(http.StatusBadRequest, "gift_card_invalid", "Gift card payments need the card code as reference number")
+	}
+
+	card, err := lockGiftCard(tx, payment.ReferenceNumber)
+	if err != nil {
+		return err
+	}
+	if err := checkGiftCardUsable(card); err != nil {
+		return err
+	}
+	if card.Balance < payment.Amount {
+		return newSaleError(http.StatusBadRequest, "gift_card_insufficient",
+			fmt.Sprintf("Insufficient balance on gift card %s. Available: %.2f, Required: %.2f", card.Code, card.Balance, payment.Amount))
+	}
+
+	payment.GiftCardID = &card.ID
+	return moveGiftCardBalance(tx, card, models.GiftCardTransaction{
+		Type:      "redeem",
+		Amount:    -payment.Amount,
+		StoreID:   &sale.StoreID,
+		SaleID:    &sale.ID,
+		Notes:     fmt.Sprintf("Sale %s", sale.SaleNumber),
+		CreatedBy: userID,
+	})
+}
+
+// reverseSaleGiftCards puts gift card payments back on their cards and takes back the cards
+// a sale issued or loaded. A card that has been spent from cannot be taken back
+func reverseSaleGiftCards(tx *gorm.DB, sale models.Sale, userID uint, notes string) error {
+	var payments []models.SalePayment
+	if err := tx.Where("sale_id = ? AND gift_card_id IS NOT NULL AND status = ?", sale.ID, "completed").
+		Find(&payments).Error; err != nil {
+		return err
+	}
+	for _, payment := range payments {
+		var card models.GiftCard
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&card, *payment.GiftCardID).Error; err != nil {
+			return err
+		}
+		if err := moveGiftCardBalance(tx, &card, models.GiftCardTransaction{
+			Type:      "refund",
+			Amount:    payment.Amount,
+			StoreID:   &sale.StoreID,
+			SaleID:    &sale.ID,
+			Notes:     notes,
+			CreatedBy: userID,
+		}); err != nil {
+			return err
+		}
+	}
+
+	for _, item := range sale.Items {
+		if item.GiftCardID == nil {
+			continue
+		}
+		var card models.GiftCard
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&card, *item.GiftCardID).Error; err != nil {
+			return err
+		}
+
+		used := newSaleError(http.StatusConflict, "gift_card_used", fmt.Sprintf("Gift card %s has already been used", card.Code))
+		issued := card.IssuedSaleID != nil && *card.IssuedSaleID == sale.ID
+		if issued && card.Balance < card.InitialBalance {
+			return used
+		}
+		if err := moveGiftCardBalance(tx, &card, models.GiftCardTransaction{
+			Type:      "void",
+			Amount:    -item.TotalPrice,
+			StoreID:   &sale.StoreID,
+			SaleID:    &sale.ID,
+			Notes:     notes,
+			CreatedBy: userID,
+		}); err != nil {
+			return used
+		}
+		if issued {
+			if err := tx.Model(&card).Update("status", "void").Error; err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// refundToGiftCard puts a return refund on a card. A store_credit refund issues new store credit
+// unless its reference number names a card to top up; a gift_card refund loads the named card
+func refundToGiftCard(tx *gorm.DB, sale models.Sale, saleReturn models.SaleReturn, refund *models.SaleReturnRefund, userID uint) error {
+	entry := models.GiftCardTransaction{
+		Type:         "refund",
+		Amount:       refund.Amount,
+		StoreID:      &sale.StoreID,
+		SaleID:       &sale.ID,
+		SaleReturnID: &saleReturn.ID,
+		Notes:        fmt.Sprintf("Return %s for sale %s", saleReturn.ReturnNumber, sale.SaleNumber),
+		CreatedBy:    userID,
+	}
+
+	if refund.ReferenceNumber == "" {
+		if refund.PaymentMethod != "store_credit" {
+			return newSaleError(http.StatusBadRequest, "gift_card_invalid", "Gift card refunds need the card code as reference number")
+		}
+		card, err := issueGiftCard(tx, models.GiftCard{
+			Type:               "store_credit",
+			Status:             "active",
+			IssuedStoreID:      sale.StoreID,
+			IssuedSaleReturnID: &saleReturn.ID,
+			CustomerID:         sale.CustomerID,
+			CreatedBy:          userID,
+		}, entry)
+		if err != nil {
+			return err
+		}
+		refund.ReferenceNumber = card.Code
+		return nil
+	}
+
+	card, err := lockGiftCard(tx, refund.ReferenceNumber)
+	if err != nil {
+		return err
+	}
+	if err := checkGiftCardUsable(card); err != nil {
+		return err
+	}
+	refund.ReferenceNumber = card.Code
+	return moveGiftCardBalance(tx, card, entry)
+}
+
+// GetGiftCards retrieves gift cards and store credit with pagination
+func (h *GiftCardHandler) GetGiftCards(c *gin.Context) {
+	var cards []models.GiftCard
+	var total int64
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10"))
+	offset := (page - 1) * limit
+
+	query := h.DB.Model(&models.GiftCard{})
+
+	if search := c.Query("search"); search != "" {
+		query = query.Where("code LIKE ?", "%"+search+"%")
+	}
+	if cardType := c.Query("type"); cardType != "" {
+		query = query.Where("type = ?", cardType)
+	}
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if customerID := c.Query("customer_id"); customerID != "" {
+		query = query.Where("customer_id = ?", customerID)
+	}
+
+	query.Count(&total)
+
+	if err := query.Preload("Customer").Preload("IssuedStore").
+		Order("created_at DESC").Limit(limit).Offset(offset).Find(&cards).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": cards,
+		"pagination": gin.H{
+			"current_page": page,
+			"per_page":     limit,
+			"total":        total,
+			"total_pages":  (total + int64(limit) - 1) / int64(limit),
+		},
+	})
+}
+
+// GetGiftCard retrieves a gift card with its transactions by ID
+func (h *GiftCardHandler) GetGiftCard(c *gin.Context) {
+	var card models.GiftCard
+	if err := h.DB.Preload("Customer").Preload("IssuedStore").
+		Preload("Transactions", func(db *gorm.DB) *gorm.DB { return db.Order("created_at DESC") }).
+		First(&card, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Gift card not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": card})
+}
+
+// LookupGiftCard finds a card by code so the till can show its balance
+func (h *GiftCardHandler) LookupGiftCard(c *gin.Context) {
+	code := strings.TrimSpace(c.Query("code"))
+	if code == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "code is required"})
+		return
+	}
+
+	var card models.GiftCard
+	if err := h.DB.Preload("Customer").
+		Preload("Transactions", func(db *gorm.DB) *gorm.DB { return db.Order("created_at DESC") }).
+		Where("code = ?", code).First(&card).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Gift card not found"})
+		return
+	}
+
+	usable := checkGiftCardUsable(&card) == nil
+	c.JSON(http.StatusOK, gin.H{"data": card, "usable": usable})
+}
+
+// UpdateGiftCardStatus disables or re-enables a card, e.g. when it is reported lost
+func (h *GiftCardHandler) UpdateGiftCardStatus(c *gin.Context) {
+	var req struct {
+		Status string `json:"status" binding:"required,oneof=active disabled"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var card models.GiftCard
+	if err := h.DB.First(&card, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Gift card not found"})
+		return
+	}
+
+	if card.Status != "active" && card.Status != "disabled" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Cannot change a %s gift card", card.Status)})
+		return
+	}
+
+	if err := h.DB.Model(&card).Update("status", req.Status).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": card})
+}
@@ -1,8 +1,11 @@
 package handlers
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
+	"time"
 
 	"starter/backend/models"
 
@@ -282,6 +285,8 @@ func (h *InventoryHandler) AdjustInventory(c *gin.Context) {
 		WarehouseID      uint    `json:"warehouse_id" binding:"required"`
 		Quantity         float64 `json:"quantity" binding:"required"`
 		Reason           string  `json:"reason" binding:"required"`
+		LotNumber        string  `json:"lot_number"`  // Lot the counted difference belongs to
+		ExpiryDate       string  `json:"expiry_date"` // YYYY-MM-DD, for stock added to a new lot
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -341,6 +346,22 @@ func (h *InventoryHandler) AdjustInventory(c *gin.Context) {
 		return
 	}
 
+	if err := adjustLots(tx, req.ProductID, req.ProductVariantID, warehouseLot(req.WarehouseID), adjustment, inventory.Quantity, req.LotNumber, req.ExpiryDate, models.StockLotMovement{
+		ReferenceType: "adjustment",
+		ReferenceID:   &transaction.ID,
+		Notes:         req.Reason,
+		CreatedBy:     userID.(uint),
+	}); err != nil {
+		tx.Rollback()
+		var saleErr *saleError
+		if errors.As(err, &saleErr) {
+			c.JSON(saleErr.Status, gin.H{"error": saleErr.Message, "code": saleErr.Code})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
 	tx.Commit()
 
 	c.JSON(http.StatusOK, gin.H{"data": inventory})
@@ -354,6 +375,8 @@ func (h *InventoryHandler) AdjustStoreInventory(c *gin.Context) {
 		StoreID          uint    `json:"store_id" binding:"required"`
 		Quantity         float64 `json:"quantity" binding:"required"`
 		Reason           string  `json:"reason" binding:"required"`
+		LotNumber        string  `json:"lot_number"`  // Lot the counted difference belongs to
+		ExpiryDate       string  `json:"expiry_date"` // YYYY-MM-DD, for stock added to a new lot
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -382,6 +405,7 @@ func (h *InventoryHandler) AdjustStoreInventory(c *gin.Context) {
 
 	// Update store inventory
 	storeInventory.Quantity = req.Quantity
+	storeInventory.LastUpdated = time.Now()
 	if err := tx.Save(&storeInventory).Error; err != nil {
 		tx.Rollback()
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
@@ -413,6 +437,22 @@ func (h *InventoryHandler) AdjustStoreInventory(c *gin.Context) {
 		return
 	}
 
+	if err := adjustLots(tx, req.ProductID, req.ProductVariantID, storeLot(req.StoreID), adjustment, storeInventory.Quantity, req.LotNumber, req.ExpiryDate, models.StockLotMovement{
+		ReferenceType: "adjustment",
+		ReferenceID:   &transaction.ID,
+		Notes:         req.Reason,
+		CreatedBy:     userID.(uint),
+	}); err != nil {
+		tx.Rollback()
+		var saleErr *saleError
+		if errors.As(err, &saleErr) {
+			c.JSON(saleErr.Status, gin.H{"error": saleErr.Message, "code": saleErr.Code})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
 	tx.Commit()
 
 	c.JSON(http.StatusOK, gin.H{"data": storeInventory})
@@ -464,3 +504,33 @@ func (h *InventoryHandler) GetInventoryTransactions(c *gin.Context) {
 		},
 	})
 }
+
+// applyStoreStockMovement changes store inventory by transaction.Quantity (signed)
+// and records the matching inventory transaction in the same DB transaction
+func applyStoreStockMovement(tx *gorm.DB, transaction models.InventoryTransaction) error {
+	if transaction.StoreID == nil {
+		return fmt.Errorf("store ID is required for store stock movement")
+	}
+
+	var inventory models.StoreInventory
+	where := models.StoreInventory{
+		ProductID:        transaction.ProductID,
+		ProductVariantID: transaction.ProductVariantID,
+		StoreID:          *transaction.StoreID,
+	}
+
+	if err := tx.Where(where).FirstOrCreate(&inventory, where).Error; err != nil {
+		return err
+	}
+
+	if err := tx.Model(&inventory).UpdateColumns(map[string]interface{}{
+		"quantity":     gorm.Expr("quantity + ?", transaction.Quantity),
+		"last_updated": time.Now(),
+	}).Error; err != nil {
+		return err
+	}
+
+	transaction.LocationType = "store"
+	transaction.LocationID = *transaction.StoreID
+	return tx.Create(&transaction).Error
+}
@@ -0,0 +1,742 @@
+package handlers
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"starter/backend/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type KitHandler struct {
+	DB *gorm.DB
+}
+
+func NewKitHandler(db *gorm.DB) *KitHandler {
+	return &KitHandler{DB: db}
+}
+
+// stockLine is a quantity of a product or variant
+type stockLine struct {
+	ProductID        uint
+	ProductVariantID *uint
+	Quantity         float64
+}
+
+// kitComponentRequest is a bill of materials line as sent by clients
+type kitComponentRequest struct {
+	ComponentProductID uint    `json:"component_product_id" binding:"required"`
+	ComponentVariantID *uint   `json:"component_variant_id"`
+	Quantity           float64 `json:"quantity" binding:"required,gt=0"`
+}
+
+type kitAssemblyRequest struct {
+	StoreID          uint    `json:"store_id" binding:"required"`
+	ProductID        uint    `json:"product_id" binding:"required"`
+	ProductVariantID *uint   `json:"product_variant_id"`
+	Quantity         float64 `json:"quantity" binding:"required,gt=0"`
+	Notes            string  `json:"notes"`
+}
+
+// kitComponentStock is how many kits one component is enough for at a store
+type kitComponentStock struct {
+	ComponentProductID uint    `json:"component_product_id"`
+	ComponentVariantID *uint   `json:"component_variant_id"`
+	Name               string  `json:"name"`
+	QuantityPerKit     float64 `json:"quantity_per_kit"`
+	Available          float64 `json:"available"`
+	Kits               float64 `json:"kits"`
+}
+
+// kitAvailability is what a store can sell of a kit: the kits already assembled plus the kits
+// the component stock makes
+type kitAvailability struct {
+	ProductID  uint                `json:"product_id"`
+	StoreID    uint                `json:"store_id"`
+	Prebuilt   float64             `json:"prebuilt"`
+	Buildable  float64             `json:"buildable"`
+	Available  float64             `json:"available"`
+	Components []kitComponentStock `json:"components"`
+}
+
+// kitComponents loads the bill of materials of a product, empty for products that are not kits
+func kitComponents(tx *gorm.DB, productID uint) ([]models.ProductComponent, error) {
+	var components []models.ProductComponent
+	if err := tx.Preload("ComponentProduct").Preload("ComponentVariant").
+		Where("product_id = ?", productID).Order("id").Find(&components).Error; err != nil {
+		return nil, err
+	}
+	return components, nil
+}
+
+// componentName names a component product or variant in messages
+func componentName(component models.ProductComponent) string {
+	name := fmt.Sprintf("product ID %d", component.ComponentProductID)
+	if component.ComponentProduct != nil {
+		name = component.ComponentProduct.Name
+	}
+	if component.ComponentVariant != nil {
+		name += " " + component.ComponentVariant.Name
+	}
+	return name
+}
+
+// componentCost is the cost of one base unit of a component
+func componentCost(component models.ProductComponent) float64 {
+	if component.ComponentVariant != nil && component.ComponentVariant.CostPrice > 0 {
+		return component.ComponentVariant.CostPrice
+	}
+	if component.ComponentProduct != nil {
+		return component.ComponentProduct.CostPrice
+	}
+	return 0
+}
+
+// kitUnitCost is the cost of one assembled kit: the cost price of the kit's variant or product
+// when one is set, the cost of its components otherwise
+func kitUnitCost(tx *gorm.DB, kit stockLine, components []models.ProductComponent) (float64, error) {
+	if kit.ProductVariantID != nil {
+		var variant models.ProductVariant
+		if err := tx.Select("id", "cost_price").First(&variant, *kit.ProductVariantID).Error; err != nil {
+			return 0, err
+		}
+		if variant.CostPrice > 0 {
+			return variant.CostPrice, nil
+		}
+	}
+	var product models.Product
+	if err := tx.Select("id", "cost_price").First(&product, kit.ProductID).Error; err != nil {
+		return 0, err
+	}
+	if product.CostPrice > 0 {
+		return product.CostPrice, nil
+	}
+
+	cost := 0.0
+	for _, component := range components {
+		cost += componentCost(component) * component.Quantity
+	}
+	return cost, nil
+}
+
+// availableStoreStock is the stock of a store not held by parked drafts
+func availableStoreStock(tx *gorm.DB, storeID uint, line stockLine) (float64, error) {
+	var inventory models.StoreInventory
+	err := tx.Where(models.StoreInventory{ProductID: line.ProductID, ProductVariantID: line.ProductVariantID, StoreID: storeID}).First(&inventory).Error
+	if err == gorm.ErrRecordNotFound {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return math.Max(inventory.Quantity-inventory.ReservedQuantity, 0), nil
+}
+
+// takeStoreStock takes stock out of a store, its lots and records the movement. The
+// transaction and movement carry the reference; stock reserved by drafts cannot be taken
+func takeStoreStock(tx *gorm.DB, storeID uint, line stockLine, name string, transaction models.InventoryTransaction, movement models.StockLotMovement) error {
+	var inventory models.StoreInventory
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where(models.StoreInventory{
+		ProductID:        line.ProductID,
+		ProductVariantID: line.ProductVariantID,
+		StoreID:          storeID,
+	}).First(&inventory).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return newSaleError(http.StatusBadRequest, "insufficient_stock", fmt.Sprintf("%s is not stocked at this store", name))
+		}
+		return err
+	}
+
+	if available := inventory.Quantity - inventory.ReservedQuantity; available < line.Quantity {
+		return newSaleError(http.StatusBadRequest, "insufficient_stock",
+			fmt.Sprintf("insufficient inventory for %s. Available: %.2f, Required: %.2f", name, available, line.Quantity))
+	}
+
+	inventory.Quantity -= line.Quantity
+	inventory.LastUpdated = time.Now()
+	if err := tx.Save(&inventory).Error; err != nil {
+		return err
+	}
+
+	if _, err := takeStockLots(tx, line.ProductID, line.ProductVariantID, storeLot(storeID), line.Quantity, inventory.Quantity, movement); err != nil {
+		return err
+	}
+
+	transaction.ProductID = line.ProductID
+	transaction.ProductVariantID = line.ProductVariantID
+	transaction.LocationType = "store"
+	transaction.LocationID = storeID
+	transaction.StoreID = &storeID
+	transaction.TransactionType = "out"
+	transaction.Quantity = -line.Quantity
+	return tx.Create(&transaction).Error
+}
+
+// sellKit takes a kit sale line out of stock: assembled kits first, then the components of the
+// kits still missing. What was taken is kept on the line for voids and returns
+func sellKit(tx *gorm.DB, storeID uint, item models.SaleItem, components []models.ProductComponent, userID uint) error {
+	kit := stockLine{ProductID: item.ProductID, ProductVariantID: item.ProductVariantID}
+	prebuilt, err := availableStoreStock(tx.Clauses(clause.Locking{Strength: "UPDATE"}), storeID, kit)
+	if err != nil {
+		return err
+	}
+
+	movement := models.StockLotMovement{
+		ReferenceType: "sale",
+		ReferenceID:   &item.SaleID,
+		SaleItemID:    &item.ID,
+		CreatedBy:     userID,
+	}
+	take := func(line stockLine, name string, unitCost float64, isPrebuilt bool) error {
+		if err := takeStoreStock(tx, storeID, line, name, models.InventoryTransaction{
+			UnitCost:      unitCost,
+			ReferenceType: "sale",
+			ReferenceID:   &item.SaleID,
+			Notes:         fmt.Sprintf("Kit product ID %d", item.ProductID),
+			CreatedBy:     userID,
+		}, movement); err != nil {
+			return err
+		}
+		return tx.Create(&models.SaleItemComponent{
+			SaleID:           item.SaleID,
+			SaleItemID:       item.ID,
+			ProductID:        line.ProductID,
+			ProductVariantID: line.ProductVariantID,
+			Quantity:         line.Quantity,
+			Prebuilt:         isPrebuilt,
+		}).Error
+	}
+
+	if kit.Quantity = math.Min(prebuilt, item.Quantity); kit.Quantity > 0 {
+		kitCost, err := kitUnitCost(tx, kit, components)
+		if err != nil {
+			return err
+		}
+		if err := take(kit, fmt.Sprintf("kit product ID %d", item.ProductID), kitCost, true); err != nil {
+			return err
+		}
+	}
+
+	missing := item.Quantity - kit.Quantity
+	if missing <= 0 {
+		return nil
+	}
+	for _, component := range components {
+		line := stockLine{
+			ProductID:        component.ComponentProductID,
+			ProductVariantID: component.ComponentVariantID,
+			Quantity:         component.Quantity * missing,
+		}
+		if err := take(line, componentName(component), componentCost(component), false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// restoreKitStock puts a share of a kit sale line back into the assembled kits and components
+// it took, with their lots. It reports false for lines that are not kits. The transaction
+// carries the reference of the movement
+func restoreKitStock(tx *gorm.DB, storeID, saleItemID uint, quantity float64, transaction models.InventoryTransaction, movement models.StockLotMovement) (bool, error) {
+	var taken []models.SaleItemComponent
+	if err := tx.Where("sale_item_id = ?", saleItemID).Order("id").Find(&taken).Error; err != nil {
+		return false, err
+	}
+	if len(taken) == 0 {
+		return false, nil
+	}
+
+	var item models.SaleItem
+	if err := tx.First(&item, saleItemID).Error; err != nil {
+		return false, err
+	}
+	if item.Quantity <= 0 {
+		return true, nil
+	}
+	share := quantity / item.Quantity
+
+	movement.SaleItemID = &saleItemID
+	for _, component := range taken {
+		back := component.Quantity * share
+		entry := transaction
+		entry.ProductID = component.ProductID
+		entry.ProductVariantID = component.ProductVariantID
+		entry.StoreID = &storeID
+		entry.TransactionType = "in"
+		entry.Quantity = back
+		if err := applyStoreStockMovement(tx, entry); err != nil {
+			return false, err
+		}
+
+		// Only the lots of this component, as the line's lot movements cover all of them
+		var movements []models.StockLotMovement
+		if err := tx.Where("sale_item_id = ? AND stock_lot_id IN (?)", saleItemID,
+			productLots(tx, component.ProductID, component.ProductVariantID, storeLot(storeID)).Select("id")).
+			Order("id").Find(&movements).Error; err != nil {
+			return false, err
+		}
+		if err := restoreTakenLots(tx, movements, back, movement); err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// draftStockLines splits a draft line into the stock it reserves: assembled kits when they
+// cover the line, the kit's components otherwise. Other lines reserve their own product.
+// When releasing, kits held on the kit's own row are given back from there
+func draftStockLines(tx *gorm.DB, storeID uint, item models.SaleItem, releasing bool) ([]stockLine, error) {
+	self := []stockLine{{ProductID: item.ProductID, ProductVariantID: item.ProductVariantID, Quantity: item.Quantity}}
+	components, err := kitComponents(tx, item.ProductID)
+	if err != nil || len(components) == 0 {
+		return self, err
+	}
+
+	var inventory models.StoreInventory
+	err = tx.Where(models.StoreInventory{ProductID: item.ProductID, ProductVariantID: item.ProductVariantID, StoreID: storeID}).First(&inventory).Error
+	switch {
+	case err == nil:
+		if (releasing && inventory.ReservedQuantity >= item.Quantity) ||
+			(!releasing && inventory.Quantity-inventory.ReservedQuantity >= item.Quantity) {
+			return self, nil
+		}
+	case err != gorm.ErrRecordNotFound:
+		return nil, err
+	}
+
+	lines := make([]stockLine, 0, len(components))
+	for _, component := range components {
+		lines = append(lines, stockLine{
+			ProductID:        component.ComponentProductID,
+			ProductVariantID: component.ComponentVariantID,
+			Quantity:         component.Quantity * item.Quantity,
+		})
+	}
+	return lines, nil
+}
+
+// loadKitAvailability works out the kits a store can sell
+func loadKitAvailability(db *gorm.DB, storeID uint, product models.Product, variantID *uint, components []models.ProductComponent) (*kitAvailability, error) {
+	prebuilt, err := availableStoreStock(db, storeID, stockLine{ProductID: product.ID, ProductVariantID: variantID})
+	if err != nil {
+		return nil, err
+	}
+
+	result := &kitAvailability{ProductID: product.ID, StoreID: storeID, Prebuilt: prebuilt, Components: []kitComponentStock{}}
+	for i, component := range components {
+		available, err := availableStoreStock(db, storeID, stockLine{ProductID: component.ComponentProductID, ProductVariantID: component.ComponentVariantID})
+		if err != nil {
+			return nil, err
+		}
+		kits := math.Floor(available / component.Quantity)
+		if i == 0 || kits < result.Buildable {
+			result.Buildable = kits
+		}
+		result.Components = append(result.Components, kitComponentStock{
+			ComponentProductID: component.ComponentProductID,
+			ComponentVariantID: component.ComponentVariantID,
+			Name:               componentName(component),
+			QuantityPerKit:     component.Quantity,
+			Available:          available,
+			Kits:               kits,
+		})
+	}
+	result.Available = result.Prebuilt + result.Buildable
+	return result, nil
+}
+
+// validateKitComponents checks a bill of materials: components are plain stocked products,
+// listed once, and kits are not nested
+func (h *KitHandler) validateKitComponents(kit models.Product, components []kitComponentRequest) string {
+	if kit.IsSerialized || kit.TrackLots || kit.IsGiftCard {
+		return "A kit cannot be serialized, tracked by lot or a gift card"
+	}
+	if len(components) > 0 {
+		var usedIn int64
+		h.DB.Model(&models.ProductComponent{}).Where("component_product_id = ?", kit.ID).Count(&usedIn)
+		if usedIn > 0 {
+			return fmt.Sprintf("%s is a component of another kit and cannot be a kit itself", kit.Name)
+		}
+	}
+
+	seen := make(map[string]bool, len(components))
+	for _, req := range components {
+		if req.ComponentProductID == kit.ID {
+			return "A kit cannot contain itself"
+		}
+		var component models.Product
+		if err := h.DB.First(&component, req.ComponentProductID).Error; err != nil {
+			return fmt.Sprintf("Component product %d not found", req.ComponentProductID)
+		}
+		if component.IsKit {
+			return fmt.Sprintf("%s is a kit; kits cannot contain kits", component.Name)
+		}
+		if component.IsSerialized || component.IsGiftCard {
+			return fmt.Sprintf("%s cannot be a kit component: serialized products and gift cards are sold on their own", component.Name)
+		}
+
+		key := strconv.FormatUint(uint64(req.ComponentProductID), 10)
+		if req.ComponentVariantID != nil {
+			var variant models.ProductVariant
+			if err := h.DB.Where("id = ? AND product_id = ?", *req.ComponentVariantID, component.ID).First(&variant).Error; err != nil {
+				return fmt.Sprintf("%s has no variant %d", component.Name, *req.ComponentVariantID)
+			}
+			key += "/" + strconv.FormatUint(uint64(variant.ID), 10)
+		}
+		if seen[key] {
+			return fmt.Sprintf("%s is listed more than once", component.Name)
+		}
+		seen[key] = true
+	}
+	return ""
+}
+
+// GetKitComponents retrieves the bill of materials of a kit
+func (h *KitHandler) GetKitComponents(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		return
+	}
+
+	components, err := kitComponents(h.DB, uint(id))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": components})
+}
+
+// SetKitComponents replaces the bill of materials of a product; an empty list makes it a plain product again
+func (h *KitHandler) SetKitComponents(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		return
+	}
+
+	var product models.Product
+	if err := h.DB.First(&product, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var req struct {
+		Components []kitComponentRequest `json:"components" binding:"dive"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if msg := h.validateKitComponents(product, req.Components); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	tx := h.DB.Begin()
+	var replacedIDs []uint
+	if err := tx.Model(&models.ProductComponent{}).Where("product_id = ?", product.ID).Pluck("id", &replacedIDs).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if err := tx.Where("product_id = ?", product.ID).Delete(&models.ProductComponent{}).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if err := recordCatalogDeletions(tx, "product_components", replacedIDs...); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	for _, req := range req.Components {
+		component := models.ProductComponent{
+			ProductID:          product.ID,
+			ComponentProductID: req.ComponentProductID,
+			ComponentVariantID: req.ComponentVariantID,
+			Quantity:           req.Quantity,
+		}
+		if err := tx.Create(&component).Error; err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	// Also bumps updated_at so offline terminals fetch the new bill of materials
+	if err := tx.Model(&product).Update("is_kit", len(req.Components) > 0).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	tx.Commit()
+
+	components, _ := kitComponents(h.DB, product.ID)
+	c.JSON(http.StatusOK, gin.H{"data": components})
+}
+
+// GetKitAvailability reports how many kits a store can sell from assembled kits and component stock
+func (h *KitHandler) GetKitAvailability(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		return
+	}
+	storeID, err := strconv.Atoi(c.Query("store_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "store_id is required"})
+		return
+	}
+	var variantID *uint
+	if param := c.Query("variant_id"); param != "" {
+		parsed, err := strconv.ParseUint(param, 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid variant ID"})
+			return
+		}
+		value := uint(parsed)
+		variantID = &value
+	}
+
+	var product models.Product
+	if err := h.DB.First(&product, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+		return
+	}
+	components, err := kitComponents(h.DB, product.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if len(components) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%s is not a kit", product.Name)})
+		return
+	}
+
+	availability, err := loadKitAvailability(h.DB, uint(storeID), product, variantID, components)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": availability})
+}
+
+// AssembleKits builds kits from component stock into the kit's own store stock
+func (h *KitHandler) AssembleKits(c *gin.Context) {
+	h.runKitAssembly(c, "assemble")
+}
+
+// DisassembleKits breaks assembled kits back into their components
+func (h *KitHandler) DisassembleKits(c *gin.Context) {
+	h.runKitAssembly(c, "disassemble")
+}
+
+func (h *KitHandler) runKitAssembly(c *gin.Context, assemblyType string) {
+	var req kitAssemblyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var store models.Store
+	if err := h.DB.First(&store, req.StoreID).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Store not found"})
+		return
+	}
+	var product models.Product
+	if err := h.DB.First(&product, req.ProductID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+		return
+	}
+	components, err := kitComponents(h.DB, product.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if len(components) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%s is not a kit", product.Name)})
+		return
+	}
+	if req.ProductVariantID != nil {
+		var variant models.ProductVariant
+		if err := h.DB.Where("id = ? AND product_id = ?", *req.ProductVariantID, product.ID).First(&variant).Error; err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%s has no variant %d", product.Name, *req.ProductVariantID)})
+			return
+		}
+	}
+
+	userID := getUserIDFromContext(c)
+	tx := h.DB.Begin()
+
+	assembly := models.KitAssembly{
+		Type:             assemblyType,
+		StoreID:          req.StoreID,
+		ProductID:        product.ID,
+		ProductVariantID: req.ProductVariantID,
+		Quantity:         req.Quantity,
+		Notes:            req.Notes,
+		CreatedBy:        userID,
+	}
+	if err := tx.Create(&assembly).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	notes := fmt.Sprintf("Kit %s: %s", assemblyType, product.Name)
+	if req.Notes != "" {
+		notes += " - " + req.Notes
+	}
+	transaction := models.InventoryTransaction{
+		ReferenceType: "assembly",
+		ReferenceID:   &assembly.ID,
+		Notes:         notes,
+		CreatedBy:     userID,
+	}
+	movement := models.StockLotMovement{
+		ReferenceType: "assembly",
+		ReferenceID:   &assembly.ID,
+		Notes:         notes,
+		CreatedBy:     userID,
+	}
+	kit := stockLine{ProductID: product.ID, ProductVariantID: req.ProductVariantID, Quantity: req.Quantity}
+
+	kitCost, err := kitUnitCost(tx, kit, components)
+	if err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if assemblyType == "assemble" {
+		err = h.assemble(tx, req.StoreID, kit, kitCost, components, transaction, movement)
+	} else {
+		transaction.ReferenceType = "disassembly"
+		movement.ReferenceType = "disassembly"
+		err = h.disassemble(tx, req.StoreID, kit, product.Name, kitCost, components, transaction, movement)
+	}
+	if err != nil {
+		tx.Rollback()
+		respondDraftError(c, err)
+		return
+	}
+	tx.Commit()
+
+	h.DB.Preload("Store").Preload("Product").Preload("ProductVariant").First(&assembly, assembly.ID)
+
+	c.JSON(http.StatusCreated, gin.H{"data": assembly})
+}
+
+// assemble takes the components of the kits out of stock and puts the kits in
+func (h *KitHandler) assemble(tx *gorm.DB, storeID uint, kit stockLine, kitCost float64, components []models.ProductComponent,
+	transaction models.InventoryTransaction, movement models.StockLotMovement) error {
+	for _, component := range components {
+		entry := transaction
+		entry.UnitCost = componentCost(component)
+		line := stockLine{
+			ProductID:        component.ComponentProductID,
+			ProductVariantID: component.ComponentVariantID,
+			Quantity:         component.Quantity * kit.Quantity,
+		}
+		if err := takeStoreStock(tx, storeID, line, componentName(component), entry, movement); err != nil {
+			return err
+		}
+	}
+
+	entry := transaction
+	entry.ProductID = kit.ProductID
+	entry.ProductVariantID = kit.ProductVariantID
+	entry.StoreID = &storeID
+	entry.TransactionType = "in"
+	entry.Quantity = kit.Quantity
+	entry.UnitCost = kitCost
+	return applyStoreStockMovement(tx, entry)
+}
+
+// disassemble takes assembled kits out of stock and puts their components back, into the
+// lots assemblies at the store most recently took them from
+func (h *KitHandler) disassemble(tx *gorm.DB, storeID uint, kit stockLine, kitName string, kitCost float64, components []models.ProductComponent,
+	transaction models.InventoryTransaction, movement models.StockLotMovement) error {
+	entry := transaction
+	entry.UnitCost = kitCost
+	if err := takeStoreStock(tx, storeID, kit, kitName, entry, movement); err != nil {
+		return err
+	}
+
+	for _, component := range components {
+		back := component.Quantity * kit.Quantity
+		entry := transaction
+		entry.ProductID = component.ComponentProductID
+		entry.ProductVariantID = component.ComponentVariantID
+		entry.StoreID = &storeID
+		entry.TransactionType = "in"
+		entry.Quantity = back
+		entry.UnitCost = componentCost(component)
+		if err := applyStoreStockMovement(tx, entry); err != nil {
+			return err
+		}
+
+		var movements []models.StockLotMovement
+		if err := tx.Where("reference_type IN ? AND stock_lot_id IN (?)", []string{"assembly", "disassembly"},
+			productLots(tx, component.ComponentProductID, component.ComponentVariantID, storeLot(storeID)).Select("id")).
+			Order("id DESC").Find(&movements).Error; err != nil {
+			return err
+		}
+		if err := restoreTakenLots(tx, movements, back, movement); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetKitAssemblies lists kit assemblies and disassemblies
+func (h *KitHandler) GetKitAssemblies(c *gin.Context) {
+	var assemblies []models.KitAssembly
+	var total int64
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10"))
+	offset := (page - 1) * limit
+
+	query := h.DB.Model(&models.KitAssembly{})
+	if storeID := c.Query("store_id"); storeID != "" {
+		query = query.Where("store_id = ?", storeID)
+	}
+	if productID := c.Query("product_id"); productID != "" {
+		query = query.Where("product_id = ?", productID)
+	}
+	if assemblyType := c.Query("type"); assemblyType != "" {
+		query = query.Where("type = ?", assemblyType)
+	}
+
+	query.Count(&total)
+
+	if err := query.Preload("Store").Preload("Product").Preload("ProductVariant").Preload("CreatedByUser").
+		Order("created_at DESC, id DESC").Limit(limit).Offset(offset).Find(&assemblies).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": assemblies,
+		"pagination": gin.H{
+			"current_page": page,
+			"per_page":     limit,
+			"total":        total,
+			"total_pages":  (total + int64(limit) - 1) / int64(limit),
+		},
+	})
+}
@@ -0,0 +1,759 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"starter/backend/barcode"
+	"starter/backend/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type LabelHandler struct {
+	DB *gorm.DB
+}
+
+func NewLabelHandler(db *gorm.DB) *LabelHandler {
+	return &LabelHandler{DB: db}
+}
+
+// labelItem is a product, variant or pack ready to be printed on a label
+type labelItem struct {
+	Product models.Product
+	Variant *models.ProductVariant
+	Unit    string  // Unit the price is for, the base unit unless a pack is labelled
+	Factor  float64 // Base units in Unit
+	Name    string
+	SKU     string
+	Code    string // Printed barcode, the SKU when the item has no barcode
+	Price   float64
+}
+
+// labelPrintItem names an item to label in print and queue requests
+type labelPrintItem struct {
+	ProductID        uint   `json:"product_id" binding:"required"`
+	ProductVariantID *uint  `json:"product_variant_id"`
+	Unit             string `json:"unit"` // Pack to label, empty for the base unit
+	Copies           int    `json:"copies"`
+}
+
+type labelPrintRequest struct {
+	TemplateID    *uint            `json:"template_id"`
+	StartPosition int              `json:"start_position"` // Labels already used on the first sheet
+	Items         []labelPrintItem `json:"items" binding:"required,min=1"`
+}
+
+type labelQueuePrintRequest struct {
+	TemplateID    *uint  `json:"template_id"`
+	StartPosition int    `json:"start_position"`
+	IDs           []uint `json:"ids"` // Queue entries to print, all pending entries when empty
+}
+
+// labelPrice is the shelf price of a product or variant for a number of base units
+func labelPrice(product models.Product, variant *models.ProductVariant, factor float64) float64 {
+	price := product.SellingPrice
+	if variant != nil && variant.SellingPrice > 0 {
+		price = variant.SellingPrice
+	}
+	return roundCurrency(price * factor)
+}
+
+// loadLabelItem resolves the product, variant and pack of a label with its current price and barcode
+func loadLabelItem(db *gorm.DB, productID uint, variantID *uint, unit string) (*labelItem, error) {
+	var product models.Product
+	if err := db.First(&product, productID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, newSaleError(http.StatusNotFound, "product_not_found", fmt.Sprintf("Product %d not found", productID))
+		}
+		return nil, err
+	}
+
+	item := &labelItem{Product: product, Unit: product.Unit, Factor: 1, Name: product.Name, SKU: product.SKU, Code: product.Barcode}
+	if variantID != nil {
+		var variant models.ProductVariant
+		if err := db.Where("id = ? AND product_id = ?", *variantID, product.ID).First(&variant).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return nil, newSaleError(http.StatusNotFound, "variant_not_found", fmt.Sprintf("%s has no variant %d", product.Name, *variantID))
+			}
+			return nil, err
+		}
+		item.Variant = &variant
+		item.Name = product.Name + " " + variant.Name
+		item.SKU = variant.SKU
+		item.Code = variant.Barcode
+	}
+
+	packUnit, factor, err := resolveProductUnit(db, product, unit)
+	if err != nil {
+		return nil, err
+	}
+	if packUnit != "" {
+		var pack models.ProductUnit
+		if err := db.Where("product_id = ? AND unit = ?", product.ID, packUnit).First(&pack).Error; err != nil {
+			return nil, err
+		}
+		item.Unit = packUnit
+		item.Factor = factor
+		item.Name = fmt.Sprintf("%s (%s isi %s)", item.Name, packUnit, strconv.FormatFloat(factor, 'f', -1, 64))
+		// A product barcode on a pack would ring up a single unit
+		item.Code = pack.Barcode
+	}
+
+	if item.Code == "" {
+		item.Code = item.SKU
+	}
+	item.Price = labelPrice(product, item.Variant, item.Factor)
+	return item, nil
+}
+
+// labelUnitPrice is the price per base unit printed on pack labels, and per 100 for goods sold by the gram or millilitre
+func labelUnitPrice(item labelItem) string {
+	if item.Factor <= 0 {
+		return ""
+	}
+	base := item.Price / item.Factor
+	switch unit := strings.ToLower(item.Product.Unit); unit {
+	case "g", "ml":
+		return fmt.Sprintf("%s / 100 %s", formatRupiah(base*100), unit)
+	}
+	if item.Factor != 1 {
+		return fmt.Sprintf("%s / %s", formatRupiah(base), item.Product.Unit)
+	}
+	return ""
+}
+
+// encodeLabelBarcode encodes a label code, choosing EAN-13 for EAN codes when no format is set
+func encodeLabelBarcode(code, format string) (*barcode.Symbol, error) {
+	var f barcode.Format
+	if format == "" {
+		f = barcode.FormatCode128
+		if isDigits(code) && (len(code) == 12 || (len(code) == 13 && eanCheckDigitValid(code))) {
+			f = barcode.FormatEAN13
+		}
+	} else {
+		parsed, err := barcode.ParseFormat(format)
+		if err != nil {
+			return nil, newSaleError(http.StatusBadRequest, "invalid_barcode", err.Error())
+		}
+		f = parsed
+	}
+
+	symbol, err := barcode.Encode(f, code)
+	if err != nil {
+		return nil, newSaleError(http.StatusBadRequest, "invalid_barcode", fmt.Sprintf("Cannot encode %s: %s", code, err.Error()))
+	}
+	return symbol, nil
+}
+
+// queueLabel adds a label to the print queue. A pending label for the same item and reason is
+// updated instead, so several price changes before the next print still give one label
+func queueLabel(tx *gorm.DB, entry models.LabelQueueItem) error {
+	query := tx.Where("product_id = ? AND unit = ? AND reason = ? AND status = ?", entry.ProductID, entry.Unit, entry.Reason, "pending")
+	if entry.ProductVariantID != nil {
+		query = query.Where("product_variant_id = ?", *entry.ProductVariantID)
+	} else {
+		query = query.Where("product_variant_id IS NULL")
+	}
+
+	var existing models.LabelQueueItem
+	err := query.First(&existing).Error
+	if err == gorm.ErrRecordNotFound {
+		if entry.Copies <= 0 {
+			entry.Copies = 1
+		}
+		entry.Status = "pending"
+		return tx.Create(&entry).Error
+	}
+	if err != nil {
+		return err
+	}
+
+	if entry.Reason == "price_change" {
+		// Back at the printed price: the label on the shelf is right again
+		if entry.NewPrice == existing.OldPrice {
+			return tx.Delete(&existing).Error
+		}
+		existing.NewPrice = entry.NewPrice
+	} else {
+		existing.NewPrice = entry.NewPrice
+		existing.Copies += max(entry.Copies, 1)
+	}
+	return tx.Save(&existing).Error
+}
+
+// queuePriceChangeLabels queues new labels after a product's selling price changed from
+// oldPrice: the product itself, its packs and the variants that sell at the product price
+func queuePriceChangeLabels(tx *gorm.DB, product models.Product, oldPrice float64, userID uint) error {
+	if product.SellingPrice == oldPrice {
+		return nil
+	}
+	old := product
+	old.SellingPrice = oldPrice
+
+	entries := []models.LabelQueueItem{{
+		ProductID: product.ID,
+		OldPrice:  labelPrice(old, nil, 1),
+		NewPrice:  labelPrice(product, nil, 1),
+	}}
+
+	var packs []models.ProductUnit
+	if err := tx.Where("product_id = ?", product.ID).Find(&packs).Error; err != nil {
+		return err
+	}
+	for _, pack := range packs {
+		entries = append(entries, models.LabelQueueItem{
+			ProductID: product.ID,
+			Unit:      pack.Unit,
+			OldPrice:  labelPrice(old, nil, pack.ConversionFactor),
+			NewPrice:  labelPrice(product, nil, pack.ConversionFactor),
+		})
+	}
+
+	var variants []models.ProductVariant
+	if err := tx.Where("product_id = ? AND is_active = ? AND selling_price <= 0", product.ID, true).Find(&variants).Error; err != nil {
+		return err
+	}
+	for _, variant := range variants {
+		variantID := variant.ID
+		entries = append(entries, models.LabelQueueItem{
+			ProductID:        product.ID,
+			ProductVariantID: &variantID,
+			OldPrice:         labelPrice(old, &variant, 1),
+			NewPrice:         labelPrice(product, &variant, 1),
+		})
+	}
+
+	for _, entry := range entries {
+		entry.Reason = "price_change"
+		entry.CreatedBy = userID
+		if err := queueLabel(tx, entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// queueVariantPriceChangeLabel queues a new label after a variant's own selling price changed from oldPrice
+func queueVariantPriceChangeLabel(tx *gorm.DB, product models.Product, variant models.ProductVariant, oldPrice float64, userID uint) error {
+	if variant.SellingPrice == oldPrice {
+		return nil
+	}
+	old := variant
+	old.SellingPrice = oldPrice
+	variantID := variant.ID
+	return queueLabel(tx, models.LabelQueueItem{
+		ProductID:        product.ID,
+		ProductVariantID: &variantID,
+		Reason:           "price_change",
+		OldPrice:         labelPrice(product, &old, 1),
+		NewPrice:         labelPrice(product, &variant, 1),
+		CreatedBy:        userID,
+	})
+}
+
+// GetProductBarcode renders the barcode of a product, variant or pack as SVG or PNG
+func (h *LabelHandler) GetProductBarcode(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		return
+	}
+
+	var variantID *uint
+	if param := c.Query("variant_id"); param != "" {
+		parsed, err := strconv.ParseUint(param, 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid variant ID"})
+			return
+		}
+		value := uint(parsed)
+		variantID = &value
+	}
+
+	item, err := loadLabelItem(h.DB, uint(id), variantID, c.Query("unit"))
+	if err != nil {
+		respondDraftError(c, err)
+		return
+	}
+	symbol, err := encodeLabelBarcode(item.Code, c.Query("format"))
+	if err != nil {
+		respondDraftError(c, err)
+		return
+	}
+
+	// Size of one module and height of linear bars, in pixels
+	module, _ := strconv.Atoi(c.DefaultQuery("scale", "2"))
+	height, _ := strconv.Atoi(c.DefaultQuery("height", "80"))
+	module = min(max(module, 1), 20)
+	height = min(max(height, 10), 1000)
+	showText := c.DefaultQuery("text", "true") != "false"
+
+	switch c.DefaultQuery("type", "svg") {
+	case "svg":
+		c.Data(http.StatusOK, "image/svg+xml", []byte(barcode.SVG(symbol, module, height, showText)))
+	case "png":
+		data, err := barcode.PNG(symbol, module, height)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.Data(http.StatusOK, "image/png", data)
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "type must be svg or png"})
+	}
+}
+
+// validateLabelTemplate checks that the label grid fits on the page
+func validateLabelTemplate(template models.LabelTemplate) string {
+	if strings.TrimSpace(template.Name) == "" {
+		return "Name is required"
+	}
+	if template.PageWidth <= 0 || template.PageHeight <= 0 || template.LabelWidth <= 0 || template.LabelHeight <= 0 {
+		return "Page and label sizes must be greater than zero"
+	}
+	if template.Columns <= 0 || template.Rows <= 0 {
+		return "Columns and rows must be greater than zero"
+	}
+	if template.MarginTop < 0 || template.MarginLeft < 0 || template.GapX < 0 || template.GapY < 0 {
+		return "Margins and gaps cannot be negative"
+	}
+	if template.FontSize <= 0 {
+		return "Font size must be greater than zero"
+	}
+	if template.BarcodeFormat != "" {
+		if _, err := barcode.ParseFormat(template.BarcodeFormat); err != nil {
+			return "Barcode format must be code128, ean13 or qr"
+		}
+	}
+
+	width := template.MarginLeft + float64(template.Columns)*template.LabelWidth + float64(template.Columns-1)*template.GapX
+	height := template.MarginTop + float64(template.Rows)*template.LabelHeight + float64(template.Rows-1)*template.GapY
+	// Allow for rounding in sizes copied from label stock datasheets
+	if width > template.PageWidth+0.5 || height > template.PageHeight+0.5 {
+		return "Labels do not fit on the page"
+	}
+	return ""
+}
+
+// GetLabelTemplates retrieves all label templates
+func (h *LabelHandler) GetLabelTemplates(c *gin.Context) {
+	var templates []models.LabelTemplate
+	if err := h.DB.Order("name").Find(&templates).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": templates})
+}
+
+// CreateLabelTemplate creates a new label template
+func (h *LabelHandler) CreateLabelTemplate(c *gin.Context) {
+	var template models.LabelTemplate
+	if err := c.ShouldBindJSON(&template); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if template.FontSize == 0 {
+		template.FontSize = 8
+	}
+
+	if msg := validateLabelTemplate(template); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	tx := h.DB.Begin()
+	if template.IsDefault {
+		if err := tx.Model(&models.LabelTemplate{}).Where("is_default = ?", true).Update("is_default", false).Error; err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if err := tx.Create(&template).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	tx.Commit()
+
+	c.JSON(http.StatusCreated, gin.H{"data": template})
+}
+
+// UpdateLabelTemplate updates a label template
+func (h *LabelHandler) UpdateLabelTemplate(c *gin.Context) {
+	var template models.LabelTemplate
+	if err := h.DB.First(&template, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Label template not found"})
+		return
+	}
+
+	var updateData models.LabelTemplate
+	if err := c.ShouldBindJSON(&updateData); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if updateData.FontSize == 0 {
+		updateData.FontSize = 8
+	}
+
+	if msg := validateLabelTemplate(updateData); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	template.Name = updateData.Name
+	template.PageWidth = updateData.PageWidth
+	template.PageHeight = updateData.PageHeight
+	template.Columns = updateData.Columns
+	template.Rows = updateData.Rows
+	template.LabelWidth = updateData.LabelWidth
+	template.LabelHeight = updateData.LabelHeight
+	template.MarginTop = updateData.MarginTop
+	template.MarginLeft = updateData.MarginLeft
+	template.GapX = updateData.GapX
+	template.GapY = updateData.GapY
+	template.BarcodeFormat = updateData.BarcodeFormat
+	template.FontSize = updateData.FontSize
+	template.ShowName = updateData.ShowName
+	template.ShowSKU = updateData.ShowSKU
+	template.ShowPrice = updateData.ShowPrice
+	template.ShowUnitPrice = updateData.ShowUnitPrice
+	template.ShowBarcode = updateData.ShowBarcode
+	template.IsDefault = updateData.IsDefault
+
+	tx := h.DB.Begin()
+	if template.IsDefault {
+		if err := tx.Model(&models.LabelTemplate{}).Where("is_default = ? AND id != ?", true, template.ID).Update("is_default", false).Error; err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if err := tx.Save(&template).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	tx.Commit()
+
+	c.JSON(http.StatusOK, gin.H{"data": template})
+}
+
+// DeleteLabelTemplate deletes a label template
+func (h *LabelHandler) DeleteLabelTemplate(c *gin.Context) {
+	if err := h.DB.Delete(&models.LabelTemplate{}, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Label template deleted successfully"})
+}
+
+// loadLabelTemplate finds the requested template, or the default one
+func (h *LabelHandler) loadLabelTemplate(id *uint) (*models.LabelTemplate, error) {
+	var template models.LabelTemplate
+	query := h.DB.Order("is_default DESC, id")
+	if id != nil {
+		query = h.DB.Where("id = ?", *id)
+	}
+	if err := query.First(&template).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, newSaleError(http.StatusNotFound, "template_not_found", "Label template not found")
+		}
+		return nil, err
+	}
+	return &template, nil
+}
+
+// PrintLabels renders a PDF label sheet for the listed products, variants and packs
+func (h *LabelHandler) PrintLabels(c *gin.Context) {
+	var req labelPrintRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	template, err := h.loadLabelTemplate(req.TemplateID)
+	if err != nil {
+		respondDraftError(c, err)
+		return
+	}
+
+	var labels []labelItem
+	for _, entry := range req.Items {
+		item, err := loadLabelItem(h.DB, entry.ProductID, entry.ProductVariantID, entry.Unit)
+		if err != nil {
+			respondDraftError(c, err)
+			return
+		}
+		for i := 0; i < max(entry.Copies, 1); i++ {
+			labels = append(labels, *item)
+		}
+	}
+
+	pdf, err := renderLabelPDF(*template, labels, req.StartPosition)
+	if err != nil {
+		respondDraftError(c, err)
+		return
+	}
+
+	c.Header("Content-Disposition", "inline; filename=labels.pdf")
+	c.Data(http.StatusOK, "application/pdf", pdf)
+}
+
+// GetLabelQueue retrieves queued labels, the pending ones unless a status is given
+func (h *LabelHandler) GetLabelQueue(c *gin.Context) {
+	var entries []models.LabelQueueItem
+	var total int64
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	offset := (page - 1) * limit
+
+	query := h.DB.Model(&models.LabelQueueItem{}).Where("status = ?", c.DefaultQuery("status", "pending"))
+	if productID := c.Query("product_id"); productID != "" {
+		query = query.Where("product_id = ?", productID)
+	}
+	if reason := c.Query("reason"); reason != "" {
+		query = query.Where("reason = ?", reason)
+	}
+
+	query.Count(&total)
+
+	if err := query.Preload("Product").Preload("ProductVariant").Order("created_at, id").
+		Limit(limit).Offset(offset).Find(&entries).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": entries,
+		"pagination": gin.H{
+			"current_page": page,
+			"per_page":     limit,
+			"total":        total,
+			"total_pages":  (total + int64(limit) - 1) / int64(limit),
+		},
+	})
+}
+
+// AddToLabelQueue queues labels to print later
+func (h *LabelHandler) AddToLabelQueue(c *gin.Context) {
+	var req labelPrintItem
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	item, err := loadLabelItem(h.DB, req.ProductID, req.ProductVariantID, req.Unit)
+	if err != nil {
+		respondDraftError(c, err)
+		return
+	}
+
+	entry := models.LabelQueueItem{
+		ProductID:        req.ProductID,
+		ProductVariantID: req.ProductVariantID,
+		Reason:           "manual",
+		OldPrice:         item.Price,
+		NewPrice:         item.Price,
+		Copies:           req.Copies,
+		CreatedBy:        getUserIDFromContext(c),
+	}
+	if item.Factor != 1 {
+		entry.Unit = item.Unit
+	}
+	if err := queueLabel(h.DB, entry); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"message": "Label queued successfully"})
+}
+
+// DeleteLabelQueueItem removes a label from the queue
+func (h *LabelHandler) DeleteLabelQueueItem(c *gin.Context) {
+	if err := h.DB.Delete(&models.LabelQueueItem{}, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Label removed from queue"})
+}
+
+// PrintLabelQueue renders the pending labels at today's prices and marks them printed
+func (h *LabelHandler) PrintLabelQueue(c *gin.Context) {
+	var req labelQueuePrintRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	template, err := h.loadLabelTemplate(req.TemplateID)
+	if err != nil {
+		respondDraftError(c, err)
+		return
+	}
+
+	var entries []models.LabelQueueItem
+	query := h.DB.Where("status = ?", "pending")
+	if len(req.IDs) > 0 {
+		query = query.Where("id IN ?", req.IDs)
+	}
+	if err := query.Order("product_id, product_variant_id, unit, id").Find(&entries).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if len(entries) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No pending labels to print"})
+		return
+	}
+
+	var labels []labelItem
+	ids := make([]uint, 0, len(entries))
+	for _, entry := range entries {
+		item, err := loadLabelItem(h.DB, entry.ProductID, entry.ProductVariantID, entry.Unit)
+		if err != nil {
+			respondDraftError(c, err)
+			return
+		}
+		for i := 0; i < max(entry.Copies, 1); i++ {
+			labels = append(labels, *item)
+		}
+		ids = append(ids, entry.ID)
+	}
+
+	pdf, err := renderLabelPDF(*template, labels, req.StartPosition)
+	if err != nil {
+		respondDraftError(c, err)
+		return
+	}
+
+	// Marked before the download finishes; a sheet that fails to print is queued again by hand
+	now := time.Now()
+	if err := h.DB.Model(&models.LabelQueueItem{}).Where("id IN ?", ids).
+		Updates(map[string]interface{}{"status": "printed", "printed_at": now}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("Content-Disposition", "inline; filename=labels.pdf")
+	c.Data(http.StatusOK, "application/pdf", pdf)
+}
+
+// renderLabelPDF lays labels out on as many pages of the template as needed, using the
+// built-in Helvetica fonts. Start skips the positions already used on the first sheet
+func renderLabelPDF(template models.LabelTemplate, labels []labelItem, start int) ([]byte, error) {
+	const mmToPt = 72 / 25.4
+	const padding = 1.5 * mmToPt
+
+	perPage := template.Columns * template.Rows
+	start = min(max(start, 0), perPage-1)
+	pageWidth, pageHeight := template.PageWidth*mmToPt, template.PageHeight*mmToPt
+	labelWidth, labelHeight := template.LabelWidth*mmToPt, template.LabelHeight*mmToPt
+	fontSize := template.FontSize
+
+	escape := strings.NewReplacer(`\`, `\\`, "(", `\(`, ")", `\)`)
+	var pages []*bytes.Buffer
+	for n, item := range labels {
+		position := start + n
+		if position/perPage >= len(pages) {
+			pages = append(pages, &bytes.Buffer{})
+		}
+		stream := pages[position/perPage]
+
+		col, row := position%perPage%template.Columns, position%perPage/template.Columns
+		left := (template.MarginLeft + float64(col)*(template.LabelWidth+template.GapX)) * mmToPt
+		top := pageHeight - (template.MarginTop+float64(row)*(template.LabelHeight+template.GapY))*mmToPt
+		x, y := left+padding, top-padding
+		width, bottom := labelWidth-2*padding, top-labelHeight+padding
+
+		text := func(line, font string, size float64) {
+			y -= size
+			fmt.Fprintf(stream, "BT /%s %.2f Tf %.2f %.2f Td (%s) Tj ET\n", font, size, x, y, escape.Replace(receiptASCII(line)))
+			y -= size * 0.2
+		}
+
+		if template.ShowName {
+			// Helvetica averages about 0.55em per character
+			lines := wrapReceiptText(item.Name, max(int(width/(fontSize*0.55)), 1))
+			for i, line := range lines[:min(len(lines), 2)] {
+				if i == 1 && len(lines) > 2 {
+					line = strings.TrimRight(line[:max(len(line)-3, 0)], " ") + "..."
+				}
+				text(line, "F2", fontSize)
+			}
+		}
+		if template.ShowSKU {
+			text(item.SKU, "F1", fontSize*0.8)
+		}
+		if template.ShowPrice {
+			text(formatRupiah(item.Price), "F2", fontSize*1.8)
+		}
+		if template.ShowUnitPrice {
+			if unitPrice := labelUnitPrice(item); unitPrice != "" {
+				text(unitPrice, "F1", fontSize*0.8)
+			}
+		}
+
+		if template.ShowBarcode {
+			symbol, err := encodeLabelBarcode(item.Code, template.BarcodeFormat)
+			if err != nil {
+				return nil, err
+			}
+			textSize := fontSize * 0.8
+			barsBottom, barsHeight := bottom, y-bottom-2
+			if !symbol.Is2D() {
+				barsBottom += textSize * 1.2
+				barsHeight -= textSize * 1.2
+			}
+			// Too little room left for a scannable symbol; the rest of the label is still useful
+			if barsHeight >= 3*mmToPt {
+				stream.WriteString(barcode.PDF(symbol, x, barsBottom, width, barsHeight))
+				if !symbol.Is2D() {
+					y = barsBottom
+					text(symbol.Text, "F1", textSize)
+				}
+			}
+		}
+	}
+
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"",
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica >>",
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold >>",
+	}
+	var kids []string
+	for i := range pages {
+		kids = append(kids, fmt.Sprintf("%d 0 R", len(objects)+1))
+		objects = append(objects,
+			fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.2f %.2f] /Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R >>",
+				pageWidth, pageHeight, len(objects)+2),
+			fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", pages[i].Len(), pages[i].String()),
+		)
+	}
+	objects[1] = fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages))
+
+	var pdf bytes.Buffer
+	pdf.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, object := range objects {
+		offsets[i] = pdf.Len()
+		fmt.Fprintf(&pdf, "%d 0 obj\n%s\nendobj\n", i+1, object)
+	}
+	xref := pdf.Len()
+	fmt.Fprintf(&pdf, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&pdf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&pdf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return pdf.Bytes(), nil
+}
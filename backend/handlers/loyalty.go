@@ -0,0 +1,433 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"starter/backend/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type LoyaltyHandler struct {
+	DB *gorm.DB
+}
+
+func NewLoyaltyHandler(db *gorm.DB) *LoyaltyHandler {
+	return &LoyaltyHandler{DB: db}
+}
+
+// loyaltyPointsExpiry is when points added now expire, nil when points never expire
+func loyaltyPointsExpiry(db *gorm.DB, now time.Time) *time.Time {
+	months := int(getSettingFloat(db, "loyalty_points_expiry_months", 12))
+	if months <= 0 {
+		return nil
+	}
+	expiresAt := now.AddDate(0, months, 0)
+	return &expiresAt
+}
+
+// postLoyaltyTransaction records a points movement and moves the customer's balance with it.
+// Points added open a lot that expires; points taken use up the lots that expire first.
+// A redemption is refused when the balance is short, other deductions stop at zero.
+// Returns nil when nothing was left to move
+func postLoyaltyTransaction(tx *gorm.DB, entry models.LoyaltyTransaction) (*models.LoyaltyTransaction, error) {
+	var customer models.Customer
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&customer, entry.CustomerID).Error; err != nil {
+		return nil, err
+	}
+
+	if customer.LoyaltyPoints+entry.Points < 0 {
+		if entry.Type == "redeemed" {
+			return nil, newSaleError(http.StatusBadRequest, "insufficient_points", "Insufficient loyalty points")
+		}
+		entry.Points = -customer.LoyaltyPoints
+	}
+	if entry.Points == 0 {
+		return nil, nil
+	}
+	entry.BalanceAfter = customer.LoyaltyPoints + entry.Points
+
+	switch {
+	case entry.Type == "expired":
+		// The expiry job closes the lot itself
+	case entry.Points > 0:
+		entry.PointsRemaining = entry.Points
+		if entry.ExpiresAt == nil {
+			entry.ExpiresAt = loyaltyPointsExpiry(tx, time.Now())
+		}
+	default:
+		entry.ExpiresAt = nil
+		if err := consumeLoyaltyLots(tx, customer.ID, -entry.Points); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Model(&customer).Update("loyalty_points", entry.BalanceAfter).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Create(&entry).Error; err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// consumeLoyaltyLots takes points out of a customer's open lots, the ones expiring first
+func consumeLoyaltyLots(tx *gorm.DB, customerID uint, points int) error {
+	var lots []models.LoyaltyTransaction
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("customer_id = ? AND points_remaining > 0", customerID).
+		Order("expires_at IS NULL, expires_at, id").Find(&lots).Error; err != nil {
+		return err
+	}
+
+	for _, lot := range lots {
+		if points <= 0 {
+			break
+		}
+		take := lot.PointsRemaining
+		if take > points {
+			take = points
+		}
+		points -= take
+		if err := tx.Model(&lot).UpdateColumn("points_remaining", lot.PointsRemaining-take).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loyaltyEarnMultiplier is the earn rate of the customer's tier, 1 without a tier
+func loyaltyEarnMultiplier(tx *gorm.DB, customer models.Customer) float64 {
+	if customer.LoyaltyTierID == nil {
+		return 1
+	}
+	var tier models.LoyaltyTier
+	if err := tx.Where("id = ? AND is_active = ?", *customer.LoyaltyTierID, true).First(&tier).Error; err != nil || tier.EarnMultiplier <= 0 {
+		return 1
+	}
+	return tier.EarnMultiplier
+}
+
+// refreshLoyaltyTier moves a member to the highest active tier their total spend reaches
+func refreshLoyaltyTier(tx *gorm.DB, customerID uint) error {
+	var customer models.Customer
+	if err := tx.Select("id", "is_member", "total_spent", "loyalty_tier_id").First(&customer, customerID).Error; err != nil {
+		return err
+	}
+
+	var tierID *uint
+	if customer.IsMember {
+		var tier models.LoyaltyTier
+		if err := tx.Where("is_active = ? AND min_total_spent <= ?", true, customer.TotalSpent).
+			Order("min_total_spent DESC").First(&tier).Error; err == nil {
+			tierID = &tier.ID
+		}
+	}
+
+	if (tierID == nil && customer.LoyaltyTierID == nil) ||
+		(tierID != nil && customer.LoyaltyTierID != nil && *tierID == *customer.LoyaltyTierID) {
+		return nil
+	}
+	return tx.Model(&models.Customer{}).Where("id = ?", customerID).Update("loyalty_tier_id", tierID).Error
+}
+
+// ExpireLoyaltyPoints takes the unused points of expired lots off the customers' balances
+func ExpireLoyaltyPoints(db *gorm.DB) error {
+	var expired []models.LoyaltyTransaction
+	if err := db.Select("id", "customer_id").Where("points_remaining > 0 AND expires_at < ?", time.Now()).
+		Find(&expired).Error; err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, candidate := range expired {
+		tx := db.Begin()
+		// Customer before lot, in the order sales redeeming points take them
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").
+			First(&models.Customer{}, candidate.CustomerID).Error; err != nil {
+			tx.Rollback()
+			errs = append(errs, fmt.Errorf("loyalty lot %d: %w", candidate.ID, err))
+			continue
+		}
+		var lot models.LoyaltyTransaction
+		// Skip lots that were used up since the scan
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ? AND points_remaining > 0", candidate.ID).First(&lot).Error; err != nil {
+			tx.Rollback()
+			continue
+		}
+		points := lot.PointsRemaining
+		if err := tx.Model(&lot).UpdateColumn("points_remaining", 0).Error; err != nil {
+			tx.Rollback()
+			errs = append(errs, fmt.Errorf("loyalty lot %d: %w", lot.ID, err))
+			continue
+		}
+		if _, err := postLoyaltyTransaction(tx, models.LoyaltyTransaction{
+			CustomerID: lot.CustomerID,
+			Type:       "expired",
+			Points:     -points,
+			SaleID:     lot.SaleID,
+			Notes:      fmt.Sprintf("Points of %s expired", lot.CreatedAt.Format("2006-01-02")),
+		}); err != nil {
+			tx.Rollback()
+			errs = append(errs, fmt.Errorf("loyalty lot %d: %w", lot.ID, err))
+			continue
+		}
+		if err := tx.Commit().Error; err != nil {
+			errs = append(errs, fmt.Errorf("loyalty lot %d: %w", lot.ID, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// RunLoyaltyExpiryJob periodically expires loyalty points; it never returns
+func RunLoyaltyExpiryJob(db *gorm.DB, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if err := ExpireLoyaltyPoints(db); err != nil {
+			log.Printf("Loyalty expiry job: %v", err)
+		}
+	}
+}
+
+// GetCustomerLoyalty returns a customer's points balance, tier and points history
+func (h *LoyaltyHandler) GetCustomerLoyalty(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid customer ID"})
+		return
+	}
+
+	var customer models.Customer
+	if err := h.DB.Preload("LoyaltyTier").First(&customer, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Customer not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10"))
+	offset := (page - 1) * limit
+
+	query := h.DB.Model(&models.LoyaltyTransaction{}).Where("customer_id = ?", customer.ID)
+	if txType := c.Query("type"); txType != "" {
+		query = query.Where("type = ?", txType)
+	}
+
+	var total int64
+	query.Count(&total)
+
+	var transactions []models.LoyaltyTransaction
+	if err := query.Preload("Sale").Order("created_at DESC, id DESC").
+		Limit(limit).Offset(offset).Find(&transactions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Points that expire within the next 30 days unless they are spent
+	var expiringSoon int
+	now := time.Now()
+	h.DB.Model(&models.LoyaltyTransaction{}).
+		Where("customer_id = ? AND points_remaining > 0 AND expires_at BETWEEN ? AND ?", customer.ID, now, now.AddDate(0, 0, 30)).
+		Select("COALESCE(SUM(points_remaining), 0)").Scan(&expiringSoon)
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": gin.H{
+			"customer":      customer,
+			"points":        customer.LoyaltyPoints,
+			"points_value":  roundCurrency(float64(customer.LoyaltyPoints) * getSettingFloat(h.DB, "loyalty_point_value", 100)),
+			"tier":          customer.LoyaltyTier,
+			"expiring_soon": expiringSoon,
+			"transactions":  transactions,
+		},
+		"pagination": gin.H{
+			"current_page": page,
+			"per_page":     limit,
+			"total":        total,
+			"total_pages":  (total + int64(limit) - 1) / int64(limit),
+		},
+	})
+}
+
+// AdjustCustomerPoints adds or removes points by hand, e.g. for a goodwill gesture or a correction
+func (h *LoyaltyHandler) AdjustCustomerPoints(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid customer ID"})
+		return
+	}
+
+	var req struct {
+		Points int    `json:"points" binding:"required"`
+		Notes  string `json:"notes" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var customer models.Customer
+	if err := h.DB.First(&customer, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Customer not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !customer.IsMember {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Only members can hold loyalty points"})
+		return
+	}
+	if customer.LoyaltyPoints+req.Points < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Customer only has %d points", customer.LoyaltyPoints)})
+		return
+	}
+
+	userID := getUserIDFromContext(c)
+	tx := h.DB.Begin()
+	entry, err := postLoyaltyTransaction(tx, models.LoyaltyTransaction{
+		CustomerID: customer.ID,
+		Type:       "adjusted",
+		Points:     req.Points,
+		Notes:      req.Notes,
+		CreatedBy:  &userID,
+	})
+	if err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if err := tx.Commit().Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"data": entry})
+}
+
+// GetLoyaltyTiers retrieves all member tiers, lowest first
+func (h *LoyaltyHandler) GetLoyaltyTiers(c *gin.Context) {
+	var tiers []models.LoyaltyTier
+
+	query := h.DB.Order("min_total_spent")
+	if active := c.Query("is_active"); active != "" {
+		query = query.Where("is_active = ?", active == "true")
+	}
+
+	if err := query.Find(&tiers).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": tiers})
+}
+
+// validateLoyaltyTier checks the fields of a tier before it is saved
+func validateLoyaltyTier(db *gorm.DB, tier models.LoyaltyTier, id uint) error {
+	if tier.Name == "" {
+		return errors.New("Name is required")
+	}
+	if tier.MinTotalSpent < 0 {
+		return errors.New("Minimum total spent cannot be negative")
+	}
+	if tier.EarnMultiplier <= 0 {
+		return errors.New("Earn multiplier must be greater than zero")
+	}
+
+	var existing models.LoyaltyTier
+	if err := db.Where("name = ? AND id != ?", tier.Name, id).First(&existing).Error; err == nil {
+		return errors.New("Tier name already exists")
+	}
+	return nil
+}
+
+// CreateLoyaltyTier creates a member tier; members move into it with their next sale
+func (h *LoyaltyHandler) CreateLoyaltyTier(c *gin.Context) {
+	var tier models.LoyaltyTier
+	if err := c.ShouldBindJSON(&tier); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if tier.EarnMultiplier == 0 {
+		tier.EarnMultiplier = 1
+	}
+
+	if err := validateLoyaltyTier(h.DB, tier, 0); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.DB.Create(&tier).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"data": tier})
+}
+
+// UpdateLoyaltyTier updates a member tier; points already earned are kept
+func (h *LoyaltyHandler) UpdateLoyaltyTier(c *gin.Context) {
+	var tier models.LoyaltyTier
+	if err := h.DB.First(&tier, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Loyalty tier not found"})
+		return
+	}
+
+	var updateData models.LoyaltyTier
+	if err := c.ShouldBindJSON(&updateData); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validateLoyaltyTier(h.DB, updateData, tier.ID); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tier.Name = updateData.Name
+	tier.MinTotalSpent = updateData.MinTotalSpent
+	tier.EarnMultiplier = updateData.EarnMultiplier
+	tier.Description = updateData.Description
+	tier.IsActive = updateData.IsActive
+
+	if err := h.DB.Save(&tier).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": tier})
+}
+
+// DeleteLoyaltyTier deletes a member tier; its members are left without a tier until their next sale
+func (h *LoyaltyHandler) DeleteLoyaltyTier(c *gin.Context) {
+	id := c.Param("id")
+
+	tx := h.DB.Begin()
+	if err := tx.Model(&models.Customer{}).Where("loyalty_tier_id = ?", id).Update("loyalty_tier_id", nil).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if err := tx.Delete(&models.LoyaltyTier{}, id).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if err := tx.Commit().Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Loyalty tier deleted successfully"})
+}
@@ -0,0 +1,426 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"starter/backend/models"
+	"starter/backend/payments"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// providerCallTimeout bounds every call to an external payment provider
+const providerCallTimeout = 15 * time.Second
+
+type PaymentHandler struct {
+	DB *gorm.DB
+}
+
+func NewPaymentHandler(db *gorm.DB) *PaymentHandler {
+	return &PaymentHandler{DB: db}
+}
+
+// initiateProviderPayments asks the providers to start collecting the pending payments of a new sale
+func initiateProviderPayments(db *gorm.DB, sale *models.Sale) error {
+	for i := range sale.Payments {
+		payment := &sale.Payments[i]
+		if payment.Provider == "" || payment.Status != "pending" {
+			continue
+		}
+
+		provider, err := payments.Get(payment.Provider)
+		if err != nil {
+			return err
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), providerCallTimeout)
+		initiation, err := provider.Initiate(ctx, payments.InitiateRequest{
+			Reference: fmt.Sprintf("%s-%d", sale.SaleNumber, payment.ID),
+			Method:    payment.PaymentMethod,
+			Amount:    payment.Amount,
+			ExpiresAt: *payment.ExpiresAt,
+		})
+		cancel()
+		if err != nil {
+			return err
+		}
+
+		payment.ProviderReference = initiation.ProviderReference
+		payment.PaymentPayload = initiation.Payload
+		if err := db.Model(payment).Updates(map[string]interface{}{
+			"provider_reference": payment.ProviderReference,
+			"payment_payload":    payment.PaymentPayload,
+		}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// settleProviderPayment applies a provider result to a pending payment. A completed payment
+// completes the sale once nothing else is pending; any other final status releases the sale.
+// A payment completed after its sale was released is refunded and reported as an error
+func settleProviderPayment(db *gorm.DB, paymentID uint, status payments.Status, amount float64) error {
+	tx := db.Begin()
+
+	var payment models.SalePayment
+	if err := tx.First(&payment, paymentID).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	// Lock the sale first so webhooks, polling and the expiry job settle it one at a time
+	var sale models.Sale
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Preload("Items").First(&sale, payment.SaleID).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.First(&payment, paymentID).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	// The customer paid after the sale was released: the money goes back to them
+	released := payment.Status == "expired" || payment.Status == "cancelled" || payment.Status == "failed"
+	if released && status == payments.StatusCompleted {
+		releasedStatus := payment.Status
+		if err := tx.Model(&payment).Update("status", "refund_pending").Error; err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit().Error; err != nil {
+			return err
+		}
+		if err := refundProviderPayment(db, payment, payment.Amount); err != nil {
+			return fmt.Errorf("payment %d completed after it was %s; refund failed and must be settled with the provider: %w",
+				payment.ID, releasedStatus, err)
+		}
+		return fmt.Errorf("payment %d completed after it was %s; %.2f refunded", payment.ID, releasedStatus, payment.Amount)
+	}
+
+	// Repeated callbacks for a settled payment are ignored
+	if payment.Status != "pending" || sale.SaleStatus != "pending" || status == payments.StatusPending {
+		tx.Rollback()
+		return nil
+	}
+
+	switch status {
+	case payments.StatusCompleted:
+		if math.Abs(amount-payment.Amount) >= 0.01 {
+			tx.Rollback()
+			return fmt.Errorf("paid amount %.2f does not match payment amount %.2f", amount, payment.Amount)
+		}
+
+		if err := tx.Model(&payment).Updates(map[string]interface{}{
+			"status":       "completed",
+			"processed_at": time.Now(),
+		}).Error; err != nil {
+			tx.Rollback()
+			return err
+		}
+
+		var stillPending int64
+		tx.Model(&models.SalePayment{}).Where("sale_id = ? AND status = ?", sale.ID, "pending").Count(&stillPending)
+		if stillPending == 0 {
+			if err := tx.Model(&sale).Updates(map[string]interface{}{
+				"sale_status":    "completed",
+				"payment_status": creditSalePaymentStatus(sale),
+			}).Error; err != nil {
+				tx.Rollback()
+				return err
+			}
+
+			// Gift cards sold with the sale can be used once it is paid
+			if err := tx.Model(&models.GiftCard{}).Where("issued_sale_id = ? AND status = ?", sale.ID, "pending").
+				Update("status", "active").Error; err != nil {
+				tx.Rollback()
+				return err
+			}
+		}
+	default:
+		release, err := releasePendingSale(tx, sale, string(status))
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit().Error; err != nil {
+			return err
+		}
+		return release.settle(db)
+	}
+
+	return tx.Commit().Error
+}
+
+// providerRefund refunds amount of a payment at its provider
+func providerRefund(payment models.SalePayment, amount float64) error {
+	provider, err := payments.Get(payment.Provider)
+	if err == nil {
+		ctx, cancel := context.WithTimeout(context.Background(), providerCallTimeout)
+		err = provider.Refund(ctx, payment.ProviderReference, amount)
+		cancel()
+	}
+	if err != nil {
+		log.Printf("Failed to refund payment %s at %s: %v", payment.ProviderReference, payment.Provider, err)
+	}
+	return err
+}
+
+// refundProviderPayment refunds amount of a payment marked refund_pending at its provider and
+// records the outcome on the payment: refunded, or refund_failed for staff to settle by hand.
+// It runs after the transaction that marked the payment has committed
+func refundProviderPayment(db *gorm.DB, payment models.SalePayment, amount float64) error {
+	err := providerRefund(payment, amount)
+	status := "refunded"
+	if err != nil {
+		status = "refund_failed"
+	}
+	if dbErr := db.Model(&models.SalePayment{}).Where("id = ? AND status = ?", payment.ID, "refund_pending").
+		Update("status", status).Error; dbErr != nil {
+		return dbErr
+	}
+	return err
+}
+
+// releasedPayments are the provider calls a released sale still needs; they are made by
+// settle once the release has committed, so no provider is waited on with the sale locked
+type releasedPayments struct {
+	cancel []models.SalePayment // Pending at the provider
+	refund []models.SalePayment // Already paid, marked refund_pending
+}
+
+// settle cancels and refunds the payments of a released sale at their providers. Failed
+// cancels are only logged, as the payment is expired or cancelled on our side either way
+func (r releasedPayments) settle(db *gorm.DB) error {
+	for _, payment := range r.cancel {
+		if provider, err := payments.Get(payment.Provider); err == nil {
+			ctx, cancel := context.WithTimeout(context.Background(), providerCallTimeout)
+			if err := provider.Cancel(ctx, payment.ProviderReference); err != nil {
+				log.Printf("Failed to cancel payment %s at %s: %v", payment.ProviderReference, payment.Provider, err)
+			}
+			cancel()
+		}
+	}
+
+	var errs []error
+	for _, payment := range r.refund {
+		if err := refundProviderPayment(db, payment, payment.Amount); err != nil {
+			errs = append(errs, fmt.Errorf("payment %d: refund failed and must be settled with the provider: %w", payment.ID, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// releasePendingSale cancels a locked pending sale whose payment will not complete,
+// returning its stock, discount usage and loyalty points. Provider payments the customer
+// already completed are marked for refund; the caller settles them after commit
+func releasePendingSale(tx *gorm.DB, sale models.Sale, paymentStatus string) (releasedPayments, error) {
+	var release releasedPayments
+	var providerPayments []models.SalePayment
+	if err := tx.Where("sale_id = ? AND provider <> '' AND status IN ?", sale.ID, []string{"pending", "completed"}).
+		Find(&providerPayments).Error; err != nil {
+		return release, err
+	}
+	for _, payment := range providerPayments {
+		switch {
+		case payment.Status == "completed":
+			release.refund = append(release.refund, payment)
+		case payment.ProviderReference != "":
+			release.cancel = append(release.cancel, payment)
+		}
+	}
+	for _, payment := range release.refund {
+		if err := tx.Model(&models.SalePayment{}).Where("id = ?", payment.ID).Update("status", "refund_pending").Error; err != nil {
+			return release, err
+		}
+	}
+
+	if err := tx.Model(&models.SalePayment{}).Where("sale_id = ? AND status = ?", sale.ID, "pending").
+		Update("status", paymentStatus).Error; err != nil {
+		return release, err
+	}
+
+	if err := reverseSaleEffects(tx, sale, sale.CashierID, "payment_release",
+		fmt.Sprintf("Payment %s for sale: %s", paymentStatus, sale.SaleNumber)); err != nil {
+		return release, err
+	}
+
+	return release, tx.Model(&sale).Updates(map[string]interface{}{
+		"sale_status":    "cancelled",
+		"payment_status": "failed",
+		"void_reason":    "Payment " + paymentStatus,
+	}).Error
+}
+
+// PaymentWebhook receives payment confirmations from a provider
+func (h *PaymentHandler) PaymentWebhook(c *gin.Context) {
+	provider, err := payments.Get(c.Param("provider"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	callback, err := provider.ParseCallback(c.Request)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	var payment models.SalePayment
+	if err := h.DB.Where("provider = ? AND provider_reference = ?", provider.Name(), callback.ProviderReference).
+		First(&payment).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Payment not found"})
+		return
+	}
+
+	if err := settleProviderPayment(h.DB, payment.ID, callback.Status, callback.Amount); err != nil {
+		log.Printf("Payment callback %s from %s: %v", callback.ProviderReference, provider.Name(), err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Callback processed"})
+}
+
+// GetSalePaymentStatus polls the providers of a pending sale and returns its current state
+func (h *PaymentHandler) GetSalePaymentStatus(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid sale ID"})
+		return
+	}
+
+	var sale models.Sale
+	if err := h.DB.Preload("Payments").First(&sale, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Sale not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if sale.SaleStatus == "pending" {
+		for _, payment := range sale.Payments {
+			if payment.Status != "pending" || payment.ProviderReference == "" {
+				continue
+			}
+			provider, err := payments.Get(payment.Provider)
+			if err != nil {
+				continue
+			}
+
+			ctx, cancel := context.WithTimeout(c.Request.Context(), providerCallTimeout)
+			status, err := provider.Status(ctx, payment.ProviderReference)
+			cancel()
+			if err != nil {
+				log.Printf("Failed to poll payment %s at %s: %v", payment.ProviderReference, payment.Provider, err)
+				continue
+			}
+			// Polling reports no amount; the provider is collecting the amount it was asked for
+			if err := settleProviderPayment(h.DB, payment.ID, status, payment.Amount); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+		}
+	}
+
+	h.DB.Preload("Payments").First(&sale, sale.ID)
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": gin.H{
+			"sale_id":        sale.ID,
+			"sale_number":    sale.SaleNumber,
+			"sale_status":    sale.SaleStatus,
+			"payment_status": sale.PaymentStatus,
+			"payments":       sale.Payments,
+		},
+	})
+}
+
+// CancelSalePayment cancels the pending payments of a sale and releases it
+func (h *PaymentHandler) CancelSalePayment(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid sale ID"})
+		return
+	}
+
+	tx := h.DB.Begin()
+
+	var sale models.Sale
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Preload("Items").First(&sale, id).Error; err != nil {
+		tx.Rollback()
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Sale not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	if sale.SaleStatus != "pending" {
+		tx.Rollback()
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Only sales awaiting payment can be cancelled"})
+		return
+	}
+
+	release, err := releasePendingSale(tx, sale, "cancelled")
+	if err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	message := "Payment cancelled and sale released"
+	if err := release.settle(h.DB); err != nil {
+		log.Printf("Cancel sale %s: %v", sale.SaleNumber, err)
+		message = "Payment cancelled and sale released; provider refunds failed and must be settled with the provider"
+	}
+
+	h.DB.Preload("Items").Preload("Payments").First(&sale, sale.ID)
+
+	c.JSON(http.StatusOK, gin.H{"data": sale, "message": message})
+}
+
+// ExpirePendingPayments releases sales whose provider payments passed their expiry time
+func ExpirePendingPayments(db *gorm.DB) error {
+	var expired []models.SalePayment
+	if err := db.Where("status = ? AND expires_at IS NOT NULL AND expires_at < ?", "pending", time.Now()).
+		Find(&expired).Error; err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, payment := range expired {
+		if err := settleProviderPayment(db, payment.ID, payments.StatusExpired, 0); err != nil {
+			errs = append(errs, fmt.Errorf("payment %d: %w", payment.ID, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// RunPaymentExpiryJob periodically releases sales with expired payments; it never returns
+func RunPaymentExpiryJob(db *gorm.DB, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if err := ExpirePendingPayments(db); err != nil {
+			log.Printf("Payment expiry job: %v", err)
+		}
+	}
+}
@@ -0,0 +1,625 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"starter/backend/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type PriceChangeHandler struct {
+	DB *gorm.DB
+}
+
+func NewPriceChangeHandler(db *gorm.DB) *PriceChangeHandler {
+	return &PriceChangeHandler{DB: db}
+}
+
+type priceChangeRequest struct {
+	ProductID        uint      `json:"product_id" binding:"required"`
+	ProductVariantID *uint     `json:"product_variant_id"`
+	StoreID          *uint     `json:"store_id"`
+	SellingPrice     *float64  `json:"selling_price"`
+	CostPrice        *float64  `json:"cost_price"`
+	EffectiveAt      time.Time `json:"effective_at" binding:"required"`
+	Notes            string    `json:"notes"`
+}
+
+// priceAt is the prices in effect at a point in time
+type priceAt struct {
+	At           time.Time `json:"at"`
+	SellingPrice float64   `json:"selling_price"`
+	CostPrice    float64   `json:"cost_price"`
+}
+
+// recordPriceHistory adds a price change to the price history; changes that leave both prices as they were are skipped
+func recordPriceHistory(tx *gorm.DB, entry models.PriceHistory) error {
+	if entry.OldSellingPrice == entry.NewSellingPrice && entry.OldCostPrice == entry.NewCostPrice {
+		return nil
+	}
+	return tx.Create(&entry).Error
+}
+
+// findStorePrice loads a store's own price for a product, or for one of its variants
+func findStorePrice(tx *gorm.DB, storeID, productID uint, variantID *uint) (*models.StorePrice, error) {
+	query := tx.Where("store_id = ? AND product_id = ?", storeID, productID)
+	if variantID != nil {
+		query = query.Where("product_variant_id = ?", *variantID)
+	} else {
+		query = query.Where("product_variant_id IS NULL")
+	}
+	var price models.StorePrice
+	if err := query.First(&price).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &price, nil
+}
+
+// storeSellingPrice is the price a store sells a product or variant at. The store's own price
+// wins over the catalog until a chain-wide change of the same product or variant clears it;
+// a variant's own price wins over the product's
+func storeSellingPrice(tx *gorm.DB, storeID uint, product models.Product, variant *models.ProductVariant) (float64, error) {
+	if variant != nil {
+		price, err := findStorePrice(tx, storeID, product.ID, &variant.ID)
+		if err != nil || price != nil {
+			return priceOf(price), err
+		}
+		if variant.SellingPrice > 0 {
+			return variant.SellingPrice, nil
+		}
+	}
+	price, err := findStorePrice(tx, storeID, product.ID, nil)
+	if err != nil || price != nil {
+		return priceOf(price), err
+	}
+	return product.SellingPrice, nil
+}
+
+// storeSellingPriceAt is the price a store sold a product or variant at at a past moment, worked
+// back from today's price through the history of the store's own prices, or of the catalog's
+// when the store never priced it itself
+func storeSellingPriceAt(tx *gorm.DB, storeID uint, product models.Product, variant *models.ProductVariant, at time.Time) (float64, error) {
+	current, err := storeSellingPrice(tx, storeID, product, variant)
+	if err != nil {
+		return 0, err
+	}
+
+	// A variant without a price history of its own sells at the product's price
+	lines := []*gorm.DB{tx.Model(&models.PriceHistory{}).Where("product_id = ? AND product_variant_id IS NULL", product.ID)}
+	if variant != nil {
+		lines = append([]*gorm.DB{tx.Model(&models.PriceHistory{}).Where("product_id = ? AND product_variant_id = ?", product.ID, variant.ID)}, lines...)
+	}
+	for _, line := range lines {
+		for _, scope := range []*gorm.DB{
+			line.Session(&gorm.Session{}).Where("store_id = ?", storeID),
+			line.Session(&gorm.Session{}).Where("store_id IS NULL"),
+		} {
+			var count int64
+			if err := scope.Session(&gorm.Session{}).Count(&count).Error; err != nil {
+				return 0, err
+			}
+			if count == 0 {
+				continue
+			}
+			price, err := pricesAt(scope, priceAt{At: at, SellingPrice: current})
+			if err != nil {
+				return 0, err
+			}
+			return price.SellingPrice, nil
+		}
+	}
+	return current, nil
+}
+
+func priceOf(price *models.StorePrice) float64 {
+	if price == nil {
+		return 0
+	}
+	return price.SellingPrice
+}
+
+// applyPriceChange sets the prices of a price change, records them in the price history and
+// queues new shelf labels for catalog selling prices
+func applyPriceChange(tx *gorm.DB, change *models.PriceChange) error {
+	var product models.Product
+	if err := tx.First(&product, change.ProductID).Error; err != nil {
+		return err
+	}
+	var variant *models.ProductVariant
+	if change.ProductVariantID != nil {
+		variant = &models.ProductVariant{}
+		if err := tx.Where("id = ? AND product_id = ?", *change.ProductVariantID, product.ID).First(variant).Error; err != nil {
+			return err
+		}
+	}
+
+	entry := models.PriceHistory{
+		ProductID:        product.ID,
+		ProductVariantID: change.ProductVariantID,
+		StoreID:          change.StoreID,
+		Source:           "price_change",
+		PriceChangeID:    &change.ID,
+		CreatedBy:        change.CreatedBy,
+	}
+
+	switch {
+	case change.StoreID != nil:
+		// Store prices only replace the selling price; the cost is the catalog's
+		oldPrice, err := storeSellingPrice(tx, *change.StoreID, product, variant)
+		if err != nil {
+			return err
+		}
+		price, err := findStorePrice(tx, *change.StoreID, product.ID, change.ProductVariantID)
+		if err != nil {
+			return err
+		}
+		if price == nil {
+			price = &models.StorePrice{StoreID: *change.StoreID, ProductID: product.ID, ProductVariantID: change.ProductVariantID}
+		}
+		price.SellingPrice = *change.SellingPrice
+		if err := tx.Save(price).Error; err != nil {
+			return err
+		}
+		entry.OldSellingPrice, entry.NewSellingPrice = oldPrice, price.SellingPrice
+		entry.OldCostPrice, entry.NewCostPrice = product.CostPrice, product.CostPrice
+		if variant != nil && variant.CostPrice > 0 {
+			entry.OldCostPrice, entry.NewCostPrice = variant.CostPrice, variant.CostPrice
+		}
+
+	case variant != nil:
+		old := *variant
+		updates := map[string]interface{}{}
+		if change.SellingPrice != nil {
+			updates["selling_price"] = *change.SellingPrice
+		}
+		if change.CostPrice != nil {
+			updates["cost_price"] = *change.CostPrice
+		}
+		if err := tx.Model(variant).Updates(updates).Error; err != nil {
+			return err
+		}
+		if err := tx.First(variant, variant.ID).Error; err != nil {
+			return err
+		}
+		if err := queueVariantPriceChangeLabel(tx, product, *variant, old.SellingPrice, change.CreatedBy); err != nil {
+			return err
+		}
+		entry.OldSellingPrice, entry.NewSellingPrice = old.SellingPrice, variant.SellingPrice
+		entry.OldCostPrice, entry.NewCostPrice = old.CostPrice, variant.CostPrice
+
+	default:
+		old := product
+		updates := map[string]interface{}{}
+		if change.SellingPrice != nil {
+			updates["selling_price"] = *change.SellingPrice
+		}
+		if change.CostPrice != nil {
+			updates["cost_price"] = *change.CostPrice
+		}
+		if err := tx.Model(&product).Updates(updates).Error; err != nil {
+			return err
+		}
+		if err := tx.First(&product, product.ID).Error; err != nil {
+			return err
+		}
+		if err := queuePriceChangeLabels(tx, product, old.SellingPrice, change.CreatedBy); err != nil {
+			return err
+		}
+		entry.OldSellingPrice, entry.NewSellingPrice = old.SellingPrice, product.SellingPrice
+		entry.OldCostPrice, entry.NewCostPrice = old.CostPrice, product.CostPrice
+	}
+
+	if err := recordPriceHistory(tx, entry); err != nil {
+		return err
+	}
+	if change.StoreID == nil && change.SellingPrice != nil {
+		if err := clearStorePrices(tx, product, variant, change); err != nil {
+			return err
+		}
+	}
+
+	now := time.Now()
+	change.Status = "applied"
+	change.AppliedAt = &now
+	return tx.Model(change).Updates(map[string]interface{}{"status": change.Status, "applied_at": now}).Error
+}
+
+// clearStorePrices removes the stores' own prices of a product or variant when a chain-wide
+// selling price takes effect, so every store sells at it. What each store's price became is
+// kept in the price history
+func clearStorePrices(tx *gorm.DB, product models.Product, variant *models.ProductVariant, change *models.PriceChange) error {
+	query := tx.Where("product_id = ?", product.ID)
+	if variant != nil {
+		query = query.Where("product_variant_id = ?", variant.ID)
+	} else {
+		query = query.Where("product_variant_id IS NULL")
+	}
+	var prices []models.StorePrice
+	if err := query.Find(&prices).Error; err != nil {
+		return err
+	}
+
+	cost := product.CostPrice
+	if variant != nil && variant.CostPrice > 0 {
+		cost = variant.CostPrice
+	}
+	for _, price := range prices {
+		if err := tx.Delete(&price).Error; err != nil {
+			return err
+		}
+		if err := recordCatalogDeletions(tx, "store_prices", price.ID); err != nil {
+			return err
+		}
+		newPrice, err := storeSellingPrice(tx, price.StoreID, product, variant)
+		if err != nil {
+			return err
+		}
+		storeID := price.StoreID
+		if err := recordPriceHistory(tx, models.PriceHistory{
+			ProductID:        product.ID,
+			ProductVariantID: price.ProductVariantID,
+			StoreID:          &storeID,
+			OldSellingPrice:  price.SellingPrice,
+			NewSellingPrice:  newPrice,
+			OldCostPrice:     cost,
+			NewCostPrice:     cost,
+			Source:           "price_change",
+			PriceChangeID:    &change.ID,
+			CreatedBy:        change.CreatedBy,
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ApplyDuePriceChanges applies the scheduled price changes whose effective date has come, oldest first
+func ApplyDuePriceChanges(db *gorm.DB) error {
+	var due []models.PriceChange
+	if err := db.Select("id").Where("status = ? AND effective_at <= ?", "scheduled", time.Now()).
+		Order("effective_at, id").Find(&due).Error; err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, candidate := range due {
+		tx := db.Begin()
+		var change models.PriceChange
+		// Skip changes that were cancelled or applied since the scan
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ? AND status = ?", candidate.ID, "scheduled").First(&change).Error; err != nil {
+			tx.Rollback()
+			continue
+		}
+		if err := applyPriceChange(tx, &change); err != nil {
+			tx.Rollback()
+			errs = append(errs, fmt.Errorf("price change %d: %w", change.ID, err))
+			continue
+		}
+		if err := tx.Commit().Error; err != nil {
+			errs = append(errs, fmt.Errorf("price change %d: %w", change.ID, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// RunPriceChangeJob periodically applies due price changes; it never returns
+func RunPriceChangeJob(db *gorm.DB, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if err := ApplyDuePriceChanges(db); err != nil {
+			log.Printf("Price change job: %v", err)
+		}
+	}
+}
+
+// validatePriceChange checks the product, variant and store a price change names and its prices
+func (h *PriceChangeHandler) validatePriceChange(req priceChangeRequest) string {
+	if req.SellingPrice == nil && req.CostPrice == nil {
+		return "selling_price or cost_price is required"
+	}
+	if (req.SellingPrice != nil && *req.SellingPrice < 0) || (req.CostPrice != nil && *req.CostPrice < 0) {
+		return "Prices cannot be negative"
+	}
+
+	var product models.Product
+	if err := h.DB.First(&product, req.ProductID).Error; err != nil {
+		return "Product not found"
+	}
+	if req.ProductVariantID != nil {
+		var count int64
+		h.DB.Model(&models.ProductVariant{}).Where("id = ? AND product_id = ?", *req.ProductVariantID, product.ID).Count(&count)
+		if count == 0 {
+			return fmt.Sprintf("%s has no variant %d", product.Name, *req.ProductVariantID)
+		}
+	}
+	if req.StoreID != nil {
+		if req.CostPrice != nil {
+			return "Cost prices apply to all stores; leave store_id empty to change them"
+		}
+		if *req.SellingPrice <= 0 {
+			return "A store price must be greater than zero"
+		}
+		var count int64
+		h.DB.Model(&models.Store{}).Where("id = ?", *req.StoreID).Count(&count)
+		if count == 0 {
+			return "Store not found"
+		}
+	}
+	return ""
+}
+
+// GetPriceChanges lists price changes with optional filters
+func (h *PriceChangeHandler) GetPriceChanges(c *gin.Context) {
+	var changes []models.PriceChange
+	var total int64
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10"))
+	offset := (page - 1) * limit
+
+	query := h.DB.Model(&models.PriceChange{})
+	if productID := c.Query("product_id"); productID != "" {
+		query = query.Where("product_id = ?", productID)
+	}
+	if storeID := c.Query("store_id"); storeID != "" {
+		query = query.Where("store_id = ?", storeID)
+	}
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	query.Count(&total)
+
+	if err := query.Preload("Product").Preload("ProductVariant").Preload("Store").Preload("CreatedByUser").
+		Order("effective_at DESC, id DESC").Limit(limit).Offset(offset).Find(&changes).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": changes,
+		"pagination": gin.H{
+			"current_page": page,
+			"per_page":     limit,
+			"total":        total,
+			"total_pages":  (total + int64(limit) - 1) / int64(limit),
+		},
+	})
+}
+
+// CreatePriceChange schedules a price change; one that is already effective is applied at once
+func (h *PriceChangeHandler) CreatePriceChange(c *gin.Context) {
+	var req priceChangeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if msg := h.validatePriceChange(req); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	change := models.PriceChange{
+		ProductID:        req.ProductID,
+		ProductVariantID: req.ProductVariantID,
+		StoreID:          req.StoreID,
+		SellingPrice:     req.SellingPrice,
+		CostPrice:        req.CostPrice,
+		EffectiveAt:      req.EffectiveAt,
+		Status:           "scheduled",
+		Notes:            req.Notes,
+		CreatedBy:        getUserIDFromContext(c),
+	}
+
+	tx := h.DB.Begin()
+	if err := tx.Create(&change).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !change.EffectiveAt.After(time.Now()) {
+		if err := applyPriceChange(tx, &change); err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	tx.Commit()
+
+	h.DB.Preload("Product").Preload("ProductVariant").Preload("Store").First(&change, change.ID)
+
+	c.JSON(http.StatusCreated, gin.H{"data": change})
+}
+
+// CancelPriceChange cancels a price change that has not been applied yet
+func (h *PriceChangeHandler) CancelPriceChange(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid price change ID"})
+		return
+	}
+
+	tx := h.DB.Begin()
+	var change models.PriceChange
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&change, id).Error; err != nil {
+		tx.Rollback()
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Price change not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if change.Status != "scheduled" {
+		tx.Rollback()
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Price change is already %s", change.Status)})
+		return
+	}
+	if err := tx.Model(&change).Update("status", "cancelled").Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	tx.Commit()
+
+	c.JSON(http.StatusOK, gin.H{"data": change})
+}
+
+// GetProductPriceHistory lists the price changes of a product, newest first. With ?at= it also
+// reports the prices in effect at that time for the product, variant or store asked for
+func (h *PriceChangeHandler) GetProductPriceHistory(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		return
+	}
+
+	var product models.Product
+	if err := h.DB.First(&product, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	offset := (page - 1) * limit
+
+	// scope narrows to the catalog prices of the product or variant, or to one store's prices
+	scope := h.DB.Model(&models.PriceHistory{}).Where("product_id = ?", product.ID)
+	variantID := c.Query("variant_id")
+	if variantID != "" {
+		scope = scope.Where("product_variant_id = ?", variantID)
+	}
+	storeID := c.Query("store_id")
+	if storeID != "" {
+		scope = scope.Where("store_id = ?", storeID)
+	}
+
+	var at *priceAt
+	if param := c.Query("at"); param != "" {
+		moment, err := time.Parse(time.RFC3339, param)
+		if err != nil {
+			day, dayErr := time.ParseInLocation("2006-01-02", param, time.Local)
+			if dayErr != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "at must be YYYY-MM-DD or an RFC 3339 time"})
+				return
+			}
+			moment = day.AddDate(0, 0, 1).Add(-time.Nanosecond)
+		}
+		// Without changes to go by, the prices are today's
+		current := priceAt{At: moment, SellingPrice: product.SellingPrice, CostPrice: product.CostPrice}
+		var variant *models.ProductVariant
+		if variantID == "" {
+			scope = scope.Where("product_variant_id IS NULL")
+		} else {
+			variant = &models.ProductVariant{}
+			if err := h.DB.Where("id = ? AND product_id = ?", variantID, product.ID).First(variant).Error; err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Variant not found for this product"})
+				return
+			}
+			current.SellingPrice, current.CostPrice = variant.SellingPrice, variant.CostPrice
+		}
+		if storeID == "" {
+			scope = scope.Where("store_id IS NULL")
+		} else {
+			store, err := strconv.Atoi(storeID)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid store ID"})
+				return
+			}
+			if current.SellingPrice, err = storeSellingPrice(h.DB, uint(store), product, variant); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+		}
+		if at, err = pricesAt(scope, current); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	query := scope.Session(&gorm.Session{})
+	if from := c.Query("date_from"); from != "" {
+		parsed, err := time.ParseInLocation("2006-01-02", from, time.Local)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "date_from must be YYYY-MM-DD"})
+			return
+		}
+		query = query.Where("created_at >= ?", parsed)
+	}
+	if to := c.Query("date_to"); to != "" {
+		parsed, err := time.ParseInLocation("2006-01-02", to, time.Local)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "date_to must be YYYY-MM-DD"})
+			return
+		}
+		query = query.Where("created_at < ?", parsed.AddDate(0, 0, 1))
+	}
+
+	var total int64
+	query.Count(&total)
+
+	var history []models.PriceHistory
+	if err := query.Preload("ProductVariant").Preload("Store").Preload("CreatedByUser").
+		Order("created_at DESC, id DESC").Limit(limit).Offset(offset).Find(&history).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	response := gin.H{
+		"data": history,
+		"pagination": gin.H{
+			"current_page": page,
+			"per_page":     limit,
+			"total":        total,
+			"total_pages":  (total + int64(limit) - 1) / int64(limit),
+		},
+	}
+	if at != nil {
+		response["price_at"] = at
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// pricesAt reconstructs the prices in effect at a moment from the history: the last change
+// before it, else what the first change after it replaced, else the current prices
+func pricesAt(scope *gorm.DB, current priceAt) (*priceAt, error) {
+	result := current
+
+	var entry models.PriceHistory
+	err := scope.Session(&gorm.Session{}).Where("created_at <= ?", current.At).Order("created_at DESC, id DESC").First(&entry).Error
+	if err == nil {
+		result.SellingPrice, result.CostPrice = entry.NewSellingPrice, entry.NewCostPrice
+		return &result, nil
+	}
+	if err != gorm.ErrRecordNotFound {
+		return nil, err
+	}
+
+	err = scope.Session(&gorm.Session{}).Where("created_at > ?", current.At).Order("created_at, id").First(&entry).Error
+	if err == nil {
+		result.SellingPrice, result.CostPrice = entry.OldSellingPrice, entry.OldCostPrice
+		return &result, nil
+	}
+	if err != gorm.ErrRecordNotFound {
+		return nil, err
+	}
+	return &result, nil
+}
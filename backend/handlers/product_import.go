@@ -0,0 +1,851 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"starter/backend/middleware"
+	"starter/backend/models"
+	"starter/backend/spreadsheet"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// productImportMaxSize is the largest catalog file accepted, in bytes
+const productImportMaxSize = 10 << 20
+
+// productExportColumns are the catalog columns of export files, followed by one
+// stock_<warehouse code> column per warehouse. Import reads the same columns
+var productExportColumns = []string{
+	"sku", "name", "category_code", "barcode", "unit", "description", "cost_price", "selling_price",
+	"min_stock", "max_stock", "track_lots", "is_active",
+	"variant_sku", "variant_name", "variant_barcode", "variant_cost_price", "variant_selling_price",
+}
+
+// productImportColumns are accepted on import besides the export columns: the lot and expiry
+// date that initial stock of lot tracked products is received into
+var productImportColumns = append(append([]string{}, productExportColumns...), "lot_number", "expiry_date")
+
+// productImportError is a problem with one row or cell of an import file. Rows are numbered
+// like the spreadsheet, the header being row 1
+type productImportError struct {
+	Row     int    `json:"row"`
+	Column  string `json:"column,omitempty"`
+	Message string `json:"message"`
+}
+
+type productImportResult struct {
+	DryRun          bool                 `json:"dry_run"`
+	Rows            int                  `json:"rows"`
+	ProductsCreated int                  `json:"products_created"`
+	ProductsUpdated int                  `json:"products_updated"`
+	VariantsCreated int                  `json:"variants_created"`
+	VariantsUpdated int                  `json:"variants_updated"`
+	StockUpdates    int                  `json:"stock_updates"`
+	Errors          []productImportError `json:"errors"`
+}
+
+// importRow is a data row of an import file keyed by column name
+type importRow struct {
+	number int
+	cells  map[string]string
+}
+
+func (r importRow) get(column string) string {
+	return strings.TrimSpace(r.cells[column])
+}
+
+// importProduct is a product the import creates or updates, with the file's values applied.
+// Updates write only the columns in changes, onto the row as it is when the import commits
+type importProduct struct {
+	row      int // Row the product's own columns were read from, 0 while only its variants were seen
+	firstRow int
+	product  models.Product
+	changes  map[string]interface{}
+	exists   bool
+	oldPrice float64
+	oldCost  float64
+	variants []*importVariant
+}
+
+type importVariant struct {
+	row      int
+	variant  models.ProductVariant
+	changes  map[string]interface{}
+	exists   bool
+	oldPrice float64
+	oldCost  float64
+}
+
+// importStock sets the stock of a product or variant in a warehouse
+type importStock struct {
+	row        int
+	column     string
+	product    *importProduct
+	variant    *importVariant
+	warehouse  models.Warehouse
+	quantity   float64
+	lotNumber  string
+	expiryDate string
+}
+
+// productImport validates an import file and keeps what committing it would write
+type productImport struct {
+	db         *gorm.DB
+	header     []string
+	categories map[string]uint
+	warehouses map[string]models.Warehouse // By stock column
+	products   []*importProduct
+	bySKU      map[string]*importProduct
+	variants   map[string]*importVariant
+	barcodes   map[string]string // Barcode to the "row N" that claims it
+	stock      []importStock
+	errors     []productImportError
+}
+
+func (p *productImport) fail(row int, column, format string, args ...interface{}) {
+	p.errors = append(p.errors, productImportError{Row: row, Column: column, Message: fmt.Sprintf(format, args...)})
+}
+
+// parseImportNumber reads a number as typed in a spreadsheet. An Rp prefix and spaces are
+// ignored; with both separators present the dot is taken as the thousands separator
+func parseImportNumber(value string) (float64, error) {
+	value = strings.ReplaceAll(strings.TrimPrefix(strings.TrimSpace(value), "Rp"), " ", "")
+	if strings.Contains(value, ",") {
+		value = strings.ReplaceAll(strings.ReplaceAll(value, ".", ""), ",", ".")
+	}
+	return strconv.ParseFloat(value, 64)
+}
+
+func parseImportBool(value string) (bool, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "1", "true", "yes", "y", "ya", "aktif":
+		return true, nil
+	case "0", "false", "no", "n", "tidak", "nonaktif":
+		return false, nil
+	}
+	return false, fmt.Errorf("must be true or false")
+}
+
+// parseImportDate reads a YYYY-MM-DD date or the day number a spreadsheet stores dates as
+func parseImportDate(value string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+	if serial, err := strconv.ParseFloat(value, 64); err == nil && serial > 0 {
+		return time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC).AddDate(0, 0, int(serial)).Format("2006-01-02"), nil
+	}
+	if _, err := time.Parse("2006-01-02", value); err != nil {
+		return "", fmt.Errorf("must be a date as YYYY-MM-DD")
+	}
+	return value, nil
+}
+
+// readHeader maps the header row to column names, recognising stock_<warehouse code> columns
+func (p *productImport) readHeader(row []string) {
+	known := make(map[string]bool, len(productImportColumns))
+	for _, column := range productImportColumns {
+		known[column] = true
+	}
+
+	var warehouses []models.Warehouse
+	p.db.Find(&warehouses)
+	byCode := make(map[string]models.Warehouse, len(warehouses))
+	for _, warehouse := range warehouses {
+		byCode[strings.ToLower(warehouse.Code)] = warehouse
+	}
+
+	seen := make(map[string]bool)
+	for _, cell := range row {
+		column := strings.ToLower(strings.ReplaceAll(strings.TrimSpace(cell), " ", "_"))
+		p.header = append(p.header, column)
+		switch {
+		case column == "":
+			continue
+		case seen[column]:
+			p.fail(1, column, "Column %s appears more than once", column)
+		case strings.HasPrefix(column, "stock_"):
+			warehouse, ok := byCode[strings.TrimPrefix(column, "stock_")]
+			if !ok {
+				p.fail(1, column, "No warehouse with code %s", strings.TrimPrefix(strings.TrimSpace(cell), "stock_"))
+			} else if warehouse.Status != "active" {
+				p.fail(1, column, "Warehouse %s is not active", warehouse.Code)
+			}
+			p.warehouses[column] = warehouse
+		case !known[column]:
+			p.fail(1, column, "Unknown column %s", strings.TrimSpace(cell))
+		}
+		seen[column] = true
+	}
+	if !seen["sku"] {
+		p.fail(1, "sku", "The sku column is required")
+	}
+}
+
+// number reads an optional non-negative number cell
+func (p *productImport) number(row importRow, column string) (float64, bool) {
+	value := row.get(column)
+	if value == "" {
+		return 0, false
+	}
+	n, err := parseImportNumber(value)
+	if err != nil || n < 0 || math.IsNaN(n) || math.IsInf(n, 0) {
+		p.fail(row.number, column, "%s must be a number of at least 0", value)
+		return 0, false
+	}
+	return n, true
+}
+
+// claimBarcode checks that a barcode is used once in the file and by no other product, variant or pack
+func (p *productImport) claimBarcode(row importRow, column, code, productSKU, variantSKU string) bool {
+	if other, ok := p.barcodes[code]; ok {
+		p.fail(row.number, column, "Barcode %s is also on %s", code, other)
+		return false
+	}
+	p.barcodes[code] = fmt.Sprintf("row %d", row.number)
+
+	var product models.Product
+	if err := p.db.Where("barcode = ?", code).First(&product).Error; err == nil && (variantSKU != "" || product.SKU != productSKU) {
+		p.fail(row.number, column, "Barcode %s already belongs to product %s", code, product.SKU)
+		return false
+	}
+	var variant models.ProductVariant
+	if err := p.db.Where("barcode = ?", code).First(&variant).Error; err == nil && variant.SKU != variantSKU {
+		p.fail(row.number, column, "Barcode %s already belongs to variant %s", code, variant.SKU)
+		return false
+	}
+	var packs int64
+	p.db.Model(&models.ProductUnit{}).Where("barcode = ?", code).Count(&packs)
+	if packs > 0 {
+		p.fail(row.number, column, "Barcode %s already belongs to a pack", code)
+		return false
+	}
+	return true
+}
+
+// productFor finds the product a row belongs to, loading it the first time its SKU is seen
+func (p *productImport) productFor(row importRow, sku string) *importProduct {
+	if item, ok := p.bySKU[sku]; ok {
+		return item
+	}
+	item := &importProduct{firstRow: row.number, changes: make(map[string]interface{})}
+	if err := p.db.Where("sku = ?", sku).First(&item.product).Error; err == nil {
+		item.exists = true
+		item.oldPrice = item.product.SellingPrice
+		item.oldCost = item.product.CostPrice
+	} else {
+		item.product = models.Product{SKU: sku, Unit: "pcs", IsActive: true, IsTrackable: true}
+	}
+	p.bySKU[sku] = item
+	p.products = append(p.products, item)
+	return item
+}
+
+// applyProductColumns copies the product columns of a row that are filled in; blank cells keep the current value
+func (p *productImport) applyProductColumns(row importRow, item *importProduct) {
+	product := &item.product
+	if name := row.get("name"); name != "" {
+		product.Name = name
+		item.changes["name"] = name
+	}
+	if code := row.get("category_code"); code != "" {
+		if id, ok := p.categories[strings.ToLower(code)]; ok {
+			product.CategoryID = &id
+			item.changes["category_id"] = id
+		} else {
+			p.fail(row.number, "category_code", "No category with code %s", code)
+		}
+	}
+	if code := row.get("barcode"); code != "" && code != product.Barcode {
+		if p.claimBarcode(row, "barcode", code, product.SKU, "") {
+			product.Barcode = code
+			item.changes["barcode"] = code
+		}
+	}
+	if unit := row.get("unit"); unit != "" {
+		product.Unit = unit
+		item.changes["unit"] = unit
+	}
+	if description := row.get("description"); description != "" {
+		product.Description = description
+		item.changes["description"] = description
+	}
+	if n, ok := p.number(row, "cost_price"); ok {
+		product.CostPrice = n
+		item.changes["cost_price"] = n
+	}
+	if n, ok := p.number(row, "selling_price"); ok {
+		product.SellingPrice = n
+		item.changes["selling_price"] = n
+	}
+	if n, ok := p.number(row, "min_stock"); ok {
+		product.MinStock = int(n)
+		item.changes["min_stock"] = int(n)
+	}
+	if n, ok := p.number(row, "max_stock"); ok {
+		maxStock := int(n)
+		product.MaxStock = &maxStock
+		item.changes["max_stock"] = maxStock
+	}
+	for column, target := range map[string]*bool{"track_lots": &product.TrackLots, "is_active": &product.IsActive} {
+		if value := row.get(column); value != "" {
+			parsed, err := parseImportBool(value)
+			if err != nil {
+				p.fail(row.number, column, "%s %s", value, err.Error())
+				continue
+			}
+			*target = parsed
+			item.changes[column] = parsed
+		}
+	}
+}
+
+// applyVariantColumns adds or updates the variant named on a row
+func (p *productImport) applyVariantColumns(row importRow, item *importProduct, sku string) *importVariant {
+	if other, ok := p.variants[sku]; ok {
+		p.fail(row.number, "variant_sku", "Variant SKU %s is also on row %d", sku, other.row)
+		return nil
+	}
+
+	variant := &importVariant{row: row.number, changes: make(map[string]interface{})}
+	if err := p.db.Where("sku = ?", sku).First(&variant.variant).Error; err == nil {
+		if !item.exists || variant.variant.ProductID != item.product.ID {
+			p.fail(row.number, "variant_sku", "Variant SKU %s belongs to another product", sku)
+			return nil
+		}
+		variant.exists = true
+		variant.oldPrice = variant.variant.SellingPrice
+		variant.oldCost = variant.variant.CostPrice
+	} else {
+		variant.variant = models.ProductVariant{SKU: sku, IsActive: true}
+	}
+	p.variants[sku] = variant
+	item.variants = append(item.variants, variant)
+
+	if name := row.get("variant_name"); name != "" {
+		variant.variant.Name = name
+		variant.changes["name"] = name
+	} else if !variant.exists {
+		p.fail(row.number, "variant_name", "variant_name is required for new variants")
+	}
+	if code := row.get("variant_barcode"); code != "" && code != variant.variant.Barcode {
+		if p.claimBarcode(row, "variant_barcode", code, item.product.SKU, sku) {
+			variant.variant.Barcode = code
+			variant.changes["barcode"] = code
+		}
+	}
+	if n, ok := p.number(row, "variant_cost_price"); ok {
+		variant.variant.CostPrice = n
+		variant.changes["cost_price"] = n
+	}
+	if n, ok := p.number(row, "variant_selling_price"); ok {
+		variant.variant.SellingPrice = n
+		variant.changes["selling_price"] = n
+	}
+	return variant
+}
+
+// readRow validates a data row and adds it to the plan
+func (p *productImport) readRow(row importRow) {
+	sku := row.get("sku")
+	if sku == "" {
+		p.fail(row.number, "sku", "sku is required")
+		return
+	}
+	item := p.productFor(row, sku)
+
+	variantSKU := row.get("variant_sku")
+	switch {
+	case variantSKU == "" && item.row != 0:
+		p.fail(row.number, "sku", "SKU %s is also on row %d", sku, item.row)
+		return
+	case variantSKU == "":
+		item.row = row.number
+		p.applyProductColumns(row, item)
+	case item.row == 0 && item.firstRow == row.number:
+		// A product listed only through its variants takes its columns from the first one
+		p.applyProductColumns(row, item)
+	}
+
+	var variant *importVariant
+	if variantSKU != "" {
+		if variant = p.applyVariantColumns(row, item, variantSKU); variant == nil {
+			return
+		}
+	}
+
+	expiryDate, err := parseImportDate(row.get("expiry_date"))
+	if err != nil {
+		p.fail(row.number, "expiry_date", "%s", err.Error())
+	}
+	for _, column := range p.header {
+		if !strings.HasPrefix(column, "stock_") {
+			continue
+		}
+		if quantity, ok := p.number(row, column); ok {
+			p.stock = append(p.stock, importStock{
+				row:        row.number,
+				column:     column,
+				product:    item,
+				variant:    variant,
+				warehouse:  p.warehouses[column],
+				quantity:   quantity,
+				lotNumber:  row.get("lot_number"),
+				expiryDate: expiryDate,
+			})
+		}
+	}
+}
+
+// check runs the checks that need the whole file, once every row is read
+func (p *productImport) check() {
+	for _, item := range p.products {
+		if item.product.Name == "" {
+			p.fail(item.firstRow, "name", "name is required for new products")
+		}
+	}
+	for _, stock := range p.stock {
+		product := stock.product.product
+		switch {
+		case product.IsSerialized && stock.quantity > 0:
+			p.fail(stock.row, stock.column, "%s is serialized; receive its stock with serial numbers through a purchase order", product.SKU)
+		case product.TrackLots && stock.quantity > 0 && stock.lotNumber == "":
+			p.fail(stock.row, "lot_number", "%s is tracked by lot; lot_number is required with its stock", product.SKU)
+		}
+	}
+}
+
+// planProductImport reads and validates an import file without writing anything
+func planProductImport(db *gorm.DB, rows [][]string) (*productImport, int) {
+	p := &productImport{
+		db:         db,
+		categories: make(map[string]uint),
+		warehouses: make(map[string]models.Warehouse),
+		bySKU:      make(map[string]*importProduct),
+		variants:   make(map[string]*importVariant),
+		barcodes:   make(map[string]string),
+	}
+	if len(rows) == 0 {
+		p.fail(1, "", "The file is empty")
+		return p, 0
+	}
+
+	p.readHeader(rows[0])
+	if len(p.errors) > 0 {
+		return p, 0
+	}
+
+	var categories []models.Category
+	db.Find(&categories)
+	for _, category := range categories {
+		p.categories[strings.ToLower(category.Code)] = category.ID
+	}
+
+	dataRows := 0
+	for i, cells := range rows[1:] {
+		row := importRow{number: i + 2, cells: make(map[string]string, len(cells))}
+		blank := true
+		for j, cell := range cells {
+			if j < len(p.header) && p.header[j] != "" {
+				row.cells[p.header[j]] = cell
+				if strings.TrimSpace(cell) != "" {
+					blank = false
+				}
+			}
+		}
+		if blank {
+			continue
+		}
+		dataRows++
+		p.readRow(row)
+	}
+	if dataRows == 0 {
+		p.fail(2, "", "The file has no products")
+	}
+	p.check()
+	return p, dataRows
+}
+
+// commit writes the planned products, variants and stock
+func (p *productImport) commit(tx *gorm.DB, userID uint, result *productImportResult) error {
+	for _, item := range p.products {
+		if item.exists {
+			// The row may have changed since the file was checked; only the imported columns are written
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&item.product, item.product.ID).Error; err != nil {
+				return err
+			}
+			item.oldPrice = item.product.SellingPrice
+			item.oldCost = item.product.CostPrice
+			if len(item.changes) > 0 {
+				if err := tx.Model(&item.product).Updates(item.changes).Error; err != nil {
+					return err
+				}
+				if err := tx.First(&item.product, item.product.ID).Error; err != nil {
+					return err
+				}
+			}
+			if err := queuePriceChangeLabels(tx, item.product, item.oldPrice, userID); err != nil {
+				return err
+			}
+			result.ProductsUpdated++
+		} else {
+			if err := tx.Create(&item.product).Error; err != nil {
+				return err
+			}
+			// The column default would turn a false is_active back to true
+			if !item.product.IsActive {
+				if err := tx.Model(&item.product).Update("is_active", false).Error; err != nil {
+					return err
+				}
+			}
+			result.ProductsCreated++
+		}
+		if err := recordPriceHistory(tx, models.PriceHistory{
+			ProductID:       item.product.ID,
+			OldSellingPrice: item.oldPrice,
+			NewSellingPrice: item.product.SellingPrice,
+			OldCostPrice:    item.oldCost,
+			NewCostPrice:    item.product.CostPrice,
+			Source:          "import",
+			CreatedBy:       userID,
+		}); err != nil {
+			return err
+		}
+
+		for _, variant := range item.variants {
+			variant.variant.ProductID = item.product.ID
+			if variant.exists {
+				if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&variant.variant, variant.variant.ID).Error; err != nil {
+					return err
+				}
+				variant.oldPrice = variant.variant.SellingPrice
+				variant.oldCost = variant.variant.CostPrice
+				if len(variant.changes) > 0 {
+					if err := tx.Model(&variant.variant).Updates(variant.changes).Error; err != nil {
+						return err
+					}
+					if err := tx.First(&variant.variant, variant.variant.ID).Error; err != nil {
+						return err
+					}
+				}
+				if err := queueVariantPriceChangeLabel(tx, item.product, variant.variant, variant.oldPrice, userID); err != nil {
+					return err
+				}
+				result.VariantsUpdated++
+			} else {
+				if err := tx.Create(&variant.variant).Error; err != nil {
+					return err
+				}
+				result.VariantsCreated++
+			}
+			variantID := variant.variant.ID
+			if err := recordPriceHistory(tx, models.PriceHistory{
+				ProductID:        item.product.ID,
+				ProductVariantID: &variantID,
+				OldSellingPrice:  variant.oldPrice,
+				NewSellingPrice:  variant.variant.SellingPrice,
+				OldCostPrice:     variant.oldCost,
+				NewCostPrice:     variant.variant.CostPrice,
+				Source:           "import",
+				CreatedBy:        userID,
+			}); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, stock := range p.stock {
+		productID := stock.product.product.ID
+		var variantID *uint
+		if stock.variant != nil {
+			variantID = &stock.variant.variant.ID
+		}
+
+		var inventory models.Inventory
+		where := models.Inventory{ProductID: productID, ProductVariantID: variantID, WarehouseID: stock.warehouse.ID}
+		if err := tx.Where(where).FirstOrCreate(&inventory, where).Error; err != nil {
+			return err
+		}
+		// Sales and transfers may move the stock until the row is locked
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&inventory, inventory.ID).Error; err != nil {
+			return err
+		}
+		adjustment := stock.quantity - inventory.Quantity
+		if adjustment == 0 {
+			continue
+		}
+		inventory.Quantity = stock.quantity
+		inventory.LastUpdated = time.Now()
+		if err := tx.Save(&inventory).Error; err != nil {
+			return err
+		}
+
+		warehouseID := stock.warehouse.ID
+		transaction := models.InventoryTransaction{
+			ProductID:        productID,
+			ProductVariantID: variantID,
+			LocationType:     "warehouse",
+			LocationID:       warehouseID,
+			WarehouseID:      &warehouseID,
+			TransactionType:  "adjustment",
+			Quantity:         adjustment,
+			UnitCost:         stock.product.product.CostPrice,
+			ReferenceType:    "import",
+			Notes:            "Import produk",
+			CreatedBy:        userID,
+		}
+		if err := tx.Create(&transaction).Error; err != nil {
+			return err
+		}
+
+		if err := adjustLots(tx, productID, variantID, warehouseLot(warehouseID), adjustment, inventory.Quantity, stock.lotNumber, stock.expiryDate, models.StockLotMovement{
+			ReferenceType: "import",
+			ReferenceID:   &transaction.ID,
+			Notes:         "Import produk",
+			CreatedBy:     userID,
+		}); err != nil {
+			var saleErr *saleError
+			if errors.As(err, &saleErr) {
+				return fmt.Errorf("row %d: %s", stock.row, saleErr.Message)
+			}
+			return err
+		}
+		result.StockUpdates++
+	}
+	return nil
+}
+
+// ImportProducts creates and updates products from a CSV or XLSX file, upserting by SKU.
+// The default dry run only validates the file; mode=commit writes it when it has no errors
+func (h *ProductHandler) ImportProducts(c *gin.Context) {
+	header, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "file is required"})
+		return
+	}
+	if header.Size > productImportMaxSize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "File is larger than 10 MB"})
+		return
+	}
+	file, err := header.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	data, err := io.ReadAll(file)
+	file.Close()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	rows, err := spreadsheet.Read(data, header.Filename)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var mode string
+	if mode = c.Query("mode"); mode == "" {
+		mode = c.DefaultPostForm("mode", "dry_run")
+	}
+	if mode != "dry_run" && mode != "commit" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "mode must be dry_run or commit"})
+		return
+	}
+
+	plan, dataRows := planProductImport(h.DB, rows)
+	result := productImportResult{DryRun: mode == "dry_run", Rows: dataRows, Errors: plan.errors}
+	if result.Errors == nil {
+		result.Errors = []productImportError{}
+	}
+
+	if mode == "dry_run" {
+		// Count what a commit would do
+		for _, item := range plan.products {
+			if item.exists {
+				result.ProductsUpdated++
+			} else {
+				result.ProductsCreated++
+			}
+			for _, variant := range item.variants {
+				if variant.exists {
+					result.VariantsUpdated++
+				} else {
+					result.VariantsCreated++
+				}
+			}
+		}
+		result.StockUpdates = len(plan.stock)
+		c.JSON(http.StatusOK, gin.H{"data": result})
+		return
+	}
+
+	if len(plan.errors) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "The file has errors; nothing was imported", "errors": plan.errors})
+		return
+	}
+
+	// Updating products and setting stock need the permissions of their own screens
+	userID := getUserIDFromContext(c)
+	var user models.User
+	if err := h.DB.First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions"})
+		return
+	}
+	updates := false
+	for _, item := range plan.products {
+		updates = updates || item.exists
+		for _, variant := range item.variants {
+			updates = updates || variant.exists
+		}
+	}
+	if updates && !middleware.UserHasPermission(&user, "products.update") {
+		c.JSON(http.StatusForbidden, gin.H{"error": "The file updates existing products, which needs the products.update permission"})
+		return
+	}
+	if len(plan.stock) > 0 && !middleware.UserHasPermission(&user, "inventory.update") {
+		c.JSON(http.StatusForbidden, gin.H{"error": "The file sets stock, which needs the inventory.update permission"})
+		return
+	}
+
+	tx := h.DB.Begin()
+	if err := plan.commit(tx, userID, &result); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	tx.Commit()
+
+	c.JSON(http.StatusOK, gin.H{"data": result})
+}
+
+// ExportProducts downloads the catalog as CSV or XLSX in the import layout, with the stock of
+// every warehouse
+func (h *ProductHandler) ExportProducts(c *gin.Context) {
+	format := c.DefaultQuery("format", "csv")
+	if format != "csv" && format != "xlsx" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be csv or xlsx"})
+		return
+	}
+
+	query := h.DB.Preload("Category").Preload("Variants").Order("sku")
+	if categoryID := c.Query("category_id"); categoryID != "" {
+		query = query.Where("category_id = ?", categoryID)
+	}
+	if active := c.Query("is_active"); active != "" {
+		query = query.Where("is_active = ?", active == "true")
+	}
+
+	var products []models.Product
+	if err := query.Find(&products).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var warehouses []models.Warehouse
+	if err := h.DB.Where("status = ?", "active").Order("code").Find(&warehouses).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var inventories []models.Inventory
+	if err := h.DB.Find(&inventories).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	stockKey := func(productID uint, variantID *uint, warehouseID uint) string {
+		if variantID == nil {
+			return fmt.Sprintf("%d/-/%d", productID, warehouseID)
+		}
+		return fmt.Sprintf("%d/%d/%d", productID, *variantID, warehouseID)
+	}
+	stock := make(map[string]float64, len(inventories))
+	for _, inventory := range inventories {
+		stock[stockKey(inventory.ProductID, inventory.ProductVariantID, inventory.WarehouseID)] += inventory.Quantity
+	}
+
+	header := make([]interface{}, 0, len(productExportColumns)+len(warehouses))
+	for _, column := range productExportColumns {
+		header = append(header, column)
+	}
+	for _, warehouse := range warehouses {
+		header = append(header, "stock_"+warehouse.Code)
+	}
+	rows := [][]interface{}{header}
+
+	for _, product := range products {
+		categoryCode := ""
+		if product.Category != nil {
+			categoryCode = product.Category.Code
+		}
+		var maxStock interface{}
+		if product.MaxStock != nil {
+			maxStock = *product.MaxStock
+		}
+		row := []interface{}{
+			product.SKU, product.Name, categoryCode, product.Barcode, product.Unit, product.Description,
+			product.CostPrice, product.SellingPrice, product.MinStock, maxStock,
+			strconv.FormatBool(product.TrackLots), strconv.FormatBool(product.IsActive),
+			nil, nil, nil, nil, nil,
+		}
+		for _, warehouse := range warehouses {
+			row = append(row, stock[stockKey(product.ID, nil, warehouse.ID)])
+		}
+		rows = append(rows, row)
+
+		for _, variant := range product.Variants {
+			variantID := variant.ID
+			// Variant rows repeat only the product SKU
+			row := make([]interface{}, 12, len(header))
+			row[0] = product.SKU
+			row = append(row, variant.SKU, variant.Name, variant.Barcode, variant.CostPrice, variant.SellingPrice)
+			for _, warehouse := range warehouses {
+				row = append(row, stock[stockKey(product.ID, &variantID, warehouse.ID)])
+			}
+			rows = append(rows, row)
+		}
+	}
+
+	filename := "products-" + time.Now().Format("20060102")
+	var buf bytes.Buffer
+	if format == "xlsx" {
+		if err := spreadsheet.WriteXLSX(&buf, "Produk", rows); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s.xlsx", filename))
+		c.Data(http.StatusOK, "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", buf.Bytes())
+		return
+	}
+
+	records := make([][]string, len(rows))
+	for i, row := range rows {
+		records[i] = make([]string, len(row))
+		for j, value := range row {
+			switch v := value.(type) {
+			case string:
+				records[i][j] = v
+			case float64:
+				records[i][j] = strconv.FormatFloat(v, 'f', -1, 64)
+			case int:
+				records[i][j] = strconv.Itoa(v)
+			}
+		}
+	}
+	if err := spreadsheet.WriteCSV(&buf, records); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s.csv", filename))
+	c.Data(http.StatusOK, "text/csv; charset=utf-8", buf.Bytes())
+}
@@ -30,10 +30,11 @@ func (h *ProductHandler) GetProducts(c *gin.Context) {
 
 	offset := (page - 1) * limit
 
-	query := h.DB.Preload("Category").Preload("Variants")
+	query := h.DB.Preload("Category").Preload("Variants").Preload("Units")
 
 	if search != "" {
-		query = query.Where("name LIKE ? OR sku LIKE ? OR barcode LIKE ?", "%"+search+"%", "%"+search+"%", "%"+search+"%")
+		query = query.Where("name LIKE ? OR sku LIKE ? OR barcode LIKE ? OR id IN (SELECT product_id FROM product_units WHERE barcode LIKE ?)",
+			"%"+search+"%", "%"+search+"%", "%"+search+"%", "%"+search+"%")
 	}
 
 	if categoryID != "" {
@@ -69,7 +70,7 @@ func (h *ProductHandler) GetProduct(c *gin.Context) {
 	}
 
 	var product models.Product
-	if err := h.DB.Preload("Category").Preload("Variants").First(&product, id).Error; err != nil {
+	if err := h.DB.Preload("Category").Preload("Variants").Preload("Units").Preload("Components").First(&product, id).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
 			return
@@ -102,13 +103,41 @@ func (h *ProductHandler) CreateProduct(c *gin.Context) {
 		return
 	}
 
-	if err := h.DB.Create(&product).Error; err != nil {
+	// Packs are added through /products/:id/units and kit components through
+	// /products/:id/components once the product exists
+	product.Units = nil
+	product.Components = nil
+	product.IsKit = false
+	if product.Unit == "" {
+		product.Unit = "pcs"
+	}
+	if msg := h.validateDefaultUnits(product, product.PurchaseUnit, product.SaleUnit); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	// The opening prices start the product's price history
+	tx := h.DB.Begin()
+	if err := tx.Create(&product).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if err := recordPriceHistory(tx, models.PriceHistory{
+		ProductID:       product.ID,
+		NewSellingPrice: product.SellingPrice,
+		NewCostPrice:    product.CostPrice,
+		Source:          "manual",
+		CreatedBy:       getUserIDFromContext(c),
+	}); err != nil {
+		tx.Rollback()
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	tx.Commit()
 
 	// Reload with related data
-	h.DB.Preload("Category").Preload("Variants").First(&product, product.ID)
+	h.DB.Preload("Category").Preload("Variants").Preload("Units").First(&product, product.ID)
 
 	c.JSON(http.StatusCreated, gin.H{"data": product})
 }
@@ -146,17 +175,70 @@ func (h *ProductHandler) UpdateProduct(c *gin.Context) {
 		}
 	}
 
-	if err := h.DB.Model(&product).Updates(updateData).Error; err != nil {
+	// A product becomes a kit by setting its components
+	updateData.Units = nil
+	updateData.Components = nil
+	updateData.IsKit = product.IsKit
+	if product.IsKit && (updateData.IsSerialized || updateData.TrackLots || updateData.IsGiftCard) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A kit cannot be serialized, tracked by lot or a gift card"})
+		return
+	}
+	if msg := h.validateDefaultUnits(product, updateData.PurchaseUnit, updateData.SaleUnit); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	old := product
+
+	tx := h.DB.Begin()
+	if err := tx.Model(&product).Updates(updateData).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Shelf labels showing the old price go to the print queue
+	if err := tx.First(&product, product.ID).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if err := queuePriceChangeLabels(tx, product, old.SellingPrice, getUserIDFromContext(c)); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if err := recordPriceHistory(tx, models.PriceHistory{
+		ProductID:       product.ID,
+		OldSellingPrice: old.SellingPrice,
+		NewSellingPrice: product.SellingPrice,
+		OldCostPrice:    old.CostPrice,
+		NewCostPrice:    product.CostPrice,
+		Source:          "manual",
+		CreatedBy:       getUserIDFromContext(c),
+	}); err != nil {
+		tx.Rollback()
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	tx.Commit()
 
 	// Reload with related data
-	h.DB.Preload("Category").Preload("Variants").First(&product, product.ID)
+	h.DB.Preload("Category").Preload("Variants").Preload("Units").First(&product, product.ID)
 
 	c.JSON(http.StatusOK, gin.H{"data": product})
 }
 
+// validateDefaultUnits checks that the purchase and sale units are the base unit or one of the product's packs
+func (h *ProductHandler) validateDefaultUnits(product models.Product, units ...string) string {
+	for _, unit := range units {
+		if _, _, err := resolveProductUnit(h.DB, product, unit); err != nil {
+			return err.Error()
+		}
+	}
+	return ""
+}
+
 // DeleteProduct deletes a product
 func (h *ProductHandler) DeleteProduct(c *gin.Context) {
 	id, err := strconv.Atoi(c.Param("id"))
@@ -183,11 +265,55 @@ func (h *ProductHandler) DeleteProduct(c *gin.Context) {
 		return
 	}
 
-	if err := h.DB.Delete(&product).Error; err != nil {
+	var kitCount int64
+	h.DB.Model(&models.ProductComponent{}).Where("component_product_id = ?", id).Count(&kitCount)
+	if kitCount > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot delete a product that is a component of a kit"})
+		return
+	}
+
+	// Packs, kit components and variants belong to the product and go with it;
+	// offline terminals learn of them all through tombstones
+	var variantIDs, unitIDs, componentIDs []uint
+	h.DB.Model(&models.ProductVariant{}).Where("product_id = ?", id).Pluck("id", &variantIDs)
+	h.DB.Model(&models.ProductUnit{}).Where("product_id = ?", id).Pluck("id", &unitIDs)
+	h.DB.Model(&models.ProductComponent{}).Where("product_id = ?", id).Pluck("id", &componentIDs)
+
+	tx := h.DB.Begin()
+	if err := tx.Where("product_id = ?", id).Delete(&models.ProductUnit{}).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if err := tx.Where("product_id = ?", id).Delete(&models.ProductComponent{}).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := tx.Delete(&product).Error; err != nil {
+		tx.Rollback()
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
+	for _, deletion := range []struct {
+		entity string
+		ids    []uint
+	}{
+		{"products", []uint{product.ID}},
+		{"variants", variantIDs},
+		{"product_units", unitIDs},
+		{"product_components", componentIDs},
+	} {
+		if err := recordCatalogDeletions(tx, deletion.entity, deletion.ids...); err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	tx.Commit()
+
 	c.JSON(http.StatusOK, gin.H{"message": "Product deleted successfully"})
 }
 
@@ -296,6 +422,7 @@ func (h *ProductHandler) UpdateCategory(c *gin.Context) {
 	category.ParentID = updateData.ParentID
 	category.ImageURL = updateData.ImageURL
 	category.Status = updateData.Status
+	category.TaxClassID = updateData.TaxClassID
 
 	if err := h.DB.Save(&category).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
@@ -331,10 +458,18 @@ func (h *ProductHandler) DeleteCategory(c *gin.Context) {
 		return
 	}
 
-	if err := h.DB.Delete(&category).Error; err != nil {
+	tx := h.DB.Begin()
+	if err := tx.Delete(&category).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if err := recordCatalogDeletions(tx, "categories", category.ID); err != nil {
+		tx.Rollback()
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	tx.Commit()
 
 	c.JSON(http.StatusOK, gin.H{"message": "Category deleted successfully"})
 }
@@ -0,0 +1,364 @@
+package handlers
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+
+	"starter/backend/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// appliedDiscount is a discount that took money off a cart
+type appliedDiscount struct {
+	DiscountID uint      `json:"discount_id"`
+	Name       string    `json:"name"`
+	Automatic  bool      `json:"automatic"` // automatic promotions are recorded on SaleItem.DiscountAmount
+	Amount     float64   `json:"amount"`
+	Lines      []float64 `json:"lines"` // amount taken off each cart line
+}
+
+// rejectedDiscount is a discount that was considered for a cart but did not apply
+type rejectedDiscount struct {
+	DiscountID uint   `json:"discount_id"`
+	Name       string `json:"name"`
+	Automatic  bool   `json:"automatic"`
+	Reason     string `json:"reason"`
+}
+
+// discountLineAmounts works out how much a discount takes off each line, based on the
+// line totals. eligible marks the lines the discount may touch
+func discountLineAmounts(discount *models.Discount, items []models.SaleItem, eligible []bool) []float64 {
+	var amounts []float64
+	switch discount.DiscountType {
+	case "buy_x_get_y":
+		amounts = buyXGetYAmounts(discount, items, eligible)
+	case "bundle":
+		amounts = bundleAmounts(discount, items, eligible)
+	case "quantity_break":
+		amounts = quantityBreakAmounts(discount, items, eligible)
+	default:
+		// Percentage and fixed discounts are spread over the lines in proportion to their totals
+		amounts = make([]float64, len(items))
+		var base float64
+		for i, item := range items {
+			if eligible[i] {
+				base += item.TotalPrice
+			}
+		}
+		if base <= 0 {
+			return amounts
+		}
+		total := roundCurrency(math.Min(calculateDiscountAmount(discount, base), base))
+		for i, item := range items {
+			if eligible[i] {
+				amounts[i] = total * item.TotalPrice / base
+			}
+		}
+		return amounts
+	}
+
+	// Promotion amounts are capped by MaxDiscount and never exceed a line's total
+	var total float64
+	for i := range amounts {
+		amounts[i] = math.Min(amounts[i], items[i].TotalPrice)
+		total += amounts[i]
+	}
+	scale := 1.0
+	if discount.MaxDiscount > 0 && total > discount.MaxDiscount {
+		scale = discount.MaxDiscount / total
+	}
+	for i := range amounts {
+		amounts[i] = roundCurrency(amounts[i] * scale)
+	}
+	return amounts
+}
+
+// unitNetPrice is what one unit of a line costs after its own discounts
+func unitNetPrice(item models.SaleItem) float64 {
+	if item.Quantity <= 0 {
+		return 0
+	}
+	return item.TotalPrice / item.Quantity
+}
+
+// buyXGetYAmounts discounts the cheapest GetQuantity units of every BuyQuantity+GetQuantity
+// eligible units by DiscountValue percent (100 makes them free)
+func buyXGetYAmounts(discount *models.Discount, items []models.SaleItem, eligible []bool) []float64 {
+	amounts := make([]float64, len(items))
+	buy, get := int(discount.BuyQuantity), int(discount.GetQuantity)
+	if buy <= 0 || get <= 0 {
+		return amounts
+	}
+	percent := discount.DiscountValue
+	if percent <= 0 || percent > 100 {
+		percent = 100
+	}
+
+	type unit struct {
+		line  int
+		price float64
+	}
+	var units []unit
+	for i, item := range items {
+		if !eligible[i] {
+			continue
+		}
+		for n := 0; n < int(item.Quantity); n++ {
+			units = append(units, unit{line: i, price: unitNetPrice(item)})
+		}
+	}
+
+	// Most expensive first, so each group's cheapest units are the ones given away
+	sort.SliceStable(units, func(a, b int) bool { return units[a].price > units[b].price })
+
+	groupSize := buy + get
+	for start := 0; start+groupSize <= len(units); start += groupSize {
+		for _, u := range units[start+buy : start+groupSize] {
+			amounts[u.line] += u.price * percent / 100
+		}
+	}
+	return amounts
+}
+
+// bundleAmounts sells complete sets of the bundle Items for BundlePrice, spreading the saving
+// over the lines that make up the sets
+func bundleAmounts(discount *models.Discount, items []models.SaleItem, eligible []bool) []float64 {
+	amounts := make([]float64, len(items))
+	if len(discount.Items) == 0 || discount.BundlePrice <= 0 {
+		return amounts
+	}
+
+	available := make(map[uint]float64)
+	for i, item := range items {
+		if eligible[i] {
+			available[item.ProductID] += item.Quantity
+		}
+	}
+
+	sets := math.Inf(1)
+	for _, component := range discount.Items {
+		if component.Quantity <= 0 {
+			return amounts
+		}
+		sets = math.Min(sets, math.Floor(available[component.ProductID]/component.Quantity))
+	}
+	if sets <= 0 || math.IsInf(sets, 1) {
+		return amounts
+	}
+
+	// Take the units of each set from the cart lines in order
+	used := make([]float64, len(items))
+	var setValue float64
+	for _, component := range discount.Items {
+		need := sets * component.Quantity
+		for i, item := range items {
+			if need <= 0 {
+				break
+			}
+			if !eligible[i] || item.ProductID != component.ProductID {
+				continue
+			}
+			take := math.Min(need, item.Quantity-used[i])
+			if take <= 0 {
+				continue
+			}
+			used[i] += take
+			need -= take
+			setValue += take * unitNetPrice(item)
+		}
+	}
+
+	saving := setValue - sets*discount.BundlePrice
+	if saving <= 0 {
+		return amounts
+	}
+	for i, item := range items {
+		if used[i] > 0 {
+			amounts[i] = saving * used[i] * unitNetPrice(item) / setValue
+		}
+	}
+	return amounts
+}
+
+// quantityBreakAmounts prices every eligible unit at the highest tier the eligible quantity reaches
+func quantityBreakAmounts(discount *models.Discount, items []models.SaleItem, eligible []bool) []float64 {
+	amounts := make([]float64, len(items))
+
+	var quantity float64
+	for i, item := range items {
+		if eligible[i] {
+			quantity += item.Quantity
+		}
+	}
+
+	var tier *models.DiscountTier
+	for i := range discount.Tiers {
+		t := &discount.Tiers[i]
+		if t.MinQuantity <= quantity && (tier == nil || t.MinQuantity > tier.MinQuantity) {
+			tier = t
+		}
+	}
+	if tier == nil {
+		return amounts
+	}
+
+	for i, item := range items {
+		if eligible[i] {
+			amounts[i] = math.Max(unitNetPrice(item)-tier.UnitPrice, 0) * item.Quantity
+		}
+	}
+	return amounts
+}
+
+// loadAutomaticPromotions returns the automatic promotions that may apply at a store
+func loadAutomaticPromotions(tx *gorm.DB, storeID uint, now time.Time) ([]models.Discount, error) {
+	var promotions []models.Discount
+	err := tx.Preload("Items").Preload("Tiers").
+		Where("is_automatic = ? AND is_active = ?", true, true).
+		Where("(start_date IS NULL OR start_date <= ?)", now).
+		Where("(end_date IS NULL OR end_date >= ?)", now).
+		Where("store_id IS NULL OR store_id = ?", storeID).
+		Find(&promotions).Error
+	return promotions, err
+}
+
+// sortDiscounts puts discounts in evaluation order: highest priority first, then oldest first
+func sortDiscounts(discounts []models.Discount) {
+	sort.SliceStable(discounts, func(a, b int) bool {
+		if discounts[a].Priority != discounts[b].Priority {
+			return discounts[a].Priority > discounts[b].Priority
+		}
+		return discounts[a].ID < discounts[b].ID
+	})
+}
+
+// applyDiscounts evaluates the automatic promotions and the selected discounts in order.
+// Each discount is worked out on the line totals left by the ones before it. A discount that
+// is not stackable is never combined with another one, and only the first discount of an
+// exclusive group applies. Promotions are recorded on SaleItem.DiscountAmount; selected
+// discounts are returned per line so tax can be charged on what is actually paid.
+// Discounts that do not apply end up in quote.Rejected with the reason.
+// Must run inside the sale transaction: it locks the discounts that have usage limits
+func applyDiscounts(tx *gorm.DB, req saleQuoteRequest, quote *saleQuote, categories map[uint]*uint, now time.Time) ([]float64, error) {
+	candidates, err := loadAutomaticPromotions(tx, req.StoreID, now)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, id := range req.DiscountIDs {
+		var discount models.Discount
+		if err := tx.Preload("Items").Preload("Tiers").First(&discount, id).Error; err != nil {
+			return nil, newSaleError(http.StatusBadRequest, "discount_unavailable", fmt.Sprintf("Invalid discount ID %d", id))
+		}
+		if discount.IsAutomatic {
+			return nil, newSaleError(http.StatusBadRequest, "discount_unavailable",
+				fmt.Sprintf("%s is an automatic promotion and is applied without being selected", discount.Name))
+		}
+		candidates = append(candidates, discount)
+	}
+	sortDiscounts(candidates)
+
+	// Gift cards are money, not merchandise: they do not count towards a minimum purchase
+	var subtotal float64
+	for i, item := range quote.Items {
+		if quote.GiftCards[i] {
+			continue
+		}
+		subtotal += item.TotalPrice
+	}
+	subtotal = roundCurrency(subtotal)
+
+	lineDiscounts := make([]float64, len(quote.Items))
+	usedGroups := make(map[string]string)
+	var blockedBy string // name of an applied discount that is not stackable
+
+	for _, discount := range candidates {
+		// Serialize sales racing for the last uses of a limited discount
+		if discount.UsageLimit > 0 || discount.UsagePerCustomer > 0 {
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&discount, discount.ID).Error; err != nil {
+				return nil, err
+			}
+		}
+
+		reason := ""
+		check := discountCheck{StoreID: req.StoreID, CustomerID: req.CustomerID, Amount: &subtotal}
+		if err := checkDiscountRules(tx, &discount, check, now); err != nil {
+			reason = err.Error()
+		} else if blockedBy != "" {
+			reason = fmt.Sprintf("Cannot be combined with %s", blockedBy)
+		} else if other, ok := usedGroups[discount.ExclusiveGroup]; ok && discount.ExclusiveGroup != "" {
+			reason = fmt.Sprintf("%s already applies from exclusive group %s", other, discount.ExclusiveGroup)
+		} else if !discount.Stackable && len(quote.Applied) > 0 {
+			reason = "Cannot be combined with other discounts"
+		}
+
+		var lines []float64
+		var amount float64
+		if reason == "" {
+			eligible := discountableLines(&discount, quote.Items, categories)
+			remaining := make([]models.SaleItem, len(quote.Items))
+			for i, item := range quote.Items {
+				if quote.GiftCards[i] {
+					eligible[i] = false
+				}
+				item.TotalPrice -= lineDiscounts[i]
+				remaining[i] = item
+			}
+			lines = discountLineAmounts(&discount, remaining, eligible)
+			for _, line := range lines {
+				amount += line
+			}
+			if roundCurrency(amount) <= 0 {
+				reason = "Discount does not apply to any item in the cart"
+			}
+		}
+
+		if reason != "" {
+			quote.Rejected = append(quote.Rejected, rejectedDiscount{
+				DiscountID: discount.ID, Name: discount.Name, Automatic: discount.IsAutomatic, Reason: reason,
+			})
+			continue
+		}
+
+		for i, line := range lines {
+			if line <= 0 {
+				continue
+			}
+			if !discount.IsAutomatic {
+				lineDiscounts[i] += line
+				continue
+			}
+			line = roundCurrency(line)
+			lines[i] = line
+			item := &quote.Items[i]
+			item.DiscountAmount = roundCurrency(item.DiscountAmount + line)
+			item.PromotionAmount = roundCurrency(item.PromotionAmount + line)
+			item.TotalPrice = roundCurrency(item.TotalPrice - line)
+		}
+
+		applied := appliedDiscount{DiscountID: discount.ID, Name: discount.Name, Automatic: discount.IsAutomatic, Lines: lines}
+		for _, line := range lines {
+			applied.Amount += line
+		}
+		applied.Amount = roundCurrency(applied.Amount)
+		if !discount.IsAutomatic {
+			quote.CodeDiscount += applied.Amount
+		}
+		quote.Applied = append(quote.Applied, applied)
+
+		if discount.ExclusiveGroup != "" {
+			usedGroups[discount.ExclusiveGroup] = discount.Name
+		}
+		if !discount.Stackable {
+			blockedBy = discount.Name
+		}
+	}
+	quote.CodeDiscount = roundCurrency(quote.CodeDiscount)
+
+	return lineDiscounts, nil
+}
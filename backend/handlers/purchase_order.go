@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
@@ -19,6 +20,7 @@ type PurchaseOrderHandler struct {
 type PurchaseOrderItemCreate struct {
 	ProductID        uint    `json:"product_id" binding:"required"`
 	ProductVariantID *uint   `json:"product_variant_id"`
+	Unit             string  `json:"unit"` // Unit quantity and cost are in, e.g. dus; empty for the base unit
 	QuantityOrdered  float64 `json:"quantity_ordered" binding:"required,gt=0"`
 	UnitCost         float64 `json:"unit_cost" binding:"required,gte=0"`
 }
@@ -76,9 +78,6 @@ func (h *PurchaseOrderHandler) CreatePurchaseOrder(c *gin.Context) {
 		userID = uint(1) // fallback
 	}
 
-	// Generate purchase number
-	purchaseNumber := fmt.Sprintf("PO-%d-%d", time.Now().Unix(), req.WarehouseID)
-
 	// Parse expected date
 	var expectedDate *time.Time
 	if req.ExpectedDate != nil && *req.ExpectedDate != "" {
@@ -90,6 +89,14 @@ func (h *PurchaseOrderHandler) CreatePurchaseOrder(c *gin.Context) {
 	// Start transaction
 	tx := h.DB.Begin()
 
+	// Generate purchase number from the warehouse's sequence
+	purchaseNumber, err := nextDocumentNumber(tx, DocumentTypePurchaseOrder, documentLocation{Type: "warehouse", ID: req.WarehouseID}, time.Now())
+	if err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
 	// Create purchase order
 	po := models.PurchaseOrder{
 		PurchaseNumber:  purchaseNumber,
@@ -113,10 +120,34 @@ func (h *PurchaseOrderHandler) CreatePurchaseOrder(c *gin.Context) {
 	// Create purchase order items and calculate total
 	var totalAmount float64
 	for _, itemReq := range req.Items {
+		var product models.Product
+		if err := tx.Select("id", "name", "unit").First(&product, itemReq.ProductID).Error; err != nil {
+			tx.Rollback()
+			if err == gorm.ErrRecordNotFound {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Product ID %d not found", itemReq.ProductID)})
+			} else {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			}
+			return
+		}
+		unit, factor, err := resolveProductUnit(tx, product, itemReq.Unit)
+		if err != nil {
+			tx.Rollback()
+			var saleErr *saleError
+			if errors.As(err, &saleErr) {
+				c.JSON(saleErr.Status, gin.H{"error": saleErr.Message, "code": saleErr.Code})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
 		item := models.PurchaseOrderItem{
 			PurchaseOrderID:  po.ID,
 			ProductID:        itemReq.ProductID,
 			ProductVariantID: itemReq.ProductVariantID,
+			Unit:             unit,
+			ConversionFactor: factor,
 			QuantityOrdered:  itemReq.QuantityOrdered,
 			UnitCost:         itemReq.UnitCost,
 			TotalCost:        itemReq.QuantityOrdered * itemReq.UnitCost,
@@ -161,8 +192,11 @@ func (h *PurchaseOrderHandler) ReceivePurchaseOrder(c *gin.Context) {
 
 	var req struct {
 		Items []struct {
-			ItemID           uint    `json:"item_id" binding:"required"`
-			QuantityReceived float64 `json:"quantity_received" binding:"required,gt=0"`
+			ItemID           uint     `json:"item_id" binding:"required"`
+			QuantityReceived float64  `json:"quantity_received" binding:"required,gt=0"` // In the unit the line was ordered in
+			LotNumber        string   `json:"lot_number"`                                // Defaults to the purchase number when an expiry date is given
+			ExpiryDate       string   `json:"expiry_date"`                               // YYYY-MM-DD, required for lot tracked products
+			SerialNumbers    []string `json:"serial_numbers"`                            // One per unit received, required for serialized products
 		} `json:"items" binding:"required,dive"`
 	}
 
@@ -225,6 +259,14 @@ func (h *PurchaseOrderHandler) ReceivePurchaseOrder(c *gin.Context) {
 			return
 		}
 
+		// Stock is kept in the base unit; the line may have been ordered by the pack
+		factor := poItem.ConversionFactor
+		if factor <= 0 {
+			factor = 1
+		}
+		baseQuantity := itemReq.QuantityReceived * factor
+		baseUnitCost := poItem.UnitCost / factor
+
 		// Update warehouse inventory
 		var inventory models.Inventory
 		where := models.Inventory{ProductID: poItem.ProductID, WarehouseID: po.WarehouseID}
@@ -238,7 +280,7 @@ func (h *PurchaseOrderHandler) ReceivePurchaseOrder(c *gin.Context) {
 			return
 		}
 
-		inventory.Quantity += itemReq.QuantityReceived
+		inventory.Quantity += baseQuantity
 		if err := tx.Save(&inventory).Error; err != nil {
 			tx.Rollback()
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
@@ -253,8 +295,8 @@ func (h *PurchaseOrderHandler) ReceivePurchaseOrder(c *gin.Context) {
 			LocationID:       po.WarehouseID,
 			WarehouseID:      &po.WarehouseID,
 			TransactionType:  "in",
-			Quantity:         itemReq.QuantityReceived,
-			UnitCost:         poItem.UnitCost,
+			Quantity:         baseQuantity,
+			UnitCost:         baseUnitCost,
 			ReferenceType:    "purchase",
 			ReferenceID:      &po.ID,
 			Notes:            fmt.Sprintf("Received from PO: %s", po.PurchaseNumber),
@@ -266,6 +308,75 @@ func (h *PurchaseOrderHandler) ReceivePurchaseOrder(c *gin.Context) {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
+
+		// Receive the goods into their lot
+		expiryDate, err := parseExpiryDate(itemReq.ExpiryDate)
+		if err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		var product models.Product
+		if err := tx.Select("id", "name", "track_lots", "is_serialized").First(&product, poItem.ProductID).Error; err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if product.TrackLots && expiryDate == nil {
+			tx.Rollback()
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Expiry date is required for %s", product.Name)})
+			return
+		}
+		if itemReq.LotNumber == "" && (product.TrackLots || expiryDate != nil) {
+			itemReq.LotNumber = po.PurchaseNumber
+		}
+		if itemReq.LotNumber != "" {
+			if _, err := receiveLot(tx, models.StockLot{
+				ProductID:        poItem.ProductID,
+				ProductVariantID: poItem.ProductVariantID,
+				LotNumber:        itemReq.LotNumber,
+				ExpiryDate:       expiryDate,
+				ReceivedDate:     time.Now(),
+				UnitCost:         baseUnitCost,
+				PurchaseOrderID:  &po.ID,
+			}, warehouseLot(po.WarehouseID), baseQuantity, models.StockLotMovement{
+				ReferenceType: "purchase",
+				ReferenceID:   &po.ID,
+				Notes:         fmt.Sprintf("Received from PO: %s", po.PurchaseNumber),
+				CreatedBy:     userID.(uint),
+			}); err != nil {
+				tx.Rollback()
+				var saleErr *saleError
+				if errors.As(err, &saleErr) {
+					c.JSON(saleErr.Status, gin.H{"error": saleErr.Message, "code": saleErr.Code})
+					return
+				}
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+		}
+
+		// Register the units of serialized products
+		serials := cleanSerialNumbers(itemReq.SerialNumbers)
+		err = checkSerialCount(product, serials, baseQuantity)
+		if err == nil {
+			err = receiveSerials(tx, product, poItem.ProductVariantID, serials, warehouseLot(po.WarehouseID), baseUnitCost, &po.ID, models.SerialNumberEvent{
+				ReferenceType:   "purchase",
+				ReferenceID:     &po.ID,
+				ReferenceNumber: po.PurchaseNumber,
+				CreatedBy:       userID.(uint),
+			})
+		}
+		if err != nil {
+			tx.Rollback()
+			var saleErr *saleError
+			if errors.As(err, &saleErr) {
+				c.JSON(saleErr.Status, gin.H{"error": saleErr.Message, "code": saleErr.Code})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
 	}
 
 	// Reload items to check received quantities
@@ -0,0 +1,511 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"starter/backend/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// receiptColumns is the characters per line of the printer font for each paper width (mm)
+var receiptColumns = map[int]int{58: 32, 80: 48}
+
+var paymentMethodLabels = map[string]string{
+	"cash":           "Tunai",
+	"card":           "Kartu",
+	"digital_wallet": "E-Wallet",
+	"credit":         "Kredit",
+	"gift_card":      "Kartu Hadiah",
+	"store_credit":   "Kredit Toko",
+	"multiple":       "Multiple",
+}
+
+// receiptSettings are the receipt options read from Store.Settings
+type receiptSettings struct {
+	Header     []string
+	Footer     []string
+	PaperWidth int
+}
+
+// receiptRow is one printed line, already padded to the paper width
+type receiptRow struct {
+	Text  string
+	Bold  bool
+	Large bool // Double height
+}
+
+// receiptBuilder lays out receipt content for a fixed number of columns
+type receiptBuilder struct {
+	cols int
+	rows []receiptRow
+}
+
+// GetSaleReceipt renders a sale receipt as text, ESC/POS, HTML or PDF
+func (h *SalesHandler) GetSaleReceipt(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid sale ID"})
+		return
+	}
+
+	var sale models.Sale
+	if err := h.DB.Preload("Store").Preload("Customer").Preload("Cashier").
+		Preload("Items").Preload("Items.Product").Preload("Items.ProductVariant").
+		Preload("Payments").First(&sale, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Sale not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	settings := parseReceiptSettings(h.DB, sale.Store)
+	if widthParam := strings.TrimSuffix(c.Query("width"), "mm"); widthParam != "" {
+		width, _ := strconv.Atoi(widthParam)
+		settings.PaperWidth = width
+	}
+	cols, ok := receiptColumns[settings.PaperWidth]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "width must be 58 or 80"})
+		return
+	}
+
+	rows := buildSaleReceipt(sale, settings, cols)
+
+	switch format := c.DefaultQuery("format", "text"); format {
+	case "text":
+		c.Data(http.StatusOK, "text/plain; charset=utf-8", []byte(renderReceiptText(rows)))
+	case "html":
+		c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(renderReceiptHTML(rows, sale.SaleNumber, settings.PaperWidth)))
+	case "escpos":
+		// The drawer only needs to open when cash changed hands, unless asked explicitly
+		kick := false
+		for _, payment := range sale.Payments {
+			if payment.PaymentMethod == "cash" {
+				kick = true
+			}
+		}
+		if drawer := c.Query("drawer"); drawer != "" {
+			kick, _ = strconv.ParseBool(drawer)
+		}
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s.bin", sale.SaleNumber))
+		c.Data(http.StatusOK, "application/octet-stream", renderReceiptESCPOS(rows, kick))
+	case "pdf":
+		c.Header("Content-Disposition", fmt.Sprintf("inline; filename=%s.pdf", sale.SaleNumber))
+		c.Data(http.StatusOK, "application/pdf", renderReceiptPDF(rows, settings.PaperWidth, cols))
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be escpos, text, pdf or html"})
+	}
+}
+
+// parseReceiptSettings reads receipt_header, receipt_footer and receipt_paper_width from the store settings,
+// falling back to the global receipt settings
+func parseReceiptSettings(db *gorm.DB, store *models.Store) receiptSettings {
+	settings := receiptSettings{
+		PaperWidth: 80,
+		Footer:     []string{"Terima Kasih", "Atas Kunjungan Anda"},
+	}
+	if footer := getSettingString(db, "receipt_footer", ""); footer != "" {
+		settings.Footer = strings.Split(footer, "\n")
+	}
+
+	if store != nil && store.Address != "" {
+		settings.Header = append(settings.Header, store.Address)
+	}
+	if store != nil && store.Phone != "" {
+		settings.Header = append(settings.Header, "Tel: "+store.Phone)
+	}
+	if header := getSettingString(db, "receipt_header", ""); header != "" {
+		settings.Header = append(settings.Header, strings.Split(header, "\n")...)
+	}
+	if store == nil {
+		return settings
+	}
+
+	var raw map[string]json.RawMessage
+	if len(store.Settings) == 0 || json.Unmarshal(store.Settings, &raw) != nil {
+		return settings
+	}
+
+	if lines := receiptSettingLines(raw["receipt_header"]); lines != nil {
+		settings.Header = lines
+	}
+	if lines := receiptSettingLines(raw["receipt_footer"]); lines != nil {
+		settings.Footer = lines
+	}
+	if width, ok := raw["receipt_paper_width"]; ok {
+		var number float64
+		var text string
+		if json.Unmarshal(width, &number) == nil {
+			settings.PaperWidth = int(number)
+		} else if json.Unmarshal(width, &text) == nil {
+			settings.PaperWidth, _ = strconv.Atoi(strings.TrimSuffix(strings.TrimSpace(text), "mm"))
+		}
+	}
+
+	return settings
+}
+
+// receiptSettingLines accepts either a newline separated string or an array of strings
+func receiptSettingLines(raw json.RawMessage) []string {
+	if len(raw) == 0 {
+		return nil
+	}
+	var lines []string
+	if json.Unmarshal(raw, &lines) == nil {
+		return lines
+	}
+	var text string
+	if json.Unmarshal(raw, &text) == nil && text != "" {
+		return strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	}
+	return nil
+}
+
+// buildSaleReceipt lays out the receipt content, mirroring the POS ReceiptPrintDialog
+func buildSaleReceipt(sale models.Sale, settings receiptSettings, cols int) []receiptRow {
+	b := &receiptBuilder{cols: cols}
+
+	storeName := "TOKO"
+	if sale.Store != nil {
+		storeName = sale.Store.Name
+	}
+	b.center(storeName, true, true)
+	for _, line := range settings.Header {
+		b.center(line, false, false)
+	}
+	b.rule('-')
+
+	if sale.SaleStatus == "cancelled" {
+		b.center("*** VOID ***", true, true)
+	}
+
+	b.pair("No:", sale.SaleNumber, false)
+	b.pair("Tanggal:", sale.SaleDate.Format("02/01/2006 15:04"), false)
+	cashier := "-"
+	if sale.Cashier != nil {
+		cashier = sale.Cashier.FullName
+		if cashier == "" {
+			cashier = sale.Cashier.Username
+		}
+	}
+	b.pair("Kasir:", cashier, false)
+	if sale.Customer != nil {
+		b.pair("Pelanggan:", sale.Customer.Name, false)
+	}
+	b.rule('-')
+
+	for i, item := range sale.Items {
+		name := fmt.Sprintf("Item %d", i+1)
+		if item.Product != nil {
+			name = item.Product.Name
+		}
+		if item.ProductVariant != nil {
+			name += " - " + item.ProductVariant.Name
+		}
+		b.text(name, false)
+		qty := strconv.FormatFloat(item.Quantity, 'f', -1, 64)
+		price := item.UnitPrice
+		if item.Unit != "" && item.UnitQuantity > 0 {
+			// Packs are printed as packs at the pack price
+			qty = strconv.FormatFloat(item.UnitQuantity, 'f', -1, 64) + " " + item.Unit
+			price = item.UnitPrice * item.Quantity / item.UnitQuantity
+		}
+		b.pair(fmt.Sprintf("  %s x %s", qty, formatRupiah(price)), formatRupiah(item.UnitPrice*item.Quantity), false)
+		if item.DiscountAmount > 0 {
+			b.pair("  Diskon", "-"+formatRupiah(item.DiscountAmount), false)
+		}
+		if item.GiftCardCode != "" {
+			b.text("  Kode: "+item.GiftCardCode, false)
+		}
+	}
+	b.rule('-')
+
+	b.pair("Subtotal", formatRupiah(sale.Subtotal), false)
+	if sale.TaxAmount > 0 {
+		label := "Pajak"
+		if sale.PricesIncludeTax {
+			label = "Pajak (termasuk)"
+		}
+		b.pair(label, formatRupiah(sale.TaxAmount), false)
+	}
+	if sale.DiscountAmount > 0 {
+		b.pair("Diskon", "-"+formatRupiah(sale.DiscountAmount), false)
+	}
+	b.rule('=')
+	b.pairLarge("TOTAL", formatRupiah(sale.TotalAmount))
+	b.rule('=')
+
+	for _, payment := range sale.Payments {
+		label := paymentMethodLabels[payment.PaymentMethod]
+		if label == "" {
+			label = payment.PaymentMethod
+		}
+		b.pair(label, formatRupiah(payment.Amount), false)
+		if payment.ReferenceNumber != "" {
+			b.text("Ref: "+payment.ReferenceNumber, false)
+		}
+	}
+	b.pair("Dibayar", formatRupiah(sale.PaidAmount), false)
+	b.pair("Kembalian", formatRupiah(sale.ChangeAmount), true)
+	if sale.CreditAmount > 0 {
+		b.pair("Sisa Tagihan", formatRupiah(sale.BalanceDue), true)
+	}
+
+	if sale.Notes != "" {
+		b.rule('-')
+		b.text("Catatan:", true)
+		b.text(sale.Notes, false)
+	}
+
+	if len(settings.Footer) > 0 {
+		b.rule('-')
+		for _, line := range settings.Footer {
+			b.center(line, false, false)
+		}
+	}
+
+	return b.rows
+}
+
+func (b *receiptBuilder) add(text string, bold, large bool) {
+	b.rows = append(b.rows, receiptRow{Text: text, Bold: bold, Large: large})
+}
+
+// text adds left aligned text, wrapped to the paper width
+func (b *receiptBuilder) text(text string, bold bool) {
+	for _, line := range wrapReceiptText(text, b.cols) {
+		b.add(line, bold, false)
+	}
+}
+
+// center adds centered text, wrapped to the paper width
+func (b *receiptBuilder) center(text string, bold, large bool) {
+	for _, line := range wrapReceiptText(text, b.cols) {
+		pad := (b.cols - receiptWidth(line)) / 2
+		b.add(strings.Repeat(" ", pad)+line, bold, large)
+	}
+}
+
+// pair adds a label on the left and a value on the right of the same line
+func (b *receiptBuilder) pair(left, right string, bold bool) {
+	gap := b.cols - receiptWidth(left) - receiptWidth(right)
+	if gap < 1 {
+		b.text(left, bold)
+		b.add(strings.Repeat(" ", max(b.cols-receiptWidth(right), 0))+right, bold, false)
+		return
+	}
+	b.add(left+strings.Repeat(" ", gap)+right, bold, false)
+}
+
+func (b *receiptBuilder) pairLarge(left, right string) {
+	b.pair(left, right, true)
+	b.rows[len(b.rows)-1].Large = true
+}
+
+func (b *receiptBuilder) rule(char rune) {
+	b.add(strings.Repeat(string(char), b.cols), false, false)
+}
+
+// wrapReceiptText breaks text on spaces so no line exceeds cols characters
+func wrapReceiptText(text string, cols int) []string {
+	var lines []string
+	for _, paragraph := range strings.Split(text, "\n") {
+		line := ""
+		for _, word := range strings.Fields(paragraph) {
+			for receiptWidth(word) > cols {
+				runes := []rune(word)
+				if line != "" {
+					lines = append(lines, line)
+					line = ""
+				}
+				lines = append(lines, string(runes[:cols]))
+				word = string(runes[cols:])
+			}
+			switch {
+			case line == "":
+				line = word
+			case receiptWidth(line)+1+receiptWidth(word) <= cols:
+				line += " " + word
+			default:
+				lines = append(lines, line)
+				line = word
+			}
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func receiptWidth(text string) int {
+	return len([]rune(text))
+}
+
+// formatRupiah formats an amount like the POS: Rp 12.500
+func formatRupiah(amount float64) string {
+	sign := ""
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+	digits := strconv.FormatFloat(amount, 'f', 0, 64)
+	var out []byte
+	for i := range digits {
+		if i > 0 && (len(digits)-i)%3 == 0 {
+			out = append(out, '.')
+		}
+		out = append(out, digits[i])
+	}
+	return sign + "Rp " + string(out)
+}
+
+// receiptASCII replaces characters thermal printers and the PDF base fonts cannot print
+func receiptASCII(text string) string {
+	var b strings.Builder
+	for _, r := range text {
+		if r < 32 || r > 126 {
+			r = '?'
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func renderReceiptText(rows []receiptRow) string {
+	var b strings.Builder
+	for _, row := range rows {
+		b.WriteString(strings.TrimRight(row.Text, " "))
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+func renderReceiptHTML(rows []receiptRow, title string, paperWidth int) string {
+	var b strings.Builder
+	b.WriteString("<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n")
+	fmt.Fprintf(&b, "<title>Struk - %s</title>\n", html.EscapeString(title))
+	fmt.Fprintf(&b, "<style>@page { size: %dmm auto; margin: 0; } body { margin: 0; } "+
+		".receipt { width: %dmm; padding: 2mm; font-family: 'Courier New', Courier, monospace; font-size: 12px; white-space: pre; } "+
+		".bold { font-weight: bold; } .large { font-size: 16px; }</style>\n", paperWidth, paperWidth)
+	b.WriteString("</head>\n<body>\n<div class=\"receipt\">")
+	for _, row := range rows {
+		var classes []string
+		if row.Bold {
+			classes = append(classes, "bold")
+		}
+		if row.Large {
+			classes = append(classes, "large")
+		}
+		text := html.EscapeString(strings.TrimRight(row.Text, " "))
+		if len(classes) > 0 {
+			fmt.Fprintf(&b, "<div class=\"%s\">%s</div>", strings.Join(classes, " "), text)
+		} else {
+			fmt.Fprintf(&b, "<div>%s</div>", text)
+		}
+	}
+	b.WriteString("</div>\n</body>\n</html>\n")
+	return b.String()
+}
+
+// renderReceiptESCPOS produces raw printer commands, ending with a feed and partial cut
+func renderReceiptESCPOS(rows []receiptRow, kickDrawer bool) []byte {
+	var b bytes.Buffer
+	b.Write([]byte{0x1B, 0x40}) // ESC @: initialize
+
+	for _, row := range rows {
+		if row.Bold {
+			b.Write([]byte{0x1B, 0x45, 0x01}) // ESC E 1: bold on
+		}
+		if row.Large {
+			b.Write([]byte{0x1D, 0x21, 0x01}) // GS ! 1: double height
+		}
+		b.WriteString(receiptASCII(strings.TrimRight(row.Text, " ")))
+		b.WriteByte('\n')
+		if row.Large {
+			b.Write([]byte{0x1D, 0x21, 0x00})
+		}
+		if row.Bold {
+			b.Write([]byte{0x1B, 0x45, 0x00})
+		}
+	}
+
+	if kickDrawer {
+		b.Write([]byte{0x1B, 0x70, 0x00, 0x19, 0xFA}) // ESC p 0: pulse drawer pin 2
+	}
+	b.Write([]byte{0x1B, 0x64, 0x04})       // ESC d 4: feed 4 lines past the cutter
+	b.Write([]byte{0x1D, 0x56, 0x42, 0x00}) // GS V B: partial cut
+	return b.Bytes()
+}
+
+// renderReceiptPDF writes a single page PDF sized to the paper roll, using the built-in Courier fonts
+func renderReceiptPDF(rows []receiptRow, paperWidth, cols int) []byte {
+	const mmToPt = 72 / 25.4
+	const margin = 8.0
+
+	pageWidth := float64(paperWidth) * mmToPt
+	// Courier glyphs are 0.6em wide
+	fontSize := (pageWidth - 2*margin) / (float64(cols) * 0.6)
+	leading := fontSize * 1.3
+
+	// Large rows get a little extra space above them
+	rowHeight := func(row receiptRow) float64 {
+		if row.Large {
+			return leading * 1.3
+		}
+		return leading
+	}
+
+	pageHeight := 3 * margin
+	for _, row := range rows {
+		pageHeight += rowHeight(row)
+	}
+
+	var stream bytes.Buffer
+	y := pageHeight - margin
+	for _, row := range rows {
+		y -= rowHeight(row)
+		font, size, scale := "F1", fontSize, 100.0
+		if row.Bold {
+			font = "F2"
+		}
+		// Taller glyphs squeezed back to the normal width, like ESC/POS double height
+		if row.Large {
+			size, scale = fontSize*1.2, 100/1.2
+		}
+		text := strings.NewReplacer(`\`, `\\`, "(", `\(`, ")", `\)`).Replace(receiptASCII(strings.TrimRight(row.Text, " ")))
+		fmt.Fprintf(&stream, "BT /%s %.2f Tf %.2f Tz %.2f %.2f Td (%s) Tj ET\n", font, size, scale, margin, y, text)
+	}
+
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.2f %.2f] /Resources << /Font << /F1 4 0 R /F2 5 0 R >> >> /Contents 6 0 R >>", pageWidth, pageHeight),
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Courier >>",
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Courier-Bold >>",
+		fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", stream.Len(), stream.String()),
+	}
+
+	var pdf bytes.Buffer
+	pdf.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, object := range objects {
+		offsets[i] = pdf.Len()
+		fmt.Fprintf(&pdf, "%d 0 obj\n%s\nendobj\n", i+1, object)
+	}
+	xref := pdf.Len()
+	fmt.Fprintf(&pdf, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&pdf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&pdf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return pdf.Bytes()
+}
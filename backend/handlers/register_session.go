@@ -0,0 +1,642 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"starter/backend/middleware"
+	"starter/backend/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type RegisterSessionHandler struct {
+	DB *gorm.DB
+}
+
+// Denomination is one line of a cash count, e.g. 3 x Rp 100.000
+type Denomination struct {
+	Value float64 `json:"value" binding:"required,gt=0"`
+	Count int     `json:"count" binding:"gte=0"`
+}
+
+// PaymentMethodSummary is the per payment method section of an X/Z report
+type PaymentMethodSummary struct {
+	PaymentMethod   string   `json:"payment_method"`
+	Sales           float64  `json:"sales"`
+	AccountPayments float64  `json:"account_payments"` // Received against customer accounts
+	Refunds         float64  `json:"refunds"`
+	Expected        float64  `json:"expected"`
+	Counted         *float64 `json:"counted,omitempty"`
+	Difference      *float64 `json:"difference,omitempty"`
+}
+
+// RegisterReport is an X (mid-shift) or Z (end-of-day) report for a register session
+type RegisterReport struct {
+	Type             string                 `json:"type"` // X, Z
+	Session          models.RegisterSession `json:"session"`
+	GeneratedAt      time.Time              `json:"generated_at"`
+	SalesCount       int64                  `json:"sales_count"`
+	GrossSales       float64                `json:"gross_sales"`
+	DiscountTotal    float64                `json:"discount_total"`
+	TaxTotal         float64                `json:"tax_total"`
+	ChangeGiven      float64                `json:"change_given"`
+	RefundTotal      float64                `json:"refund_total"`
+	AccountPayments  float64                `json:"account_payments"`
+	PayIns           float64                `json:"pay_ins"`
+	PayOuts          float64                `json:"pay_outs"`
+	OpeningFloat     float64                `json:"opening_float"`
+	ExpectedCash     float64                `json:"expected_cash"`
+	CountedCash      *float64               `json:"counted_cash,omitempty"`
+	CashDifference   *float64               `json:"cash_difference,omitempty"`
+	PaymentBreakdown []PaymentMethodSummary `json:"payment_breakdown"`
+}
+
+func NewRegisterSessionHandler(db *gorm.DB) *RegisterSessionHandler {
+	return &RegisterSessionHandler{DB: db}
+}
+
+// findOpenRegisterSession returns the open session of a cashier at a store
+func findOpenRegisterSession(tx *gorm.DB, storeID, cashierID uint) (*models.RegisterSession, error) {
+	var session models.RegisterSession
+	if err := tx.Where("store_id = ? AND cashier_id = ? AND status = ?", storeID, cashierID, "open").
+		First(&session).Error; err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// canOperateSession allows the session's own cashier or a user with registers.manage
+func (h *RegisterSessionHandler) canOperateSession(session *models.RegisterSession, userID uint) bool {
+	if session.CashierID == userID {
+		return true
+	}
+	var user models.User
+	if err := h.DB.First(&user, userID).Error; err != nil {
+		return false
+	}
+	return middleware.UserHasPermission(&user, "registers.manage")
+}
+
+// OpenRegisterSession starts a shift with an opening float
+func (h *RegisterSessionHandler) OpenRegisterSession(c *gin.Context) {
+	var req struct {
+		StoreID      uint    `json:"store_id" binding:"required"`
+		OpeningFloat float64 `json:"opening_float" binding:"gte=0"`
+		Notes        string  `json:"notes"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var store models.Store
+	if err := h.DB.First(&store, req.StoreID).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid store ID"})
+		return
+	}
+
+	userID := getUserIDFromContext(c)
+
+	// Serialize opens of the same cashier and store so two of them cannot both pass the check
+	tx := h.DB.Begin()
+	if err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext(?))", fmt.Sprintf("register_session:%d:%d", req.StoreID, userID)).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if _, err := findOpenRegisterSession(tx, req.StoreID, userID); err == nil {
+		tx.Rollback()
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You already have an open register session at this store"})
+		return
+	}
+
+	session := models.RegisterSession{
+		StoreID:      req.StoreID,
+		CashierID:    userID,
+		Status:       "open",
+		OpeningFloat: req.OpeningFloat,
+		OpenedAt:     time.Now(),
+		Notes:        req.Notes,
+	}
+
+	if err := tx.Create(&session).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if err := tx.Commit().Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.DB.Preload("Store").Preload("Cashier").First(&session, session.ID)
+
+	c.JSON(http.StatusCreated, gin.H{"data": session})
+}
+
+// GetCurrentRegisterSession returns the current user's open session for a store
+func (h *RegisterSessionHandler) GetCurrentRegisterSession(c *gin.Context) {
+	storeID, err := strconv.Atoi(c.Query("store_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "store_id is required"})
+		return
+	}
+
+	session, err := findOpenRegisterSession(h.DB, uint(storeID), getUserIDFromContext(c))
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "No open register session"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.DB.Preload("Store").Preload("Cashier").Preload("Movements").First(session, session.ID)
+
+	c.JSON(http.StatusOK, gin.H{"data": session})
+}
+
+// GetRegisterSessions retrieves register sessions with pagination
+func (h *RegisterSessionHandler) GetRegisterSessions(c *gin.Context) {
+	var sessions []models.RegisterSession
+	var total int64
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10"))
+	storeID := c.Query("store_id")
+	cashierID := c.Query("cashier_id")
+	status := c.Query("status")
+	dateFrom := c.Query("date_from")
+	dateTo := c.Query("date_to")
+
+	offset := (page - 1) * limit
+
+	query := h.DB.Preload("Store").Preload("Cashier").Preload("ClosedByUser")
+
+	if storeID != "" {
+		query = query.Where("store_id = ?", storeID)
+	}
+
+	if cashierID != "" {
+		query = query.Where("cashier_id = ?", cashierID)
+	}
+
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	if dateFrom != "" {
+		query = query.Where("DATE(opened_at) >= ?", dateFrom)
+	}
+
+	if dateTo != "" {
+		query = query.Where("DATE(opened_at) <= ?", dateTo)
+	}
+
+	// Get total count
+	query.Model(&models.RegisterSession{}).Count(&total)
+
+	// Get sessions with pagination
+	if err := query.Order("opened_at DESC").Limit(limit).Offset(offset).Find(&sessions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": sessions,
+		"pagination": gin.H{
+			"current_page": page,
+			"per_page":     limit,
+			"total":        total,
+			"total_pages":  (total + int64(limit) - 1) / int64(limit),
+		},
+	})
+}
+
+// GetRegisterSession retrieves a single register session by ID
+func (h *RegisterSessionHandler) GetRegisterSession(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid register session ID"})
+		return
+	}
+
+	var session models.RegisterSession
+	if err := h.DB.Preload("Store").Preload("Cashier").Preload("ClosedByUser").
+		Preload("Movements").Preload("Movements.CreatedByUser").First(&session, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Register session not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": session})
+}
+
+// CreateCashMovement records a pay-in or pay-out on an open session
+func (h *RegisterSessionHandler) CreateCashMovement(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid register session ID"})
+		return
+	}
+
+	var req struct {
+		Type   string  `json:"type" binding:"required,oneof=pay_in pay_out"`
+		Amount float64 `json:"amount" binding:"required,gt=0"`
+		Reason string  `json:"reason" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID := getUserIDFromContext(c)
+
+	tx := h.DB.Begin()
+
+	var session models.RegisterSession
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&session, id).Error; err != nil {
+		tx.Rollback()
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Register session not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	if session.Status != "open" {
+		tx.Rollback()
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Register session is closed"})
+		return
+	}
+
+	if !h.canOperateSession(&session, userID) {
+		tx.Rollback()
+		c.JSON(http.StatusForbidden, gin.H{"error": "Register session belongs to another cashier"})
+		return
+	}
+
+	movement := models.CashMovement{
+		RegisterSessionID: session.ID,
+		Type:              req.Type,
+		Amount:            req.Amount,
+		Reason:            req.Reason,
+		CreatedBy:         userID,
+	}
+
+	if err := tx.Create(&movement).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	tx.Commit()
+
+	c.JSON(http.StatusCreated, gin.H{"data": movement})
+}
+
+// GetXReport returns a mid-shift report without closing the session
+func (h *RegisterSessionHandler) GetXReport(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid register session ID"})
+		return
+	}
+
+	var session models.RegisterSession
+	if err := h.DB.Preload("Store").Preload("Cashier").First(&session, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Register session not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	report, err := buildRegisterReport(h.DB, session, "X", nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": report})
+}
+
+// GetZReport returns the end-of-day report of a closed session
+func (h *RegisterSessionHandler) GetZReport(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid register session ID"})
+		return
+	}
+
+	var session models.RegisterSession
+	if err := h.DB.Preload("Store").Preload("Cashier").Preload("ClosedByUser").First(&session, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Register session not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if session.Status != "closed" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Z report is only available for closed sessions"})
+		return
+	}
+
+	// Voids and returns after the close do not change the Z report
+	if len(session.ZReport) > 0 {
+		var report RegisterReport
+		if err := json.Unmarshal(session.ZReport, &report); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		report.Session = session
+		c.JSON(http.StatusOK, gin.H{"data": report})
+		return
+	}
+
+	// Sessions closed before Z reports were kept are rebuilt from their sales
+	var countedByMethod map[string]float64
+	if len(session.CountedByMethod) > 0 {
+		json.Unmarshal(session.CountedByMethod, &countedByMethod)
+	}
+	if countedByMethod == nil {
+		countedByMethod = map[string]float64{}
+	}
+	countedByMethod["cash"] = session.CountedCash
+
+	report, err := buildRegisterReport(h.DB, session, "Z", countedByMethod)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": report})
+}
+
+// CloseRegisterSession counts the drawer, closes the session and returns the Z report
+func (h *RegisterSessionHandler) CloseRegisterSession(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid register session ID"})
+		return
+	}
+
+	var req struct {
+		Denominations   []Denomination     `json:"denominations" binding:"dive"`
+		CountedByMethod map[string]float64 `json:"counted_by_method"` // Non-cash totals, e.g. EDC settlement
+		Notes           string             `json:"notes"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID := getUserIDFromContext(c)
+
+	tx := h.DB.Begin()
+
+	// Lock the session so no sale can attach to it while it is being closed
+	var session models.RegisterSession
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&session, id).Error; err != nil {
+		tx.Rollback()
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Register session not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	if session.Status != "open" {
+		tx.Rollback()
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Register session is already closed"})
+		return
+	}
+
+	if !h.canOperateSession(&session, userID) {
+		tx.Rollback()
+		c.JSON(http.StatusForbidden, gin.H{"error": "Register session belongs to another cashier"})
+		return
+	}
+
+	var countedCash float64
+	for _, d := range req.Denominations {
+		countedCash += d.Value * float64(d.Count)
+	}
+	countedCash = roundCurrency(countedCash)
+
+	countedByMethod := map[string]float64{}
+	for method, amount := range req.CountedByMethod {
+		if method != "cash" {
+			countedByMethod[method] = amount
+		}
+	}
+	countedByMethod["cash"] = countedCash
+
+	report, err := buildRegisterReport(tx, session, "Z", countedByMethod)
+	if err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	denominationsJSON, _ := json.Marshal(req.Denominations)
+	delete(countedByMethod, "cash")
+	countedByMethodJSON, _ := json.Marshal(countedByMethod)
+
+	now := time.Now()
+	session.Status = "closed"
+	session.ExpectedCash = report.ExpectedCash
+	session.CountedCash = countedCash
+	session.CashDifference = roundCurrency(countedCash - report.ExpectedCash)
+	session.CountedDenominations = denominationsJSON
+	session.CountedByMethod = countedByMethodJSON
+	session.ClosedAt = &now
+	session.ClosedBy = &userID
+	if req.Notes != "" {
+		session.Notes = req.Notes
+	}
+
+	snapshot := *report
+	snapshot.Session = models.RegisterSession{}
+	if session.ZReport, err = json.Marshal(snapshot); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := tx.Save(&session).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	tx.Commit()
+
+	h.DB.Preload("Store").Preload("Cashier").Preload("ClosedByUser").First(&session, session.ID)
+	report.Session = session
+
+	c.JSON(http.StatusOK, gin.H{"data": report, "message": "Register session closed successfully"})
+}
+
+// buildRegisterReport totals sales, account payments, refunds and cash movements of a session.
+// counted holds the counted amount per payment method; nil for an X report
+func buildRegisterReport(db *gorm.DB, session models.RegisterSession, reportType string, counted map[string]float64) (*RegisterReport, error) {
+	report := &RegisterReport{
+		Type:         reportType,
+		Session:      session,
+		GeneratedAt:  time.Now(),
+		OpeningFloat: session.OpeningFloat,
+	}
+
+	// Cancelled (voided) sales are excluded; their money has been handed back
+	salesQuery := db.Model(&models.Sale{}).
+		Where("register_session_id = ? AND sale_status IN ?", session.ID, []string{"completed", "refunded"})
+
+	var totals struct {
+		SalesCount    int64
+		GrossSales    float64
+		DiscountTotal float64
+		TaxTotal      float64
+		ChangeGiven   float64
+	}
+	if err := salesQuery.Select(`COUNT(*) AS sales_count, COALESCE(SUM(total_amount), 0) AS gross_sales,
+		COALESCE(SUM(discount_amount), 0) AS discount_total, COALESCE(SUM(tax_amount), 0) AS tax_total,
+		COALESCE(SUM(change_amount), 0) AS change_given`).Scan(&totals).Error; err != nil {
+		return nil, err
+	}
+	report.SalesCount = totals.SalesCount
+	report.GrossSales = totals.GrossSales
+	report.DiscountTotal = totals.DiscountTotal
+	report.TaxTotal = totals.TaxTotal
+	report.ChangeGiven = totals.ChangeGiven
+
+	var paymentRows []struct {
+		PaymentMethod string
+		Amount        float64
+	}
+	if err := db.Model(&models.SalePayment{}).
+		Select("sale_payments.payment_method, COALESCE(SUM(sale_payments.amount), 0) AS amount").
+		Joins("JOIN sales ON sales.id = sale_payments.sale_id").
+		Where("sales.register_session_id = ? AND sales.sale_status IN ? AND sale_payments.status = ? AND sale_payments.payment_method <> ?",
+			session.ID, []string{"completed", "refunded"}, "completed", "credit").
+		Group("sale_payments.payment_method").
+		Scan(&paymentRows).Error; err != nil {
+		return nil, err
+	}
+
+	var refundRows []struct {
+		PaymentMethod string
+		Amount        float64
+	}
+	if err := db.Model(&models.SaleReturnRefund{}).
+		Select("sale_return_refunds.payment_method, COALESCE(SUM(sale_return_refunds.amount), 0) AS amount").
+		Joins("JOIN sale_returns ON sale_returns.id = sale_return_refunds.sale_return_id").
+		Where("sale_returns.register_session_id = ? AND sale_return_refunds.status = ? AND sale_return_refunds.payment_method NOT IN ?",
+			session.ID, "completed", []string{"credit", "store_credit"}).
+		Group("sale_return_refunds.payment_method").
+		Scan(&refundRows).Error; err != nil {
+		return nil, err
+	}
+
+	var accountPaymentRows []struct {
+		PaymentMethod string
+		Amount        float64
+	}
+	if err := db.Model(&models.CustomerPayment{}).
+		Select("payment_method, COALESCE(SUM(amount), 0) AS amount").
+		Where("register_session_id = ?", session.ID).
+		Group("payment_method").
+		Scan(&accountPaymentRows).Error; err != nil {
+		return nil, err
+	}
+
+	var movementRows []struct {
+		Type   string
+		Amount float64
+	}
+	if err := db.Model(&models.CashMovement{}).
+		Select("type, COALESCE(SUM(amount), 0) AS amount").
+		Where("register_session_id = ?", session.ID).
+		Group("type").
+		Scan(&movementRows).Error; err != nil {
+		return nil, err
+	}
+	for _, row := range movementRows {
+		switch row.Type {
+		case "pay_in":
+			report.PayIns = row.Amount
+		case "pay_out":
+			report.PayOuts = row.Amount
+		}
+	}
+
+	// Cash is always reported, even when no cash was taken
+	summaries := map[string]*PaymentMethodSummary{"cash": {PaymentMethod: "cash"}}
+	order := []string{"cash"}
+	summaryFor := func(method string) *PaymentMethodSummary {
+		if s, ok := summaries[method]; ok {
+			return s
+		}
+		summaries[method] = &PaymentMethodSummary{PaymentMethod: method}
+		order = append(order, method)
+		return summaries[method]
+	}
+	for _, row := range paymentRows {
+		summaryFor(row.PaymentMethod).Sales = row.Amount
+	}
+	for _, row := range accountPaymentRows {
+		summaryFor(row.PaymentMethod).AccountPayments = row.Amount
+		report.AccountPayments += row.Amount
+	}
+	for _, row := range refundRows {
+		summaryFor(row.PaymentMethod).Refunds = row.Amount
+		report.RefundTotal += row.Amount
+	}
+	for method := range counted {
+		summaryFor(method)
+	}
+
+	for _, method := range order {
+		summary := summaries[method]
+		summary.Expected = summary.Sales + summary.AccountPayments - summary.Refunds
+		if method == "cash" {
+			// Change is always handed out from the drawer
+			summary.Expected += report.OpeningFloat + report.PayIns - report.PayOuts - report.ChangeGiven
+			report.ExpectedCash = roundCurrency(summary.Expected)
+		}
+		summary.Expected = roundCurrency(summary.Expected)
+
+		if amount, ok := counted[method]; ok {
+			countedAmount := amount
+			difference := roundCurrency(amount - summary.Expected)
+			summary.Counted = &countedAmount
+			summary.Difference = &difference
+			if method == "cash" {
+				report.CountedCash = &countedAmount
+				report.CashDifference = &difference
+			}
+		}
+		report.PaymentBreakdown = append(report.PaymentBreakdown, *summary)
+	}
+
+	return report, nil
+}
@@ -0,0 +1,529 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"starter/backend/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// draftRequest is a parked cart; it is priced like a sale but takes no payment
+type draftRequest struct {
+	StoreID          uint              `json:"store_id" binding:"required"`
+	CustomerID       *uint             `json:"customer_id"`
+	DiscountID       *uint             `json:"discount_id"`
+	DiscountIDs      []uint            `json:"discount_ids"`
+	PointsRedeemed   int               `json:"points_redeemed"`
+	Items            []models.SaleItem `json:"items" binding:"required"`
+	OverrideApproval *OverrideApproval `json:"override_approval"`
+	ReserveStock     bool              `json:"reserve_stock"`
+	Notes            string            `json:"notes"`
+}
+
+// finalizeDraftRequest completes a draft with the payments taken at the till
+type finalizeDraftRequest struct {
+	Payments         []models.SalePayment `json:"payments" binding:"required"`
+	OverrideApproval *OverrideApproval    `json:"override_approval"`
+	ClientUUID       string               `json:"client_uuid"`
+}
+
+// reserveDraftStock holds the saved items of a draft so other sales cannot sell them, and
+// records what each item holds for releaseDraftStock
+func reserveDraftStock(tx *gorm.DB, storeID uint, items []models.SaleItem) error {
+	for _, item := range items {
+		lines, err := draftStockLines(tx, storeID, item, false)
+		if err != nil {
+			return err
+		}
+		for _, line := range lines {
+			var inventory models.StoreInventory
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where(models.StoreInventory{
+				ProductID:        line.ProductID,
+				ProductVariantID: line.ProductVariantID,
+				StoreID:          storeID,
+			}).First(&inventory).Error; err != nil {
+				if err == gorm.ErrRecordNotFound {
+					return newSaleError(http.StatusBadRequest, "insufficient_stock",
+						fmt.Sprintf("product ID %d not found in store inventory", line.ProductID))
+				}
+				return err
+			}
+
+			if available := inventory.Quantity - inventory.ReservedQuantity; available < line.Quantity {
+				return newSaleError(http.StatusBadRequest, "insufficient_stock",
+					fmt.Sprintf("insufficient inventory to reserve product ID %d. Available: %.2f, Required: %.2f",
+						line.ProductID, available, line.Quantity))
+			}
+
+			if err := tx.Model(&inventory).UpdateColumn("reserved_quantity", gorm.Expr("reserved_quantity + ?", line.Quantity)).Error; err != nil {
+				return err
+			}
+			if err := tx.Create(&models.SaleItemReservation{
+				SaleID:           item.SaleID,
+				SaleItemID:       item.ID,
+				ProductID:        line.ProductID,
+				ProductVariantID: line.ProductVariantID,
+				Quantity:         line.Quantity,
+			}).Error; err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// releaseDraftStock gives back the stock reserved by a draft and forgets the reservation
+func releaseDraftStock(tx *gorm.DB, draft models.Sale) error {
+	if !draft.StockReserved {
+		return nil
+	}
+
+	var reservations []models.SaleItemReservation
+	if err := tx.Where("sale_id = ?", draft.ID).Order("id").Find(&reservations).Error; err != nil {
+		return err
+	}
+	reserved := make(map[uint][]stockLine, len(draft.Items))
+	for _, reservation := range reservations {
+		reserved[reservation.SaleItemID] = append(reserved[reservation.SaleItemID], stockLine{
+			ProductID:        reservation.ProductID,
+			ProductVariantID: reservation.ProductVariantID,
+			Quantity:         reservation.Quantity,
+		})
+	}
+
+	for _, item := range draft.Items {
+		lines, ok := reserved[item.ID]
+		if !ok {
+			// Drafts parked before reservations were recorded
+			var err error
+			if lines, err = draftStockLines(tx, draft.StoreID, item, true); err != nil {
+				return err
+			}
+		}
+		for _, line := range lines {
+			if err := tx.Model(&models.StoreInventory{}).Where(models.StoreInventory{
+				ProductID:        line.ProductID,
+				ProductVariantID: line.ProductVariantID,
+				StoreID:          draft.StoreID,
+			}).UpdateColumn("reserved_quantity", gorm.Expr("GREATEST(reserved_quantity - ?, 0)", line.Quantity)).Error; err != nil {
+				return err
+			}
+		}
+	}
+	return tx.Where("sale_id = ?", draft.ID).Delete(&models.SaleItemReservation{}).Error
+}
+
+// deleteDraft releases a locked draft's reservation and removes it with its items
+func deleteDraft(tx *gorm.DB, draft models.Sale) error {
+	if err := releaseDraftStock(tx, draft); err != nil {
+		return err
+	}
+	if err := tx.Where("sale_id = ?", draft.ID).Delete(&models.SaleItem{}).Error; err != nil {
+		return err
+	}
+	return tx.Delete(&draft).Error
+}
+
+// consumeDraft removes a draft that is being turned into a sale; the row lock makes a
+// second finalize of the same draft fail instead of selling the cart twice
+func consumeDraft(tx *gorm.DB, draftID uint) error {
+	var draft models.Sale
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Preload("Items").
+		Where("id = ? AND sale_status = ?", draftID, "draft").First(&draft).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return newSaleError(http.StatusConflict, "draft_unavailable", "Draft was already finalized or has expired")
+		}
+		return err
+	}
+	return deleteDraft(tx, draft)
+}
+
+// draftHeldUntil is when a draft saved now expires
+func draftHeldUntil(db *gorm.DB) time.Time {
+	minutes := getSettingFloat(db, "draft_expiry_minutes", 240)
+	return time.Now().Add(time.Duration(minutes) * time.Minute)
+}
+
+// saveDraft prices a cart and stores it as a draft, replacing the items of an existing draft
+func (h *SalesHandler) saveDraft(tx *gorm.DB, draft *models.Sale, req draftRequest, userID uint) error {
+	overrideBy, err := h.resolvePriceOverride(userID, req.OverrideApproval)
+	if err != nil {
+		return newSaleError(http.StatusForbidden, "override_denied", err.Error())
+	}
+
+	discountIDs := selectedDiscountIDs(req.DiscountID, req.DiscountIDs)
+	quote, err := quoteSale(tx, saleQuoteRequest{
+		StoreID:        req.StoreID,
+		CustomerID:     req.CustomerID,
+		DiscountIDs:    discountIDs,
+		PointsRedeemed: req.PointsRedeemed,
+		Items:          req.Items,
+		OverrideBy:     overrideBy,
+	}, time.Now())
+	if err != nil {
+		var saleErr *saleError
+		if errors.As(err, &saleErr) {
+			return saleErr
+		}
+		return newSaleError(http.StatusBadRequest, "invalid_sale", err.Error())
+	}
+
+	heldUntil := draftHeldUntil(tx)
+	draft.StoreID = req.StoreID
+	draft.CustomerID = req.CustomerID
+	draft.DiscountID = firstDiscountID(discountIDs)
+	draft.DiscountIDs = encodeDiscountIDs(discountIDs)
+	draft.PointsRedeemed = req.PointsRedeemed
+	draft.Subtotal = quote.Subtotal
+	draft.TaxAmount = quote.TaxAmount
+	draft.PricesIncludeTax = quote.PricesIncludeTax
+	draft.DiscountAmount = quote.DiscountAmount
+	draft.TotalAmount = quote.TotalAmount
+	draft.PaymentStatus = "pending"
+	draft.SaleStatus = "draft"
+	draft.StockReserved = req.ReserveStock
+	draft.HeldUntil = &heldUntil
+	draft.Notes = req.Notes
+
+	if draft.ID == 0 {
+		draft.CashierID = userID
+		draft.SaleDate = time.Now()
+		// Drafts do not take a number from the sale sequence; that keeps sale numbers gap-free
+		draft.SaleNumber = fmt.Sprintf("DRAFT-%d-%d", req.StoreID, time.Now().UnixNano())
+		if err := tx.Create(draft).Error; err != nil {
+			return err
+		}
+	} else if err := tx.Select("store_id", "customer_id", "discount_id", "discount_ids", "points_redeemed", "subtotal", "tax_amount",
+		"prices_include_tax", "discount_amount", "total_amount", "stock_reserved", "held_until", "notes").
+		Save(draft).Error; err != nil {
+		return err
+	}
+
+	// Tax lines are only written when the draft becomes a sale
+	for i := range quote.Items {
+		item := quote.Items[i]
+		item.SaleID = draft.ID
+		item.Taxes = nil
+		if err := tx.Create(&item).Error; err != nil {
+			return err
+		}
+		quote.Items[i].ID = item.ID
+		quote.Items[i].SaleID = draft.ID
+	}
+
+	if req.ReserveStock {
+		return reserveDraftStock(tx, req.StoreID, quote.stockItems())
+	}
+	return nil
+}
+
+// respondDraftError writes a saleError with its code, anything else as a server error
+func respondDraftError(c *gin.Context, err error) {
+	var saleErr *saleError
+	if errors.As(err, &saleErr) {
+		c.JSON(saleErr.Status, gin.H{"error": saleErr.Message, "code": saleErr.Code})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+}
+
+// loadDraftForUpdate locks a draft of the current user's store
+func (h *SalesHandler) loadDraftForUpdate(tx *gorm.DB, c *gin.Context) (*models.Sale, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid draft ID"})
+		return nil, false
+	}
+
+	var draft models.Sale
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Preload("Items").
+		Where("id = ? AND sale_status = ?", id, "draft").First(&draft).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Draft not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return nil, false
+	}
+
+	if userStoreID := h.getUserStoreID(c); userStoreID > 0 && draft.StoreID != userStoreID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Draft not found"})
+		return nil, false
+	}
+	return &draft, true
+}
+
+// CreateDraft parks a cart so it can be resumed later, optionally reserving its stock
+func (h *SalesHandler) CreateDraft(c *gin.Context) {
+	var req draftRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var store models.Store
+	if err := h.DB.First(&store, req.StoreID).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid store ID", "code": "invalid_store"})
+		return
+	}
+
+	tx := h.DB.Begin()
+
+	var draft models.Sale
+	if err := h.saveDraft(tx, &draft, req, getUserIDFromContext(c)); err != nil {
+		tx.Rollback()
+		respondDraftError(c, err)
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.DB.Preload("Store").Preload("Customer").Preload("Cashier").
+		Preload("Items").Preload("Items.Product").Preload("Items.ProductVariant").First(&draft, draft.ID)
+
+	c.JSON(http.StatusCreated, gin.H{"data": draft})
+}
+
+// GetDrafts lists the parked carts of a store, newest first
+func (h *SalesHandler) GetDrafts(c *gin.Context) {
+	var drafts []models.Sale
+
+	query := h.DB.Preload("Customer").Preload("Cashier").
+		Preload("Items").Preload("Items.Product").Preload("Items.ProductVariant").
+		Where("sale_status = ?", "draft")
+
+	if userStoreID := h.getUserStoreID(c); userStoreID > 0 {
+		query = query.Where("store_id = ?", userStoreID)
+	} else if storeID := c.Query("store_id"); storeID != "" {
+		query = query.Where("store_id = ?", storeID)
+	}
+
+	if cashierID := c.Query("cashier_id"); cashierID != "" {
+		query = query.Where("cashier_id = ?", cashierID)
+	}
+
+	if search := strings.TrimSpace(c.Query("search")); search != "" {
+		query = query.Where("notes ILIKE ?", "%"+search+"%")
+	}
+
+	if err := query.Order("updated_at DESC").Find(&drafts).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": drafts})
+}
+
+// UpdateDraft replaces the cart of a draft and extends its hold
+func (h *SalesHandler) UpdateDraft(c *gin.Context) {
+	var req draftRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tx := h.DB.Begin()
+
+	draft, ok := h.loadDraftForUpdate(tx, c)
+	if !ok {
+		tx.Rollback()
+		return
+	}
+
+	// Release the old cart before pricing and reserving the new one
+	if err := releaseDraftStock(tx, *draft); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if err := tx.Where("sale_id = ?", draft.ID).Delete(&models.SaleItem{}).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	draft.Items = nil
+	if err := h.saveDraft(tx, draft, req, getUserIDFromContext(c)); err != nil {
+		tx.Rollback()
+		respondDraftError(c, err)
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.DB.Preload("Store").Preload("Customer").Preload("Cashier").
+		Preload("Items").Preload("Items.Product").Preload("Items.ProductVariant").First(draft, draft.ID)
+
+	c.JSON(http.StatusOK, gin.H{"data": draft})
+}
+
+// DeleteDraft discards a parked cart and releases its reserved stock
+func (h *SalesHandler) DeleteDraft(c *gin.Context) {
+	tx := h.DB.Begin()
+
+	draft, ok := h.loadDraftForUpdate(tx, c)
+	if !ok {
+		tx.Rollback()
+		return
+	}
+
+	if err := deleteDraft(tx, *draft); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Draft deleted successfully"})
+}
+
+// FinalizeDraft turns a draft into a completed sale. The cart is repriced at current
+// prices and the draft is removed in the same transaction that records the sale
+func (h *SalesHandler) FinalizeDraft(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid draft ID"})
+		return
+	}
+
+	var req finalizeDraftRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	idempotencyKey := strings.TrimSpace(c.GetHeader("Idempotency-Key"))
+	if idempotencyKey == "" {
+		idempotencyKey = strings.TrimSpace(req.ClientUUID)
+	}
+
+	var draft models.Sale
+	if err := h.DB.Preload("Items").Preload("Items.Product").Where("id = ? AND sale_status = ?", id, "draft").First(&draft).Error; err != nil {
+		// A retry of a finalize that already went through finds its sale by the key
+		var existing models.Sale
+		if idempotencyKey != "" && h.DB.Where("client_uuid = ?", idempotencyKey).First(&existing).Error == nil {
+			sale, err := h.replaySale(existing, existing.StoreID)
+			if err != nil {
+				respondDraftError(c, err)
+				return
+			}
+			c.Header("Idempotent-Replayed", "true")
+			c.JSON(http.StatusOK, gin.H{"data": sale})
+			return
+		}
+		c.JSON(http.StatusNotFound, gin.H{"error": "Draft not found"})
+		return
+	}
+	if userStoreID := h.getUserStoreID(c); userStoreID > 0 && draft.StoreID != userStoreID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Draft not found"})
+		return
+	}
+
+	// Only approved overrides and gift card amounts carry their price over; other lines take the current price
+	items := make([]models.SaleItem, 0, len(draft.Items))
+	for _, item := range draft.Items {
+		line := models.SaleItem{
+			ProductID:        item.ProductID,
+			ProductVariantID: item.ProductVariantID,
+			Quantity:         item.Quantity,
+			Unit:             item.Unit,
+			UnitQuantity:     item.UnitQuantity,
+			GiftCardCode:     item.GiftCardCode,
+			SerialNumbers:    item.SerialNumbers,
+		}
+		if item.Product != nil && item.Product.IsGiftCard {
+			line.UnitPrice = item.UnitPrice
+		}
+		if item.PriceOverrideBy != nil {
+			line.UnitPrice = item.UnitPrice
+			line.DiscountAmount = roundCurrency(item.DiscountAmount - item.PromotionAmount)
+		}
+		items = append(items, line)
+	}
+
+	sale, replayed, err := h.processSale(saleRequest{
+		StoreID:          draft.StoreID,
+		CustomerID:       draft.CustomerID,
+		DiscountID:       draft.DiscountID,
+		DiscountIDs:      decodeDiscountIDs(draft.DiscountIDs),
+		PointsRedeemed:   draft.PointsRedeemed,
+		Items:            items,
+		Payments:         req.Payments,
+		OverrideApproval: req.OverrideApproval,
+		Notes:            draft.Notes,
+		draftID:          draft.ID,
+	}, getUserIDFromContext(c), idempotencyKey)
+	if err != nil {
+		respondDraftError(c, err)
+		return
+	}
+
+	if replayed {
+		c.Header("Idempotent-Replayed", "true")
+		c.JSON(http.StatusOK, gin.H{"data": sale})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"data": sale})
+}
+
+// ExpireDrafts discards drafts whose hold has run out, releasing their reserved stock
+func ExpireDrafts(db *gorm.DB) error {
+	var expired []models.Sale
+	if err := db.Select("id").Where("sale_status = ? AND held_until < ?", "draft", time.Now()).
+		Find(&expired).Error; err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, candidate := range expired {
+		tx := db.Begin()
+		var draft models.Sale
+		// Skip drafts that were finalized or extended since the scan
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Preload("Items").
+			Where("id = ? AND sale_status = ? AND held_until < ?", candidate.ID, "draft", time.Now()).
+			First(&draft).Error; err != nil {
+			tx.Rollback()
+			continue
+		}
+		if err := deleteDraft(tx, draft); err != nil {
+			tx.Rollback()
+			errs = append(errs, fmt.Errorf("draft %d: %w", draft.ID, err))
+			continue
+		}
+		if err := tx.Commit().Error; err != nil {
+			errs = append(errs, fmt.Errorf("draft %d: %w", draft.ID, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// RunDraftExpiryJob periodically discards expired drafts; it never returns
+func RunDraftExpiryJob(db *gorm.DB, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if err := ExpireDrafts(db); err != nil {
+			log.Printf("Draft expiry job: %v", err)
+		}
+	}
+}
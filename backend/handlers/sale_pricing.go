@@ -0,0 +1,312 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"starter/backend/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// saleQuoteRequest is the client input that pricing is allowed to look at
+type saleQuoteRequest struct {
+	StoreID        uint
+	CustomerID     *uint
+	DiscountIDs    []uint // discounts selected at the till, automatic promotions are found by quoteSale
+	PointsRedeemed int
+	Items          []models.SaleItem
+	OverrideBy     *uint      // user who approved price overrides, nil when none was approved
+	KeepRejected   bool       // report selected discounts that do not apply in Rejected instead of failing
+	RequireSerials bool       // serialized lines must name one serial number per unit, as when the sale is made
+	PricedAt       *time.Time // list prices as they were at this moment, for sales synced after the fact
+}
+
+// saleQuote is the server computed price breakdown of a sale
+type saleQuote struct {
+	Items            []models.SaleItem
+	GiftCards        []bool             // lines selling a gift card; they carry no stock, tax or discount
+	Applied          []appliedDiscount  // promotions and selected discounts that took money off, in evaluation order
+	Rejected         []rejectedDiscount // discounts that were considered but did not apply
+	PricesIncludeTax bool
+	Subtotal         float64
+	CodeDiscount     float64 // discount coming from the selected discounts
+	PointsValue      float64 // value of redeemed loyalty points
+	DiscountAmount   float64 // CodeDiscount + PointsValue
+	TaxAmount        float64
+	TotalAmount      float64
+}
+
+// quoteSale recomputes line prices, discounts, points and tax from the catalog and settings.
+// Must run inside the sale transaction: it locks the discount and customer rows it reads
+func quoteSale(tx *gorm.DB, req saleQuoteRequest, now time.Time) (*saleQuote, error) {
+	if len(req.Items) == 0 {
+		return nil, errors.New("Sale must have at least one item")
+	}
+
+	quote := &saleQuote{}
+	categories := make(map[uint]*uint, len(req.Items))
+	products := make([]models.Product, 0, len(req.Items))
+
+	for _, reqItem := range req.Items {
+		var product models.Product
+		if err := tx.Where("id = ? AND is_active = ?", reqItem.ProductID, true).First(&product).Error; err != nil {
+			return nil, fmt.Errorf("Product ID %d not found or inactive", reqItem.ProductID)
+		}
+
+		// A line rung up by the pack counts unit_quantity packs; stock and price work in base units
+		unit, factor, err := resolveProductUnit(tx, product, reqItem.Unit)
+		if err != nil {
+			return nil, err
+		}
+		quantity := reqItem.Quantity
+		if unit != "" {
+			quantity = reqItem.UnitQuantity * factor
+		}
+		if quantity <= 0 {
+			return nil, fmt.Errorf("Quantity for product ID %d must be greater than zero", reqItem.ProductID)
+		}
+		categories[product.ID] = product.CategoryID
+		products = append(products, product)
+
+		var variant *models.ProductVariant
+		if reqItem.ProductVariantID != nil {
+			variant = &models.ProductVariant{}
+			if err := tx.Where("id = ? AND product_id = ? AND is_active = ?", *reqItem.ProductVariantID, product.ID, true).
+				First(variant).Error; err != nil {
+				return nil, fmt.Errorf("Variant ID %d not found for product %s", *reqItem.ProductVariantID, product.Name)
+			}
+		}
+		var listPrice float64
+		if req.PricedAt != nil {
+			listPrice, err = storeSellingPriceAt(tx, req.StoreID, product, variant, *req.PricedAt)
+		} else {
+			listPrice, err = storeSellingPrice(tx, req.StoreID, product, variant)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		item := models.SaleItem{
+			ProductID:        product.ID,
+			ProductVariantID: reqItem.ProductVariantID,
+			Quantity:         quantity,
+			UnitPrice:        listPrice,
+			ListPrice:        listPrice,
+		}
+		if unit != "" {
+			item.Unit = unit
+			item.UnitQuantity = reqItem.UnitQuantity
+		}
+
+		// A gift card is sold for the amount loaded on it, one card per line
+		if product.IsGiftCard {
+			if quantity != 1 || unit != "" {
+				return nil, fmt.Errorf("Gift card %s must be sold one card per line", product.Name)
+			}
+			if reqItem.UnitPrice > 0 {
+				item.UnitPrice = roundCurrency(reqItem.UnitPrice)
+			}
+			if item.UnitPrice <= 0 {
+				return nil, fmt.Errorf("Gift card %s needs an amount", product.Name)
+			}
+			if reqItem.DiscountAmount > 0 {
+				return nil, fmt.Errorf("Gift card %s cannot be discounted", product.Name)
+			}
+			item.GiftCardCode = strings.TrimSpace(reqItem.GiftCardCode)
+			item.TotalPrice = item.UnitPrice
+			quote.Items = append(quote.Items, item)
+			quote.GiftCards = append(quote.GiftCards, true)
+			continue
+		}
+
+		// Any deviation from the catalog price needs an approved override
+		priceChanged := reqItem.UnitPrice > 0 && math.Abs(reqItem.UnitPrice-listPrice) >= 0.01
+		if priceChanged || reqItem.DiscountAmount > 0 {
+			if req.OverrideBy == nil {
+				return nil, fmt.Errorf("Price override for product %s requires manager approval", product.Name)
+			}
+			item.PriceOverrideBy = req.OverrideBy
+			if priceChanged {
+				item.UnitPrice = reqItem.UnitPrice
+			}
+			item.DiscountAmount = math.Min(reqItem.DiscountAmount, item.UnitPrice*item.Quantity)
+		}
+
+		// Serialized products name the units sold; a held cart may name them later
+		serials, err := decodeSerialNumbers(reqItem.SerialNumbers)
+		if err != nil {
+			return nil, err
+		}
+		if req.RequireSerials || len(serials) > 0 {
+			if err := checkSerialCount(product, serials, item.Quantity); err != nil {
+				return nil, err
+			}
+		}
+		item.SerialNumbers = encodeSerialNumbers(serials)
+
+		item.TotalPrice = roundCurrency(item.UnitPrice*item.Quantity - item.DiscountAmount)
+		quote.Items = append(quote.Items, item)
+		quote.GiftCards = append(quote.GiftCards, false)
+	}
+
+	// Promotions and selected discounts, in priority order, through the same rules as ValidateDiscount
+	lineDiscounts, err := applyDiscounts(tx, req, quote, categories, now)
+	if err != nil {
+		return nil, err
+	}
+	for _, rejected := range quote.Rejected {
+		if !rejected.Automatic && !req.KeepRejected {
+			return nil, newSaleError(http.StatusBadRequest, "discount_unavailable", fmt.Sprintf("%s: %s", rejected.Name, rejected.Reason))
+		}
+	}
+	for _, item := range quote.Items {
+		quote.Subtotal += item.TotalPrice
+	}
+	quote.Subtotal = roundCurrency(quote.Subtotal)
+
+	// Tax is computed per line from its tax class, on the line net of discounts
+	quote.PricesIncludeTax = storePricesIncludeTax(tx, req.StoreID)
+	taxes := newTaxResolver(tx)
+	for i := range quote.Items {
+		if quote.GiftCards[i] {
+			continue
+		}
+		item := &quote.Items[i]
+		taxLine := taxes.lineTax(products[i], item.TotalPrice-lineDiscounts[i], quote.PricesIncludeTax)
+		item.TaxClassID = taxLine.TaxClassID
+		item.TaxRate = taxLine.TaxRate
+		item.TaxAmount = taxLine.TaxAmount
+		item.Taxes = []models.SaleItemTax{taxLine}
+		quote.TaxAmount += taxLine.TaxAmount
+	}
+	quote.TaxAmount = roundCurrency(quote.TaxAmount)
+
+	// Inclusive prices already contain the tax
+	addedTax := quote.TaxAmount
+	if quote.PricesIncludeTax {
+		addedTax = 0
+	}
+
+	// Redeemed points are valued from settings, never from the client
+	if req.PointsRedeemed > 0 {
+		if req.CustomerID == nil {
+			return nil, errors.New("Customer is required to redeem points")
+		}
+
+		var customer models.Customer
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&customer, *req.CustomerID).Error; err != nil {
+			return nil, errors.New("Customer not found")
+		}
+		if !customer.IsMember {
+			return nil, errors.New("Only members can redeem points")
+		}
+		if customer.LoyaltyPoints < req.PointsRedeemed {
+			return nil, errors.New("Insufficient loyalty points")
+		}
+		if minRedeem := int(getSettingFloat(tx, "loyalty_min_redeem", 10)); req.PointsRedeemed < minRedeem {
+			return nil, fmt.Errorf("Minimum %d points required to redeem", minRedeem)
+		}
+
+		quote.PointsValue = roundCurrency(float64(req.PointsRedeemed) * getSettingFloat(tx, "loyalty_point_value", 100))
+		if quote.PointsValue > quote.Subtotal+addedTax-quote.CodeDiscount {
+			return nil, errors.New("Points redemption exceeds sale total")
+		}
+	}
+
+	quote.DiscountAmount = roundCurrency(quote.CodeDiscount + quote.PointsValue)
+	quote.TotalAmount = roundCurrency(quote.Subtotal + addedTax - quote.DiscountAmount)
+
+	return quote, nil
+}
+
+// stockItems returns the lines that take goods out of inventory
+func (q *saleQuote) stockItems() []models.SaleItem {
+	items := make([]models.SaleItem, 0, len(q.Items))
+	for i, item := range q.Items {
+		if !q.GiftCards[i] {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// loyaltyAmount is what the customer pays for goods. Gift cards earn points when they are
+// spent, not when they are bought
+func (q *saleQuote) loyaltyAmount() float64 {
+	amount := q.TotalAmount
+	for i, item := range q.Items {
+		if q.GiftCards[i] {
+			amount -= item.TotalPrice
+		}
+	}
+	return max(roundCurrency(amount), 0)
+}
+
+// selectedDiscountIDs merges discount_id and discount_ids into one list without duplicates
+func selectedDiscountIDs(discountID *uint, discountIDs []uint) []uint {
+	var ids []uint
+	seen := make(map[uint]bool)
+	if discountID != nil {
+		discountIDs = append([]uint{*discountID}, discountIDs...)
+	}
+	for _, id := range discountIDs {
+		if id != 0 && !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// firstDiscountID is what Sale.DiscountID keeps of the selected discounts
+func firstDiscountID(ids []uint) *uint {
+	if len(ids) == 0 {
+		return nil
+	}
+	return &ids[0]
+}
+
+// encodeDiscountIDs stores the selected discounts on Sale.DiscountIDs
+func encodeDiscountIDs(ids []uint) json.RawMessage {
+	if len(ids) == 0 {
+		return nil
+	}
+	data, _ := json.Marshal(ids)
+	return data
+}
+
+// decodeDiscountIDs reads the selected discounts back from Sale.DiscountIDs
+func decodeDiscountIDs(data json.RawMessage) []uint {
+	var ids []uint
+	if len(data) > 0 {
+		json.Unmarshal(data, &ids)
+	}
+	return ids
+}
+
+// discountableLines reports which lines a discount applies to according to ApplicableItems
+func discountableLines(discount *models.Discount, items []models.SaleItem, categories map[uint]*uint) []bool {
+	applies := make([]bool, len(items))
+	for i, item := range items {
+		switch discount.ApplicableItems {
+		case "product":
+			if discount.ProductID == nil || *discount.ProductID != item.ProductID {
+				continue
+			}
+		case "category":
+			categoryID := categories[item.ProductID]
+			if discount.CategoryID == nil || categoryID == nil || *discount.CategoryID != *categoryID {
+				continue
+			}
+		}
+		applies[i] = true
+	}
+	return applies
+}
@@ -0,0 +1,718 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"starter/backend/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type SaleReturnHandler struct {
+	DB *gorm.DB
+}
+
+type SaleReturnItemCreate struct {
+	SaleItemID    uint     `json:"sale_item_id" binding:"required"`
+	Quantity      float64  `json:"quantity" binding:"required,gt=0"`
+	Condition     string   `json:"condition"` // restock (default), damaged
+	Reason        string   `json:"reason"`
+	SerialNumbers []string `json:"serial_numbers"` // Units brought back, required for serialized products
+}
+
+type SaleReturnRefundCreate struct {
+	PaymentMethod   string  `json:"payment_method" binding:"required"`
+	Amount          float64 `json:"amount" binding:"required,gt=0"`
+	ReferenceNumber string  `json:"reference_number"`
+	SalePaymentID   *uint   `json:"sale_payment_id"` // Refund a provider payment of the sale through its provider
+}
+
+func NewSaleReturnHandler(db *gorm.DB) *SaleReturnHandler {
+	return &SaleReturnHandler{DB: db}
+}
+
+// roundCurrency rounds an amount to two decimal places
+func roundCurrency(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
+
+// CreateSaleReturn records a partial or full return against a completed sale
+func (h *SaleReturnHandler) CreateSaleReturn(c *gin.Context) {
+	saleID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid sale ID"})
+		return
+	}
+
+	var req struct {
+		Reason  string                   `json:"reason" binding:"required"`
+		Notes   string                   `json:"notes"`
+		Items   []SaleReturnItemCreate   `json:"items" binding:"required,min=1,dive"`
+		Refunds []SaleReturnRefundCreate `json:"refunds" binding:"dive"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID := getUserIDFromContext(c)
+
+	// Start transaction
+	tx := h.DB.Begin()
+
+	// Lock the sale so concurrent returns see each other's quantities
+	var sale models.Sale
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Preload("Items").First(&sale, saleID).Error; err != nil {
+		tx.Rollback()
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Sale not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	if sale.SaleStatus != "completed" {
+		tx.Rollback()
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Only completed sales can be returned"})
+		return
+	}
+
+	returned, err := h.returnedQuantities(tx, sale.ID)
+	if err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	saleItems := make(map[uint]models.SaleItem, len(sale.Items))
+	for _, item := range sale.Items {
+		saleItems[item.ID] = item
+	}
+
+	// Order level tax and discount are spread over lines in proportion to their totals;
+	// gift card lines carry neither
+	var giftCardTotal float64
+	for _, item := range sale.Items {
+		if item.GiftCardID != nil {
+			giftCardTotal += item.TotalPrice
+		}
+	}
+	ratio := 1.0
+	if sale.Subtotal-giftCardTotal > 0 {
+		ratio = (sale.TotalAmount - giftCardTotal) / (sale.Subtotal - giftCardTotal)
+	}
+
+	var returnItems []models.SaleReturnItem
+	var refundAmount float64
+	for _, itemReq := range req.Items {
+		saleItem, ok := saleItems[itemReq.SaleItemID]
+		if !ok {
+			tx.Rollback()
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Item ID %d not found in sale", itemReq.SaleItemID)})
+			return
+		}
+		if saleItem.GiftCardID != nil {
+			tx.Rollback()
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Item ID %d is a gift card and cannot be returned", itemReq.SaleItemID)})
+			return
+		}
+
+		condition := itemReq.Condition
+		if condition == "" {
+			condition = "restock"
+		}
+		if condition != "restock" && condition != "damaged" {
+			tx.Rollback()
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid condition. Must be 'restock' or 'damaged'"})
+			return
+		}
+
+		available := saleItem.Quantity - returned[saleItem.ID]
+		if itemReq.Quantity > available {
+			tx.Rollback()
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Return quantity for item ID %d exceeds returnable quantity. Available: %.2f, Requested: %.2f",
+				saleItem.ID, available, itemReq.Quantity)})
+			return
+		}
+		returned[saleItem.ID] += itemReq.Quantity
+
+		// Serialized products name the units brought back
+		var product models.Product
+		if err := tx.Select("id", "name", "is_serialized").First(&product, saleItem.ProductID).Error; err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		serials := cleanSerialNumbers(itemReq.SerialNumbers)
+		if err := checkSerialCount(product, serials, itemReq.Quantity); err != nil {
+			tx.Rollback()
+			var saleErr *saleError
+			if errors.As(err, &saleErr) {
+				c.JSON(saleErr.Status, gin.H{"error": saleErr.Message, "code": saleErr.Code})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		lineRefund := roundCurrency(saleItem.TotalPrice / saleItem.Quantity * itemReq.Quantity * ratio)
+		refundAmount += lineRefund
+
+		returnItems = append(returnItems, models.SaleReturnItem{
+			SaleItemID:       saleItem.ID,
+			ProductID:        saleItem.ProductID,
+			ProductVariantID: saleItem.ProductVariantID,
+			Quantity:         itemReq.Quantity,
+			UnitPrice:        saleItem.UnitPrice,
+			RefundAmount:     lineRefund,
+			Condition:        condition,
+			Reason:           itemReq.Reason,
+			SerialNumbers:    encodeSerialNumbers(serials),
+		})
+	}
+	refundAmount = roundCurrency(refundAmount)
+
+	// Default to refunding the way the sale was paid
+	refunds := req.Refunds
+	if len(refunds) == 0 {
+		if refunds, err = defaultRefundTenders(tx, sale, refundAmount); err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	providerPayments := map[uint]models.SalePayment{}
+	requested := map[uint]float64{}
+	for _, refund := range refunds {
+		if refund.SalePaymentID == nil {
+			continue
+		}
+		var payment models.SalePayment
+		if err := tx.Where("id = ? AND sale_id = ? AND status = ? AND provider <> ?", *refund.SalePaymentID, sale.ID, "completed", "").
+			First(&payment).Error; err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Sale payment %d is not a completed provider payment of this sale", *refund.SalePaymentID)})
+			return
+		}
+		providerPayments[payment.ID] = payment
+		requested[payment.ID] += refund.Amount
+	}
+	// A provider payment gives back at most what is left of it after earlier returns
+	for paymentID, amount := range requested {
+		var refunded float64
+		if err := tx.Model(&models.SaleReturnRefund{}).Where("sale_payment_id = ? AND status <> ?", paymentID, "failed").
+			Select("COALESCE(SUM(amount), 0)").Scan(&refunded).Error; err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if refundable := roundCurrency(providerPayments[paymentID].Amount - refunded); roundCurrency(amount) > refundable {
+			tx.Rollback()
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Refund to sale payment %d (%.2f) is more than its refundable balance (%.2f)", paymentID, amount, refundable)})
+			return
+		}
+	}
+	var refundTotal, creditRefund float64
+	for _, refund := range refunds {
+		refundTotal += refund.Amount
+		if refund.PaymentMethod == "credit" {
+			creditRefund += refund.Amount
+		}
+	}
+	if math.Abs(roundCurrency(refundTotal)-refundAmount) >= 0.01 {
+		tx.Rollback()
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Refund tenders (%.2f) must equal refund amount (%.2f)", refundTotal, refundAmount)})
+		return
+	}
+	creditRefund = roundCurrency(creditRefund)
+	if creditRefund > sale.BalanceDue {
+		tx.Rollback()
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Credit refund (%.2f) is more than the balance due (%.2f)", creditRefund, sale.BalanceDue)})
+		return
+	}
+	// What the customer still owes is taken off first; only the rest is paid out
+	if owed := roundCurrency(math.Min(refundAmount, sale.BalanceDue)); creditRefund < owed {
+		tx.Rollback()
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Credit refund (%.2f) must first clear the balance due (%.2f)", creditRefund, owed)})
+		return
+	}
+
+	fullyReturned := true
+	for _, item := range sale.Items {
+		if item.GiftCardID == nil && returned[item.ID] < item.Quantity {
+			fullyReturned = false
+			break
+		}
+	}
+
+	pointsReversed, pointsRestored, err := h.returnPoints(tx, sale, refundAmount, fullyReturned)
+	if err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	returnNumber, err := nextDocumentNumber(tx, DocumentTypeSaleReturn, documentLocation{Type: "store", ID: sale.StoreID}, time.Now())
+	if err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	saleReturn := models.SaleReturn{
+		ReturnNumber:   returnNumber,
+		SaleID:         sale.ID,
+		StoreID:        sale.StoreID,
+		CustomerID:     sale.CustomerID,
+		ProcessedBy:    userID,
+		RefundAmount:   refundAmount,
+		PointsReversed: pointsReversed,
+		PointsRestored: pointsRestored,
+		Reason:         req.Reason,
+		Notes:          req.Notes,
+		ReturnDate:     time.Now(),
+	}
+
+	// Cash refunds come out of the processor's drawer, so they need one open
+	if session, err := findOpenRegisterSession(tx, sale.StoreID, userID); err == nil {
+		saleReturn.RegisterSessionID = &session.ID
+	} else {
+		for _, refund := range refunds {
+			if refund.PaymentMethod == "cash" && refund.Amount > 0 {
+				tx.Rollback()
+				c.JSON(http.StatusBadRequest, gin.H{"error": "No open register session to pay the cash refund from", "code": "no_register_session"})
+				return
+			}
+		}
+	}
+
+	if err := tx.Create(&saleReturn).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Create return items and put restockable goods back on the shelf
+	for _, item := range returnItems {
+		item.SaleReturnID = saleReturn.ID
+		if err := tx.Create(&item).Error; err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		// Serialized units come back from the customer, onto the shelf when restocked
+		if err := returnSerials(tx, sale, saleReturn, item, userID); err != nil {
+			tx.Rollback()
+			var saleErr *saleError
+			if errors.As(err, &saleErr) {
+				c.JSON(saleErr.Status, gin.H{"error": saleErr.Message, "code": saleErr.Code})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		if item.Condition != "restock" {
+			continue
+		}
+
+		// Restocked kits go back to the assembled kits and components they were sold from
+		restored, err := restoreKitStock(tx, sale.StoreID, item.SaleItemID, item.Quantity, models.InventoryTransaction{
+			UnitCost:      item.UnitPrice,
+			ReferenceType: "return",
+			ReferenceID:   &saleReturn.ID,
+			Notes:         fmt.Sprintf("Return %s for sale %s", saleReturn.ReturnNumber, sale.SaleNumber),
+			CreatedBy:     userID,
+		}, models.StockLotMovement{
+			ReferenceType: "return",
+			ReferenceID:   &saleReturn.ID,
+			Notes:         fmt.Sprintf("Return %s for sale %s", saleReturn.ReturnNumber, sale.SaleNumber),
+			CreatedBy:     userID,
+		})
+		if err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if restored {
+			continue
+		}
+
+		if err := applyStoreStockMovement(tx, models.InventoryTransaction{
+			ProductID:        item.ProductID,
+			ProductVariantID: item.ProductVariantID,
+			StoreID:          &sale.StoreID,
+			TransactionType:  "in",
+			Quantity:         item.Quantity,
+			UnitCost:         item.UnitPrice,
+			ReferenceType:    "return",
+			ReferenceID:      &saleReturn.ID,
+			Notes:            fmt.Sprintf("Return %s for sale %s", saleReturn.ReturnNumber, sale.SaleNumber),
+			CreatedBy:        userID,
+		}); err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		// Restocked goods go back into the lots they were sold from
+		if err := restoreSaleLots(tx, item.SaleItemID, item.Quantity, models.StockLotMovement{
+			ReferenceType: "return",
+			ReferenceID:   &saleReturn.ID,
+			Notes:         fmt.Sprintf("Return %s for sale %s", saleReturn.ReturnNumber, sale.SaleNumber),
+			CreatedBy:     userID,
+		}); err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	// Record refund tenders; provider refunds stay pending until the provider has been asked
+	var providerRefunds []models.SaleReturnRefund
+	for _, refundReq := range refunds {
+		refund := models.SaleReturnRefund{
+			SaleReturnID:    saleReturn.ID,
+			PaymentMethod:   refundReq.PaymentMethod,
+			Amount:          refundReq.Amount,
+			ReferenceNumber: refundReq.ReferenceNumber,
+			SalePaymentID:   refundReq.SalePaymentID,
+			Status:          "completed",
+		}
+		if refund.SalePaymentID != nil {
+			payment := providerPayments[*refund.SalePaymentID]
+			refund.PaymentMethod = payment.PaymentMethod
+			refund.ReferenceNumber = payment.ProviderReference
+			refund.Status = "pending"
+		}
+
+		// Store credit and gift card refunds go onto a card instead of out of the drawer
+		if refund.PaymentMethod == "store_credit" || refund.PaymentMethod == "gift_card" {
+			if err := refundToGiftCard(tx, sale, saleReturn, &refund, userID); err != nil {
+				tx.Rollback()
+				var saleErr *saleError
+				if errors.As(err, &saleErr) {
+					c.JSON(saleErr.Status, gin.H{"error": saleErr.Message, "code": saleErr.Code})
+					return
+				}
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+		}
+		if err := tx.Create(&refund).Error; err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if refund.Status == "pending" {
+			providerRefunds = append(providerRefunds, refund)
+		}
+	}
+
+	// Reduce customer's total_spent and loyalty points proportionally
+	if sale.CustomerID != nil {
+		if err := tx.Model(&models.Customer{}).Where("id = ?", *sale.CustomerID).
+			Update("total_spent", gorm.Expr("GREATEST(total_spent - ?, 0)", refundAmount)).Error; err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update customer stats"})
+			return
+		}
+		if err := refreshLoyaltyTier(tx, *sale.CustomerID); err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		// Points earned on the refund are taken back and points redeemed for it given back
+		for _, points := range []int{-pointsReversed, pointsRestored} {
+			if points == 0 {
+				continue
+			}
+			if _, err := postLoyaltyTransaction(tx, models.LoyaltyTransaction{
+				CustomerID:   *sale.CustomerID,
+				Type:         "adjusted",
+				Points:       points,
+				SaleID:       &sale.ID,
+				SaleReturnID: &saleReturn.ID,
+				Notes:        fmt.Sprintf("Return %s for sale %s", saleReturn.ReturnNumber, sale.SaleNumber),
+				CreatedBy:    &userID,
+			}); err != nil {
+				tx.Rollback()
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+		}
+	}
+
+	// Credit refunds reduce what the customer owes on the sale
+	if creditRefund > 0 {
+		if _, err := postCustomerLedger(tx, models.CustomerLedgerEntry{
+			CustomerID:   *sale.CustomerID,
+			EntryType:    "return",
+			SaleID:       &sale.ID,
+			SaleReturnID: &saleReturn.ID,
+			Amount:       -creditRefund,
+			Description:  fmt.Sprintf("Return %s for sale %s", saleReturn.ReturnNumber, sale.SaleNumber),
+			CreatedBy:    userID,
+		}); err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	// Update sale status; payment_status keeps describing how the sale was paid
+	saleUpdates := map[string]interface{}{"return_status": "partial"}
+	if creditRefund > 0 {
+		sale.BalanceDue = roundCurrency(sale.BalanceDue - creditRefund)
+		saleUpdates["balance_due"] = sale.BalanceDue
+		saleUpdates["payment_status"] = creditSalePaymentStatus(sale)
+	}
+	if fullyReturned {
+		saleUpdates["return_status"] = "full"
+		saleUpdates["payment_status"] = "refunded"
+		saleUpdates["sale_status"] = "refunded"
+	}
+	if err := tx.Model(&sale).Updates(saleUpdates).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// A failed provider refund is left failed for staff to settle with the provider
+	for _, refund := range providerRefunds {
+		status := "completed"
+		if err := providerRefund(providerPayments[*refund.SalePaymentID], refund.Amount); err != nil {
+			status = "failed"
+		}
+		h.DB.Model(&refund).Updates(map[string]interface{}{"status": status, "processed_at": time.Now()})
+	}
+
+	// Reload with relations
+	h.DB.Preload("Sale").Preload("Store").Preload("Customer").Preload("ProcessedByUser").
+		Preload("Items").Preload("Items.Product").Preload("Items.ProductVariant").
+		Preload("Refunds").First(&saleReturn, saleReturn.ID)
+
+	c.JSON(http.StatusCreated, gin.H{"data": saleReturn})
+}
+
+// defaultRefundTenders splits a refund the way the sale was paid: first off what the customer
+// still owes on account, the rest back through the tenders taken at the till in proportion.
+// Gift cards get the money back on the card, provider payments are refunded by the provider
+func defaultRefundTenders(tx *gorm.DB, sale models.Sale, refundAmount float64) ([]SaleReturnRefundCreate, error) {
+	var refunds []SaleReturnRefundCreate
+	creditRefund := math.Min(refundAmount, sale.BalanceDue)
+	if creditRefund > 0 {
+		refunds = append(refunds, SaleReturnRefundCreate{PaymentMethod: "credit", Amount: creditRefund})
+	}
+	rest := roundCurrency(refundAmount - creditRefund)
+	if rest <= 0 {
+		return refunds, nil
+	}
+
+	var paid []models.SalePayment
+	if err := tx.Where("sale_id = ? AND status = ? AND payment_method <> ?", sale.ID, "completed", "credit").
+		Order("id").Find(&paid).Error; err != nil {
+		return nil, err
+	}
+
+	// Change was handed back out of the cash tendered
+	change := sale.ChangeAmount
+	nets := make([]float64, len(paid))
+	var total float64
+	for i, payment := range paid {
+		nets[i] = payment.Amount
+		if payment.PaymentMethod == "cash" && change > 0 {
+			taken := math.Min(change, nets[i])
+			nets[i] -= taken
+			change -= taken
+		}
+		total += nets[i]
+	}
+	if total <= 0 {
+		return append(refunds, SaleReturnRefundCreate{PaymentMethod: "cash", Amount: rest}), nil
+	}
+
+	allocated := 0.0
+	last := -1
+	for i := range paid {
+		if nets[i] > 0 {
+			last = i
+		}
+	}
+	for i, payment := range paid {
+		if nets[i] <= 0 {
+			continue
+		}
+		amount := roundCurrency(rest * nets[i] / total)
+		if i == last {
+			amount = roundCurrency(rest - allocated)
+		}
+		allocated += amount
+		if amount <= 0 {
+			continue
+		}
+
+		refund := SaleReturnRefundCreate{PaymentMethod: payment.PaymentMethod, Amount: amount, ReferenceNumber: payment.ReferenceNumber}
+		switch {
+		case payment.Provider != "":
+			id := payment.ID
+			refund.SalePaymentID = &id
+		case payment.PaymentMethod == "gift_card":
+			// A card that can no longer take money gets store credit instead
+			var card models.GiftCard
+			if payment.GiftCardID != nil && tx.First(&card, *payment.GiftCardID).Error == nil && checkGiftCardUsable(&card) == nil {
+				refund.ReferenceNumber = card.Code
+			} else {
+				refund.PaymentMethod = "store_credit"
+				refund.ReferenceNumber = ""
+			}
+		}
+		refunds = append(refunds, refund)
+	}
+	return refunds, nil
+}
+
+// GetSaleReturns retrieves sale returns with pagination
+func (h *SaleReturnHandler) GetSaleReturns(c *gin.Context) {
+	var returns []models.SaleReturn
+	var total int64
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10"))
+	saleID := c.Query("sale_id")
+	storeID := c.Query("store_id")
+	dateFrom := c.Query("date_from")
+	dateTo := c.Query("date_to")
+
+	offset := (page - 1) * limit
+
+	query := h.DB.Preload("Sale").Preload("Store").Preload("Customer").Preload("ProcessedByUser").
+		Preload("Items").Preload("Refunds")
+
+	if saleID != "" {
+		query = query.Where("sale_id = ?", saleID)
+	}
+
+	if storeID != "" {
+		query = query.Where("store_id = ?", storeID)
+	}
+
+	if dateFrom != "" {
+		query = query.Where("DATE(return_date) >= ?", dateFrom)
+	}
+
+	if dateTo != "" {
+		query = query.Where("DATE(return_date) <= ?", dateTo)
+	}
+
+	// Get total count
+	query.Model(&models.SaleReturn{}).Count(&total)
+
+	// Get returns with pagination
+	if err := query.Order("return_date DESC").Limit(limit).Offset(offset).Find(&returns).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": returns,
+		"pagination": gin.H{
+			"current_page": page,
+			"per_page":     limit,
+			"total":        total,
+			"total_pages":  (total + int64(limit) - 1) / int64(limit),
+		},
+	})
+}
+
+// GetSaleReturn retrieves a single sale return by ID
+func (h *SaleReturnHandler) GetSaleReturn(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid sale return ID"})
+		return
+	}
+
+	var saleReturn models.SaleReturn
+	if err := h.DB.Preload("Sale").Preload("Store").Preload("Customer").Preload("ProcessedByUser").
+		Preload("Items").Preload("Items.Product").Preload("Items.ProductVariant").
+		Preload("Refunds").First(&saleReturn, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Sale return not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": saleReturn})
+}
+
+// returnedQuantities sums previously returned quantities per sale item
+func (h *SaleReturnHandler) returnedQuantities(tx *gorm.DB, saleID uint) (map[uint]float64, error) {
+	var rows []struct {
+		SaleItemID uint
+		Quantity   float64
+	}
+
+	if err := tx.Model(&models.SaleReturnItem{}).
+		Select("sale_return_items.sale_item_id, COALESCE(SUM(sale_return_items.quantity), 0) AS quantity").
+		Joins("JOIN sale_returns ON sale_returns.id = sale_return_items.sale_return_id").
+		Where("sale_returns.sale_id = ?", saleID).
+		Group("sale_return_items.sale_item_id").
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	returned := make(map[uint]float64, len(rows))
+	for _, row := range rows {
+		returned[row.SaleItemID] = row.Quantity
+	}
+	return returned, nil
+}
+
+// returnPoints works out the loyalty points a return settles: the earned points it takes back
+// and the redeemed points it gives back, as the refunded share of the sale, and all that is
+// left of both once every item has been returned
+func (h *SaleReturnHandler) returnPoints(tx *gorm.DB, sale models.Sale, refundAmount float64, fullyReturned bool) (int, int, error) {
+	if (sale.PointsEarned == 0 && sale.PointsRedeemed == 0) || sale.TotalAmount <= 0 {
+		return 0, 0, nil
+	}
+
+	var previous struct {
+		RefundAmount   float64
+		PointsReversed int
+		PointsRestored int
+	}
+	if err := tx.Model(&models.SaleReturn{}).
+		Select(`COALESCE(SUM(refund_amount), 0) AS refund_amount, COALESCE(SUM(points_reversed), 0) AS points_reversed,
+			COALESCE(SUM(points_restored), 0) AS points_restored`).
+		Where("sale_id = ?", sale.ID).
+		Scan(&previous).Error; err != nil {
+		return 0, 0, err
+	}
+
+	share := func(total, settled int) int {
+		target := total
+		if !fullyReturned {
+			target = min(int(float64(total)*(previous.RefundAmount+refundAmount)/sale.TotalAmount), total)
+		}
+		return max(target-settled, 0)
+	}
+	return share(sale.PointsEarned, previous.PointsReversed), share(sale.PointsRedeemed, previous.PointsRestored), nil
+}
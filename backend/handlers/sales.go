@@ -1,16 +1,20 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
 	"strings"
 	"time"
 
+	"starter/backend/middleware"
 	"starter/backend/models"
+	"starter/backend/payments"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type SalesHandler struct {
@@ -78,8 +82,11 @@ func (h *SalesHandler) GetSales(c *gin.Context) {
 		query = query.Where("sale_number LIKE ? OR notes LIKE ?", "%"+search+"%", "%"+search+"%")
 	}
 
+	// Parked drafts are listed through GetDrafts
 	if status != "" {
 		query = query.Where("sale_status = ?", status)
+	} else {
+		query = query.Where("sale_status <> ?", "draft")
 	}
 
 	if dateFrom != "" {
@@ -119,9 +126,9 @@ func (h *SalesHandler) GetSale(c *gin.Context) {
 	}
 
 	var sale models.Sale
-	if err := h.DB.Preload("Store").Preload("Customer").Preload("Cashier").
-		Preload("Items").Preload("Items.Product").Preload("Items.ProductVariant").
-		Preload("Payments").First(&sale, id).Error; err != nil {
+	if err := h.DB.Preload("Store").Preload("Customer").Preload("Cashier").Preload("VoidedByUser").
+		Preload("Items").Preload("Items.Product").Preload("Items.ProductVariant").Preload("Items.Taxes").
+		Preload("Payments").Preload("DiscountUsages").Preload("DiscountUsages.Discount").First(&sale, id).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Sale not found"})
 			return
@@ -133,217 +140,506 @@ func (h *SalesHandler) GetSale(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"data": sale})
 }
 
+// saleRequest is the body of CreateSale and of each sale in a sync batch
+type saleRequest struct {
+	StoreID          uint                 `json:"store_id" binding:"required"`
+	CustomerID       *uint                `json:"customer_id"`
+	DiscountID       *uint                `json:"discount_id"`
+	DiscountIDs      []uint               `json:"discount_ids"` // Further discounts to stack with DiscountID
+	PointsRedeemed   int                  `json:"points_redeemed"`
+	Items            []models.SaleItem    `json:"items" binding:"required"`
+	Payments         []models.SalePayment `json:"payments" binding:"required"`
+	OverrideApproval *OverrideApproval    `json:"override_approval"`
+	Notes            string               `json:"notes"`
+	ClientUUID       string               `json:"client_uuid"`
+	SaleDate         *time.Time           `json:"sale_date"` // Original time of an offline sale, only honoured by sync
+
+	// Cashier and register session an offline sale was rung up on, only honoured by sync
+	CashierID         *uint `json:"cashier_id"`
+	RegisterSessionID *uint `json:"register_session_id"`
+
+	draftID uint // Draft being finalized; it is consumed in the sale transaction
+}
+
+// saleError is a rejected sale with its HTTP status and a machine readable code
+type saleError struct {
+	Status  int
+	Code    string // invalid_store, insufficient_stock, discount_unavailable, ...
+	Message string
+}
+
+func (e *saleError) Error() string {
+	return e.Message
+}
+
+func newSaleError(status int, code, message string) *saleError {
+	return &saleError{Status: status, Code: code, Message: message}
+}
+
 // CreateSale creates a new sale (POS transaction)
+// Prices, discount, tax and totals are computed on the server; client amounts are ignored
 func (h *SalesHandler) CreateSale(c *gin.Context) {
-	var req struct {
-		StoreID               uint                 `json:"store_id" binding:"required"`
-		CustomerID            *uint                `json:"customer_id"`
-		DiscountID            *uint                `json:"discount_id"`
-		PointsRedeemed        int                  `json:"points_redeemed"`
-		PointsRedemptionValue float64              `json:"points_redemption_value"`
-		Items                 []models.SaleItem    `json:"items" binding:"required"`
-		Payments              []models.SalePayment `json:"payments" binding:"required"`
-		DiscountAmount        float64              `json:"discount_amount"`
-		TaxAmount             float64              `json:"tax_amount"`
-		Notes                 string               `json:"notes"`
-	}
-
+	var req saleRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
+	// Idempotency-Key header wins over the client UUID in the body
+	idempotencyKey := strings.TrimSpace(c.GetHeader("Idempotency-Key"))
+	if idempotencyKey == "" {
+		idempotencyKey = strings.TrimSpace(req.ClientUUID)
+	}
+
+	// Online sales are always stamped with the server time and rung up by the caller
+	req.SaleDate = nil
+	req.CashierID = nil
+	req.RegisterSessionID = nil
+
+	sale, replayed, err := h.processSale(req, getUserIDFromContext(c), idempotencyKey)
+	if err != nil {
+		var saleErr *saleError
+		if errors.As(err, &saleErr) {
+			c.JSON(saleErr.Status, gin.H{"error": saleErr.Message, "code": saleErr.Code})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if replayed {
+		c.Header("Idempotent-Replayed", "true")
+		c.JSON(http.StatusOK, gin.H{"data": sale})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"data": sale})
+}
+
+// processSale validates, prices and records a sale in its own transaction.
+// replayed is true when the idempotency key matched a sale created earlier
+func (h *SalesHandler) processSale(req saleRequest, userID uint, idempotencyKey string) (*models.Sale, bool, error) {
+	if len(idempotencyKey) > 100 {
+		return nil, false, newSaleError(http.StatusBadRequest, "invalid_idempotency_key", "Idempotency key must be at most 100 characters")
+	}
+
+	// Fast path for a retry of a sale that was already committed
+	if idempotencyKey != "" {
+		var existing models.Sale
+		if err := h.DB.Where("client_uuid = ?", idempotencyKey).First(&existing).Error; err == nil {
+			sale, err := h.replaySale(existing, req.StoreID)
+			return sale, err == nil, err
+		}
+	}
+
 	// Validate store exists
 	var store models.Store
 	if err := h.DB.First(&store, req.StoreID).Error; err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid store ID"})
-		return
+		return nil, false, newSaleError(http.StatusBadRequest, "invalid_store", "Invalid store ID")
 	}
 
-	// Validate points redemption if applicable
-	if req.PointsRedeemed > 0 && req.CustomerID != nil {
+	// Validate customer exists
+	if req.CustomerID != nil {
 		var customer models.Customer
 		if err := h.DB.First(&customer, *req.CustomerID).Error; err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Customer not found"})
-			return
+			return nil, false, newSaleError(http.StatusBadRequest, "invalid_customer", "Customer not found")
 		}
-		if !customer.IsMember {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Only members can redeem points"})
-			return
+	}
+
+	overrideBy, err := h.resolvePriceOverride(userID, req.OverrideApproval)
+	if err != nil {
+		return nil, false, newSaleError(http.StatusForbidden, "override_denied", err.Error())
+	}
+
+	saleDate := time.Now()
+	if req.SaleDate != nil {
+		saleDate = *req.SaleDate
+	}
+
+	// Payments confirmed by a provider (QRIS, EDC) stay pending until the provider reports back
+	awaitingProvider := false
+	paymentExpiry := time.Now().Add(time.Duration(getSettingFloat(h.DB, "payment_timeout_minutes", 15)) * time.Minute)
+	for i := range req.Payments {
+		payment := &req.Payments[i]
+		payment.ProviderReference = ""
+		payment.PaymentPayload = ""
+		payment.ExpiresAt = nil
+		payment.GiftCardID = nil
+		payment.Status = "completed"
+		// A negative tender would credit a gift card or offset another tender
+		if payment.Amount <= 0 {
+			return nil, false, newSaleError(http.StatusBadRequest, "invalid_payment", "Payment amounts must be greater than zero")
 		}
-		if customer.LoyaltyPoints < req.PointsRedeemed {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Insufficient loyalty points"})
-			return
+		if payment.PaymentMethod == "gift_card" && payment.Provider != "" {
+			return nil, false, newSaleError(http.StatusBadRequest, "invalid_payment_provider", "Gift card payments are confirmed at the till")
 		}
+		if payment.Provider == "" {
+			continue
+		}
+		if _, err := payments.Get(payment.Provider); err != nil {
+			return nil, false, newSaleError(http.StatusBadRequest, "invalid_payment_provider", err.Error())
+		}
+		payment.Status = "pending"
+		payment.ExpiresAt = &paymentExpiry
+		awaitingProvider = true
 	}
 
 	// Start transaction
 	tx := h.DB.Begin()
 
-	// Generate sale number
-	saleNumber := h.generateSaleNumber()
+	// Serialize racing retries on the key; the loser waits here until the
+	// winner commits and then finds its sale
+	if idempotencyKey != "" {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext(?))", idempotencyKey).Error; err != nil {
+			tx.Rollback()
+			return nil, false, err
+		}
 
-	// Calculate totals
-	var subtotal float64
-	for _, item := range req.Items {
-		subtotal += item.TotalPrice
+		var existing models.Sale
+		if err := tx.Where("client_uuid = ?", idempotencyKey).First(&existing).Error; err == nil {
+			tx.Rollback()
+			sale, err := h.replaySale(existing, req.StoreID)
+			return sale, err == nil, err
+		}
+	}
+
+	// Sales must be rung up on an open register session; the shared lock
+	// keeps the session from being closed until this sale is committed.
+	// Offline sales go on the cashier's session that was open at the time of sale
+	var session models.RegisterSession
+	sessionQuery := tx.Clauses(clause.Locking{Strength: "SHARE"}).Where("store_id = ? AND cashier_id = ?", req.StoreID, userID)
+	if req.SaleDate == nil {
+		sessionQuery = sessionQuery.Where("status = ?", "open")
+	} else {
+		sessionQuery = sessionQuery.Where("opened_at <= ? AND (closed_at IS NULL OR closed_at >= ?)", saleDate, saleDate).
+			Order("opened_at DESC")
+		if req.RegisterSessionID != nil {
+			sessionQuery = sessionQuery.Where("id = ?", *req.RegisterSessionID)
+		}
+	}
+	if err := sessionQuery.First(&session).Error; err != nil {
+		tx.Rollback()
+		if req.SaleDate != nil {
+			return nil, false, newSaleError(http.StatusBadRequest, "no_register_session", "No register session of the cashier was open at the time of sale")
+		}
+		return nil, false, newSaleError(http.StatusBadRequest, "no_register_session", "No open register session")
 	}
 
-	totalAmount := subtotal + req.TaxAmount - req.DiscountAmount
+	// A finalized draft gives back its reserved stock before the sale takes it
+	if req.draftID != 0 {
+		if err := consumeDraft(tx, req.draftID); err != nil {
+			tx.Rollback()
+			return nil, false, err
+		}
+	}
+
+	// Generate sale number from the store's sequence
+	saleNumber, err := nextDocumentNumber(tx, DocumentTypeSale, documentLocation{Type: "store", ID: req.StoreID}, saleDate)
+	if err != nil {
+		tx.Rollback()
+		return nil, false, err
+	}
 
-	// Calculate total paid amount
-	var paidAmount float64
+	// Calculate totals from catalog prices and settings, as of the time of sale
+	discountIDs := selectedDiscountIDs(req.DiscountID, req.DiscountIDs)
+	quote, err := quoteSale(tx, saleQuoteRequest{
+		StoreID:        req.StoreID,
+		CustomerID:     req.CustomerID,
+		DiscountIDs:    discountIDs,
+		PointsRedeemed: req.PointsRedeemed,
+		Items:          req.Items,
+		OverrideBy:     overrideBy,
+		RequireSerials: true,
+		PricedAt:       req.SaleDate,
+	}, saleDate)
+	if err != nil {
+		tx.Rollback()
+		var saleErr *saleError
+		if errors.As(err, &saleErr) {
+			return nil, false, saleErr
+		}
+		return nil, false, newSaleError(http.StatusBadRequest, "invalid_sale", err.Error())
+	}
+	totalAmount := quote.TotalAmount
+
+	// Calculate total paid amount; the credit tender is charged to the customer's account instead
+	var paidAmount, creditAmount, giftCardAmount float64
 	for _, payment := range req.Payments {
+		if payment.PaymentMethod == "credit" {
+			creditAmount += payment.Amount
+			continue
+		}
+		if payment.PaymentMethod == "gift_card" {
+			giftCardAmount += payment.Amount
+		}
 		paidAmount += payment.Amount
 	}
+	paidAmount = roundCurrency(paidAmount)
+	creditAmount = roundCurrency(creditAmount)
+	giftCardAmount = roundCurrency(giftCardAmount)
 
-	changeAmount := paidAmount - totalAmount
-	if changeAmount < 0 {
-		changeAmount = 0
+	if creditAmount > totalAmount {
+		tx.Rollback()
+		return nil, false, newSaleError(http.StatusBadRequest, "invalid_sale",
+			fmt.Sprintf("Credit amount (%.2f) is more than total (%.2f)", creditAmount, totalAmount))
 	}
 
-	// Get user ID from JWT token
-	userID := uint(1) // Default fallback
-	if uid, exists := c.Get("user_id"); exists {
-		if id, ok := uid.(uint); ok {
-			userID = id
-		}
+	// Gift cards pay out their exact amount, so change is never given from a card balance
+	if giftCardAmount > roundCurrency(totalAmount-creditAmount) {
+		tx.Rollback()
+		return nil, false, newSaleError(http.StatusBadRequest, "invalid_sale",
+			fmt.Sprintf("Gift card amount (%.2f) is more than the amount due (%.2f)", giftCardAmount, roundCurrency(totalAmount-creditAmount)))
+	}
+
+	if roundCurrency(paidAmount+creditAmount) < totalAmount {
+		tx.Rollback()
+		return nil, false, newSaleError(http.StatusBadRequest, "underpaid",
+			fmt.Sprintf("Paid amount (%.2f) is less than total (%.2f)", roundCurrency(paidAmount+creditAmount), totalAmount))
 	}
 
+	// Change only ever comes out of the money tendered
+	changeAmount := roundCurrency(paidAmount + creditAmount - totalAmount)
+
 	// Determine primary payment method from payments
 	primaryPaymentMethod := "cash"
 	if len(req.Payments) > 0 {
 		primaryPaymentMethod = req.Payments[0].PaymentMethod
 	}
 
+	var clientUUID *string
+	if idempotencyKey != "" {
+		clientUUID = &idempotencyKey
+	}
+
+	paymentStatus, saleStatus := "paid", "completed"
+	if creditAmount > 0 {
+		paymentStatus = creditSalePaymentStatus(models.Sale{TotalAmount: totalAmount, BalanceDue: creditAmount})
+	}
+	if awaitingProvider {
+		paymentStatus, saleStatus = "pending", "pending"
+	}
+
 	// Create sale
 	sale := models.Sale{
-		SaleNumber:     saleNumber,
-		StoreID:        req.StoreID,
-		CustomerID:     req.CustomerID,
-		DiscountID:     req.DiscountID,
-		CashierID:      userID,
-		Subtotal:       subtotal,
-		TaxAmount:      req.TaxAmount,
-		DiscountAmount: req.DiscountAmount,
-		TotalAmount:    totalAmount,
-		PaidAmount:     paidAmount,
-		ChangeAmount:   changeAmount,
-		PaymentStatus:  "paid",
-		SaleStatus:     "completed",
-		PaymentMethod:  primaryPaymentMethod,
-		Notes:          req.Notes,
-		SaleDate:       time.Now(),
+		SaleNumber:        saleNumber,
+		ClientUUID:        clientUUID,
+		StoreID:           req.StoreID,
+		CustomerID:        req.CustomerID,
+		DiscountID:        firstDiscountID(discountIDs),
+		DiscountIDs:       encodeDiscountIDs(discountIDs),
+		CashierID:         userID,
+		RegisterSessionID: &session.ID,
+		Subtotal:          quote.Subtotal,
+		TaxAmount:         quote.TaxAmount,
+		PricesIncludeTax:  quote.PricesIncludeTax,
+		DiscountAmount:    quote.DiscountAmount,
+		TotalAmount:       totalAmount,
+		PaidAmount:        paidAmount,
+		ChangeAmount:      changeAmount,
+		CreditAmount:      creditAmount,
+		BalanceDue:        creditAmount,
+		PaymentStatus:     paymentStatus,
+		SaleStatus:        saleStatus,
+		PaymentMethod:     primaryPaymentMethod,
+		Notes:             req.Notes,
+		SaleDate:          saleDate,
 	}
 
 	if err := tx.Create(&sale).Error; err != nil {
 		tx.Rollback()
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
+		return nil, false, err
 	}
 
-	// Track discount usage if discount was applied
-	if req.DiscountID != nil && req.DiscountAmount > 0 {
-		// Increment discount usage count
-		if err := tx.Model(&models.Discount{}).Where("id = ?", *req.DiscountID).
-			UpdateColumn("usage_count", gorm.Expr("usage_count + 1")).Error; err != nil {
+	// Put the credit part on the customer's account, within their credit limit
+	if creditAmount > 0 {
+		if err := chargeCustomerAccount(tx, sale, userID); err != nil {
 			tx.Rollback()
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update discount usage"})
-			return
+			return nil, false, err
 		}
+	}
 
-		// Create discount usage record
-		discountUsage := models.DiscountUsage{
-			DiscountID: *req.DiscountID,
+	// Record every discount the sale received, selected or automatic
+	for _, applied := range quote.Applied {
+		if err := tx.Model(&models.Discount{}).Where("id = ?", applied.DiscountID).
+			UpdateColumn("usage_count", gorm.Expr("usage_count + 1")).Error; err != nil {
+			tx.Rollback()
+			return nil, false, errors.New("Failed to update discount usage")
+		}
+		if err := tx.Create(&models.DiscountUsage{
+			DiscountID: applied.DiscountID,
 			CustomerID: req.CustomerID,
 			SaleID:     sale.ID,
-			Amount:     req.DiscountAmount,
-		}
-		if err := tx.Create(&discountUsage).Error; err != nil {
+			Amount:     applied.Amount,
+		}).Error; err != nil {
 			tx.Rollback()
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create discount usage record"})
-			return
+			return nil, false, errors.New("Failed to create discount usage record")
 		}
 	}
 
 	// Create sale items and update inventory
-	for _, item := range req.Items {
+	for n, item := range quote.Items {
 		item.SaleID = sale.ID
+		for i := range item.Taxes {
+			item.Taxes[i].SaleID = sale.ID
+		}
+
+		// Gift card lines issue or load their card instead of taking stock
+		if quote.GiftCards[n] {
+			if err := issueSaleGiftCard(tx, sale, &item, userID); err != nil {
+				tx.Rollback()
+				return nil, false, err
+			}
+			if err := tx.Create(&item).Error; err != nil {
+				tx.Rollback()
+				return nil, false, err
+			}
+			continue
+		}
+
+		// Creates the tax breakdown lines along with the item
 		if err := tx.Create(&item).Error; err != nil {
 			tx.Rollback()
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
+			return nil, false, err
 		}
 
 		// Update inventory (reduce stock from store)
 		if err := h.updateInventoryForSale(tx, req.StoreID, item, userID); err != nil {
 			tx.Rollback()
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
+			return nil, false, err
+		}
+
+		// Serialized units leave the store with the customer
+		if err := sellSerials(tx, sale, item, userID); err != nil {
+			tx.Rollback()
+			return nil, false, err
 		}
 	}
 
 	// Create sale payments
 	for _, payment := range req.Payments {
 		payment.SaleID = sale.ID
-		payment.Status = "completed"
+		if payment.PaymentMethod == "gift_card" {
+			if err := redeemGiftCardPayment(tx, sale, &payment, userID); err != nil {
+				tx.Rollback()
+				return nil, false, err
+			}
+		}
 		if err := tx.Create(&payment).Error; err != nil {
 			tx.Rollback()
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
+			return nil, false, err
 		}
 	}
 
-	// Update customer's total_spent, loyalty_points and last_visit if customer is specified
+	// Update customer's total_spent, loyalty points, tier and last_visit if customer is specified
 	if req.CustomerID != nil {
 		now := time.Now()
 
-		// Get loyalty settings from database
-		minPurchaseForPoints := float64(10000) // Default: 1 point per Rp 10,000
-		var loyaltySetting models.Setting
-		if err := tx.Where("key = ?", "loyalty_min_purchase").First(&loyaltySetting).Error; err == nil {
-			if val, err := strconv.ParseFloat(loyaltySetting.Value, 64); err == nil && val > 0 {
-				minPurchaseForPoints = val
+		var customer models.Customer
+		if err := tx.First(&customer, *req.CustomerID).Error; err == nil && customer.IsMember {
+			// Get loyalty settings from database
+			minPurchaseForPoints := getSettingFloat(tx, "loyalty_min_purchase", 10000) // Default: 1 point per Rp 10,000
+			if minPurchaseForPoints <= 0 {
+				minPurchaseForPoints = 10000
 			}
-		}
 
-		// Calculate loyalty points earned (before points redemption)
-		loyaltyPointsEarned := 0
-		if totalAmount >= minPurchaseForPoints {
-			loyaltyPointsEarned = int(totalAmount / minPurchaseForPoints)
-		}
+			// Points are earned on what the customer pays for goods, at the rate of their tier
+			loyaltyPointsEarned := 0
+			if earningAmount := quote.loyaltyAmount(); earningAmount >= minPurchaseForPoints {
+				loyaltyPointsEarned = int(earningAmount / minPurchaseForPoints * loyaltyEarnMultiplier(tx, customer))
+			}
+
+			if req.PointsRedeemed > 0 {
+				if _, err := postLoyaltyTransaction(tx, models.LoyaltyTransaction{
+					CustomerID: customer.ID,
+					Type:       "redeemed",
+					Points:     -req.PointsRedeemed,
+					SaleID:     &sale.ID,
+					Notes:      fmt.Sprintf("Redeemed on sale %s", sale.SaleNumber),
+					CreatedBy:  &userID,
+				}); err != nil {
+					tx.Rollback()
+					return nil, false, err
+				}
+			}
+			if loyaltyPointsEarned > 0 {
+				if _, err := postLoyaltyTransaction(tx, models.LoyaltyTransaction{
+					CustomerID: customer.ID,
+					Type:       "earned",
+					Points:     loyaltyPointsEarned,
+					SaleID:     &sale.ID,
+					Notes:      fmt.Sprintf("Earned on sale %s", sale.SaleNumber),
+					CreatedBy:  &userID,
+				}); err != nil {
+					tx.Rollback()
+					return nil, false, err
+				}
+			}
 
-		// Calculate net points change (earned - redeemed)
-		netPointsChange := loyaltyPointsEarned - req.PointsRedeemed
+			// Remember the applied points so the sale can be reversed exactly
+			sale.PointsEarned = loyaltyPointsEarned
+			sale.PointsRedeemed = req.PointsRedeemed
+			if err := tx.Model(&sale).UpdateColumns(map[string]interface{}{
+				"points_earned":   sale.PointsEarned,
+				"points_redeemed": sale.PointsRedeemed,
+			}).Error; err != nil {
+				tx.Rollback()
+				return nil, false, err
+			}
+		}
 
 		updates := map[string]interface{}{
 			"total_spent": gorm.Expr("total_spent + ?", totalAmount),
 			"last_visit":  now,
 		}
-
-		// Update loyalty points if customer is a member
-		var customer models.Customer
-		if err := tx.First(&customer, *req.CustomerID).Error; err == nil && customer.IsMember {
-			if netPointsChange != 0 {
-				updates["loyalty_points"] = gorm.Expr("loyalty_points + ?", netPointsChange)
-			}
-		}
-
 		if err := tx.Model(&models.Customer{}).Where("id = ?", *req.CustomerID).Updates(updates).Error; err != nil {
 			tx.Rollback()
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update customer stats"})
-			return
+			return nil, false, errors.New("Failed to update customer stats")
+		}
+		if err := refreshLoyaltyTier(tx, *req.CustomerID); err != nil {
+			tx.Rollback()
+			return nil, false, err
 		}
 	}
 
-	tx.Commit()
+	if err := tx.Commit().Error; err != nil {
+		return nil, false, err
+	}
+
+	if awaitingProvider {
+		h.DB.Preload("Payments").First(&sale, sale.ID)
+		if err := initiateProviderPayments(h.DB, &sale); err != nil {
+			// Without an initiated payment the customer cannot pay; give the stock back
+			for _, payment := range sale.Payments {
+				if payment.Status == "pending" {
+					if releaseErr := settleProviderPayment(h.DB, payment.ID, payments.StatusFailed, 0); releaseErr != nil {
+						return nil, false, releaseErr
+					}
+					break
+				}
+			}
+			return nil, false, newSaleError(http.StatusBadGateway, "payment_provider_error", "Payment provider error: "+err.Error())
+		}
+	}
 
 	// Reload with all relations
+	h.DB.Preload("Store").Preload("Customer").Preload("Cashier").
+		Preload("Items").Preload("Items.Product").Preload("Items.ProductVariant").Preload("Items.Taxes").
+		Preload("Payments").Preload("DiscountUsages").Preload("DiscountUsages.Discount").First(&sale, sale.ID)
+
+	return &sale, false, nil
+}
+
+// replaySale returns the sale created by the first attempt of a retried submission
+func (h *SalesHandler) replaySale(sale models.Sale, storeID uint) (*models.Sale, error) {
+	if sale.StoreID != storeID {
+		return nil, newSaleError(http.StatusConflict, "idempotency_conflict", "Idempotency key was already used for another sale")
+	}
+
 	h.DB.Preload("Store").Preload("Customer").Preload("Cashier").
 		Preload("Items").Preload("Items.Product").Preload("Items.ProductVariant").
 		Preload("Payments").First(&sale, sale.ID)
 
-	c.JSON(http.StatusCreated, gin.H{"data": sale})
+	return &sale, nil
 }
 
 // UpdateSale updates an existing sale
@@ -376,7 +672,8 @@ func (h *SalesHandler) UpdateSale(c *gin.Context) {
 		return
 	}
 
-	if err := h.DB.Model(&sale).Updates(updateData).Error; err != nil {
+	// Cart contents, status and totals only change through UpdateDraft and FinalizeDraft
+	if err := h.DB.Model(&sale).Select("notes").Updates(updateData).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -388,20 +685,162 @@ func (h *SalesHandler) UpdateSale(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"data": sale})
 }
 
-// generateSaleNumber generates a unique sale number
-func (h *SalesHandler) generateSaleNumber() string {
+// VoidSale cancels a completed sale and reverses all of its side effects
+func (h *SalesHandler) VoidSale(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid sale ID"})
+		return
+	}
+
+	var req struct {
+		Reason string `json:"reason" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID := getUserIDFromContext(c)
+
+	// Start transaction
+	tx := h.DB.Begin()
+
+	// Lock the sale row so concurrent voids cannot both pass the status check
+	var sale models.Sale
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Preload("Items").First(&sale, id).Error; err != nil {
+		tx.Rollback()
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Sale not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	if sale.SaleStatus != "completed" {
+		tx.Rollback()
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Only completed sales can be voided"})
+		return
+	}
+
+	// Returned goods have already been reversed; a void would count them twice
+	var returnCount int64
+	tx.Model(&models.SaleReturn{}).Where("sale_id = ?", sale.ID).Count(&returnCount)
+	if returnCount > 0 {
+		tx.Rollback()
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot void a sale that has returns"})
+		return
+	}
+
+	// Put back stock, discount usage and customer stats
+	if err := reverseSaleEffects(tx, sale, userID, "void", fmt.Sprintf("Void sale: %s", sale.SaleNumber)); err != nil {
+		tx.Rollback()
+		var saleErr *saleError
+		if errors.As(err, &saleErr) {
+			c.JSON(saleErr.Status, gin.H{"error": saleErr.Message, "code": saleErr.Code})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Payments collected by a provider are refunded once the void is committed
+	var providerPayments []models.SalePayment
+	if err := tx.Where("sale_id = ? AND status = ? AND provider <> ?", sale.ID, "completed", "").Find(&providerPayments).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if len(providerPayments) > 0 {
+		if err := tx.Model(&models.SalePayment{}).Where("sale_id = ? AND status = ? AND provider <> ?", sale.ID, "completed", "").
+			Update("status", "refund_pending").Error; err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	// Mark the sale as cancelled
 	now := time.Now()
-	dateStr := now.Format("20060102")
+	if err := tx.Model(&sale).Updates(map[string]interface{}{
+		"sale_status":    "cancelled",
+		"payment_status": "refunded",
+		"void_reason":    req.Reason,
+		"voided_by":      userID,
+		"voided_at":      now,
+	}).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
 
-	var count int64
-	h.DB.Model(&models.Sale{}).Where("DATE(created_at) = CURRENT_DATE").Count(&count)
+	if err := tx.Commit().Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// A failed refund leaves the payment refund_failed for staff to settle with the provider
+	message := "Sale voided successfully"
+	failed := 0
+	for _, payment := range providerPayments {
+		if err := refundProviderPayment(h.DB, payment, payment.Amount); err != nil {
+			failed++
+		}
+	}
+	if failed > 0 {
+		message = fmt.Sprintf("Sale voided; %d provider refund(s) failed and must be settled with the provider", failed)
+	}
+
+	// Reload with all relations
+	h.DB.Preload("Store").Preload("Customer").Preload("Cashier").Preload("VoidedByUser").
+		Preload("Items").Preload("Items.Product").Preload("Items.ProductVariant").
+		Preload("Payments").First(&sale, sale.ID)
 
-	// Use timestamp to ensure uniqueness
-	return fmt.Sprintf("TRX%s%d", dateStr, now.UnixNano()/1000000)
+	c.JSON(http.StatusOK, gin.H{"data": sale, "message": message})
+}
+
+// OverrideApproval carries the credentials of a manager approving a price override at the till
+type OverrideApproval struct {
+	Username string `json:"username" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+// resolvePriceOverride returns the user allowed to override prices for this sale:
+// the cashier when they hold sales.price_override, otherwise the approving manager.
+// Returns nil without error when no override is available
+func (h *SalesHandler) resolvePriceOverride(userID uint, approval *OverrideApproval) (*uint, error) {
+	if approval == nil {
+		var cashier models.User
+		if err := h.DB.First(&cashier, userID).Error; err == nil && middleware.UserHasPermission(&cashier, "sales.price_override") {
+			return &cashier.ID, nil
+		}
+		return nil, nil
+	}
+
+	var approver models.User
+	if err := h.DB.Where("username = ? OR email = ?", approval.Username, approval.Username).First(&approver).Error; err != nil ||
+		!approver.IsActive || !approver.CheckPassword(approval.Password) {
+		return nil, errors.New("Invalid override credentials")
+	}
+	if !middleware.UserHasPermission(&approver, "sales.price_override") {
+		return nil, errors.New("Approver is not allowed to override prices")
+	}
+	return &approver.ID, nil
 }
 
 // updateInventoryForSale reduces store inventory when sale is made
 func (h *SalesHandler) updateInventoryForSale(tx *gorm.DB, storeID uint, item models.SaleItem, userID uint) error {
+	// Kits are sold from assembled kits and their components
+	components, err := kitComponents(tx, item.ProductID)
+	if err != nil {
+		return err
+	}
+	if len(components) > 0 {
+		return sellKit(tx, storeID, item, components, userID)
+	}
+
 	// Find store inventory record
 	var inventory models.StoreInventory
 	where := models.StoreInventory{
@@ -410,25 +849,38 @@ func (h *SalesHandler) updateInventoryForSale(tx *gorm.DB, storeID uint, item mo
 		StoreID:          storeID,
 	}
 
-	if err := tx.Where(where).First(&inventory).Error; err != nil {
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where(where).First(&inventory).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
-			return fmt.Errorf("product ID %d not found in store inventory", item.ProductID)
+			return newSaleError(http.StatusBadRequest, "insufficient_stock",
+				fmt.Sprintf("product ID %d not found in store inventory", item.ProductID))
 		}
 		return err
 	}
 
-	// Check if enough stock
-	if inventory.Quantity < item.Quantity {
-		return fmt.Errorf("insufficient inventory for product ID %d. Available: %.2f, Required: %.2f",
-			item.ProductID, inventory.Quantity, item.Quantity)
+	// Check if enough stock; stock held by parked drafts is not available
+	if available := inventory.Quantity - inventory.ReservedQuantity; available < item.Quantity {
+		return newSaleError(http.StatusBadRequest, "insufficient_stock",
+			fmt.Sprintf("insufficient inventory for product ID %d. Available: %.2f, Required: %.2f",
+				item.ProductID, available, item.Quantity))
 	}
 
 	// Reduce inventory
 	inventory.Quantity -= item.Quantity
+	inventory.LastUpdated = time.Now()
 	if err := tx.Save(&inventory).Error; err != nil {
 		return err
 	}
 
+	// Sell from the lots expiring first; the line remembers its lots for returns
+	if _, err := takeStockLots(tx, item.ProductID, item.ProductVariantID, storeLot(storeID), item.Quantity, inventory.Quantity, models.StockLotMovement{
+		ReferenceType: "sale",
+		ReferenceID:   &item.SaleID,
+		SaleItemID:    &item.ID,
+		CreatedBy:     userID,
+	}); err != nil {
+		return err
+	}
+
 	// Create inventory transaction
 	transaction := models.InventoryTransaction{
 		ProductID:        item.ProductID,
@@ -447,6 +899,129 @@ func (h *SalesHandler) updateInventoryForSale(tx *gorm.DB, storeID uint, item mo
 	return tx.Create(&transaction).Error
 }
 
+// reverseSaleEffects undoes what creating a sale did: it returns the items to store inventory,
+// reverses gift card movements, releases discount usage, takes back the customer's total_spent
+// and loyalty points and clears the balance still owed on account
+func reverseSaleEffects(tx *gorm.DB, sale models.Sale, userID uint, referenceType, notes string) error {
+	for _, item := range sale.Items {
+		// Gift card lines never took stock
+		if item.GiftCardID != nil {
+			continue
+		}
+		// Kits go back to the assembled kits and components they were sold from
+		restored, err := restoreKitStock(tx, sale.StoreID, item.ID, item.Quantity, models.InventoryTransaction{
+			UnitCost:      item.UnitPrice,
+			ReferenceType: referenceType,
+			ReferenceID:   &sale.ID,
+			Notes:         notes,
+			CreatedBy:     userID,
+		}, models.StockLotMovement{
+			ReferenceType: referenceType,
+			ReferenceID:   &sale.ID,
+			Notes:         notes,
+			CreatedBy:     userID,
+		})
+		if err != nil {
+			return err
+		}
+		if restored {
+			continue
+		}
+		if err := applyStoreStockMovement(tx, models.InventoryTransaction{
+			ProductID:        item.ProductID,
+			ProductVariantID: item.ProductVariantID,
+			StoreID:          &sale.StoreID,
+			TransactionType:  "in",
+			Quantity:         item.Quantity,
+			UnitCost:         item.UnitPrice,
+			ReferenceType:    referenceType,
+			ReferenceID:      &sale.ID,
+			Notes:            notes,
+			CreatedBy:        userID,
+		}); err != nil {
+			return err
+		}
+		if err := restoreSaleLots(tx, item.ID, item.Quantity, models.StockLotMovement{
+			ReferenceType: referenceType,
+			ReferenceID:   &sale.ID,
+			Notes:         notes,
+			CreatedBy:     userID,
+		}); err != nil {
+			return err
+		}
+		if err := releaseSaleSerials(tx, sale, item, userID, referenceType, notes); err != nil {
+			return err
+		}
+	}
+
+	// Put gift card payments back and take back the cards the sale issued
+	if err := reverseSaleGiftCards(tx, sale, userID, notes); err != nil {
+		return err
+	}
+
+	// Roll back discount usage
+	var usages []models.DiscountUsage
+	if err := tx.Where("sale_id = ?", sale.ID).Find(&usages).Error; err != nil {
+		return err
+	}
+	for _, usage := range usages {
+		if err := tx.Model(&models.Discount{}).Where("id = ? AND usage_count > 0", usage.DiscountID).
+			UpdateColumn("usage_count", gorm.Expr("usage_count - 1")).Error; err != nil {
+			return errors.New("Failed to update discount usage")
+		}
+		if err := tx.Delete(&usage).Error; err != nil {
+			return errors.New("Failed to delete discount usage record")
+		}
+	}
+
+	// Roll back customer's total_spent and loyalty points
+	if sale.CustomerID != nil {
+		if err := tx.Model(&models.Customer{}).Where("id = ?", *sale.CustomerID).
+			Update("total_spent", gorm.Expr("GREATEST(total_spent - ?, 0)", sale.TotalAmount)).Error; err != nil {
+			return errors.New("Failed to update customer stats")
+		}
+		if err := refreshLoyaltyTier(tx, *sale.CustomerID); err != nil {
+			return err
+		}
+
+		// Points earned are taken back and redeemed points given back, through the ledger
+		for _, points := range []int{-sale.PointsEarned, sale.PointsRedeemed} {
+			if points == 0 {
+				continue
+			}
+			if _, err := postLoyaltyTransaction(tx, models.LoyaltyTransaction{
+				CustomerID: *sale.CustomerID,
+				Type:       "adjusted",
+				Points:     points,
+				SaleID:     &sale.ID,
+				Notes:      notes,
+				CreatedBy:  &userID,
+			}); err != nil {
+				return err
+			}
+		}
+
+		// Take what is still owed off the account; money already paid on it is refunded with the sale
+		if sale.BalanceDue > 0 {
+			if _, err := postCustomerLedger(tx, models.CustomerLedgerEntry{
+				CustomerID:  *sale.CustomerID,
+				EntryType:   "reversal",
+				SaleID:      &sale.ID,
+				Amount:      -sale.BalanceDue,
+				Description: notes,
+				CreatedBy:   userID,
+			}); err != nil {
+				return err
+			}
+			if err := tx.Model(&sale).UpdateColumn("balance_due", 0).Error; err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
 // GetSalesStats retrieves sales statistics
 func (h *SalesHandler) GetSalesStats(c *gin.Context) {
 	storeID := c.Query("store_id")
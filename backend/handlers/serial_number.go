@@ -0,0 +1,425 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"starter/backend/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type SerialNumberHandler struct {
+	DB *gorm.DB
+}
+
+func NewSerialNumberHandler(db *gorm.DB) *SerialNumberHandler {
+	return &SerialNumberHandler{DB: db}
+}
+
+// cleanSerialNumbers trims the serial numbers and drops blanks
+func cleanSerialNumbers(serials []string) []string {
+	cleaned := make([]string, 0, len(serials))
+	for _, serial := range serials {
+		if serial = strings.TrimSpace(serial); serial != "" {
+			cleaned = append(cleaned, serial)
+		}
+	}
+	return cleaned
+}
+
+// encodeSerialNumbers stores a serial number list on a line
+func encodeSerialNumbers(serials []string) json.RawMessage {
+	if len(serials) == 0 {
+		return nil
+	}
+	data, _ := json.Marshal(serials)
+	return data
+}
+
+// decodeSerialNumbers reads a serial number list back from a line
+func decodeSerialNumbers(data json.RawMessage) ([]string, error) {
+	var serials []string
+	if len(data) > 0 && string(data) != "null" {
+		if err := json.Unmarshal(data, &serials); err != nil {
+			return nil, newSaleError(http.StatusBadRequest, "serial_invalid", "serial_numbers must be a list of strings")
+		}
+	}
+	return cleanSerialNumbers(serials), nil
+}
+
+// checkSerialCount verifies that a line of a serialized product names one distinct serial
+// number per unit, and that other products are not given any
+func checkSerialCount(product models.Product, serials []string, quantity float64) error {
+	if !product.IsSerialized {
+		if len(serials) > 0 {
+			return newSaleError(http.StatusBadRequest, "serial_not_allowed", fmt.Sprintf("%s is not tracked by serial number", product.Name))
+		}
+		return nil
+	}
+	if quantity != math.Trunc(quantity) {
+		return newSaleError(http.StatusBadRequest, "serial_count", fmt.Sprintf("%s is serialized and is counted in whole units", product.Name))
+	}
+	if len(serials) != int(quantity) {
+		return newSaleError(http.StatusBadRequest, "serial_count",
+			fmt.Sprintf("%s needs %d serial numbers, got %d", product.Name, int(quantity), len(serials)))
+	}
+	seen := make(map[string]bool, len(serials))
+	for _, serial := range serials {
+		if seen[serial] {
+			return newSaleError(http.StatusBadRequest, "serial_duplicate", fmt.Sprintf("Serial number %s is listed twice", serial))
+		}
+		seen[serial] = true
+	}
+	return nil
+}
+
+// setSerialLocation places a serial at a location, nil clears it
+func setSerialLocation(serial *models.SerialNumber, loc *lotLocation) {
+	serial.LocationType, serial.WarehouseID, serial.StoreID = "", nil, nil
+	if loc == nil {
+		return
+	}
+	id := loc.ID
+	serial.LocationType = loc.Type
+	if loc.Type == "warehouse" {
+		serial.WarehouseID = &id
+	} else {
+		serial.StoreID = &id
+	}
+}
+
+// moveSerial saves a serial with its new status and location and adds the event to its history
+func moveSerial(tx *gorm.DB, serial *models.SerialNumber, status string, loc *lotLocation, event models.SerialNumberEvent) error {
+	serial.Status = status
+	setSerialLocation(serial, loc)
+	if err := tx.Omit(clause.Associations).Save(serial).Error; err != nil {
+		return err
+	}
+
+	event.SerialNumberID = serial.ID
+	event.Status = serial.Status
+	event.LocationType = serial.LocationType
+	event.WarehouseID = serial.WarehouseID
+	event.StoreID = serial.StoreID
+	return tx.Create(&event).Error
+}
+
+// receiveSerials registers new units of a product in stock at a location
+func receiveSerials(tx *gorm.DB, product models.Product, variantID *uint, serials []string, loc lotLocation, unitCost float64, purchaseOrderID *uint, event models.SerialNumberEvent) error {
+	for _, number := range serials {
+		var existing models.SerialNumber
+		if err := tx.Where("serial_number = ? AND product_id = ?", number, product.ID).First(&existing).Error; err == nil {
+			return newSaleError(http.StatusBadRequest, "serial_exists",
+				fmt.Sprintf("Serial number %s of %s is already registered (%s)", number, product.Name, existing.Status))
+		} else if err != gorm.ErrRecordNotFound {
+			return err
+		}
+
+		serial := models.SerialNumber{
+			SerialNumber:     number,
+			ProductID:        product.ID,
+			ProductVariantID: variantID,
+			UnitCost:         unitCost,
+			PurchaseOrderID:  purchaseOrderID,
+		}
+		event.Event = "received"
+		if err := moveSerial(tx, &serial, "in_stock", &loc, event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// lockSerials loads the named units of a product, locked, and checks that every one of them
+// is in one of the statuses and, when loc is given, at that location
+func lockSerials(tx *gorm.DB, product models.Product, variantID *uint, serials []string, statuses []string, loc *lotLocation) ([]models.SerialNumber, error) {
+	query := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("serial_number IN ? AND product_id = ?", serials, product.ID)
+	if variantID != nil {
+		query = query.Where("product_variant_id = ?", *variantID)
+	}
+	var found []models.SerialNumber
+	if err := query.Find(&found).Error; err != nil {
+		return nil, err
+	}
+
+	byNumber := make(map[string]models.SerialNumber, len(found))
+	for _, serial := range found {
+		byNumber[serial.SerialNumber] = serial
+	}
+
+	locked := make([]models.SerialNumber, 0, len(serials))
+	for _, number := range serials {
+		serial, ok := byNumber[number]
+		if !ok {
+			return nil, newSaleError(http.StatusBadRequest, "serial_unavailable", fmt.Sprintf("Serial number %s of %s not found", number, product.Name))
+		}
+		allowed := false
+		for _, status := range statuses {
+			allowed = allowed || serial.Status == status
+		}
+		if loc != nil && (serial.LocationType != loc.Type || !serialAt(serial, *loc)) {
+			allowed = false
+		}
+		if !allowed {
+			return nil, newSaleError(http.StatusBadRequest, "serial_unavailable",
+				fmt.Sprintf("Serial number %s of %s is not available here (%s)", number, product.Name, serial.Status))
+		}
+		locked = append(locked, serial)
+	}
+	return locked, nil
+}
+
+// serialAt reports whether a serial is kept at a location
+func serialAt(serial models.SerialNumber, loc lotLocation) bool {
+	if loc.Type == "warehouse" {
+		return serial.WarehouseID != nil && *serial.WarehouseID == loc.ID
+	}
+	return serial.StoreID != nil && *serial.StoreID == loc.ID
+}
+
+// sellSerials marks the units named on a sale line as sold to the sale's customer
+func sellSerials(tx *gorm.DB, sale models.Sale, item models.SaleItem, userID uint) error {
+	serials, err := decodeSerialNumbers(item.SerialNumbers)
+	if err != nil || len(serials) == 0 {
+		return err
+	}
+
+	var product models.Product
+	if err := tx.Select("id", "name", "is_serialized").First(&product, item.ProductID).Error; err != nil {
+		return err
+	}
+	store := storeLot(sale.StoreID)
+	locked, err := lockSerials(tx, product, item.ProductVariantID, serials, []string{"in_stock", "returned"}, &store)
+	if err != nil {
+		return err
+	}
+
+	for i := range locked {
+		serial := &locked[i]
+		serial.SaleID = &sale.ID
+		serial.SaleItemID = &item.ID
+		serial.CustomerID = sale.CustomerID
+		if err := moveSerial(tx, serial, "sold", nil, models.SerialNumberEvent{
+			Event:           "sold",
+			ReferenceType:   "sale",
+			ReferenceID:     &sale.ID,
+			ReferenceNumber: sale.SaleNumber,
+			CustomerID:      sale.CustomerID,
+			CreatedBy:       userID,
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// releaseSaleSerials puts the units a voided or released sale line sold back in stock
+func releaseSaleSerials(tx *gorm.DB, sale models.Sale, item models.SaleItem, userID uint, referenceType, notes string) error {
+	var serials []models.SerialNumber
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("sale_item_id = ? AND status = ?", item.ID, "sold").Find(&serials).Error; err != nil {
+		return err
+	}
+
+	store := storeLot(sale.StoreID)
+	for i := range serials {
+		serial := &serials[i]
+		serial.SaleID, serial.SaleItemID, serial.CustomerID = nil, nil, nil
+		if err := moveSerial(tx, serial, "in_stock", &store, models.SerialNumberEvent{
+			Event:           "voided",
+			ReferenceType:   referenceType,
+			ReferenceID:     &sale.ID,
+			ReferenceNumber: sale.SaleNumber,
+			CustomerID:      sale.CustomerID,
+			Notes:           notes,
+			CreatedBy:       userID,
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// returnSerials takes back the units named on a return line. They must have been sold on
+// that sale line; restocked units go back on the store shelf, damaged ones are kept off it
+func returnSerials(tx *gorm.DB, sale models.Sale, saleReturn models.SaleReturn, item models.SaleReturnItem, userID uint) error {
+	serials, err := decodeSerialNumbers(item.SerialNumbers)
+	if err != nil || len(serials) == 0 {
+		return err
+	}
+
+	var product models.Product
+	if err := tx.Select("id", "name", "is_serialized").First(&product, item.ProductID).Error; err != nil {
+		return err
+	}
+	locked, err := lockSerials(tx, product, item.ProductVariantID, serials, []string{"sold"}, nil)
+	if err != nil {
+		return err
+	}
+
+	var loc *lotLocation
+	if item.Condition == "restock" {
+		store := storeLot(sale.StoreID)
+		loc = &store
+	}
+	for i := range locked {
+		serial := &locked[i]
+		if serial.SaleItemID == nil || *serial.SaleItemID != item.SaleItemID {
+			return newSaleError(http.StatusBadRequest, "serial_unavailable",
+				fmt.Sprintf("Serial number %s was not sold on this sale line", serial.SerialNumber))
+		}
+		if err := moveSerial(tx, serial, "returned", loc, models.SerialNumberEvent{
+			Event:           "returned",
+			ReferenceType:   "return",
+			ReferenceID:     &saleReturn.ID,
+			ReferenceNumber: saleReturn.ReturnNumber,
+			CustomerID:      sale.CustomerID,
+			Notes:           item.Condition,
+			CreatedBy:       userID,
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// shipSerials puts the units named on a transfer line in transit
+func shipSerials(tx *gorm.DB, transfer models.StockTransfer, item models.StockTransferItem, from lotLocation, userID uint) error {
+	serials, err := decodeSerialNumbers(item.SerialNumbers)
+	if err != nil || len(serials) == 0 {
+		return err
+	}
+
+	var product models.Product
+	if err := tx.Select("id", "name", "is_serialized").First(&product, item.ProductID).Error; err != nil {
+		return err
+	}
+	locked, err := lockSerials(tx, product, item.ProductVariantID, serials, []string{"in_stock", "returned"}, &from)
+	if err != nil {
+		return err
+	}
+
+	for i := range locked {
+		serial := &locked[i]
+		serial.StockTransferID = &transfer.ID
+		if err := moveSerial(tx, serial, "in_transit", nil, models.SerialNumberEvent{
+			Event:           "transfer_out",
+			ReferenceType:   "transfer",
+			ReferenceID:     &transfer.ID,
+			ReferenceNumber: transfer.TransferNumber,
+			CreatedBy:       userID,
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// receiveTransferSerials puts the units a transfer line carries in stock at the destination
+func receiveTransferSerials(tx *gorm.DB, transfer models.StockTransfer, item models.StockTransferItem, to lotLocation, userID uint) error {
+	var serials []models.SerialNumber
+	query := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("stock_transfer_id = ? AND product_id = ? AND status = ?", transfer.ID, item.ProductID, "in_transit")
+	if item.ProductVariantID != nil {
+		query = query.Where("product_variant_id = ?", *item.ProductVariantID)
+	}
+	if err := query.Find(&serials).Error; err != nil {
+		return err
+	}
+
+	for i := range serials {
+		serial := &serials[i]
+		serial.StockTransferID = nil
+		if err := moveSerial(tx, serial, "in_stock", &to, models.SerialNumberEvent{
+			Event:           "transfer_in",
+			ReferenceType:   "transfer",
+			ReferenceID:     &transfer.ID,
+			ReferenceNumber: transfer.TransferNumber,
+			CreatedBy:       userID,
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetSerialNumbers lists serial numbers filtered by product, status and location
+func (h *SerialNumberHandler) GetSerialNumbers(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10"))
+	offset := (page - 1) * limit
+
+	query := h.DB.Model(&models.SerialNumber{})
+	if productID := c.Query("product_id"); productID != "" {
+		query = query.Where("product_id = ?", productID)
+	}
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if warehouseID := c.Query("warehouse_id"); warehouseID != "" {
+		query = query.Where("warehouse_id = ?", warehouseID)
+	}
+	if storeID := c.Query("store_id"); storeID != "" {
+		query = query.Where("store_id = ?", storeID)
+	}
+	if customerID := c.Query("customer_id"); customerID != "" {
+		query = query.Where("customer_id = ?", customerID)
+	}
+	if search := c.Query("search"); search != "" {
+		query = query.Where("serial_number LIKE ?", "%"+search+"%")
+	}
+
+	var total int64
+	query.Count(&total)
+
+	var serials []models.SerialNumber
+	if err := query.Preload("Product").Preload("ProductVariant").Preload("Warehouse").Preload("Store").Preload("Customer").
+		Order("updated_at DESC").Limit(limit).Offset(offset).Find(&serials).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": serials,
+		"pagination": gin.H{
+			"current_page": page,
+			"per_page":     limit,
+			"total":        total,
+			"total_pages":  (total + int64(limit) - 1) / int64(limit),
+		},
+	})
+}
+
+// LookupSerialNumber finds a serial number and returns where it is now, who bought it and its full history
+func (h *SerialNumberHandler) LookupSerialNumber(c *gin.Context) {
+	number := strings.TrimSpace(c.Query("serial_number"))
+	if number == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "serial_number is required"})
+		return
+	}
+
+	// The same number may be used by different manufacturers
+	var serials []models.SerialNumber
+	if err := h.DB.Preload("Product").Preload("ProductVariant").Preload("Warehouse").Preload("Store").
+		Preload("Sale").Preload("Customer").
+		Preload("Events", func(db *gorm.DB) *gorm.DB { return db.Order("created_at, id") }).
+		Preload("Events.Warehouse").Preload("Events.Store").Preload("Events.Customer").Preload("Events.CreatedByUser").
+		Where("serial_number = ?", number).Find(&serials).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if len(serials) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Serial number not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": serials})
+}
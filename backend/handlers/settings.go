@@ -4,8 +4,11 @@ import (
 	"net/http"
 	"starter/backend/database"
 	"starter/backend/models"
+	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 // GetSettings returns all settings as key-value pairs
@@ -60,3 +63,38 @@ func UpdateSettings(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{"message": "Settings updated successfully"})
 }
+
+// getSettingFloat reads a numeric setting, falling back to def when missing or invalid
+func getSettingFloat(db *gorm.DB, key string, def float64) float64 {
+	var setting models.Setting
+	if err := db.Where("key = ?", key).First(&setting).Error; err != nil {
+		return def
+	}
+	val, err := strconv.ParseFloat(strings.TrimSpace(setting.Value), 64)
+	if err != nil || val < 0 {
+		return def
+	}
+	return val
+}
+
+// getSettingBool reads a boolean setting, falling back to def when missing or invalid
+func getSettingBool(db *gorm.DB, key string, def bool) bool {
+	var setting models.Setting
+	if err := db.Where("key = ?", key).First(&setting).Error; err != nil {
+		return def
+	}
+	val, err := strconv.ParseBool(strings.TrimSpace(setting.Value))
+	if err != nil {
+		return def
+	}
+	return val
+}
+
+// getSettingString reads a text setting, falling back to def when missing
+func getSettingString(db *gorm.DB, key string, def string) string {
+	var setting models.Setting
+	if err := db.Where("key = ?", key).First(&setting).Error; err != nil {
+		return def
+	}
+	return setting.Value
+}
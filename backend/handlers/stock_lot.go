@@ -0,0 +1,565 @@
+package handlers
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"starter/backend/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type StockLotHandler struct {
+	DB *gorm.DB
+}
+
+func NewStockLotHandler(db *gorm.DB) *StockLotHandler {
+	return &StockLotHandler{DB: db}
+}
+
+// lotLocation is the warehouse or store a lot is kept at
+type lotLocation struct {
+	Type string // warehouse, store
+	ID   uint
+}
+
+func warehouseLot(id uint) lotLocation { return lotLocation{Type: "warehouse", ID: id} }
+func storeLot(id uint) lotLocation     { return lotLocation{Type: "store", ID: id} }
+
+// lotUsage is the quantity taken out of one lot
+type lotUsage struct {
+	Lot      models.StockLot
+	Quantity float64
+}
+
+// startOfDay is midnight of t; a lot can still be sold on its expiry date
+func startOfDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// parseExpiryDate reads an optional YYYY-MM-DD expiry date
+func parseExpiryDate(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	parsed, err := time.ParseInLocation("2006-01-02", value, time.Now().Location())
+	if err != nil {
+		return nil, fmt.Errorf("expiry_date must be YYYY-MM-DD")
+	}
+	return &parsed, nil
+}
+
+// productLots selects the lots of a product variant at a location
+func productLots(tx *gorm.DB, productID uint, variantID *uint, loc lotLocation) *gorm.DB {
+	query := tx.Model(&models.StockLot{}).
+		Where("product_id = ? AND location_type = ? AND location_id = ?", productID, loc.Type, loc.ID)
+	if variantID != nil {
+		return query.Where("product_variant_id = ?", *variantID)
+	}
+	return query.Where("product_variant_id IS NULL")
+}
+
+// moveLot changes the quantity of a lot and records the movement
+func moveLot(tx *gorm.DB, lot *models.StockLot, quantity float64, movement models.StockLotMovement) error {
+	if err := tx.Model(lot).UpdateColumn("quantity", gorm.Expr("quantity + ?", quantity)).Error; err != nil {
+		return err
+	}
+	lot.Quantity += quantity
+
+	movement.StockLotID = lot.ID
+	movement.Quantity = quantity
+	return tx.Create(&movement).Error
+}
+
+// receiveLot puts stock into a lot at a location, creating the lot there when it is new.
+// lot carries the product, lot number, expiry, received date and cost of the lot
+func receiveLot(tx *gorm.DB, lot models.StockLot, loc lotLocation, quantity float64, movement models.StockLotMovement) (*models.StockLot, error) {
+	var existing models.StockLot
+	err := productLots(tx, lot.ProductID, lot.ProductVariantID, loc).
+		Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("lot_number = ?", lot.LotNumber).First(&existing).Error
+	switch {
+	case err == nil:
+		if !sameExpiry(existing.ExpiryDate, lot.ExpiryDate) {
+			return nil, newSaleError(http.StatusBadRequest, "lot_expiry_mismatch",
+				fmt.Sprintf("Lot %s is already stocked with a different expiry date", lot.LotNumber))
+		}
+	case err == gorm.ErrRecordNotFound:
+		existing = models.StockLot{
+			ProductID:        lot.ProductID,
+			ProductVariantID: lot.ProductVariantID,
+			LotNumber:        lot.LotNumber,
+			ExpiryDate:       lot.ExpiryDate,
+			ReceivedDate:     lot.ReceivedDate,
+			LocationType:     loc.Type,
+			LocationID:       loc.ID,
+			UnitCost:         lot.UnitCost,
+			PurchaseOrderID:  lot.PurchaseOrderID,
+		}
+		if existing.ReceivedDate.IsZero() {
+			existing.ReceivedDate = time.Now()
+		}
+		if loc.Type == "warehouse" {
+			existing.WarehouseID = &loc.ID
+		} else {
+			existing.StoreID = &loc.ID
+		}
+		if err := tx.Create(&existing).Error; err != nil {
+			return nil, err
+		}
+	default:
+		return nil, err
+	}
+
+	if err := moveLot(tx, &existing, quantity, movement); err != nil {
+		return nil, err
+	}
+	return &existing, nil
+}
+
+func sameExpiry(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return a.Format("2006-01-02") == b.Format("2006-01-02")
+}
+
+// takeLots takes up to quantity out of the lots at a location, first expired first out.
+// Expired lots are only used when includeExpired is set. Returns what came out of each
+// lot and the quantity the lots could not cover
+func takeLots(tx *gorm.DB, productID uint, variantID *uint, loc lotLocation, quantity float64, includeExpired bool, movement models.StockLotMovement) ([]lotUsage, float64, error) {
+	query := productLots(tx, productID, variantID, loc).
+		Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("quantity > 0")
+	if !includeExpired {
+		query = query.Where("(expiry_date IS NULL OR expiry_date >= ?)", startOfDay(time.Now()))
+	}
+
+	var lots []models.StockLot
+	if err := query.Order("expiry_date IS NULL, expiry_date, received_date, id").Find(&lots).Error; err != nil {
+		return nil, quantity, err
+	}
+
+	var usages []lotUsage
+	for i := range lots {
+		if quantity <= 0 {
+			break
+		}
+		take := math.Min(lots[i].Quantity, quantity)
+		if err := moveLot(tx, &lots[i], -take, movement); err != nil {
+			return nil, quantity, err
+		}
+		quantity -= take
+		usages = append(usages, lotUsage{Lot: lots[i], Quantity: take})
+	}
+	return usages, math.Max(quantity, 0), nil
+}
+
+// trimLots takes stock out of the lots at a location, oldest expiry first and expired lots
+// included, until they hold no more than onHand
+func trimLots(tx *gorm.DB, productID uint, variantID *uint, loc lotLocation, onHand float64, movement models.StockLotMovement) ([]lotUsage, error) {
+	var inLots float64
+	if err := productLots(tx, productID, variantID, loc).Where("quantity > 0").
+		Select("COALESCE(SUM(quantity), 0)").Scan(&inLots).Error; err != nil {
+		return nil, err
+	}
+	excess := inLots - math.Max(onHand, 0)
+	if excess <= 0 {
+		return nil, nil
+	}
+	usages, _, err := takeLots(tx, productID, variantID, loc, excess, true, movement)
+	return usages, err
+}
+
+// takeStockLots takes stock that left a location out of its lots, after the inventory row
+// was reduced to onHand. Lot tracked products must be covered by unexpired lots; other
+// products use stock kept outside lots before expired lots
+func takeStockLots(tx *gorm.DB, productID uint, variantID *uint, loc lotLocation, quantity, onHand float64, movement models.StockLotMovement) ([]lotUsage, error) {
+	usages, short, err := takeLots(tx, productID, variantID, loc, quantity, false, movement)
+	if err != nil || short <= 0 {
+		return usages, err
+	}
+
+	var product models.Product
+	if err := tx.Select("id", "name", "track_lots").First(&product, productID).Error; err != nil {
+		return nil, err
+	}
+	if product.TrackLots {
+		return nil, newSaleError(http.StatusBadRequest, "insufficient_stock",
+			fmt.Sprintf("Not enough unexpired stock of %s: %.2f short", product.Name, short))
+	}
+
+	more, err := trimLots(tx, productID, variantID, loc, onHand, movement)
+	if err != nil {
+		return nil, err
+	}
+	return append(usages, more...), nil
+}
+
+// restoreSaleLots puts stock a sale line took back into the lots it came from, up to what
+// the line took and was not put back yet
+func restoreSaleLots(tx *gorm.DB, saleItemID uint, quantity float64, movement models.StockLotMovement) error {
+	var movements []models.StockLotMovement
+	if err := tx.Where("sale_item_id = ?", saleItemID).Order("id").Find(&movements).Error; err != nil {
+		return err
+	}
+
+	movement.SaleItemID = &saleItemID
+	return restoreTakenLots(tx, movements, quantity, movement)
+}
+
+// restoreTakenLots puts stock back into the lots a list of movements took it from, up to what
+// they took and did not put back yet, in the order the lots first appear
+func restoreTakenLots(tx *gorm.DB, movements []models.StockLotMovement, quantity float64, movement models.StockLotMovement) error {
+	// Net quantity still out per lot
+	var lotIDs []uint
+	outstanding := make(map[uint]float64)
+	for _, m := range movements {
+		if _, seen := outstanding[m.StockLotID]; !seen {
+			lotIDs = append(lotIDs, m.StockLotID)
+		}
+		outstanding[m.StockLotID] -= m.Quantity
+	}
+
+	for _, lotID := range lotIDs {
+		if quantity <= 0 {
+			break
+		}
+		back := math.Min(outstanding[lotID], quantity)
+		if back <= 0 {
+			continue
+		}
+		var lot models.StockLot
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&lot, lotID).Error; err != nil {
+			return err
+		}
+		if err := moveLot(tx, &lot, back, movement); err != nil {
+			return err
+		}
+		quantity -= back
+	}
+	return nil
+}
+
+// GetStockLots lists lots with stock, filtered by product, location and lot number
+func (h *StockLotHandler) GetStockLots(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10"))
+	offset := (page - 1) * limit
+
+	query := h.DB.Model(&models.StockLot{})
+	if c.Query("include_empty") != "true" {
+		query = query.Where("quantity > 0")
+	}
+	if productID := c.Query("product_id"); productID != "" {
+		query = query.Where("product_id = ?", productID)
+	}
+	if warehouseID := c.Query("warehouse_id"); warehouseID != "" {
+		query = query.Where("warehouse_id = ?", warehouseID)
+	}
+	if storeID := c.Query("store_id"); storeID != "" {
+		query = query.Where("store_id = ?", storeID)
+	}
+	if lotNumber := c.Query("lot_number"); lotNumber != "" {
+		query = query.Where("lot_number = ?", lotNumber)
+	}
+
+	var total int64
+	query.Count(&total)
+
+	var lots []models.StockLot
+	if err := query.Preload("Product").Preload("ProductVariant").Preload("Warehouse").Preload("Store").
+		Order("expiry_date IS NULL, expiry_date, id").Limit(limit).Offset(offset).Find(&lots).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": lots,
+		"pagination": gin.H{
+			"current_page": page,
+			"per_page":     limit,
+			"total":        total,
+			"total_pages":  (total + int64(limit) - 1) / int64(limit),
+		},
+	})
+}
+
+// expiryReportLine is a lot with stock in an expiry report
+type expiryReportLine struct {
+	models.StockLot
+	DaysToExpiry int     `json:"days_to_expiry"` // negative once expired
+	StockValue   float64 `json:"stock_value"`
+}
+
+// lotExpiryReport lists the lots with stock whose expiry date falls in [from, to)
+func (h *StockLotHandler) lotExpiryReport(c *gin.Context, from, to *time.Time) {
+	query := h.DB.Where("quantity > 0 AND expiry_date IS NOT NULL")
+	if from != nil {
+		query = query.Where("expiry_date >= ?", *from)
+	}
+	if to != nil {
+		query = query.Where("expiry_date < ?", *to)
+	}
+	if warehouseID := c.Query("warehouse_id"); warehouseID != "" {
+		query = query.Where("warehouse_id = ?", warehouseID)
+	}
+	if storeID := c.Query("store_id"); storeID != "" {
+		query = query.Where("store_id = ?", storeID)
+	}
+	if productID := c.Query("product_id"); productID != "" {
+		query = query.Where("product_id = ?", productID)
+	}
+
+	var lots []models.StockLot
+	if err := query.Preload("Product").Preload("ProductVariant").Preload("Warehouse").Preload("Store").
+		Order("expiry_date, id").Find(&lots).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	today := startOfDay(time.Now())
+	lines := make([]expiryReportLine, len(lots))
+	var quantity, value float64
+	for i, lot := range lots {
+		lines[i] = expiryReportLine{
+			StockLot:     lot,
+			DaysToExpiry: int(math.Round(startOfDay(*lot.ExpiryDate).Sub(today).Hours() / 24)),
+			StockValue:   roundCurrency(lot.Quantity * lot.UnitCost),
+		}
+		quantity += lot.Quantity
+		value += lines[i].StockValue
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": lines,
+		"summary": gin.H{
+			"lots":        len(lines),
+			"quantity":    quantity,
+			"stock_value": roundCurrency(value),
+		},
+	})
+}
+
+// GetNearExpiryReport lists the stock expiring within the next days (default expiry_warning_days)
+func (h *StockLotHandler) GetNearExpiryReport(c *gin.Context) {
+	days, err := strconv.Atoi(c.DefaultQuery("days", strconv.Itoa(int(getSettingFloat(h.DB, "expiry_warning_days", 30)))))
+	if err != nil || days < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "days must be a positive number"})
+		return
+	}
+
+	from := startOfDay(time.Now())
+	to := from.AddDate(0, 0, days+1)
+	h.lotExpiryReport(c, &from, &to)
+}
+
+// GetExpiredStockReport lists the stock past its expiry date that is still on hand
+func (h *StockLotHandler) GetExpiredStockReport(c *gin.Context) {
+	to := startOfDay(time.Now())
+	h.lotExpiryReport(c, nil, &to)
+}
+
+// lotTraceEntry is one movement of a lot with the document and location it belongs to
+type lotTraceEntry struct {
+	Date            time.Time `json:"date"`
+	StockLotID      uint      `json:"stock_lot_id"`
+	LocationType    string    `json:"location_type"`
+	LocationID      uint      `json:"location_id"`
+	LocationName    string    `json:"location_name"`
+	Quantity        float64   `json:"quantity"`
+	ReferenceType   string    `json:"reference_type"`
+	ReferenceID     *uint     `json:"reference_id"`
+	ReferenceNumber string    `json:"reference_number"`
+	CustomerID      *uint     `json:"customer_id,omitempty"`
+	CustomerName    string    `json:"customer_name,omitempty"`
+	Notes           string    `json:"notes"`
+}
+
+// GetLotTrace shows where a lot went: the locations still holding it, every movement
+// with its document, and the sales it was sold on
+func (h *StockLotHandler) GetLotTrace(c *gin.Context) {
+	lotNumber := c.Query("lot_number")
+	if lotNumber == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "lot_number is required"})
+		return
+	}
+
+	query := h.DB.Where("lot_number = ?", lotNumber)
+	if productID := c.Query("product_id"); productID != "" {
+		query = query.Where("product_id = ?", productID)
+	}
+
+	var lots []models.StockLot
+	if err := query.Preload("Product").Preload("ProductVariant").Preload("Warehouse").Preload("Store").
+		Preload("PurchaseOrder").Order("id").Find(&lots).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if len(lots) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Lot not found"})
+		return
+	}
+
+	lotByID := make(map[uint]models.StockLot, len(lots))
+	lotIDs := make([]uint, len(lots))
+	for i, lot := range lots {
+		lotByID[lot.ID] = lot
+		lotIDs[i] = lot.ID
+	}
+
+	var movements []models.StockLotMovement
+	if err := h.DB.Where("stock_lot_id IN ?", lotIDs).Order("created_at, id").Find(&movements).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Document numbers per reference type
+	refIDs := make(map[string][]uint)
+	for _, m := range movements {
+		if m.ReferenceID != nil {
+			refIDs[m.ReferenceType] = append(refIDs[m.ReferenceType], *m.ReferenceID)
+		}
+	}
+	var purchaseOrders []models.PurchaseOrder
+	var transfers []models.StockTransfer
+	var returns []models.SaleReturn
+	var sales []models.Sale
+	h.DB.Select("id", "purchase_number").Where("id IN ?", append(refIDs["purchase"], 0)).Find(&purchaseOrders)
+	h.DB.Select("id", "transfer_number").Where("id IN ?", append(refIDs["transfer"], 0)).Find(&transfers)
+	h.DB.Select("id", "return_number").Where("id IN ?", append(refIDs["return"], 0)).Find(&returns)
+	saleIDs := append(append(refIDs["sale"], refIDs["void"]...), refIDs["payment_release"]...)
+	h.DB.Preload("Customer").Select("id", "sale_number", "customer_id").Where("id IN ?", append(saleIDs, 0)).Find(&sales)
+
+	numbers := make(map[string]map[uint]string)
+	for _, refType := range []string{"purchase", "transfer", "return", "sale"} {
+		numbers[refType] = make(map[uint]string)
+	}
+	for _, po := range purchaseOrders {
+		numbers["purchase"][po.ID] = po.PurchaseNumber
+	}
+	for _, transfer := range transfers {
+		numbers["transfer"][transfer.ID] = transfer.TransferNumber
+	}
+	for _, ret := range returns {
+		numbers["return"][ret.ID] = ret.ReturnNumber
+	}
+	saleByID := make(map[uint]models.Sale, len(sales))
+	for _, sale := range sales {
+		saleByID[sale.ID] = sale
+		numbers["sale"][sale.ID] = sale.SaleNumber
+	}
+
+	type soldLine struct {
+		SaleID       uint    `json:"sale_id"`
+		SaleNumber   string  `json:"sale_number"`
+		CustomerID   *uint   `json:"customer_id"`
+		CustomerName string  `json:"customer_name"`
+		Quantity     float64 `json:"quantity"`
+	}
+	var sold []soldLine
+	soldIndex := make(map[uint]int)
+
+	entries := make([]lotTraceEntry, len(movements))
+	for i, m := range movements {
+		lot := lotByID[m.StockLotID]
+		entry := lotTraceEntry{
+			Date:          m.CreatedAt,
+			StockLotID:    lot.ID,
+			LocationType:  lot.LocationType,
+			LocationID:    lot.LocationID,
+			Quantity:      m.Quantity,
+			ReferenceType: m.ReferenceType,
+			ReferenceID:   m.ReferenceID,
+			Notes:         m.Notes,
+		}
+		if lot.Warehouse != nil {
+			entry.LocationName = lot.Warehouse.Name
+		} else if lot.Store != nil {
+			entry.LocationName = lot.Store.Name
+		}
+
+		if m.ReferenceID != nil {
+			refType := m.ReferenceType
+			if refType == "void" || refType == "payment_release" {
+				refType = "sale"
+			}
+			if byID, ok := numbers[refType]; ok {
+				entry.ReferenceNumber = byID[*m.ReferenceID]
+			}
+			if sale, ok := saleByID[*m.ReferenceID]; ok && refType == "sale" {
+				entry.CustomerID = sale.CustomerID
+				if sale.Customer != nil {
+					entry.CustomerName = sale.Customer.Name
+				}
+
+				// Net quantity sold per sale, after voids
+				idx, seen := soldIndex[sale.ID]
+				if !seen {
+					idx = len(sold)
+					soldIndex[sale.ID] = idx
+					sold = append(sold, soldLine{SaleID: sale.ID, SaleNumber: sale.SaleNumber, CustomerID: entry.CustomerID, CustomerName: entry.CustomerName})
+				}
+				sold[idx].Quantity -= m.Quantity
+			}
+		}
+		entries[i] = entry
+	}
+
+	var onHand float64
+	for _, lot := range lots {
+		onHand += lot.Quantity
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": gin.H{
+			"lot_number": lotNumber,
+			"on_hand":    onHand,
+			"locations":  lots,
+			"movements":  entries,
+			"sales":      sold,
+		},
+	})
+}
+
+// adjustLots keeps the lots of a location in line with a stock adjustment. Stock added with a
+// lot number goes into that lot and stock removed with one comes out of it; otherwise the lots
+// expiring first give up what they hold beyond the stock left on hand
+func adjustLots(tx *gorm.DB, productID uint, variantID *uint, loc lotLocation, adjustment, onHand float64, lotNumber, expiryDate string, movement models.StockLotMovement) error {
+	expiry, err := parseExpiryDate(expiryDate)
+	if err != nil {
+		return newSaleError(http.StatusBadRequest, "invalid_expiry_date", err.Error())
+	}
+
+	switch {
+	case adjustment > 0 && lotNumber != "":
+		_, err := receiveLot(tx, models.StockLot{
+			ProductID:        productID,
+			ProductVariantID: variantID,
+			LotNumber:        lotNumber,
+			ExpiryDate:       expiry,
+		}, loc, adjustment, movement)
+		return err
+	case adjustment < 0 && lotNumber != "":
+		var lot models.StockLot
+		if err := productLots(tx, productID, variantID, loc).Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("lot_number = ?", lotNumber).First(&lot).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return newSaleError(http.StatusBadRequest, "lot_not_found", fmt.Sprintf("Lot %s not found at this location", lotNumber))
+			}
+			return err
+		}
+		if lot.Quantity < -adjustment {
+			return newSaleError(http.StatusBadRequest, "insufficient_stock", fmt.Sprintf("Lot %s only holds %.2f", lotNumber, lot.Quantity))
+		}
+		return moveLot(tx, &lot, adjustment, movement)
+	}
+
+	_, err = trimLots(tx, productID, variantID, loc, onHand, movement)
+	return err
+}
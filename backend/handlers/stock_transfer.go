@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
@@ -17,9 +18,13 @@ type StockTransferHandler struct {
 }
 
 type StockTransferItemCreate struct {
-	ProductID         uint    `json:"product_id" binding:"required"`
-	ProductVariantID  *uint   `json:"product_variant_id"`
-	QuantityRequested float64 `json:"quantity_requested" binding:"required,gt=0"`
+	ProductID         uint     `json:"product_id" binding:"required"`
+	ProductVariantID  *uint    `json:"product_variant_id"`
+	Unit              string   `json:"unit"` // Unit the quantity is in, e.g. dus; empty for the base unit
+	QuantityRequested float64  `json:"quantity_requested" binding:"required,gt=0"`
+	SerialNumbers     []string `json:"serial_numbers"` // One per base unit, required for serialized products
+
+	factor float64 // base units in one Unit, set while validating
 }
 
 func NewStockTransferHandler(db *gorm.DB) *StockTransferHandler {
@@ -76,26 +81,57 @@ func (h *StockTransferHandler) CreateStockTransfer(c *gin.Context) {
 		userID = uint(1) // fallback
 	}
 
-	// Generate transfer number
-	fromID := uint(0)
-	toID := uint(0)
+	// Transfers are numbered by their source location
+	source := documentLocation{Type: "store"}
 	if req.FromWarehouseID != nil {
-		fromID = *req.FromWarehouseID
-	} else {
-		fromID = *req.FromStoreID
-	}
-	if req.ToWarehouseID != nil {
-		toID = *req.ToWarehouseID
+		source = documentLocation{Type: "warehouse", ID: *req.FromWarehouseID}
 	} else {
-		toID = *req.ToStoreID
+		source.ID = *req.FromStoreID
 	}
-	transferNumber := fmt.Sprintf("ST-%d-%d%d", time.Now().Unix(), fromID, toID)
 
 	// Start transaction
 	tx := h.DB.Begin()
 
+	// Generate transfer number
+	transferNumber, err := nextDocumentNumber(tx, DocumentTypeStockTransfer, source, time.Now())
+	if err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
 	// Validate stock availability for each item
-	for _, itemReq := range req.Items {
+	for i := range req.Items {
+		itemReq := &req.Items[i]
+
+		var product models.Product
+		if err := tx.Select("id", "name", "unit", "is_serialized").First(&product, itemReq.ProductID).Error; err != nil {
+			tx.Rollback()
+			if err == gorm.ErrRecordNotFound {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Product not found"})
+			} else {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			}
+			return
+		}
+
+		// Packs are moved as their number of base units; serialized products name each one
+		itemReq.Unit, itemReq.factor, err = resolveProductUnit(tx, product, itemReq.Unit)
+		if err == nil {
+			itemReq.SerialNumbers = cleanSerialNumbers(itemReq.SerialNumbers)
+			err = checkSerialCount(product, itemReq.SerialNumbers, itemReq.QuantityRequested*itemReq.factor)
+		}
+		if err != nil {
+			tx.Rollback()
+			var saleErr *saleError
+			if errors.As(err, &saleErr) {
+				c.JSON(saleErr.Status, gin.H{"error": saleErr.Message, "code": saleErr.Code})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
 		// Check if source has enough stock
 		if req.FromWarehouseID != nil {
 			var inventory models.Inventory
@@ -114,9 +150,9 @@ func (h *StockTransferHandler) CreateStockTransfer(c *gin.Context) {
 				return
 			}
 
-			if inventory.Quantity < itemReq.QuantityRequested {
+			if inventory.Quantity < itemReq.QuantityRequested*itemReq.factor {
 				tx.Rollback()
-				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Insufficient stock in source warehouse. Available: %.2f, Requested: %.2f", inventory.Quantity, itemReq.QuantityRequested)})
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Insufficient stock in source warehouse. Available: %.2f, Requested: %.2f", inventory.Quantity, itemReq.QuantityRequested*itemReq.factor)})
 				return
 			}
 		} else {
@@ -136,9 +172,9 @@ func (h *StockTransferHandler) CreateStockTransfer(c *gin.Context) {
 				return
 			}
 
-			if inventory.Quantity < itemReq.QuantityRequested {
+			if inventory.Quantity < itemReq.QuantityRequested*itemReq.factor {
 				tx.Rollback()
-				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Insufficient stock in source store. Available: %.2f, Requested: %.2f", inventory.Quantity, itemReq.QuantityRequested)})
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Insufficient stock in source store. Available: %.2f, Requested: %.2f", inventory.Quantity, itemReq.QuantityRequested*itemReq.factor)})
 				return
 			}
 		}
@@ -168,7 +204,10 @@ func (h *StockTransferHandler) CreateStockTransfer(c *gin.Context) {
 			TransferID:        transfer.ID,
 			ProductID:         itemReq.ProductID,
 			ProductVariantID:  itemReq.ProductVariantID,
+			Unit:              itemReq.Unit,
+			ConversionFactor:  itemReq.factor,
 			QuantityRequested: itemReq.QuantityRequested,
+			SerialNumbers:     encodeSerialNumbers(itemReq.SerialNumbers),
 		}
 
 		if err := tx.Create(&item).Error; err != nil {
@@ -176,6 +215,22 @@ func (h *StockTransferHandler) CreateStockTransfer(c *gin.Context) {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
+
+		// The named units are set aside for the transfer until it is executed
+		from := storeLot(source.ID)
+		if source.Type == "warehouse" {
+			from = warehouseLot(source.ID)
+		}
+		if err := shipSerials(tx, transfer, item, from, userID.(uint)); err != nil {
+			tx.Rollback()
+			var saleErr *saleError
+			if errors.As(err, &saleErr) {
+				c.JSON(saleErr.Status, gin.H{"error": saleErr.Message, "code": saleErr.Code})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
 	}
 
 	tx.Commit()
@@ -229,7 +284,13 @@ func (h *StockTransferHandler) ExecuteStockTransfer(c *gin.Context) {
 	// Process each item
 	for i := range transfer.Items {
 		item := &transfer.Items[i]
-		quantityToTransfer := item.QuantityRequested
+		// Inventory moves in the base unit; the line may count packs
+		factor := item.ConversionFactor
+		if factor <= 0 {
+			factor = 1
+		}
+		quantityToTransfer := item.QuantityRequested * factor
+		var usages []lotUsage
 
 		// Deduct from source location
 		if transfer.FromWarehouseID != nil {
@@ -246,6 +307,7 @@ func (h *StockTransferHandler) ExecuteStockTransfer(c *gin.Context) {
 			}
 
 			inventory.Quantity -= quantityToTransfer
+			inventory.LastUpdated = time.Now()
 			if err := tx.Save(&inventory).Error; err != nil {
 				tx.Rollback()
 				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
@@ -272,6 +334,24 @@ func (h *StockTransferHandler) ExecuteStockTransfer(c *gin.Context) {
 				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 				return
 			}
+
+			// The goods leave in their lots, first expired first out
+			usages, err = takeStockLots(tx, item.ProductID, item.ProductVariantID, warehouseLot(*transfer.FromWarehouseID), quantityToTransfer, inventory.Quantity, models.StockLotMovement{
+				ReferenceType: "transfer",
+				ReferenceID:   &transfer.ID,
+				Notes:         fmt.Sprintf("Transfer out: %s", transfer.TransferNumber),
+				CreatedBy:     userID.(uint),
+			})
+			if err != nil {
+				tx.Rollback()
+				var saleErr *saleError
+				if errors.As(err, &saleErr) {
+					c.JSON(saleErr.Status, gin.H{"error": saleErr.Message, "code": saleErr.Code})
+					return
+				}
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
 		} else {
 			var inventory models.StoreInventory
 			where := models.StoreInventory{ProductID: item.ProductID, StoreID: *transfer.FromStoreID}
@@ -286,6 +366,7 @@ func (h *StockTransferHandler) ExecuteStockTransfer(c *gin.Context) {
 			}
 
 			inventory.Quantity -= quantityToTransfer
+			inventory.LastUpdated = time.Now()
 			if err := tx.Save(&inventory).Error; err != nil {
 				tx.Rollback()
 				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
@@ -312,6 +393,24 @@ func (h *StockTransferHandler) ExecuteStockTransfer(c *gin.Context) {
 				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 				return
 			}
+
+			// The goods leave in their lots, first expired first out
+			usages, err = takeStockLots(tx, item.ProductID, item.ProductVariantID, storeLot(*transfer.FromStoreID), quantityToTransfer, inventory.Quantity, models.StockLotMovement{
+				ReferenceType: "transfer",
+				ReferenceID:   &transfer.ID,
+				Notes:         fmt.Sprintf("Transfer out: %s", transfer.TransferNumber),
+				CreatedBy:     userID.(uint),
+			})
+			if err != nil {
+				tx.Rollback()
+				var saleErr *saleError
+				if errors.As(err, &saleErr) {
+					c.JSON(saleErr.Status, gin.H{"error": saleErr.Message, "code": saleErr.Code})
+					return
+				}
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
 		}
 
 		// Add to destination location
@@ -329,6 +428,7 @@ func (h *StockTransferHandler) ExecuteStockTransfer(c *gin.Context) {
 			}
 
 			inventory.Quantity += quantityToTransfer
+			inventory.LastUpdated = time.Now()
 			if err := tx.Save(&inventory).Error; err != nil {
 				tx.Rollback()
 				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
@@ -355,6 +455,25 @@ func (h *StockTransferHandler) ExecuteStockTransfer(c *gin.Context) {
 				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 				return
 			}
+
+			// Lots arrive with the lot number, expiry and received date they left with
+			for _, usage := range usages {
+				if _, err := receiveLot(tx, usage.Lot, warehouseLot(*transfer.ToWarehouseID), usage.Quantity, models.StockLotMovement{
+					ReferenceType: "transfer",
+					ReferenceID:   &transfer.ID,
+					Notes:         fmt.Sprintf("Transfer in: %s", transfer.TransferNumber),
+					CreatedBy:     userID.(uint),
+				}); err != nil {
+					tx.Rollback()
+					var saleErr *saleError
+					if errors.As(err, &saleErr) {
+						c.JSON(saleErr.Status, gin.H{"error": saleErr.Message, "code": saleErr.Code})
+						return
+					}
+					c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+					return
+				}
+			}
 		} else {
 			var inventory models.StoreInventory
 			where := models.StoreInventory{ProductID: item.ProductID, StoreID: *transfer.ToStoreID}
@@ -369,6 +488,7 @@ func (h *StockTransferHandler) ExecuteStockTransfer(c *gin.Context) {
 			}
 
 			inventory.Quantity += quantityToTransfer
+			inventory.LastUpdated = time.Now()
 			if err := tx.Save(&inventory).Error; err != nil {
 				tx.Rollback()
 				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
@@ -395,11 +515,43 @@ func (h *StockTransferHandler) ExecuteStockTransfer(c *gin.Context) {
 				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 				return
 			}
+
+			// Lots arrive with the lot number, expiry and received date they left with
+			for _, usage := range usages {
+				if _, err := receiveLot(tx, usage.Lot, storeLot(*transfer.ToStoreID), usage.Quantity, models.StockLotMovement{
+					ReferenceType: "transfer",
+					ReferenceID:   &transfer.ID,
+					Notes:         fmt.Sprintf("Transfer in: %s", transfer.TransferNumber),
+					CreatedBy:     userID.(uint),
+				}); err != nil {
+					tx.Rollback()
+					var saleErr *saleError
+					if errors.As(err, &saleErr) {
+						c.JSON(saleErr.Status, gin.H{"error": saleErr.Message, "code": saleErr.Code})
+						return
+					}
+					c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+					return
+				}
+			}
+		}
+
+		// Serialized units in transit arrive at the destination
+		var to lotLocation
+		if transfer.ToWarehouseID != nil {
+			to = warehouseLot(*transfer.ToWarehouseID)
+		} else {
+			to = storeLot(*transfer.ToStoreID)
+		}
+		if err := receiveTransferSerials(tx, transfer, *item, to, userID.(uint)); err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
 		}
 
 		// Update item quantities
-		item.QuantityShipped = quantityToTransfer
-		item.QuantityReceived = quantityToTransfer
+		item.QuantityShipped = item.QuantityRequested
+		item.QuantityReceived = item.QuantityRequested
 		if err := tx.Save(&item).Error; err != nil {
 			tx.Rollback()
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
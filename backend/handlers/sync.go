@@ -0,0 +1,289 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"starter/backend/middleware"
+	"starter/backend/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// maxSyncBatch limits how many offline sales a terminal can push in one request
+const maxSyncBatch = 200
+
+// maxClockSkew is how far in the future an offline sale date may be before it is rejected
+const maxClockSkew = 5 * time.Minute
+
+type SyncHandler struct {
+	DB    *gorm.DB
+	sales *SalesHandler
+}
+
+// SyncSaleResult is the outcome of one offline sale in a sync batch
+type SyncSaleResult struct {
+	Index       int     `json:"index"`
+	ClientUUID  string  `json:"client_uuid"`
+	Status      string  `json:"status"` // created, duplicate, conflict, error
+	SaleID      *uint   `json:"sale_id,omitempty"`
+	SaleNumber  string  `json:"sale_number,omitempty"`
+	TotalAmount float64 `json:"total_amount,omitempty"`
+	Code        string  `json:"code,omitempty"` // insufficient_stock, discount_unavailable, underpaid, ...
+	Error       string  `json:"error,omitempty"`
+}
+
+func NewSyncHandler(db *gorm.DB) *SyncHandler {
+	return &SyncHandler{DB: db, sales: NewSalesHandler(db)}
+}
+
+// SyncSales applies sales recorded offline, in the order they were sent, through the CreateSale logic
+func (h *SyncHandler) SyncSales(c *gin.Context) {
+	var req struct {
+		Sales []saleRequest `json:"sales" binding:"required,min=1"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if len(req.Sales) > maxSyncBatch {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("At most %d sales can be synced at once", maxSyncBatch)})
+		return
+	}
+
+	userID := getUserIDFromContext(c)
+	results := make([]SyncSaleResult, 0, len(req.Sales))
+	counts := map[string]int{"created": 0, "duplicate": 0, "conflict": 0, "error": 0}
+
+	for i, saleReq := range req.Sales {
+		result := SyncSaleResult{Index: i, ClientUUID: strings.TrimSpace(saleReq.ClientUUID)}
+
+		// Each sale commits on its own so one conflict does not undo the rest of the batch
+		sale, replayed, err := h.syncSale(saleReq, userID)
+		switch {
+		case err != nil:
+			var saleErr *saleError
+			if errors.As(err, &saleErr) && saleErr.Status < http.StatusInternalServerError {
+				result.Status = "conflict"
+				result.Code = saleErr.Code
+			} else {
+				result.Status = "error"
+			}
+			result.Error = err.Error()
+		case replayed:
+			result.Status = "duplicate"
+		default:
+			result.Status = "created"
+		}
+
+		if sale != nil {
+			result.SaleID = &sale.ID
+			result.SaleNumber = sale.SaleNumber
+			result.TotalAmount = sale.TotalAmount
+		}
+
+		counts[result.Status]++
+		results = append(results, result)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": gin.H{
+			"results":   results,
+			"created":   counts["created"],
+			"duplicate": counts["duplicate"],
+			"conflict":  counts["conflict"],
+			"error":     counts["error"],
+		},
+	})
+}
+
+// syncSale checks the offline specific fields of a sale and hands it to processSale
+func (h *SyncHandler) syncSale(req saleRequest, userID uint) (*models.Sale, bool, error) {
+	clientUUID := strings.TrimSpace(req.ClientUUID)
+	if clientUUID == "" {
+		return nil, false, newSaleError(http.StatusBadRequest, "missing_client_uuid", "client_uuid is required for offline sales")
+	}
+
+	if req.SaleDate == nil {
+		now := time.Now()
+		req.SaleDate = &now
+	} else if req.SaleDate.After(time.Now().Add(maxClockSkew)) {
+		return nil, false, newSaleError(http.StatusBadRequest, "invalid_sale_date", "Sale date is in the future")
+	}
+
+	// A provider cannot confirm a payment after the fact; offline tenders are settled at the till
+	for _, payment := range req.Payments {
+		if payment.Provider != "" {
+			return nil, false, newSaleError(http.StatusBadRequest, "provider_payment_offline", "Provider payments cannot be synced offline")
+		}
+	}
+
+	// The sale belongs to the cashier who rang it up, who need not be the user syncing it
+	cashierID := userID
+	if req.RegisterSessionID != nil {
+		var session models.RegisterSession
+		if err := h.DB.Where("id = ? AND store_id = ?", *req.RegisterSessionID, req.StoreID).First(&session).Error; err != nil {
+			return nil, false, newSaleError(http.StatusBadRequest, "no_register_session", "Register session not found at this store")
+		}
+		if req.CashierID != nil && *req.CashierID != session.CashierID {
+			return nil, false, newSaleError(http.StatusBadRequest, "invalid_cashier", "Register session belongs to another cashier")
+		}
+		cashierID = session.CashierID
+	} else if req.CashierID != nil {
+		cashierID = *req.CashierID
+	}
+	// Only register managers may book sales into another cashier's drawer; anyone else
+	// syncs onto their own session
+	if cashierID != userID && !h.canManageRegisters(userID) {
+		cashierID = userID
+		req.CashierID = nil
+		req.RegisterSessionID = nil
+	}
+
+	return h.sales.processSale(req, cashierID, clientUUID)
+}
+
+// canManageRegisters reports whether a user may operate other cashiers' register sessions
+func (h *SyncHandler) canManageRegisters(userID uint) bool {
+	var user models.User
+	if err := h.DB.First(&user, userID).Error; err != nil {
+		return false
+	}
+	return middleware.UserHasPermission(&user, "registers.manage")
+}
+
+// GetCatalog returns the catalog rows changed since a point in time so terminals can cache them offline
+func (h *SyncHandler) GetCatalog(c *gin.Context) {
+	// Taken before querying so nothing written during the sync is skipped next time
+	serverTime := time.Now()
+
+	var since time.Time
+	if sinceParam := c.Query("since"); sinceParam != "" {
+		parsed, err := time.Parse(time.RFC3339, sinceParam)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "since must be an RFC3339 timestamp"})
+			return
+		}
+		since = parsed
+	}
+	storeID := c.Query("store_id")
+
+	// Inactive rows are included so terminals can drop them from their cache
+	var categories []models.Category
+	if err := h.DB.Where("updated_at > ?", since).Order("id").Find(&categories).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var products []models.Product
+	if err := h.DB.Where("updated_at > ?", since).Order("id").Find(&products).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var variants []models.ProductVariant
+	if err := h.DB.Where("updated_at > ?", since).Order("id").Find(&variants).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Packs let terminals ring up a pack barcode offline
+	var units []models.ProductUnit
+	if err := h.DB.Where("updated_at > ?", since).Order("id").Find(&units).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// The full bill of materials of every kit that changed; terminals replace what they hold
+	var components []models.ProductComponent
+	if err := h.DB.Where("product_id IN (?)", h.DB.Model(&models.Product{}).Where("updated_at > ?", since).Select("id")).
+		Order("id").Find(&components).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Deleted discounts come back with deleted_at set
+	var discounts []models.Discount
+	if err := h.DB.Unscoped().Preload("Items").Preload("Tiers").Where("updated_at > ? OR deleted_at > ?", since, since).
+		Order("id").Find(&discounts).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var settings []models.Setting
+	if err := h.DB.Where("updated_at > ?", since).Order("id").Find(&settings).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// The store's own prices replace catalog prices at its terminals
+	storePrices := []models.StorePrice{}
+	if storeID != "" {
+		if err := h.DB.Where("store_id = ? AND updated_at > ?", storeID, since).
+			Order("id").Find(&storePrices).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	inventory := []models.StoreInventory{}
+	if storeID != "" {
+		if err := h.DB.Where("store_id = ? AND last_updated > ?", storeID, since).
+			Order("id").Find(&inventory).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	// Hard-deleted rows, by entity, that terminals must drop
+	var tombstones []models.CatalogDeletion
+	if err := h.DB.Where("deleted_at > ?", since).Order("id").Find(&tombstones).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	deleted := map[string][]uint{}
+	for _, entity := range catalogEntities {
+		deleted[entity] = []uint{}
+	}
+	for _, tombstone := range tombstones {
+		deleted[tombstone.Entity] = append(deleted[tombstone.Entity], tombstone.EntityID)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": gin.H{
+			"categories":         categories,
+			"products":           products,
+			"variants":           variants,
+			"product_units":      units,
+			"product_components": components,
+			"discounts":          discounts,
+			"settings":           settings,
+			"store_prices":       storePrices,
+			"store_inventory":    inventory,
+			"deleted":            deleted,
+		},
+		"server_time": serverTime.Format(time.RFC3339Nano),
+	})
+}
+
+// catalogEntities are the hard-deleted catalog tables the sync keeps tombstones of
+var catalogEntities = []string{"categories", "products", "variants", "product_units", "product_components", "store_prices"}
+
+// recordCatalogDeletions keeps tombstones of catalog rows deleted in tx for the catalog sync
+func recordCatalogDeletions(tx *gorm.DB, entity string, ids ...uint) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	now := time.Now()
+	tombstones := make([]models.CatalogDeletion, 0, len(ids))
+	for _, id := range ids {
+		tombstones = append(tombstones, models.CatalogDeletion{Entity: entity, EntityID: id, DeletedAt: now})
+	}
+	return tx.Create(&tombstones).Error
+}
@@ -0,0 +1,296 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"starter/backend/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type TaxHandler struct {
+	DB *gorm.DB
+}
+
+func NewTaxHandler(db *gorm.DB) *TaxHandler {
+	return &TaxHandler{DB: db}
+}
+
+// taxResolver finds the tax class of products, caching classes and categories for one sale
+type taxResolver struct {
+	db          *gorm.DB
+	enabled     bool
+	defaultRate float64
+	classes     map[uint]*models.TaxClass
+	categories  map[uint]*uint
+}
+
+func newTaxResolver(db *gorm.DB) *taxResolver {
+	return &taxResolver{
+		db:          db,
+		enabled:     getSettingBool(db, "tax_enabled", true),
+		defaultRate: getSettingFloat(db, "tax_rate", 11),
+		classes:     map[uint]*models.TaxClass{},
+		categories:  map[uint]*uint{},
+	}
+}
+
+// classFor returns the product's tax class, then its category's; nil means the tax_rate setting applies
+func (r *taxResolver) classFor(product models.Product) *models.TaxClass {
+	classID := product.TaxClassID
+	if classID == nil && product.CategoryID != nil {
+		categoryClassID, ok := r.categories[*product.CategoryID]
+		if !ok {
+			var category models.Category
+			if err := r.db.Select("id", "tax_class_id").First(&category, *product.CategoryID).Error; err == nil {
+				categoryClassID = category.TaxClassID
+			}
+			r.categories[*product.CategoryID] = categoryClassID
+		}
+		classID = categoryClassID
+	}
+	if classID == nil {
+		return nil
+	}
+
+	class, ok := r.classes[*classID]
+	if !ok {
+		var found models.TaxClass
+		if err := r.db.Where("id = ? AND is_active = ?", *classID, true).First(&found).Error; err == nil {
+			class = &found
+		}
+		r.classes[*classID] = class
+	}
+	return class
+}
+
+// lineTax computes the tax of a sale line worth net after discounts.
+// With inclusive pricing the tax is taken out of net instead of added on top
+func (r *taxResolver) lineTax(product models.Product, net float64, inclusive bool) models.SaleItemTax {
+	line := models.SaleItemTax{TaxName: "PPN", TaxRate: r.defaultRate}
+	if class := r.classFor(product); class != nil {
+		line.TaxClassID = &class.ID
+		line.TaxName = class.Name
+		line.TaxRate = class.Rate
+	}
+	if !r.enabled {
+		line.TaxRate = 0
+	}
+
+	if inclusive {
+		line.TaxableAmount = roundCurrency(net / (1 + line.TaxRate/100))
+		line.TaxAmount = roundCurrency(net - line.TaxableAmount)
+	} else {
+		line.TaxableAmount = roundCurrency(net)
+		line.TaxAmount = roundCurrency(net * line.TaxRate / 100)
+	}
+	return line
+}
+
+// storePricesIncludeTax reads prices_include_tax from Store.Settings, falling back to the global setting
+func storePricesIncludeTax(db *gorm.DB, storeID uint) bool {
+	var store models.Store
+	if err := db.Select("id", "settings").First(&store, storeID).Error; err == nil && len(store.Settings) > 0 {
+		var settings struct {
+			PricesIncludeTax *bool `json:"prices_include_tax"`
+		}
+		if json.Unmarshal(store.Settings, &settings) == nil && settings.PricesIncludeTax != nil {
+			return *settings.PricesIncludeTax
+		}
+	}
+	return getSettingBool(db, "prices_include_tax", false)
+}
+
+// GetTaxClasses retrieves all tax classes
+func (h *TaxHandler) GetTaxClasses(c *gin.Context) {
+	var classes []models.TaxClass
+
+	query := h.DB.Order("name")
+	if active := c.Query("is_active"); active != "" {
+		query = query.Where("is_active = ?", active == "true")
+	}
+
+	if err := query.Find(&classes).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": classes})
+}
+
+// GetTaxClass retrieves a single tax class by ID
+func (h *TaxHandler) GetTaxClass(c *gin.Context) {
+	var class models.TaxClass
+	if err := h.DB.First(&class, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Tax class not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": class})
+}
+
+// CreateTaxClass creates a new tax class
+func (h *TaxHandler) CreateTaxClass(c *gin.Context) {
+	var class models.TaxClass
+	if err := c.ShouldBindJSON(&class); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if class.Name == "" || class.Code == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Name and code are required"})
+		return
+	}
+	if class.Rate < 0 || class.Rate > 100 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Rate must be between 0 and 100"})
+		return
+	}
+
+	var existing models.TaxClass
+	if err := h.DB.Where("code = ?", class.Code).First(&existing).Error; err == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Tax class code already exists"})
+		return
+	}
+
+	if err := h.DB.Create(&class).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"data": class})
+}
+
+// UpdateTaxClass updates a tax class; sales already made keep their stored tax lines
+func (h *TaxHandler) UpdateTaxClass(c *gin.Context) {
+	id := c.Param("id")
+	var class models.TaxClass
+
+	if err := h.DB.First(&class, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Tax class not found"})
+		return
+	}
+
+	var updateData models.TaxClass
+	if err := c.ShouldBindJSON(&updateData); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if updateData.Name == "" || updateData.Code == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Name and code are required"})
+		return
+	}
+	if updateData.Rate < 0 || updateData.Rate > 100 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Rate must be between 0 and 100"})
+		return
+	}
+
+	var existing models.TaxClass
+	if err := h.DB.Where("code = ? AND id != ?", updateData.Code, id).First(&existing).Error; err == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Tax class code already exists"})
+		return
+	}
+
+	class.Name = updateData.Name
+	class.Code = updateData.Code
+	class.Rate = updateData.Rate
+	class.Description = updateData.Description
+	class.IsActive = updateData.IsActive
+
+	if err := h.DB.Save(&class).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": class})
+}
+
+// DeleteTaxClass deletes a tax class that is not assigned to any product or category
+func (h *TaxHandler) DeleteTaxClass(c *gin.Context) {
+	id := c.Param("id")
+
+	var productCount, categoryCount int64
+	h.DB.Model(&models.Product{}).Where("tax_class_id = ?", id).Count(&productCount)
+	h.DB.Model(&models.Category{}).Where("tax_class_id = ?", id).Count(&categoryCount)
+	if productCount > 0 || categoryCount > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot delete tax class assigned to products or categories"})
+		return
+	}
+
+	if err := h.DB.Delete(&models.TaxClass{}, id).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Tax class deleted successfully"})
+}
+
+// GetTaxSummary reports taxable turnover and tax per tax class and period.
+// Returned quantities are taken out of the sale they belong to
+func (h *TaxHandler) GetTaxSummary(c *gin.Context) {
+	period := c.DefaultQuery("period", "month")
+	if period != "day" && period != "month" && period != "year" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "period must be day, month or year"})
+		return
+	}
+
+	dateFrom := c.Query("date_from")
+	dateTo := c.Query("date_to")
+	storeID := c.Query("store_id")
+
+	query := h.DB.Table("sale_item_taxes AS t").
+		Select(`DATE_TRUNC(?, s.sale_date) AS period,
+			t.tax_class_id, t.tax_name, t.tax_rate,
+			COUNT(DISTINCT s.id) AS sales_count,
+			COALESCE(SUM(t.taxable_amount * (1 - COALESCE(r.quantity, 0) / si.quantity)), 0) AS taxable_amount,
+			COALESCE(SUM(t.tax_amount * (1 - COALESCE(r.quantity, 0) / si.quantity)), 0) AS tax_amount`, period).
+		Joins("JOIN sale_items si ON si.id = t.sale_item_id").
+		Joins("JOIN sales s ON s.id = t.sale_id").
+		Joins("LEFT JOIN (SELECT sale_item_id, SUM(quantity) AS quantity FROM sale_return_items GROUP BY sale_item_id) r ON r.sale_item_id = si.id").
+		Where("s.sale_status IN ?", []string{"completed", "refunded"})
+
+	if dateFrom != "" {
+		query = query.Where("DATE(s.sale_date) >= ?", dateFrom)
+	}
+	if dateTo != "" {
+		query = query.Where("DATE(s.sale_date) <= ?", dateTo)
+	}
+	if storeID != "" {
+		query = query.Where("s.store_id = ?", storeID)
+	}
+
+	var rows []struct {
+		Period        time.Time `json:"period"`
+		TaxClassID    *uint     `json:"tax_class_id"`
+		TaxName       string    `json:"tax_name"`
+		TaxRate       float64   `json:"tax_rate"`
+		SalesCount    int64     `json:"sales_count"`
+		TaxableAmount float64   `json:"taxable_amount"`
+		TaxAmount     float64   `json:"tax_amount"`
+	}
+	if err := query.Group("1, t.tax_class_id, t.tax_name, t.tax_rate").
+		Order("1, t.tax_name").Scan(&rows).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var totalTaxable, totalTax float64
+	for i := range rows {
+		rows[i].TaxableAmount = roundCurrency(rows[i].TaxableAmount)
+		rows[i].TaxAmount = roundCurrency(rows[i].TaxAmount)
+		totalTaxable += rows[i].TaxableAmount
+		totalTax += rows[i].TaxAmount
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": rows,
+		"summary": gin.H{
+			"period":         period,
+			"taxable_amount": roundCurrency(totalTaxable),
+			"tax_amount":     roundCurrency(totalTax),
+		},
+	})
+}
@@ -0,0 +1,314 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"starter/backend/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type UnitHandler struct {
+	DB *gorm.DB
+}
+
+func NewUnitHandler(db *gorm.DB) *UnitHandler {
+	return &UnitHandler{DB: db}
+}
+
+// resolveProductUnit finds how many base units of a product one unit holds. The base unit,
+// given by name or left empty, resolves to an empty unit and a factor of 1
+func resolveProductUnit(db *gorm.DB, product models.Product, unit string) (string, float64, error) {
+	unit = strings.TrimSpace(unit)
+	if unit == "" || strings.EqualFold(unit, product.Unit) {
+		return "", 1, nil
+	}
+
+	var productUnit models.ProductUnit
+	if err := db.Where("product_id = ? AND LOWER(unit) = LOWER(?)", product.ID, unit).First(&productUnit).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return "", 0, newSaleError(http.StatusBadRequest, "invalid_unit", fmt.Sprintf("%s has no unit %s", product.Name, unit))
+		}
+		return "", 0, err
+	}
+	return productUnit.Unit, productUnit.ConversionFactor, nil
+}
+
+// validateProductUnit checks the unit code and factor of a product pack
+func (h *UnitHandler) validateProductUnit(product models.Product, productUnit *models.ProductUnit, excludeID uint) string {
+	productUnit.Unit = strings.TrimSpace(productUnit.Unit)
+	productUnit.Barcode = strings.TrimSpace(productUnit.Barcode)
+	if productUnit.Unit == "" {
+		return "Unit is required"
+	}
+	if strings.EqualFold(productUnit.Unit, product.Unit) {
+		return "Unit must differ from the product's base unit"
+	}
+	if productUnit.ConversionFactor <= 0 {
+		return "Conversion factor must be greater than zero"
+	}
+
+	var uom models.UnitOfMeasure
+	if err := h.DB.Where("code = ? AND is_active = ?", productUnit.Unit, true).First(&uom).Error; err != nil {
+		return fmt.Sprintf("Unit %s is not defined", productUnit.Unit)
+	}
+
+	var count int64
+	h.DB.Model(&models.ProductUnit{}).Where("product_id = ? AND LOWER(unit) = LOWER(?) AND id != ?", product.ID, productUnit.Unit, excludeID).Count(&count)
+	if count > 0 {
+		return fmt.Sprintf("%s already has unit %s", product.Name, productUnit.Unit)
+	}
+
+	// A pack barcode must not be mistaken for another product or pack
+	if productUnit.Barcode != "" {
+		var products, variants, packs int64
+		h.DB.Model(&models.Product{}).Where("barcode = ?", productUnit.Barcode).Count(&products)
+		h.DB.Model(&models.ProductVariant{}).Where("barcode = ?", productUnit.Barcode).Count(&variants)
+		h.DB.Model(&models.ProductUnit{}).Where("barcode = ? AND id != ?", productUnit.Barcode, excludeID).Count(&packs)
+		if products+variants+packs > 0 {
+			return "Barcode already exists"
+		}
+	}
+	return ""
+}
+
+// GetUnits retrieves all units of measure
+func (h *UnitHandler) GetUnits(c *gin.Context) {
+	var units []models.UnitOfMeasure
+
+	query := h.DB.Order("code")
+	if active := c.Query("is_active"); active != "" {
+		query = query.Where("is_active = ?", active == "true")
+	}
+
+	if err := query.Find(&units).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": units})
+}
+
+// CreateUnit creates a new unit of measure
+func (h *UnitHandler) CreateUnit(c *gin.Context) {
+	var unit models.UnitOfMeasure
+	if err := c.ShouldBindJSON(&unit); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	unit.Code = strings.TrimSpace(unit.Code)
+	if unit.Code == "" || unit.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Name and code are required"})
+		return
+	}
+
+	var existing models.UnitOfMeasure
+	if err := h.DB.Where("LOWER(code) = LOWER(?)", unit.Code).First(&existing).Error; err == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unit code already exists"})
+		return
+	}
+
+	if err := h.DB.Create(&unit).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"data": unit})
+}
+
+// UpdateUnit updates the name, description and status of a unit; its code is kept because
+// products and packs refer to it
+func (h *UnitHandler) UpdateUnit(c *gin.Context) {
+	var unit models.UnitOfMeasure
+	if err := h.DB.First(&unit, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Unit not found"})
+		return
+	}
+
+	var updateData models.UnitOfMeasure
+	if err := c.ShouldBindJSON(&updateData); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if updateData.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Name is required"})
+		return
+	}
+	if updateData.Code != "" && updateData.Code != unit.Code {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unit code cannot be changed"})
+		return
+	}
+
+	unit.Name = updateData.Name
+	unit.Description = updateData.Description
+	unit.IsActive = updateData.IsActive
+
+	if err := h.DB.Save(&unit).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": unit})
+}
+
+// DeleteUnit deletes a unit that no product or pack uses
+func (h *UnitHandler) DeleteUnit(c *gin.Context) {
+	var unit models.UnitOfMeasure
+	if err := h.DB.First(&unit, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Unit not found"})
+		return
+	}
+
+	var productCount, packCount int64
+	h.DB.Model(&models.Product{}).Where("unit = ? OR purchase_unit = ? OR sale_unit = ?", unit.Code, unit.Code, unit.Code).Count(&productCount)
+	h.DB.Model(&models.ProductUnit{}).Where("unit = ?", unit.Code).Count(&packCount)
+	if productCount > 0 || packCount > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot delete unit used by products"})
+		return
+	}
+
+	if err := h.DB.Delete(&unit).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Unit deleted successfully"})
+}
+
+// loadProduct loads the product named by the :id route parameter
+func (h *UnitHandler) loadProduct(c *gin.Context) (models.Product, bool) {
+	var product models.Product
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		return product, false
+	}
+	if err := h.DB.First(&product, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return product, false
+	}
+	return product, true
+}
+
+// GetProductUnits lists the packs of a product
+func (h *UnitHandler) GetProductUnits(c *gin.Context) {
+	product, ok := h.loadProduct(c)
+	if !ok {
+		return
+	}
+
+	var units []models.ProductUnit
+	if err := h.DB.Where("product_id = ?", product.ID).Order("conversion_factor").Find(&units).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": units})
+}
+
+// CreateProductUnit adds a pack to a product
+func (h *UnitHandler) CreateProductUnit(c *gin.Context) {
+	product, ok := h.loadProduct(c)
+	if !ok {
+		return
+	}
+
+	var productUnit models.ProductUnit
+	if err := c.ShouldBindJSON(&productUnit); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	productUnit.ID = 0
+	productUnit.ProductID = product.ID
+
+	if msg := h.validateProductUnit(product, &productUnit, 0); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	if err := h.DB.Create(&productUnit).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"data": productUnit})
+}
+
+// UpdateProductUnit changes the unit, factor or barcode of a pack. Lines already on purchase
+// orders and transfers keep the factor they were made with
+func (h *UnitHandler) UpdateProductUnit(c *gin.Context) {
+	product, ok := h.loadProduct(c)
+	if !ok {
+		return
+	}
+
+	var productUnit models.ProductUnit
+	if err := h.DB.Where("id = ? AND product_id = ?", c.Param("unitId"), product.ID).First(&productUnit).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Product unit not found"})
+		return
+	}
+
+	var updateData models.ProductUnit
+	if err := c.ShouldBindJSON(&updateData); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if msg := h.validateProductUnit(product, &updateData, productUnit.ID); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	productUnit.Unit = updateData.Unit
+	productUnit.ConversionFactor = updateData.ConversionFactor
+	productUnit.Barcode = updateData.Barcode
+
+	if err := h.DB.Save(&productUnit).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": productUnit})
+}
+
+// DeleteProductUnit removes a pack from a product
+func (h *UnitHandler) DeleteProductUnit(c *gin.Context) {
+	product, ok := h.loadProduct(c)
+	if !ok {
+		return
+	}
+
+	var productUnit models.ProductUnit
+	if err := h.DB.Where("id = ? AND product_id = ?", c.Param("unitId"), product.ID).First(&productUnit).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Product unit not found"})
+		return
+	}
+	if strings.EqualFold(productUnit.Unit, product.PurchaseUnit) || strings.EqualFold(productUnit.Unit, product.SaleUnit) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unit is the product's purchase or sale unit"})
+		return
+	}
+
+	tx := h.DB.Begin()
+	if err := tx.Delete(&productUnit).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if err := recordCatalogDeletions(tx, "product_units", productUnit.ID); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	tx.Commit()
+
+	c.JSON(http.StatusOK, gin.H{"message": "Product unit deleted successfully"})
+}
@@ -6,6 +6,8 @@ import (
 	"starter/backend/database"
 	"starter/backend/handlers"
 	"starter/backend/middleware"
+	"starter/backend/payments"
+	"time"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
@@ -39,6 +41,30 @@ func main() {
 	// 	log.Printf("Warning: Failed to seed data: %v", err)
 	// }
 
+	// Register payment providers and release sales whose payment timed out. The mock
+	// provider settles payments with no money moving, so release builds only get it
+	// when a secret of its own is set
+	mockSecret := cfg.PaymentMockSecret
+	if mockSecret == "" && cfg.GinMode != gin.ReleaseMode {
+		mockSecret = config.DevPaymentMockSecret
+	}
+	if cfg.GinMode == gin.ReleaseMode && mockSecret == config.DevPaymentMockSecret {
+		log.Fatal("PAYMENT_MOCK_SECRET must not be the development secret in release mode")
+	}
+	if mockSecret != "" {
+		payments.Register(payments.NewMockProvider(mockSecret))
+	}
+	go handlers.RunPaymentExpiryJob(database.DB, time.Minute)
+
+	// Discard parked carts that were never resumed
+	go handlers.RunDraftExpiryJob(database.DB, 5*time.Minute)
+
+	// Take expired loyalty points off the customers' balances
+	go handlers.RunLoyaltyExpiryJob(database.DB, time.Hour)
+
+	// Put scheduled price changes into effect
+	go handlers.RunPriceChangeJob(database.DB, time.Minute)
+
 	// Set Gin mode from config
 	gin.SetMode(cfg.GinMode)
 
@@ -50,8 +76,8 @@ func main() {
 	r.Use(cors.New(cors.Config{
 		AllowOrigins:     corsOrigins,
 		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization"},
-		ExposeHeaders:    []string{"Content-Length"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization", "Idempotency-Key"},
+		ExposeHeaders:    []string{"Content-Length", "Idempotent-Replayed"},
 		AllowCredentials: true,
 	}))
 
@@ -61,6 +87,10 @@ func main() {
 		api.POST("/auth/login", handlers.Login)
 		api.GET("/settings", handlers.GetSettings) // Public access to settings
 
+		// Payment provider callbacks are authenticated by the provider's signature
+		paymentHandler := handlers.NewPaymentHandler(database.DB)
+		api.POST("/payments/webhook/:provider", paymentHandler.PaymentWebhook)
+
 		// Protected routes
 		protected := api.Group("")
 		protected.Use(middleware.AuthMiddleware())
@@ -104,6 +134,21 @@ func main() {
 			stockTransferHandler := handlers.NewStockTransferHandler(database.DB)
 			storageLocationHandler := handlers.NewStorageLocationHandler(database.DB)
 			discountHandler := handlers.NewDiscountHandler(database.DB)
+			saleReturnHandler := handlers.NewSaleReturnHandler(database.DB)
+			registerSessionHandler := handlers.NewRegisterSessionHandler(database.DB)
+			syncHandler := handlers.NewSyncHandler(database.DB)
+			taxHandler := handlers.NewTaxHandler(database.DB)
+			documentSequenceHandler := handlers.NewDocumentSequenceHandler(database.DB)
+			customerAccountHandler := handlers.NewCustomerAccountHandler(database.DB)
+			giftCardHandler := handlers.NewGiftCardHandler(database.DB)
+			loyaltyHandler := handlers.NewLoyaltyHandler(database.DB)
+			stockLotHandler := handlers.NewStockLotHandler(database.DB)
+			serialNumberHandler := handlers.NewSerialNumberHandler(database.DB)
+			unitHandler := handlers.NewUnitHandler(database.DB)
+			barcodeHandler := handlers.NewBarcodeHandler(database.DB)
+			labelHandler := handlers.NewLabelHandler(database.DB)
+			kitHandler := handlers.NewKitHandler(database.DB)
+			priceChangeHandler := handlers.NewPriceChangeHandler(database.DB)
 
 			// Store routes
 			// Note: pos.view allows POS/Kasir to read store list without full stores management access
@@ -125,10 +170,50 @@ func main() {
 			// Product routes
 			// Note: pos.view allows POS/Kasir to read products for transactions
 			protected.GET("/products", middleware.RequireAnyPermission("products.view", "pos.view"), productHandler.GetProducts)
+			protected.GET("/products/export", middleware.RequirePermission("products.view"), productHandler.ExportProducts)
+			protected.POST("/products/import", middleware.RequirePermission("products.create"), productHandler.ImportProducts)
+			protected.GET("/products/lookup", middleware.RequireAnyPermission("products.view", "pos.view"), barcodeHandler.LookupProduct)
 			protected.GET("/products/:id", middleware.RequireAnyPermission("products.view", "pos.view"), productHandler.GetProduct)
 			protected.POST("/products", middleware.RequirePermission("products.create"), productHandler.CreateProduct)
 			protected.PUT("/products/:id", middleware.RequirePermission("products.update"), productHandler.UpdateProduct)
 			protected.DELETE("/products/:id", middleware.RequirePermission("products.delete"), productHandler.DeleteProduct)
+			protected.GET("/products/:id/units", middleware.RequireAnyPermission("products.view", "pos.view"), unitHandler.GetProductUnits)
+			protected.POST("/products/:id/units", middleware.RequirePermission("products.update"), unitHandler.CreateProductUnit)
+			protected.PUT("/products/:id/units/:unitId", middleware.RequirePermission("products.update"), unitHandler.UpdateProductUnit)
+			protected.DELETE("/products/:id/units/:unitId", middleware.RequirePermission("products.update"), unitHandler.DeleteProductUnit)
+			protected.GET("/products/:id/barcode", middleware.RequirePermission("products.view"), labelHandler.GetProductBarcode)
+			protected.GET("/products/:id/components", middleware.RequireAnyPermission("products.view", "pos.view"), kitHandler.GetKitComponents)
+			protected.PUT("/products/:id/components", middleware.RequirePermission("products.update"), kitHandler.SetKitComponents)
+			protected.GET("/products/:id/availability", middleware.RequireAnyPermission("products.view", "pos.view"), kitHandler.GetKitAvailability)
+			protected.GET("/products/:id/price-history", middleware.RequirePermission("products.view"), priceChangeHandler.GetProductPriceHistory)
+
+			// Scheduled price change routes
+			protected.GET("/price-changes", middleware.RequirePermission("products.view"), priceChangeHandler.GetPriceChanges)
+			protected.POST("/price-changes", middleware.RequirePermission("products.update"), priceChangeHandler.CreatePriceChange)
+			protected.DELETE("/price-changes/:id", middleware.RequirePermission("products.update"), priceChangeHandler.CancelPriceChange)
+
+			// Unit of measure routes
+			protected.GET("/units", middleware.RequireAnyPermission("products.view", "pos.view"), unitHandler.GetUnits)
+			protected.POST("/units", middleware.RequirePermission("products.create"), unitHandler.CreateUnit)
+			protected.PUT("/units/:id", middleware.RequirePermission("products.update"), unitHandler.UpdateUnit)
+			protected.DELETE("/units/:id", middleware.RequirePermission("products.delete"), unitHandler.DeleteUnit)
+
+			// Embedded barcode schema routes (scale and price labels)
+			protected.GET("/barcode-schemas", middleware.RequireAnyPermission("products.view", "settings.view"), barcodeHandler.GetBarcodeSchemas)
+			protected.POST("/barcode-schemas", middleware.RequirePermission("settings.update"), barcodeHandler.CreateBarcodeSchema)
+			protected.PUT("/barcode-schemas/:id", middleware.RequirePermission("settings.update"), barcodeHandler.UpdateBarcodeSchema)
+			protected.DELETE("/barcode-schemas/:id", middleware.RequirePermission("settings.update"), barcodeHandler.DeleteBarcodeSchema)
+
+			// Label printing routes
+			protected.GET("/label-templates", middleware.RequireAnyPermission("products.view", "settings.view"), labelHandler.GetLabelTemplates)
+			protected.POST("/label-templates", middleware.RequirePermission("settings.update"), labelHandler.CreateLabelTemplate)
+			protected.PUT("/label-templates/:id", middleware.RequirePermission("settings.update"), labelHandler.UpdateLabelTemplate)
+			protected.DELETE("/label-templates/:id", middleware.RequirePermission("settings.update"), labelHandler.DeleteLabelTemplate)
+			protected.POST("/labels/print", middleware.RequirePermission("products.view"), labelHandler.PrintLabels)
+			protected.GET("/labels/queue", middleware.RequirePermission("products.view"), labelHandler.GetLabelQueue)
+			protected.POST("/labels/queue", middleware.RequirePermission("products.update"), labelHandler.AddToLabelQueue)
+			protected.POST("/labels/queue/print", middleware.RequirePermission("products.update"), labelHandler.PrintLabelQueue)
+			protected.DELETE("/labels/queue/:id", middleware.RequirePermission("products.update"), labelHandler.DeleteLabelQueueItem)
 
 			// Category routes
 			// Note: pos.view allows POS/Kasir to read categories for filtering products
@@ -145,6 +230,17 @@ func main() {
 			protected.PUT("/inventory/:id", middleware.RequirePermission("inventory.update"), inventoryHandler.UpdateInventory)
 			protected.POST("/inventory/adjust", middleware.RequirePermission("inventory.update"), inventoryHandler.AdjustInventory)
 			protected.GET("/inventory/transactions", middleware.RequirePermission("inventory.view"), inventoryHandler.GetInventoryTransactions)
+			protected.GET("/inventory/lots", middleware.RequirePermission("inventory.view"), stockLotHandler.GetStockLots)
+
+			// Serial number routes
+			// Note: pos.view allows POS/Kasir to look up a unit at the till, e.g. for warranty claims
+			protected.GET("/serial-numbers", middleware.RequireAnyPermission("inventory.view", "pos.view"), serialNumberHandler.GetSerialNumbers)
+			protected.GET("/serial-numbers/lookup", middleware.RequireAnyPermission("inventory.view", "pos.view"), serialNumberHandler.LookupSerialNumber)
+
+			// Kit assembly routes
+			protected.GET("/kits/assemblies", middleware.RequirePermission("inventory.view"), kitHandler.GetKitAssemblies)
+			protected.POST("/kits/assemble", middleware.RequirePermission("inventory.update"), kitHandler.AssembleKits)
+			protected.POST("/kits/disassemble", middleware.RequirePermission("inventory.update"), kitHandler.DisassembleKits)
 
 			// Store Inventory routes
 			// Note: pos.view allows POS/Kasir to read store inventory for stock checking
@@ -159,8 +255,55 @@ func main() {
 			protected.GET("/sales/:id", middleware.RequireAnyPermission("sales.view", "pos.view"), salesHandler.GetSale)
 			protected.POST("/sales", middleware.RequireAnyPermission("sales.create", "pos.create"), salesHandler.CreateSale)
 			protected.PUT("/sales/:id", middleware.RequirePermission("sales.update"), salesHandler.UpdateSale)
+
+			// Parked cart routes
+			protected.POST("/sales/drafts", middleware.RequireAnyPermission("sales.create", "pos.create"), salesHandler.CreateDraft)
+			protected.GET("/sales/drafts", middleware.RequireAnyPermission("sales.view", "pos.view"), salesHandler.GetDrafts)
+			protected.PUT("/sales/drafts/:id", middleware.RequireAnyPermission("sales.create", "pos.create"), salesHandler.UpdateDraft)
+			protected.DELETE("/sales/drafts/:id", middleware.RequireAnyPermission("sales.create", "pos.create"), salesHandler.DeleteDraft)
+			protected.POST("/sales/drafts/:id/finalize", middleware.RequireAnyPermission("sales.create", "pos.create"), salesHandler.FinalizeDraft)
+			protected.GET("/sales/:id/receipt", middleware.RequireAnyPermission("sales.view", "pos.view"), salesHandler.GetSaleReceipt)
+			protected.POST("/sales/:id/void", middleware.RequirePermission("sales.void"), salesHandler.VoidSale)
+			protected.GET("/sales/:id/payment-status", middleware.RequireAnyPermission("sales.view", "pos.view"), paymentHandler.GetSalePaymentStatus)
+			protected.POST("/sales/:id/cancel-payment", middleware.RequireAnyPermission("sales.create", "pos.create"), paymentHandler.CancelSalePayment)
+
+			// Sale return routes
+			protected.POST("/sales/:id/returns", middleware.RequirePermission("sales.return"), saleReturnHandler.CreateSaleReturn)
+			protected.GET("/sale-returns", middleware.RequireAnyPermission("sales.view", "sales.return"), saleReturnHandler.GetSaleReturns)
+			protected.GET("/sale-returns/:id", middleware.RequireAnyPermission("sales.view", "sales.return"), saleReturnHandler.GetSaleReturn)
 			protected.GET("/sales/stats", middleware.RequireAnyPermission("sales.view", "pos.view"), salesHandler.GetSalesStats)
 
+			// Tax routes
+			// Note: pos.view allows POS/Kasir to read tax classes for price display
+			protected.GET("/tax-classes", middleware.RequireAnyPermission("products.view", "pos.view"), taxHandler.GetTaxClasses)
+			protected.GET("/tax-classes/:id", middleware.RequireAnyPermission("products.view", "pos.view"), taxHandler.GetTaxClass)
+			protected.POST("/tax-classes", middleware.RequirePermission("settings.update"), taxHandler.CreateTaxClass)
+			protected.PUT("/tax-classes/:id", middleware.RequirePermission("settings.update"), taxHandler.UpdateTaxClass)
+			protected.DELETE("/tax-classes/:id", middleware.RequirePermission("settings.update"), taxHandler.DeleteTaxClass)
+			protected.GET("/reports/tax-summary", middleware.RequireAnyPermission("reports.view", "reports.sales"), taxHandler.GetTaxSummary)
+
+			// Document numbering routes
+			protected.GET("/document-sequences", middleware.RequirePermission("settings.view"), documentSequenceHandler.GetDocumentSequences)
+			protected.POST("/document-sequences", middleware.RequirePermission("settings.update"), documentSequenceHandler.CreateDocumentSequence)
+			protected.PUT("/document-sequences/:id", middleware.RequirePermission("settings.update"), documentSequenceHandler.UpdateDocumentSequence)
+			protected.DELETE("/document-sequences/:id", middleware.RequirePermission("settings.update"), documentSequenceHandler.DeleteDocumentSequence)
+
+			// Offline sync routes
+			// Note: pos.view/pos.create allows POS terminals to cache the catalog and push sales made offline
+			protected.POST("/sync/sales", middleware.RequireAnyPermission("sales.create", "pos.create"), syncHandler.SyncSales)
+			protected.GET("/sync/catalog", middleware.RequireAnyPermission("products.view", "pos.view"), syncHandler.GetCatalog)
+
+			// Register session routes
+			// Note: pos.create lets kasir open/close their own shift; registers.manage is checked in the handler for other cashiers
+			protected.POST("/register-sessions", middleware.RequireAnyPermission("sales.create", "pos.create"), registerSessionHandler.OpenRegisterSession)
+			protected.GET("/register-sessions", middleware.RequirePermission("registers.view"), registerSessionHandler.GetRegisterSessions)
+			protected.GET("/register-sessions/current", middleware.RequireAnyPermission("sales.create", "pos.view"), registerSessionHandler.GetCurrentRegisterSession)
+			protected.GET("/register-sessions/:id", middleware.RequireAnyPermission("registers.view", "pos.view"), registerSessionHandler.GetRegisterSession)
+			protected.POST("/register-sessions/:id/cash-movements", middleware.RequireAnyPermission("sales.create", "pos.create"), registerSessionHandler.CreateCashMovement)
+			protected.POST("/register-sessions/:id/close", middleware.RequireAnyPermission("sales.create", "pos.create"), registerSessionHandler.CloseRegisterSession)
+			protected.GET("/register-sessions/:id/x-report", middleware.RequireAnyPermission("registers.view", "pos.view"), registerSessionHandler.GetXReport)
+			protected.GET("/register-sessions/:id/z-report", middleware.RequireAnyPermission("registers.view", "pos.view"), registerSessionHandler.GetZReport)
+
 			// Customer routes
 			// Note: pos.view allows POS/Kasir to read customer list for transactions
 			protected.GET("/customers", middleware.RequireAnyPermission("customers.view", "pos.view"), customerHandler.GetCustomers)
@@ -170,6 +313,31 @@ func main() {
 			protected.DELETE("/customers/:id", middleware.RequirePermission("customers.delete"), customerHandler.DeleteCustomer)
 			protected.GET("/customers/:id/stats", middleware.RequireAnyPermission("customers.view", "pos.view"), customerHandler.GetCustomerStats)
 
+			// Customer account (receivables) routes
+			protected.POST("/customers/:id/payments", middleware.RequirePermission("customers.payment"), customerAccountHandler.CreateCustomerPayment)
+			protected.GET("/customers/:id/payments", middleware.RequireAnyPermission("customers.view", "customers.payment"), customerAccountHandler.GetCustomerPayments)
+			protected.GET("/customers/:id/statement", middleware.RequireAnyPermission("customers.view", "customers.payment"), customerAccountHandler.GetCustomerStatement)
+			protected.GET("/reports/ar-aging", middleware.RequireAnyPermission("reports.view", "reports.sales"), customerAccountHandler.GetAgingReport)
+
+			// Lot and expiry reports
+			protected.GET("/reports/near-expiry", middleware.RequireAnyPermission("reports.view", "inventory.view"), stockLotHandler.GetNearExpiryReport)
+			protected.GET("/reports/expired-stock", middleware.RequireAnyPermission("reports.view", "inventory.view"), stockLotHandler.GetExpiredStockReport)
+			protected.GET("/reports/lot-trace", middleware.RequireAnyPermission("reports.view", "inventory.view"), stockLotHandler.GetLotTrace)
+
+			// Gift card and store credit routes
+			protected.GET("/gift-cards", middleware.RequirePermission("giftcards.view"), giftCardHandler.GetGiftCards)
+			protected.GET("/gift-cards/lookup", middleware.RequireAnyPermission("giftcards.view", "pos.view"), giftCardHandler.LookupGiftCard)
+			protected.GET("/gift-cards/:id", middleware.RequirePermission("giftcards.view"), giftCardHandler.GetGiftCard)
+			protected.PUT("/gift-cards/:id/status", middleware.RequirePermission("giftcards.manage"), giftCardHandler.UpdateGiftCardStatus)
+
+			// Loyalty routes
+			protected.GET("/customers/:id/loyalty", middleware.RequireAnyPermission("customers.view", "pos.view"), loyaltyHandler.GetCustomerLoyalty)
+			protected.POST("/customers/:id/loyalty/adjust", middleware.RequirePermission("loyalty.manage"), loyaltyHandler.AdjustCustomerPoints)
+			protected.GET("/loyalty-tiers", middleware.RequireAnyPermission("customers.view", "pos.view"), loyaltyHandler.GetLoyaltyTiers)
+			protected.POST("/loyalty-tiers", middleware.RequirePermission("loyalty.manage"), loyaltyHandler.CreateLoyaltyTier)
+			protected.PUT("/loyalty-tiers/:id", middleware.RequirePermission("loyalty.manage"), loyaltyHandler.UpdateLoyaltyTier)
+			protected.DELETE("/loyalty-tiers/:id", middleware.RequirePermission("loyalty.manage"), loyaltyHandler.DeleteLoyaltyTier)
+
 			// Supplier routes
 			protected.GET("/suppliers", middleware.RequirePermission("suppliers.view"), supplierHandler.GetSuppliers)
 			protected.GET("/suppliers/:id", middleware.RequirePermission("suppliers.view"), supplierHandler.GetSupplier)
@@ -206,6 +374,7 @@ func main() {
 			protected.GET("/discounts", middleware.RequireAnyPermission("sales.view", "discounts.view", "pos.view"), discountHandler.GetDiscounts)
 			protected.GET("/discounts/active", middleware.RequireAnyPermission("sales.view", "discounts.view", "pos.view"), discountHandler.GetActiveDiscounts)
 			protected.GET("/discounts/validate", middleware.RequireAnyPermission("sales.view", "discounts.view", "pos.view"), discountHandler.ValidateDiscount)
+			protected.POST("/discounts/evaluate", middleware.RequireAnyPermission("sales.view", "discounts.view", "pos.view"), discountHandler.EvaluateDiscounts)
 			protected.GET("/discounts/:id", middleware.RequireAnyPermission("sales.view", "discounts.view", "pos.view"), discountHandler.GetDiscount)
 			protected.POST("/discounts", middleware.RequireAnyPermission("sales.create", "discounts.create"), discountHandler.CreateDiscount)
 			protected.PUT("/discounts/:id", middleware.RequireAnyPermission("sales.update", "discounts.update"), discountHandler.UpdateDiscount)
@@ -180,3 +180,24 @@ func RequireAnyPermission(permissions ...string) gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+// UserHasPermission reports whether a user's role grants the given permission.
+// Used for in-request approvals (e.g. manager overrides) that cannot be expressed as route middleware
+func UserHasPermission(user *models.User, permission string) bool {
+	var role models.Role
+	if err := database.DB.Preload("Permissions").First(&role, user.RoleID).Error; err != nil {
+		return false
+	}
+
+	// Admin role always has all permissions
+	if strings.ToLower(role.Name) == "admin" {
+		return true
+	}
+
+	for _, perm := range role.Permissions {
+		if perm.Name == permission {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,11 @@
+-- Add void tracking and applied loyalty points to sales table
+ALTER TABLE sales ADD COLUMN IF NOT EXISTS points_earned INTEGER DEFAULT 0;
+ALTER TABLE sales ADD COLUMN IF NOT EXISTS points_redeemed INTEGER DEFAULT 0;
+ALTER TABLE sales ADD COLUMN IF NOT EXISTS void_reason TEXT;
+ALTER TABLE sales ADD COLUMN IF NOT EXISTS voided_by INTEGER REFERENCES users(id);
+ALTER TABLE sales ADD COLUMN IF NOT EXISTS voided_at TIMESTAMP;
+
+-- Register void permission
+INSERT INTO permissions (name, module, category, description, actions, created_at, updated_at)
+VALUES ('sales.void', 'Penjualan', 'edit', 'Batalkan (void) transaksi penjualan', '["void"]', NOW(), NOW())
+ON CONFLICT (name) DO NOTHING;
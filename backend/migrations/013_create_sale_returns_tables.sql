@@ -0,0 +1,51 @@
+-- Sale returns
+CREATE TABLE IF NOT EXISTS sale_returns (
+    id SERIAL PRIMARY KEY,
+    return_number VARCHAR(50) UNIQUE NOT NULL,
+    sale_id INTEGER NOT NULL REFERENCES sales(id),
+    store_id INTEGER NOT NULL REFERENCES stores(id),
+    customer_id INTEGER REFERENCES customers(id),
+    processed_by INTEGER NOT NULL REFERENCES users(id),
+    refund_amount DECIMAL(15,2) NOT NULL DEFAULT 0,
+    points_reversed INTEGER DEFAULT 0,
+    reason TEXT,
+    notes TEXT,
+    return_date TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Returned lines, linked to the original sale items
+CREATE TABLE IF NOT EXISTS sale_return_items (
+    id SERIAL PRIMARY KEY,
+    sale_return_id INTEGER NOT NULL REFERENCES sale_returns(id) ON DELETE CASCADE,
+    sale_item_id INTEGER NOT NULL REFERENCES sale_items(id),
+    product_id INTEGER NOT NULL REFERENCES products(id),
+    product_variant_id INTEGER REFERENCES product_variants(id),
+    quantity DECIMAL(10,3) NOT NULL CHECK (quantity > 0),
+    unit_price DECIMAL(15,2) NOT NULL,
+    refund_amount DECIMAL(15,2) NOT NULL,
+    condition VARCHAR(20) DEFAULT 'restock', -- restock, damaged
+    reason TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Refund tenders
+CREATE TABLE IF NOT EXISTS sale_return_refunds (
+    id SERIAL PRIMARY KEY,
+    sale_return_id INTEGER NOT NULL REFERENCES sale_returns(id) ON DELETE CASCADE,
+    payment_method VARCHAR(50) NOT NULL,
+    amount DECIMAL(15,2) NOT NULL,
+    reference_number VARCHAR(100),
+    status VARCHAR(20) DEFAULT 'pending', -- pending, completed, failed
+    processed_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_sale_returns_sale_id ON sale_returns(sale_id);
+CREATE INDEX IF NOT EXISTS idx_sale_return_items_sale_item_id ON sale_return_items(sale_item_id);
+
+-- Register return permission
+INSERT INTO permissions (name, module, category, description, actions, created_at, updated_at)
+VALUES ('sales.return', 'Penjualan', 'create', 'Proses retur dan refund penjualan', '["return"]', NOW(), NOW())
+ON CONFLICT (name) DO NOTHING;
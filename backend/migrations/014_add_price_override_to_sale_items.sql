@@ -0,0 +1,13 @@
+-- Track catalog price and manager price overrides per sale line
+ALTER TABLE sale_items ADD COLUMN IF NOT EXISTS list_price DECIMAL(15,2) DEFAULT 0;
+ALTER TABLE sale_items ADD COLUMN IF NOT EXISTS price_override_by INTEGER REFERENCES users(id);
+
+-- Tax is now computed on the server from these settings
+INSERT INTO settings (key, value, created_at, updated_at)
+VALUES ('tax_enabled', 'true', NOW(), NOW())
+ON CONFLICT (key) DO NOTHING;
+
+-- Register price override permission
+INSERT INTO permissions (name, module, category, description, actions, created_at, updated_at)
+VALUES ('sales.price_override', 'Penjualan', 'edit', 'Setujui perubahan harga dan diskon manual di kasir', '["override"]', NOW(), NOW())
+ON CONFLICT (name) DO NOTHING;
@@ -0,0 +1,49 @@
+-- Cash register sessions (shifts)
+CREATE TABLE IF NOT EXISTS register_sessions (
+    id SERIAL PRIMARY KEY,
+    store_id INTEGER NOT NULL REFERENCES stores(id),
+    cashier_id INTEGER NOT NULL REFERENCES users(id),
+    status VARCHAR(20) DEFAULT 'open', -- open, closed
+    opening_float DECIMAL(15,2) DEFAULT 0,
+    expected_cash DECIMAL(15,2) DEFAULT 0,
+    counted_cash DECIMAL(15,2) DEFAULT 0,
+    cash_difference DECIMAL(15,2) DEFAULT 0, -- counted - expected
+    counted_denominations JSONB,
+    counted_by_method JSONB,
+    opened_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    closed_at TIMESTAMP,
+    closed_by INTEGER REFERENCES users(id),
+    notes TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- A cashier can only have one open session per store
+CREATE UNIQUE INDEX IF NOT EXISTS idx_register_sessions_open
+    ON register_sessions(store_id, cashier_id) WHERE status = 'open';
+
+-- Pay-ins and pay-outs during a session
+CREATE TABLE IF NOT EXISTS cash_movements (
+    id SERIAL PRIMARY KEY,
+    register_session_id INTEGER NOT NULL REFERENCES register_sessions(id) ON DELETE CASCADE,
+    type VARCHAR(20) NOT NULL, -- pay_in, pay_out
+    amount DECIMAL(15,2) NOT NULL CHECK (amount > 0),
+    reason TEXT,
+    created_by INTEGER NOT NULL REFERENCES users(id),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_cash_movements_register_session_id ON cash_movements(register_session_id);
+
+-- Link sales and refunds to the drawer they were taken on
+ALTER TABLE sales ADD COLUMN IF NOT EXISTS register_session_id INTEGER REFERENCES register_sessions(id);
+ALTER TABLE sale_returns ADD COLUMN IF NOT EXISTS register_session_id INTEGER REFERENCES register_sessions(id);
+
+CREATE INDEX IF NOT EXISTS idx_sales_register_session_id ON sales(register_session_id);
+
+-- Register session permissions
+INSERT INTO permissions (name, module, category, description, actions, created_at, updated_at)
+VALUES
+    ('registers.view', 'Shift Kasir', 'view', 'Lihat shift kasir dan laporan X/Z', '["view"]', NOW(), NOW()),
+    ('registers.manage', 'Shift Kasir', 'edit', 'Kelola dan tutup shift kasir lain', '["manage"]', NOW(), NOW())
+ON CONFLICT (name) DO NOTHING;
@@ -0,0 +1,4 @@
+-- Idempotency key for POS retries; NULLs are allowed for sales created without a key
+ALTER TABLE sales ADD COLUMN IF NOT EXISTS client_uuid VARCHAR(100);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_sales_client_uuid ON sales(client_uuid);
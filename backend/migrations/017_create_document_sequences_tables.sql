@@ -0,0 +1,30 @@
+-- Document numbering configuration; an empty location_type is the default for all locations
+CREATE TABLE IF NOT EXISTS document_sequences (
+    id SERIAL PRIMARY KEY,
+    document_type VARCHAR(50) NOT NULL, -- sale, sale_return, purchase_order, stock_transfer, journal_entry
+    location_type VARCHAR(20) NOT NULL DEFAULT '', -- store, warehouse, '' for the default
+    location_id INTEGER NOT NULL DEFAULT 0,
+    prefix VARCHAR(20),
+    format VARCHAR(100) NOT NULL, -- {PREFIX}, {STORE}, {YYYY}, {YY}, {MM}, {DD}, {SEQ}
+    reset_period VARCHAR(20) DEFAULT 'daily', -- daily, monthly, yearly, never
+    padding INTEGER DEFAULT 4,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_document_sequence_scope
+    ON document_sequences(document_type, location_type, location_id);
+
+-- Last issued number per document type, location and period; locked by the issuing transaction
+CREATE TABLE IF NOT EXISTS document_counters (
+    id SERIAL PRIMARY KEY,
+    document_type VARCHAR(50) NOT NULL,
+    location_type VARCHAR(20) NOT NULL DEFAULT '',
+    location_id INTEGER NOT NULL DEFAULT 0,
+    period_key VARCHAR(10) NOT NULL, -- 20240131, 202401, 2024 or all
+    last_value BIGINT NOT NULL DEFAULT 0,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_document_counter_scope
+    ON document_counters(document_type, location_type, location_id, period_key);
@@ -0,0 +1,46 @@
+-- Tax classes assignable to products and categories
+CREATE TABLE IF NOT EXISTS tax_classes (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(100) NOT NULL,
+    code VARCHAR(50) UNIQUE NOT NULL,
+    rate DECIMAL(5,2) DEFAULT 0, -- percentage, 0 for exempt
+    description TEXT,
+    is_active BOOLEAN DEFAULT true,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+ALTER TABLE categories ADD COLUMN IF NOT EXISTS tax_class_id INTEGER REFERENCES tax_classes(id);
+ALTER TABLE products ADD COLUMN IF NOT EXISTS tax_class_id INTEGER REFERENCES tax_classes(id);
+
+-- Per-line tax on sales
+ALTER TABLE sales ADD COLUMN IF NOT EXISTS prices_include_tax BOOLEAN DEFAULT false;
+ALTER TABLE sale_items ADD COLUMN IF NOT EXISTS tax_class_id INTEGER REFERENCES tax_classes(id);
+ALTER TABLE sale_items ADD COLUMN IF NOT EXISTS tax_rate DECIMAL(5,2) DEFAULT 0;
+ALTER TABLE sale_items ADD COLUMN IF NOT EXISTS tax_amount DECIMAL(15,2) DEFAULT 0;
+
+-- Tax breakdown lines per sale item
+CREATE TABLE IF NOT EXISTS sale_item_taxes (
+    id SERIAL PRIMARY KEY,
+    sale_item_id INTEGER NOT NULL REFERENCES sale_items(id) ON DELETE CASCADE,
+    sale_id INTEGER NOT NULL REFERENCES sales(id) ON DELETE CASCADE,
+    tax_class_id INTEGER REFERENCES tax_classes(id),
+    tax_name VARCHAR(100),
+    tax_rate DECIMAL(5,2) DEFAULT 0,
+    taxable_amount DECIMAL(15,2) DEFAULT 0,
+    tax_amount DECIMAL(15,2) DEFAULT 0,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_sale_item_taxes_sale_item_id ON sale_item_taxes(sale_item_id);
+CREATE INDEX IF NOT EXISTS idx_sale_item_taxes_sale_id ON sale_item_taxes(sale_id);
+
+INSERT INTO tax_classes (code, name, rate, description, created_at, updated_at)
+VALUES
+    ('PPN', 'PPN', 11, 'Pajak Pertambahan Nilai', NOW(), NOW()),
+    ('BEBAS', 'Bebas PPN', 0, 'Barang kebutuhan pokok yang dibebaskan dari PPN', NOW(), NOW())
+ON CONFLICT (code) DO NOTHING;
+
+INSERT INTO settings (key, value, created_at, updated_at)
+VALUES ('prices_include_tax', 'false', NOW(), NOW())
+ON CONFLICT (key) DO NOTHING;
@@ -0,0 +1,11 @@
+-- Payments confirmed by a provider (QRIS, EDC) stay pending until a webhook or poll settles them
+ALTER TABLE sale_payments ADD COLUMN IF NOT EXISTS provider VARCHAR(50);
+ALTER TABLE sale_payments ADD COLUMN IF NOT EXISTS provider_reference VARCHAR(255);
+ALTER TABLE sale_payments ADD COLUMN IF NOT EXISTS payment_payload TEXT;
+ALTER TABLE sale_payments ADD COLUMN IF NOT EXISTS expires_at TIMESTAMP;
+
+CREATE INDEX IF NOT EXISTS idx_sale_payments_provider_reference ON sale_payments(provider_reference);
+
+INSERT INTO settings (key, value, created_at, updated_at)
+VALUES ('payment_timeout_minutes', '15', NOW(), NOW())
+ON CONFLICT (key) DO NOTHING;
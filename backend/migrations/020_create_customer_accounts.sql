@@ -0,0 +1,66 @@
+-- Customer credit limits and accounts receivable
+ALTER TABLE customers ADD COLUMN IF NOT EXISTS credit_limit DECIMAL(15,2) DEFAULT 0;
+ALTER TABLE customers ADD COLUMN IF NOT EXISTS balance DECIMAL(15,2) DEFAULT 0;
+
+ALTER TABLE sales ADD COLUMN IF NOT EXISTS credit_amount DECIMAL(15,2) DEFAULT 0;
+ALTER TABLE sales ADD COLUMN IF NOT EXISTS balance_due DECIMAL(15,2) DEFAULT 0;
+
+CREATE INDEX IF NOT EXISTS idx_sales_open_balance ON sales(customer_id, sale_date) WHERE balance_due > 0;
+
+-- Money received against a customer's account
+CREATE TABLE IF NOT EXISTS customer_payments (
+    id SERIAL PRIMARY KEY,
+    payment_number VARCHAR(50) UNIQUE NOT NULL,
+    customer_id INTEGER NOT NULL REFERENCES customers(id),
+    store_id INTEGER NOT NULL REFERENCES stores(id),
+    register_session_id INTEGER REFERENCES register_sessions(id),
+    payment_method VARCHAR(50) NOT NULL,
+    amount DECIMAL(15,2) NOT NULL CHECK (amount > 0),
+    reference_number VARCHAR(255),
+    notes TEXT,
+    received_by INTEGER NOT NULL REFERENCES users(id),
+    payment_date TIMESTAMP NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_customer_payments_customer_id ON customer_payments(customer_id);
+
+-- Which credit sales each payment settled
+CREATE TABLE IF NOT EXISTS customer_payment_allocations (
+    id SERIAL PRIMARY KEY,
+    customer_payment_id INTEGER NOT NULL REFERENCES customer_payments(id) ON DELETE CASCADE,
+    sale_id INTEGER NOT NULL REFERENCES sales(id),
+    amount DECIMAL(15,2) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_customer_payment_allocations_payment_id ON customer_payment_allocations(customer_payment_id);
+CREATE INDEX IF NOT EXISTS idx_customer_payment_allocations_sale_id ON customer_payment_allocations(sale_id);
+
+-- Every movement on a customer's account; amount > 0 increases what is owed
+CREATE TABLE IF NOT EXISTS customer_ledger_entries (
+    id SERIAL PRIMARY KEY,
+    customer_id INTEGER NOT NULL REFERENCES customers(id),
+    entry_type VARCHAR(20) NOT NULL, -- charge, payment, return, reversal
+    sale_id INTEGER REFERENCES sales(id),
+    customer_payment_id INTEGER REFERENCES customer_payments(id),
+    sale_return_id INTEGER REFERENCES sale_returns(id),
+    amount DECIMAL(15,2) NOT NULL,
+    balance_after DECIMAL(15,2),
+    description TEXT,
+    created_by INTEGER REFERENCES users(id),
+    entry_date TIMESTAMP NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_customer_ledger_entries_customer_id ON customer_ledger_entries(customer_id);
+CREATE INDEX IF NOT EXISTS idx_customer_ledger_entries_sale_id ON customer_ledger_entries(sale_id);
+CREATE INDEX IF NOT EXISTS idx_customer_ledger_entries_customer_payment_id ON customer_ledger_entries(customer_payment_id);
+CREATE INDEX IF NOT EXISTS idx_customer_ledger_entries_entry_date ON customer_ledger_entries(entry_date);
+
+-- Receivables permissions
+INSERT INTO permissions (name, module, category, description, actions, created_at, updated_at)
+VALUES
+    ('customers.credit', 'Pelanggan', 'edit', 'Atur limit kredit pelanggan', '["credit"]', NOW(), NOW()),
+    ('customers.payment', 'Pelanggan', 'create', 'Terima pembayaran piutang pelanggan', '["payment"]', NOW(), NOW())
+ON CONFLICT (name) DO NOTHING;
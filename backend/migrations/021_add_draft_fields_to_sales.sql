@@ -0,0 +1,9 @@
+-- Parked carts are draft sales; they may hold stock until they expire
+ALTER TABLE sales ADD COLUMN IF NOT EXISTS stock_reserved BOOLEAN DEFAULT FALSE;
+ALTER TABLE sales ADD COLUMN IF NOT EXISTS held_until TIMESTAMP;
+
+CREATE INDEX IF NOT EXISTS idx_sales_draft_held_until ON sales(held_until) WHERE sale_status = 'draft';
+
+INSERT INTO settings (key, value, created_at, updated_at)
+VALUES ('draft_expiry_minutes', '240', NOW(), NOW())
+ON CONFLICT (key) DO NOTHING;
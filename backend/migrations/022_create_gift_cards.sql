@@ -0,0 +1,55 @@
+-- Gift cards and store credit, spent as the gift_card tender
+CREATE TABLE IF NOT EXISTS gift_cards (
+    id SERIAL PRIMARY KEY,
+    code VARCHAR(50) UNIQUE NOT NULL,
+    type VARCHAR(20) DEFAULT 'gift_card', -- gift_card, store_credit
+    initial_balance DECIMAL(15,2) DEFAULT 0,
+    balance DECIMAL(15,2) DEFAULT 0 CHECK (balance >= 0),
+    status VARCHAR(20) DEFAULT 'active', -- pending, active, disabled, void
+    expires_at TIMESTAMP,
+    issued_store_id INTEGER NOT NULL REFERENCES stores(id),
+    issued_sale_id INTEGER REFERENCES sales(id),
+    issued_sale_return_id INTEGER REFERENCES sale_returns(id),
+    customer_id INTEGER REFERENCES customers(id),
+    created_by INTEGER REFERENCES users(id),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_gift_cards_customer_id ON gift_cards(customer_id);
+CREATE INDEX IF NOT EXISTS idx_gift_cards_issued_sale_id ON gift_cards(issued_sale_id);
+
+-- Every movement on a card; amount > 0 adds to the balance
+CREATE TABLE IF NOT EXISTS gift_card_transactions (
+    id SERIAL PRIMARY KEY,
+    gift_card_id INTEGER NOT NULL REFERENCES gift_cards(id),
+    type VARCHAR(20) NOT NULL, -- issue, load, redeem, refund, void
+    amount DECIMAL(15,2) NOT NULL,
+    balance_after DECIMAL(15,2),
+    store_id INTEGER REFERENCES stores(id),
+    sale_id INTEGER REFERENCES sales(id),
+    sale_return_id INTEGER REFERENCES sale_returns(id),
+    notes TEXT,
+    created_by INTEGER REFERENCES users(id),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_gift_card_transactions_gift_card_id ON gift_card_transactions(gift_card_id);
+CREATE INDEX IF NOT EXISTS idx_gift_card_transactions_sale_id ON gift_card_transactions(sale_id);
+
+-- Gift card products and the cards sold or spent on a sale
+ALTER TABLE products ADD COLUMN IF NOT EXISTS is_gift_card BOOLEAN DEFAULT FALSE;
+ALTER TABLE sale_items ADD COLUMN IF NOT EXISTS gift_card_code VARCHAR(50);
+ALTER TABLE sale_items ADD COLUMN IF NOT EXISTS gift_card_id INTEGER REFERENCES gift_cards(id);
+ALTER TABLE sale_payments ADD COLUMN IF NOT EXISTS gift_card_id INTEGER REFERENCES gift_cards(id);
+
+-- Gift card permissions
+INSERT INTO permissions (name, module, category, description, actions, created_at, updated_at)
+VALUES
+    ('giftcards.view', 'Kartu Hadiah', 'view', 'Lihat kartu hadiah dan kredit toko', '["view"]', NOW(), NOW()),
+    ('giftcards.manage', 'Kartu Hadiah', 'edit', 'Blokir atau aktifkan kartu hadiah', '["manage"]', NOW(), NOW())
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO settings (key, value, created_at, updated_at)
+VALUES ('gift_card_expiry_months', '12', NOW(), NOW())
+ON CONFLICT (key) DO NOTHING;
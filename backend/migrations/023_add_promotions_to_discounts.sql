@@ -0,0 +1,33 @@
+-- Promotions: buy X get Y, bundles and quantity breaks, applied automatically without a code
+ALTER TABLE discounts ADD COLUMN IF NOT EXISTS is_automatic BOOLEAN DEFAULT FALSE;
+ALTER TABLE discounts ADD COLUMN IF NOT EXISTS buy_quantity DECIMAL(15,3) DEFAULT 0;
+ALTER TABLE discounts ADD COLUMN IF NOT EXISTS get_quantity DECIMAL(15,3) DEFAULT 0;
+ALTER TABLE discounts ADD COLUMN IF NOT EXISTS bundle_price DECIMAL(15,2) DEFAULT 0;
+
+-- Automatic promotions have no code, so only non-empty codes must be unique
+ALTER TABLE discounts DROP CONSTRAINT IF EXISTS discounts_code_key;
+DROP INDEX IF EXISTS idx_discounts_code;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_discounts_code ON discounts(code) WHERE code <> '';
+
+-- Components of a bundle promotion
+CREATE TABLE IF NOT EXISTS discount_items (
+    id SERIAL PRIMARY KEY,
+    discount_id INTEGER NOT NULL REFERENCES discounts(id) ON DELETE CASCADE,
+    product_id INTEGER NOT NULL REFERENCES products(id),
+    quantity DECIMAL(15,3) NOT NULL CHECK (quantity > 0)
+);
+
+CREATE INDEX IF NOT EXISTS idx_discount_items_discount_id ON discount_items(discount_id);
+
+-- Quantity breaks: from min_quantity eligible units on, each unit costs unit_price
+CREATE TABLE IF NOT EXISTS discount_tiers (
+    id SERIAL PRIMARY KEY,
+    discount_id INTEGER NOT NULL REFERENCES discounts(id) ON DELETE CASCADE,
+    min_quantity DECIMAL(15,3) NOT NULL CHECK (min_quantity > 0),
+    unit_price DECIMAL(15,2) NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_discount_tiers_discount_id ON discount_tiers(discount_id);
+
+-- Promotion share of each sale line's discount_amount
+ALTER TABLE sale_items ADD COLUMN IF NOT EXISTS promotion_amount DECIMAL(15,2) DEFAULT 0;
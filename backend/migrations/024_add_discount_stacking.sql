@@ -0,0 +1,7 @@
+-- Several discounts per sale, evaluated by priority with stacking rules
+ALTER TABLE discounts ADD COLUMN IF NOT EXISTS priority INTEGER DEFAULT 0;
+ALTER TABLE discounts ADD COLUMN IF NOT EXISTS stackable BOOLEAN DEFAULT FALSE;
+ALTER TABLE discounts ADD COLUMN IF NOT EXISTS exclusive_group VARCHAR(50);
+
+-- All discounts selected at the till; discount_id keeps the first one
+ALTER TABLE sales ADD COLUMN IF NOT EXISTS discount_ids JSONB;
@@ -0,0 +1,64 @@
+-- Member tiers, reached by total spend; members earn earn_multiplier times the base points
+CREATE TABLE IF NOT EXISTS loyalty_tiers (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(50) UNIQUE NOT NULL,
+    min_total_spent DECIMAL(15,2) DEFAULT 0,
+    earn_multiplier DECIMAL(5,2) DEFAULT 1,
+    description TEXT,
+    is_active BOOLEAN DEFAULT TRUE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT INTO loyalty_tiers (name, min_total_spent, earn_multiplier, description)
+VALUES
+    ('Silver', 5000000, 1.25, 'Belanja minimal Rp 5.000.000'),
+    ('Gold', 20000000, 1.5, 'Belanja minimal Rp 20.000.000')
+ON CONFLICT (name) DO NOTHING;
+
+ALTER TABLE customers ADD COLUMN IF NOT EXISTS loyalty_tier_id INTEGER REFERENCES loyalty_tiers(id);
+
+-- Every movement of a customer's points; points > 0 adds to the balance and opens a lot
+-- that expires, points_remaining is what later redemptions left of it
+CREATE TABLE IF NOT EXISTS loyalty_transactions (
+    id SERIAL PRIMARY KEY,
+    customer_id INTEGER NOT NULL REFERENCES customers(id),
+    type VARCHAR(20) NOT NULL, -- earned, redeemed, expired, adjusted
+    points INTEGER NOT NULL,
+    balance_after INTEGER,
+    points_remaining INTEGER DEFAULT 0,
+    expires_at TIMESTAMP,
+    sale_id INTEGER REFERENCES sales(id),
+    sale_return_id INTEGER REFERENCES sale_returns(id),
+    notes TEXT,
+    created_by INTEGER REFERENCES users(id),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_loyalty_transactions_customer_id ON loyalty_transactions(customer_id);
+CREATE INDEX IF NOT EXISTS idx_loyalty_transactions_sale_id ON loyalty_transactions(sale_id);
+CREATE INDEX IF NOT EXISTS idx_loyalty_transactions_expires_at ON loyalty_transactions(expires_at);
+
+-- Existing balances become the opening lot of each customer
+INSERT INTO loyalty_transactions (customer_id, type, points, balance_after, points_remaining, expires_at, notes, created_at)
+SELECT c.id, 'adjusted', c.loyalty_points, c.loyalty_points, c.loyalty_points, NOW() + INTERVAL '12 months', 'Opening balance', NOW()
+FROM customers c
+WHERE c.loyalty_points > 0
+  AND NOT EXISTS (SELECT 1 FROM loyalty_transactions lt WHERE lt.customer_id = c.id);
+
+-- Members move into the tier their spend reaches
+UPDATE customers c SET loyalty_tier_id = (
+    SELECT t.id FROM loyalty_tiers t
+    WHERE t.is_active AND t.min_total_spent <= c.total_spent
+    ORDER BY t.min_total_spent DESC LIMIT 1
+)
+WHERE c.is_member;
+
+-- Loyalty permission
+INSERT INTO permissions (name, module, category, description, actions, created_at, updated_at)
+VALUES ('loyalty.manage', 'Loyalitas', 'edit', 'Atur tier member dan sesuaikan poin pelanggan', '["manage"]', NOW(), NOW())
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO settings (key, value, created_at, updated_at)
+VALUES ('loyalty_points_expiry_months', '12', NOW(), NOW())
+ON CONFLICT (key) DO NOTHING;
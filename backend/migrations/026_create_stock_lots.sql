@@ -0,0 +1,45 @@
+-- Products kept by lot and expiry date, sold first-expired-first-out
+ALTER TABLE products ADD COLUMN IF NOT EXISTS track_lots BOOLEAN DEFAULT FALSE;
+
+-- Stock of one lot at one warehouse or store
+CREATE TABLE IF NOT EXISTS stock_lots (
+    id SERIAL PRIMARY KEY,
+    product_id INTEGER NOT NULL REFERENCES products(id),
+    product_variant_id INTEGER REFERENCES product_variants(id),
+    lot_number VARCHAR(100) NOT NULL,
+    expiry_date TIMESTAMP,
+    received_date TIMESTAMP,
+    location_type VARCHAR(20) NOT NULL, -- warehouse, store
+    location_id INTEGER NOT NULL,
+    warehouse_id INTEGER REFERENCES warehouses(id),
+    store_id INTEGER REFERENCES stores(id),
+    quantity DECIMAL(15,3) DEFAULT 0,
+    unit_cost DECIMAL(15,2) DEFAULT 0,
+    purchase_order_id INTEGER REFERENCES purchase_orders(id),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_stock_lots_product_id ON stock_lots(product_id);
+CREATE INDEX IF NOT EXISTS idx_stock_lots_lot_number ON stock_lots(lot_number);
+CREATE INDEX IF NOT EXISTS idx_stock_lots_expiry_date ON stock_lots(expiry_date);
+
+-- Every change of a lot's quantity; quantity > 0 adds to the lot
+CREATE TABLE IF NOT EXISTS stock_lot_movements (
+    id SERIAL PRIMARY KEY,
+    stock_lot_id INTEGER NOT NULL REFERENCES stock_lots(id),
+    quantity DECIMAL(15,3) NOT NULL,
+    reference_type VARCHAR(30) NOT NULL, -- purchase, sale, transfer, return, void, payment_release, adjustment
+    reference_id INTEGER,
+    sale_item_id INTEGER REFERENCES sale_items(id),
+    notes TEXT,
+    created_by INTEGER REFERENCES users(id),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_stock_lot_movements_stock_lot_id ON stock_lot_movements(stock_lot_id);
+CREATE INDEX IF NOT EXISTS idx_stock_lot_movements_sale_item_id ON stock_lot_movements(sale_item_id);
+
+INSERT INTO settings (key, value, created_at, updated_at)
+VALUES ('expiry_warning_days', '30', NOW(), NOW())
+ON CONFLICT (key) DO NOTHING;
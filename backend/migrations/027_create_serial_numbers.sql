@@ -0,0 +1,51 @@
+-- Products tracked unit by unit, e.g. phones by IMEI
+ALTER TABLE products ADD COLUMN IF NOT EXISTS is_serialized BOOLEAN DEFAULT FALSE;
+
+-- Serial numbers named on sale, return and transfer lines
+ALTER TABLE sale_items ADD COLUMN IF NOT EXISTS serial_numbers JSONB;
+ALTER TABLE sale_return_items ADD COLUMN IF NOT EXISTS serial_numbers JSONB;
+ALTER TABLE stock_transfer_items ADD COLUMN IF NOT EXISTS serial_numbers JSONB;
+
+-- One unit of a serialized product and where it is now
+CREATE TABLE IF NOT EXISTS serial_numbers (
+    id SERIAL PRIMARY KEY,
+    serial_number VARCHAR(100) NOT NULL,
+    product_id INTEGER NOT NULL REFERENCES products(id),
+    product_variant_id INTEGER REFERENCES product_variants(id),
+    status VARCHAR(20) DEFAULT 'in_stock', -- in_stock, in_transit, sold, returned
+    location_type VARCHAR(20), -- warehouse, store; empty in transit, sold or returned damaged
+    warehouse_id INTEGER REFERENCES warehouses(id),
+    store_id INTEGER REFERENCES stores(id),
+    unit_cost DECIMAL(15,2) DEFAULT 0,
+    purchase_order_id INTEGER REFERENCES purchase_orders(id),
+    stock_transfer_id INTEGER REFERENCES stock_transfers(id),
+    sale_id INTEGER REFERENCES sales(id),
+    sale_item_id INTEGER REFERENCES sale_items(id),
+    customer_id INTEGER REFERENCES customers(id),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_serial_numbers_serial_product ON serial_numbers(serial_number, product_id);
+CREATE INDEX IF NOT EXISTS idx_serial_numbers_status ON serial_numbers(status);
+CREATE INDEX IF NOT EXISTS idx_serial_numbers_sale_item_id ON serial_numbers(sale_item_id);
+
+-- History of a serial number: receipt, transfers, sale, void and return
+CREATE TABLE IF NOT EXISTS serial_number_events (
+    id SERIAL PRIMARY KEY,
+    serial_number_id INTEGER NOT NULL REFERENCES serial_numbers(id),
+    event VARCHAR(20) NOT NULL, -- received, transfer_out, transfer_in, sold, voided, returned
+    status VARCHAR(20),
+    location_type VARCHAR(20),
+    warehouse_id INTEGER REFERENCES warehouses(id),
+    store_id INTEGER REFERENCES stores(id),
+    reference_type VARCHAR(30), -- purchase, transfer, sale, void, payment_release, return
+    reference_id INTEGER,
+    reference_number VARCHAR(100),
+    customer_id INTEGER REFERENCES customers(id),
+    notes TEXT,
+    created_by INTEGER REFERENCES users(id),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_serial_number_events_serial_number_id ON serial_number_events(serial_number_id);
@@ -0,0 +1,48 @@
+-- Units goods are counted in
+CREATE TABLE IF NOT EXISTS unit_of_measures (
+    id SERIAL PRIMARY KEY,
+    code VARCHAR(20) NOT NULL UNIQUE,
+    name VARCHAR(100) NOT NULL,
+    description TEXT,
+    is_active BOOLEAN DEFAULT TRUE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT INTO unit_of_measures (code, name, description, created_at, updated_at) VALUES
+    ('pcs', 'Pieces', 'Satuan dasar per buah', NOW(), NOW()),
+    ('pack', 'Pack', 'Kemasan isi beberapa buah', NOW(), NOW()),
+    ('dus', 'Dus', 'Karton isi beberapa pack atau buah', NOW(), NOW()),
+    ('kg', 'Kilogram', 'Barang timbangan', NOW(), NOW()),
+    ('g', 'Gram', 'Barang timbangan', NOW(), NOW()),
+    ('l', 'Liter', 'Barang cair', NOW(), NOW()),
+    ('ml', 'Mililiter', 'Barang cair', NOW(), NOW())
+ON CONFLICT (code) DO NOTHING;
+
+-- Products keep stock in their base unit (products.unit) and may be bought or sold by the pack
+ALTER TABLE products ADD COLUMN IF NOT EXISTS purchase_unit VARCHAR(20);
+ALTER TABLE products ADD COLUMN IF NOT EXISTS sale_unit VARCHAR(20);
+
+-- Packs of a product, e.g. 1 dus = 40 pcs
+CREATE TABLE IF NOT EXISTS product_units (
+    id SERIAL PRIMARY KEY,
+    product_id INTEGER NOT NULL REFERENCES products(id),
+    unit VARCHAR(20) NOT NULL,
+    conversion_factor DECIMAL(15,4) NOT NULL, -- base units in one of this unit
+    barcode VARCHAR(100),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_product_units_product_unit ON product_units(product_id, unit);
+CREATE INDEX IF NOT EXISTS idx_product_units_barcode ON product_units(barcode);
+
+-- Purchase and transfer lines keep the unit they were entered in and its factor at the time
+ALTER TABLE purchase_order_items ADD COLUMN IF NOT EXISTS unit VARCHAR(20);
+ALTER TABLE purchase_order_items ADD COLUMN IF NOT EXISTS conversion_factor DECIMAL(15,4) DEFAULT 1;
+ALTER TABLE stock_transfer_items ADD COLUMN IF NOT EXISTS unit VARCHAR(20);
+ALTER TABLE stock_transfer_items ADD COLUMN IF NOT EXISTS conversion_factor DECIMAL(15,4) DEFAULT 1;
+
+-- Sale lines rung up by the pack; quantity stays in the base unit
+ALTER TABLE sale_items ADD COLUMN IF NOT EXISTS unit VARCHAR(20);
+ALTER TABLE sale_items ADD COLUMN IF NOT EXISTS unit_quantity DECIMAL(15,3) DEFAULT 0;
@@ -0,0 +1,26 @@
+-- In-store barcodes embedding an item code and a weight or price (scale and deli labels)
+CREATE TABLE IF NOT EXISTS barcode_schemas (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(100) NOT NULL,
+    prefix VARCHAR(10) NOT NULL,
+    length INTEGER DEFAULT 13,
+    item_code_start INTEGER NOT NULL,
+    item_code_length INTEGER NOT NULL,
+    value_start INTEGER NOT NULL,
+    value_length INTEGER NOT NULL,
+    value_type VARCHAR(20) NOT NULL, -- weight, price, quantity
+    value_decimals INTEGER DEFAULT 0,
+    has_check_digit BOOLEAN DEFAULT FALSE,
+    is_active BOOLEAN DEFAULT TRUE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- EAN-13 2P IIIII VVVVV C: weight in grams under prefix 20, price in rupiah under prefix 21
+INSERT INTO barcode_schemas (name, prefix, length, item_code_start, item_code_length, value_start, value_length, value_type, value_decimals, has_check_digit, created_at, updated_at)
+SELECT 'Timbangan (berat)', '20', 13, 2, 5, 7, 5, 'weight', 3, TRUE, NOW(), NOW()
+WHERE NOT EXISTS (SELECT 1 FROM barcode_schemas WHERE prefix = '20');
+
+INSERT INTO barcode_schemas (name, prefix, length, item_code_start, item_code_length, value_start, value_length, value_type, value_decimals, has_check_digit, created_at, updated_at)
+SELECT 'Timbangan (harga)', '21', 13, 2, 5, 7, 5, 'price', 0, TRUE, NOW(), NOW()
+WHERE NOT EXISTS (SELECT 1 FROM barcode_schemas WHERE prefix = '21');
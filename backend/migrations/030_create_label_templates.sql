@@ -0,0 +1,51 @@
+-- Layouts of label sheets and rolls, sizes in millimetres
+CREATE TABLE IF NOT EXISTS label_templates (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(100) NOT NULL UNIQUE,
+    page_width DECIMAL(8,2) NOT NULL,
+    page_height DECIMAL(8,2) NOT NULL,
+    columns INTEGER NOT NULL,
+    rows INTEGER NOT NULL,
+    label_width DECIMAL(8,2) NOT NULL,
+    label_height DECIMAL(8,2) NOT NULL,
+    margin_top DECIMAL(8,2) DEFAULT 0,
+    margin_left DECIMAL(8,2) DEFAULT 0,
+    gap_x DECIMAL(8,2) DEFAULT 0,
+    gap_y DECIMAL(8,2) DEFAULT 0,
+    barcode_format VARCHAR(20), -- code128, ean13, qr; empty picks by code
+    font_size DECIMAL(5,2) DEFAULT 8,
+    show_name BOOLEAN DEFAULT FALSE,
+    show_sku BOOLEAN DEFAULT FALSE,
+    show_price BOOLEAN DEFAULT FALSE,
+    show_unit_price BOOLEAN DEFAULT FALSE,
+    show_barcode BOOLEAN DEFAULT FALSE,
+    is_default BOOLEAN DEFAULT FALSE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT INTO label_templates (name, page_width, page_height, columns, rows, label_width, label_height, margin_top, margin_left, gap_x, gap_y,
+    font_size, show_name, show_price, show_unit_price, show_barcode, is_default, created_at, updated_at) VALUES
+    ('A4 3 x 8 (63,5 x 33,9 mm)', 210, 297, 3, 8, 63.5, 33.9, 12.9, 7.2, 2.5, 0, 8, TRUE, TRUE, TRUE, TRUE, TRUE, NOW(), NOW()),
+    ('Roll 50 x 30 mm', 50, 30, 1, 1, 50, 30, 0, 0, 0, 0, 7, TRUE, TRUE, TRUE, TRUE, FALSE, NOW(), NOW())
+ON CONFLICT (name) DO NOTHING;
+
+-- Shelf labels waiting to be printed, queued when a selling price changes or by hand
+CREATE TABLE IF NOT EXISTS label_queue_items (
+    id SERIAL PRIMARY KEY,
+    product_id INTEGER NOT NULL REFERENCES products(id),
+    product_variant_id INTEGER REFERENCES product_variants(id),
+    unit VARCHAR(20),
+    reason VARCHAR(20) NOT NULL, -- price_change, manual
+    old_price DECIMAL(15,2) DEFAULT 0,
+    new_price DECIMAL(15,2) DEFAULT 0,
+    copies INTEGER DEFAULT 1,
+    status VARCHAR(20) DEFAULT 'pending', -- pending, printed
+    printed_at TIMESTAMP,
+    created_by INTEGER REFERENCES users(id),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_label_queue_items_product_id ON label_queue_items(product_id);
+CREATE INDEX IF NOT EXISTS idx_label_queue_items_status ON label_queue_items(status);
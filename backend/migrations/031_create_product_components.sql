@@ -0,0 +1,47 @@
+-- Kits are sold from their components; is_kit is set while a product has components
+ALTER TABLE products ADD COLUMN IF NOT EXISTS is_kit BOOLEAN DEFAULT FALSE;
+
+-- Bill of materials: quantity of the component, in its base unit, in one kit
+CREATE TABLE IF NOT EXISTS product_components (
+    id SERIAL PRIMARY KEY,
+    product_id INTEGER NOT NULL REFERENCES products(id),
+    component_product_id INTEGER NOT NULL REFERENCES products(id),
+    component_variant_id INTEGER REFERENCES product_variants(id),
+    quantity DECIMAL(15,3) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_product_components_product_id ON product_components(product_id);
+CREATE INDEX IF NOT EXISTS idx_product_components_component ON product_components(component_product_id);
+
+-- Stock a kit sale line took: assembled kits (prebuilt) or components, for voids and returns
+CREATE TABLE IF NOT EXISTS sale_item_components (
+    id SERIAL PRIMARY KEY,
+    sale_id INTEGER NOT NULL REFERENCES sales(id),
+    sale_item_id INTEGER NOT NULL REFERENCES sale_items(id),
+    product_id INTEGER NOT NULL REFERENCES products(id),
+    product_variant_id INTEGER REFERENCES product_variants(id),
+    quantity DECIMAL(15,3) NOT NULL,
+    prebuilt BOOLEAN DEFAULT FALSE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_sale_item_components_sale_id ON sale_item_components(sale_id);
+CREATE INDEX IF NOT EXISTS idx_sale_item_components_sale_item_id ON sale_item_components(sale_item_id);
+
+-- Kits built from components at a store or broken back into them
+CREATE TABLE IF NOT EXISTS kit_assemblies (
+    id SERIAL PRIMARY KEY,
+    type VARCHAR(20) NOT NULL, -- assemble, disassemble
+    store_id INTEGER NOT NULL REFERENCES stores(id),
+    product_id INTEGER NOT NULL REFERENCES products(id),
+    product_variant_id INTEGER REFERENCES product_variants(id),
+    quantity DECIMAL(15,3) NOT NULL,
+    notes TEXT,
+    created_by INTEGER REFERENCES users(id),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_kit_assemblies_store_id ON kit_assemblies(store_id);
+CREATE INDEX IF NOT EXISTS idx_kit_assemblies_product_id ON kit_assemblies(product_id);
@@ -0,0 +1,52 @@
+-- Prices set for a product or variant from a date, in all stores or in one store
+CREATE TABLE IF NOT EXISTS price_changes (
+    id SERIAL PRIMARY KEY,
+    product_id INTEGER NOT NULL REFERENCES products(id),
+    product_variant_id INTEGER REFERENCES product_variants(id),
+    store_id INTEGER REFERENCES stores(id), -- NULL for all stores
+    selling_price DECIMAL(15,2), -- NULL leaves the price as it is
+    cost_price DECIMAL(15,2),
+    effective_at TIMESTAMP NOT NULL,
+    status VARCHAR(20) DEFAULT 'scheduled', -- scheduled, applied, cancelled
+    applied_at TIMESTAMP,
+    notes TEXT,
+    created_by INTEGER REFERENCES users(id),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_price_changes_product_id ON price_changes(product_id);
+CREATE INDEX IF NOT EXISTS idx_price_changes_effective_at ON price_changes(effective_at);
+CREATE INDEX IF NOT EXISTS idx_price_changes_status ON price_changes(status);
+
+-- A store's own selling price, replacing the catalog price at that store
+CREATE TABLE IF NOT EXISTS store_prices (
+    id SERIAL PRIMARY KEY,
+    store_id INTEGER NOT NULL REFERENCES stores(id),
+    product_id INTEGER NOT NULL REFERENCES products(id),
+    product_variant_id INTEGER REFERENCES product_variants(id),
+    selling_price DECIMAL(15,2) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_store_prices_store_id ON store_prices(store_id);
+CREATE INDEX IF NOT EXISTS idx_store_prices_product_id ON store_prices(product_id);
+
+-- Every change of a catalog or store price, for margin audits and historical prices
+CREATE TABLE IF NOT EXISTS price_histories (
+    id SERIAL PRIMARY KEY,
+    product_id INTEGER NOT NULL REFERENCES products(id),
+    product_variant_id INTEGER REFERENCES product_variants(id),
+    store_id INTEGER REFERENCES stores(id), -- NULL for catalog prices
+    old_selling_price DECIMAL(15,2) DEFAULT 0,
+    new_selling_price DECIMAL(15,2) DEFAULT 0,
+    old_cost_price DECIMAL(15,2) DEFAULT 0,
+    new_cost_price DECIMAL(15,2) DEFAULT 0,
+    source VARCHAR(20) NOT NULL, -- manual, import, price_change
+    price_change_id INTEGER REFERENCES price_changes(id),
+    created_by INTEGER REFERENCES users(id),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_price_histories_product_id ON price_histories(product_id, created_at);
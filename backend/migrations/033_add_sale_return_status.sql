@@ -0,0 +1,12 @@
+-- Returns are tracked apart from payment_status, where partial means a credit sale partly paid
+ALTER TABLE sales ADD COLUMN IF NOT EXISTS return_status VARCHAR(20);
+
+-- Sales partly returned before the column existed
+UPDATE sales SET return_status = 'partial', payment_status = CASE
+        WHEN balance_due <= 0 THEN 'paid'
+        WHEN balance_due < total_amount THEN 'partial'
+        ELSE 'unpaid'
+    END
+WHERE payment_status = 'partial' AND sale_status = 'completed'
+  AND EXISTS (SELECT 1 FROM sale_returns WHERE sale_returns.sale_id = sales.id);
+UPDATE sales SET return_status = 'full' WHERE sale_status = 'refunded';
@@ -0,0 +1,2 @@
+-- Return tenders refunded through the provider that collected the original payment
+ALTER TABLE sale_return_refunds ADD COLUMN IF NOT EXISTS sale_payment_id INTEGER REFERENCES sale_payments(id);
@@ -0,0 +1,2 @@
+-- Z report kept as it stood when the session closed; later voids and returns leave it alone
+ALTER TABLE register_sessions ADD COLUMN IF NOT EXISTS z_report JSONB;
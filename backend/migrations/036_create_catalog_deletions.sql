@@ -0,0 +1,10 @@
+-- Tombstones of hard-deleted catalog rows, returned by the catalog sync so terminals can drop them
+CREATE TABLE IF NOT EXISTS catalog_deletions (
+    id SERIAL PRIMARY KEY,
+    entity VARCHAR(50) NOT NULL, -- categories, products, variants, product_units, product_components, store_prices
+    entity_id INTEGER NOT NULL,
+    deleted_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_catalog_deletions_entity ON catalog_deletions(entity);
+CREATE INDEX IF NOT EXISTS idx_catalog_deletions_deleted_at ON catalog_deletions(deleted_at);
@@ -0,0 +1,13 @@
+-- Stock each line of a parked draft reserved, released exactly when the draft is
+CREATE TABLE IF NOT EXISTS sale_item_reservations (
+    id SERIAL PRIMARY KEY,
+    sale_id INTEGER NOT NULL REFERENCES sales(id),
+    sale_item_id INTEGER NOT NULL REFERENCES sale_items(id),
+    product_id INTEGER NOT NULL REFERENCES products(id),
+    product_variant_id INTEGER REFERENCES product_variants(id),
+    quantity DECIMAL(15,3) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_sale_item_reservations_sale_id ON sale_item_reservations(sale_id);
+CREATE INDEX IF NOT EXISTS idx_sale_item_reservations_sale_item_id ON sale_item_reservations(sale_item_id);
@@ -0,0 +1,2 @@
+-- Redeemed points a return gave back to the customer
+ALTER TABLE sale_returns ADD COLUMN IF NOT EXISTS points_restored INTEGER DEFAULT 0;
@@ -0,0 +1,25 @@
+package models
+
+import (
+	"time"
+)
+
+// BarcodeSchema describes an in-store barcode that embeds an item code and a weight or price,
+// e.g. the EAN-13 labels printed by a deli scale: 2P IIIII VVVVV C. Positions are 0-based
+// indexes into the scanned code
+type BarcodeSchema struct {
+	ID             uint      `json:"id" gorm:"primaryKey"`
+	Name           string    `json:"name" gorm:"not null"`
+	Prefix         string    `json:"prefix" gorm:"not null"`          // Leading digits that select the schema, e.g. 20
+	Length         int       `json:"length" gorm:"default:13"`        // Total length of the code, check digit included
+	ItemCodeStart  int       `json:"item_code_start" gorm:"not null"` // Item code is matched against product and variant barcodes
+	ItemCodeLength int       `json:"item_code_length" gorm:"not null"`
+	ValueStart     int       `json:"value_start" gorm:"not null"`
+	ValueLength    int       `json:"value_length" gorm:"not null"`
+	ValueType      string    `json:"value_type" gorm:"not null"`           // weight, price, quantity
+	ValueDecimals  int       `json:"value_decimals" gorm:"default:0"`      // e.g. 3 turns grams into kg
+	HasCheckDigit  bool      `json:"has_check_digit" gorm:"default:false"` // Last digit is an EAN check digit
+	IsActive       bool      `json:"is_active" gorm:"default:true"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
@@ -0,0 +1,55 @@
+package models
+
+import (
+	"time"
+)
+
+// CustomerLedgerEntry is one movement on a customer's account. Amount is positive
+// when the customer owes more (a credit sale) and negative when they owe less
+type CustomerLedgerEntry struct {
+	ID                uint             `json:"id" gorm:"primaryKey"`
+	CustomerID        uint             `json:"customer_id" gorm:"not null;index"`
+	Customer          *Customer        `json:"customer,omitempty" gorm:"foreignKey:CustomerID"`
+	EntryType         string           `json:"entry_type" gorm:"not null"` // charge, payment, return, reversal
+	SaleID            *uint            `json:"sale_id" gorm:"index"`
+	Sale              *Sale            `json:"sale,omitempty" gorm:"foreignKey:SaleID"`
+	CustomerPaymentID *uint            `json:"customer_payment_id" gorm:"index"`
+	CustomerPayment   *CustomerPayment `json:"customer_payment,omitempty" gorm:"foreignKey:CustomerPaymentID"`
+	SaleReturnID      *uint            `json:"sale_return_id"`
+	Amount            float64          `json:"amount" gorm:"not null"`
+	BalanceAfter      float64          `json:"balance_after"`
+	Description       string           `json:"description"`
+	CreatedBy         uint             `json:"created_by"`
+	EntryDate         time.Time        `json:"entry_date" gorm:"not null;index"`
+	CreatedAt         time.Time        `json:"created_at"`
+}
+
+// CustomerPayment is money received against a customer's account
+type CustomerPayment struct {
+	ID                uint                        `json:"id" gorm:"primaryKey"`
+	PaymentNumber     string                      `json:"payment_number" gorm:"uniqueIndex;not null"`
+	CustomerID        uint                        `json:"customer_id" gorm:"not null;index"`
+	Customer          *Customer                   `json:"customer,omitempty" gorm:"foreignKey:CustomerID"`
+	StoreID           uint                        `json:"store_id" gorm:"not null"`
+	Store             *Store                      `json:"store,omitempty" gorm:"foreignKey:StoreID"`
+	RegisterSessionID *uint                       `json:"register_session_id"`            // Drawer the money was taken into, if any
+	PaymentMethod     string                      `json:"payment_method" gorm:"not null"` // cash, card, digital_wallet, transfer
+	Amount            float64                     `json:"amount" gorm:"not null"`
+	ReferenceNumber   string                      `json:"reference_number"`
+	Notes             string                      `json:"notes"`
+	ReceivedBy        uint                        `json:"received_by" gorm:"not null"`
+	ReceivedByUser    *User                       `json:"received_by_user,omitempty" gorm:"foreignKey:ReceivedBy"`
+	PaymentDate       time.Time                   `json:"payment_date" gorm:"not null"`
+	Allocations       []CustomerPaymentAllocation `json:"allocations,omitempty" gorm:"foreignKey:CustomerPaymentID"`
+	CreatedAt         time.Time                   `json:"created_at"`
+}
+
+// CustomerPaymentAllocation is the part of a payment that settled one credit sale
+type CustomerPaymentAllocation struct {
+	ID                uint      `json:"id" gorm:"primaryKey"`
+	CustomerPaymentID uint      `json:"customer_payment_id" gorm:"not null;index"`
+	SaleID            uint      `json:"sale_id" gorm:"not null;index"`
+	Sale              *Sale     `json:"sale,omitempty" gorm:"foreignKey:SaleID"`
+	Amount            float64   `json:"amount" gorm:"not null"`
+	CreatedAt         time.Time `json:"created_at"`
+}
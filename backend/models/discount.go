@@ -9,10 +9,19 @@ import (
 type Discount struct {
 	ID               uint           `json:"id" gorm:"primaryKey"`
 	Name             string         `json:"name" gorm:"not null"`
-	Code             string         `json:"code" gorm:"uniqueIndex"`
+	Code             string         `json:"code" gorm:"uniqueIndex:idx_discounts_code,where:code <> ''"` // Empty for automatic promotions
 	Description      string         `json:"description"`
-	DiscountType     string         `json:"discount_type" gorm:"not null"` // percentage, fixed
-	DiscountValue    float64        `json:"discount_value" gorm:"not null"`
+	DiscountType     string         `json:"discount_type" gorm:"not null"`     // percentage, fixed, buy_x_get_y, bundle, quantity_break
+	DiscountValue    float64        `json:"discount_value" gorm:"not null"`    // buy_x_get_y: percent off the free units
+	IsAutomatic      bool           `json:"is_automatic" gorm:"default:false"` // Promotion applied to every eligible cart without a code
+	BuyQuantity      float64        `json:"buy_quantity" gorm:"default:0"`     // buy_x_get_y: units to pay for
+	GetQuantity      float64        `json:"get_quantity" gorm:"default:0"`     // buy_x_get_y: units discounted per BuyQuantity bought
+	BundlePrice      float64        `json:"bundle_price" gorm:"default:0"`     // bundle: price of one set of Items
+	Priority         int            `json:"priority" gorm:"default:0"`         // Higher priorities are evaluated first
+	Stackable        bool           `json:"stackable" gorm:"default:false"`    // May be combined with other discounts on a sale
+	ExclusiveGroup   string         `json:"exclusive_group"`                   // At most one discount of a group applies to a sale
+	Items            []DiscountItem `json:"items,omitempty" gorm:"foreignKey:DiscountID"`
+	Tiers            []DiscountTier `json:"tiers,omitempty" gorm:"foreignKey:DiscountID"`
 	MinPurchase      float64        `json:"min_purchase" gorm:"default:0"`    // Minimum purchase amount
 	MaxDiscount      float64        `json:"max_discount" gorm:"default:0"`    // Maximum discount amount (0 = unlimited)
 	ApplicableTo     string         `json:"applicable_to" gorm:"default:all"` // all, member, specific_customer
@@ -36,6 +45,23 @@ type Discount struct {
 	DeletedAt        gorm.DeletedAt `json:"deleted_at" gorm:"index"`
 }
 
+// DiscountItem is one component of a bundle promotion
+type DiscountItem struct {
+	ID         uint     `json:"id" gorm:"primaryKey"`
+	DiscountID uint     `json:"discount_id" gorm:"not null;index"`
+	ProductID  uint     `json:"product_id" gorm:"not null"`
+	Product    *Product `json:"product,omitempty" gorm:"foreignKey:ProductID"`
+	Quantity   float64  `json:"quantity" gorm:"not null"`
+}
+
+// DiscountTier is a quantity break: from MinQuantity eligible units on, each unit costs UnitPrice
+type DiscountTier struct {
+	ID          uint    `json:"id" gorm:"primaryKey"`
+	DiscountID  uint    `json:"discount_id" gorm:"not null;index"`
+	MinQuantity float64 `json:"min_quantity" gorm:"not null"`
+	UnitPrice   float64 `json:"unit_price" gorm:"not null"`
+}
+
 // DiscountUsage tracks discount usage per customer
 type DiscountUsage struct {
 	ID         uint      `json:"id" gorm:"primaryKey"`
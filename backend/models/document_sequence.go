@@ -0,0 +1,32 @@
+package models
+
+import (
+	"time"
+)
+
+// DocumentSequence configures how numbers of a document type are formatted.
+// A row with an empty LocationType is the default for every store/warehouse
+type DocumentSequence struct {
+	ID           uint      `json:"id" gorm:"primaryKey"`
+	DocumentType string    `json:"document_type" gorm:"not null;uniqueIndex:idx_document_sequence_scope"` // sale, sale_return, purchase_order, stock_transfer, journal_entry, customer_payment
+	LocationType string    `json:"location_type" gorm:"uniqueIndex:idx_document_sequence_scope"`          // store, warehouse, empty for the default
+	LocationID   uint      `json:"location_id" gorm:"default:0;uniqueIndex:idx_document_sequence_scope"`
+	Prefix       string    `json:"prefix"`
+	Format       string    `json:"format" gorm:"not null"`            // e.g. {PREFIX}-{STORE}-{YYYY}{MM}{DD}-{SEQ}
+	ResetPeriod  string    `json:"reset_period" gorm:"default:daily"` // daily, monthly, yearly, never
+	Padding      int       `json:"padding" gorm:"default:4"`          // Zero padding of {SEQ}
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// DocumentCounter is the last number issued per document type, location and period.
+// It is incremented inside the document's transaction so rolled back documents leave no gap
+type DocumentCounter struct {
+	ID           uint      `json:"id" gorm:"primaryKey"`
+	DocumentType string    `json:"document_type" gorm:"not null;uniqueIndex:idx_document_counter_scope"`
+	LocationType string    `json:"location_type" gorm:"uniqueIndex:idx_document_counter_scope"`
+	LocationID   uint      `json:"location_id" gorm:"default:0;uniqueIndex:idx_document_counter_scope"`
+	PeriodKey    string    `json:"period_key" gorm:"not null;uniqueIndex:idx_document_counter_scope"` // 20240131, 202401, 2024 or all
+	LastValue    int64     `json:"last_value" gorm:"default:0"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
@@ -0,0 +1,41 @@
+package models
+
+import (
+	"time"
+)
+
+// GiftCard is a prepaid balance: a gift card sold at the till or store credit issued from a refund
+type GiftCard struct {
+	ID                 uint                  `json:"id" gorm:"primaryKey"`
+	Code               string                `json:"code" gorm:"uniqueIndex;not null"`
+	Type               string                `json:"type" gorm:"default:gift_card"` // gift_card, store_credit
+	InitialBalance     float64               `json:"initial_balance" gorm:"default:0"`
+	Balance            float64               `json:"balance" gorm:"default:0"`
+	Status             string                `json:"status" gorm:"default:active"` // pending, active, disabled, void
+	ExpiresAt          *time.Time            `json:"expires_at"`
+	IssuedStoreID      uint                  `json:"issued_store_id" gorm:"not null"`
+	IssuedStore        *Store                `json:"issued_store,omitempty" gorm:"foreignKey:IssuedStoreID"`
+	IssuedSaleID       *uint                 `json:"issued_sale_id"`
+	IssuedSaleReturnID *uint                 `json:"issued_sale_return_id"`
+	CustomerID         *uint                 `json:"customer_id"`
+	Customer           *Customer             `json:"customer,omitempty" gorm:"foreignKey:CustomerID"`
+	CreatedBy          uint                  `json:"created_by"`
+	Transactions       []GiftCardTransaction `json:"transactions,omitempty" gorm:"foreignKey:GiftCardID"`
+	CreatedAt          time.Time             `json:"created_at"`
+	UpdatedAt          time.Time             `json:"updated_at"`
+}
+
+// GiftCardTransaction is one movement on a gift card balance
+type GiftCardTransaction struct {
+	ID           uint      `json:"id" gorm:"primaryKey"`
+	GiftCardID   uint      `json:"gift_card_id" gorm:"not null;index"`
+	Type         string    `json:"type" gorm:"not null"`   // issue, load, redeem, refund, void
+	Amount       float64   `json:"amount" gorm:"not null"` // Positive adds to the balance
+	BalanceAfter float64   `json:"balance_after"`
+	StoreID      *uint     `json:"store_id"`
+	SaleID       *uint     `json:"sale_id" gorm:"index"`
+	SaleReturnID *uint     `json:"sale_return_id"`
+	Notes        string    `json:"notes"`
+	CreatedBy    uint      `json:"created_by"`
+	CreatedAt    time.Time `json:"created_at"`
+}
@@ -1,6 +1,7 @@
 package models
 
 import (
+	"encoding/json"
 	"time"
 )
 
@@ -61,7 +62,7 @@ type InventoryTransaction struct {
 	TransactionType  string          `json:"transaction_type" gorm:"not null"` // in, out, transfer, adjustment
 	Quantity         float64         `json:"quantity" gorm:"not null"`         // Positive for in, negative for out
 	UnitCost         float64         `json:"unit_cost" gorm:"default:0"`
-	ReferenceType    string          `json:"reference_type" gorm:"not null"` // purchase, sale, transfer, adjustment, return
+	ReferenceType    string          `json:"reference_type" gorm:"not null"` // purchase, sale, transfer, adjustment, return, import, assembly, disassembly
 	ReferenceID      *uint           `json:"reference_id"`
 	Notes            string          `json:"notes"`
 	CreatedBy        uint            `json:"created_by" gorm:"not null"`
@@ -100,9 +101,12 @@ type StockTransferItem struct {
 	Product           *Product        `json:"product,omitempty" gorm:"foreignKey:ProductID"`
 	ProductVariantID  *uint           `json:"product_variant_id"`
 	ProductVariant    *ProductVariant `json:"product_variant,omitempty" gorm:"foreignKey:ProductVariantID"`
+	Unit              string          `json:"unit"`                               // Unit quantities are in, empty for the base unit
+	ConversionFactor  float64         `json:"conversion_factor" gorm:"default:1"` // Base units in one Unit
 	QuantityRequested float64         `json:"quantity_requested" gorm:"not null"`
 	QuantityShipped   float64         `json:"quantity_shipped" gorm:"default:0"`
 	QuantityReceived  float64         `json:"quantity_received" gorm:"default:0"`
+	SerialNumbers     json.RawMessage `json:"serial_numbers,omitempty" gorm:"type:jsonb"` // Units sent on a serialized line
 	CreatedAt         time.Time       `json:"created_at"`
 }
 
@@ -135,6 +139,8 @@ type PurchaseOrderItem struct {
 	Product          *Product        `json:"product,omitempty" gorm:"foreignKey:ProductID"`
 	ProductVariantID *uint           `json:"product_variant_id"`
 	ProductVariant   *ProductVariant `json:"product_variant,omitempty" gorm:"foreignKey:ProductVariantID"`
+	Unit             string          `json:"unit"`                               // Unit quantities and cost are in, empty for the base unit
+	ConversionFactor float64         `json:"conversion_factor" gorm:"default:1"` // Base units in one Unit
 	QuantityOrdered  float64         `json:"quantity_ordered" gorm:"not null"`
 	QuantityReceived float64         `json:"quantity_received" gorm:"default:0"`
 	UnitCost         float64         `json:"unit_cost" gorm:"default:0"`
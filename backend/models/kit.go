@@ -0,0 +1,51 @@
+package models
+
+import (
+	"time"
+)
+
+// ProductComponent is a line of a kit's bill of materials: every kit is made of Quantity of
+// the component product or variant, in the component's base unit
+type ProductComponent struct {
+	ID                 uint            `json:"id" gorm:"primaryKey"`
+	ProductID          uint            `json:"product_id" gorm:"not null;index"` // The kit
+	ComponentProductID uint            `json:"component_product_id" gorm:"not null"`
+	ComponentProduct   *Product        `json:"component_product,omitempty" gorm:"foreignKey:ComponentProductID"`
+	ComponentVariantID *uint           `json:"component_variant_id"`
+	ComponentVariant   *ProductVariant `json:"component_variant,omitempty" gorm:"foreignKey:ComponentVariantID"`
+	Quantity           float64         `json:"quantity" gorm:"not null"`
+	CreatedAt          time.Time       `json:"created_at"`
+	UpdatedAt          time.Time       `json:"updated_at"`
+}
+
+// SaleItemComponent is stock a kit sale line took, so voids and returns put back the same goods.
+// Assembled kits taken from the kit's own stock are recorded against the kit with Prebuilt set
+type SaleItemComponent struct {
+	ID               uint            `json:"id" gorm:"primaryKey"`
+	SaleID           uint            `json:"sale_id" gorm:"not null;index"`
+	SaleItemID       uint            `json:"sale_item_id" gorm:"not null;index"`
+	ProductID        uint            `json:"product_id" gorm:"not null"`
+	Product          *Product        `json:"product,omitempty" gorm:"foreignKey:ProductID"`
+	ProductVariantID *uint           `json:"product_variant_id"`
+	ProductVariant   *ProductVariant `json:"product_variant,omitempty" gorm:"foreignKey:ProductVariantID"`
+	Quantity         float64         `json:"quantity" gorm:"not null"` // Taken for the whole line
+	Prebuilt         bool            `json:"prebuilt" gorm:"default:false"`
+	CreatedAt        time.Time       `json:"created_at"`
+}
+
+// KitAssembly is a batch of kits built from their components at a store, or broken back into them
+type KitAssembly struct {
+	ID               uint            `json:"id" gorm:"primaryKey"`
+	Type             string          `json:"type" gorm:"not null"` // assemble, disassemble
+	StoreID          uint            `json:"store_id" gorm:"not null;index"`
+	Store            *Store          `json:"store,omitempty" gorm:"foreignKey:StoreID"`
+	ProductID        uint            `json:"product_id" gorm:"not null;index"`
+	Product          *Product        `json:"product,omitempty" gorm:"foreignKey:ProductID"`
+	ProductVariantID *uint           `json:"product_variant_id"`
+	ProductVariant   *ProductVariant `json:"product_variant,omitempty" gorm:"foreignKey:ProductVariantID"`
+	Quantity         float64         `json:"quantity" gorm:"not null"`
+	Notes            string          `json:"notes"`
+	CreatedBy        uint            `json:"created_by"`
+	CreatedByUser    *User           `json:"created_by_user,omitempty" gorm:"foreignKey:CreatedBy"`
+	CreatedAt        time.Time       `json:"created_at"`
+}
@@ -0,0 +1,52 @@
+package models
+
+import (
+	"time"
+)
+
+// LabelTemplate is the layout of a label sheet or roll. Sizes are in millimetres; labels are
+// placed in a grid of Columns x Rows from the top left corner of the page
+type LabelTemplate struct {
+	ID            uint      `json:"id" gorm:"primaryKey"`
+	Name          string    `json:"name" gorm:"uniqueIndex;not null"`
+	PageWidth     float64   `json:"page_width" gorm:"not null"`
+	PageHeight    float64   `json:"page_height" gorm:"not null"`
+	Columns       int       `json:"columns" gorm:"not null"`
+	Rows          int       `json:"rows" gorm:"not null"`
+	LabelWidth    float64   `json:"label_width" gorm:"not null"`
+	LabelHeight   float64   `json:"label_height" gorm:"not null"`
+	MarginTop     float64   `json:"margin_top" gorm:"default:0"`
+	MarginLeft    float64   `json:"margin_left" gorm:"default:0"`
+	GapX          float64   `json:"gap_x" gorm:"default:0"` // Space between columns
+	GapY          float64   `json:"gap_y" gorm:"default:0"` // Space between rows
+	BarcodeFormat string    `json:"barcode_format"`         // code128, ean13 or qr; empty picks EAN-13 for EAN codes and Code 128 otherwise
+	FontSize      float64   `json:"font_size" gorm:"default:8"`
+	ShowName      bool      `json:"show_name"`
+	ShowSKU       bool      `json:"show_sku"`
+	ShowPrice     bool      `json:"show_price"`
+	ShowUnitPrice bool      `json:"show_unit_price"` // Price per base unit, e.g. per pcs on a dus label or per 100 g
+	ShowBarcode   bool      `json:"show_barcode"`
+	IsDefault     bool      `json:"is_default" gorm:"default:false"` // Used when a print request names no template
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// LabelQueueItem is a shelf label waiting to be printed, e.g. because the price changed
+type LabelQueueItem struct {
+	ID               uint            `json:"id" gorm:"primaryKey"`
+	ProductID        uint            `json:"product_id" gorm:"not null;index"`
+	Product          *Product        `json:"product,omitempty" gorm:"foreignKey:ProductID"`
+	ProductVariantID *uint           `json:"product_variant_id"`
+	ProductVariant   *ProductVariant `json:"product_variant,omitempty" gorm:"foreignKey:ProductVariantID"`
+	Unit             string          `json:"unit"`                                // Pack the label is for, empty for the base unit
+	Reason           string          `json:"reason" gorm:"not null"`              // price_change, manual
+	OldPrice         float64         `json:"old_price"`                           // Label price before the change
+	NewPrice         float64         `json:"new_price"`                           // Label price to print
+	Copies           int             `json:"copies" gorm:"default:1"`             // Labels to print
+	Status           string          `json:"status" gorm:"default:pending;index"` // pending, printed
+	PrintedAt        *time.Time      `json:"printed_at"`
+	CreatedBy        uint            `json:"created_by"`
+	CreatedByUser    *User           `json:"created_by_user,omitempty" gorm:"foreignKey:CreatedBy"`
+	CreatedAt        time.Time       `json:"created_at"`
+	UpdatedAt        time.Time       `json:"updated_at"`
+}
@@ -0,0 +1,39 @@
+package models
+
+import (
+	"time"
+)
+
+// LoyaltyTier is a membership level reached by total spend. Members earn
+// EarnMultiplier times the base points on every sale
+type LoyaltyTier struct {
+	ID             uint      `json:"id" gorm:"primaryKey"`
+	Name           string    `json:"name" gorm:"uniqueIndex;not null"` // Silver, Gold
+	MinTotalSpent  float64   `json:"min_total_spent" gorm:"default:0"`
+	EarnMultiplier float64   `json:"earn_multiplier" gorm:"default:1"`
+	Description    string    `json:"description"`
+	IsActive       bool      `json:"is_active" gorm:"default:true"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// LoyaltyTransaction is one movement of a customer's points. Points is positive when
+// the balance grows. Positive movements are lots that expire: PointsRemaining is what
+// is left of the lot after later redemptions took their points oldest lot first
+type LoyaltyTransaction struct {
+	ID              uint        `json:"id" gorm:"primaryKey"`
+	CustomerID      uint        `json:"customer_id" gorm:"not null;index"`
+	Customer        *Customer   `json:"customer,omitempty" gorm:"foreignKey:CustomerID"`
+	Type            string      `json:"type" gorm:"not null"` // earned, redeemed, expired, adjusted
+	Points          int         `json:"points" gorm:"not null"`
+	BalanceAfter    int         `json:"balance_after"`
+	PointsRemaining int         `json:"points_remaining" gorm:"default:0"`
+	ExpiresAt       *time.Time  `json:"expires_at" gorm:"index"`
+	SaleID          *uint       `json:"sale_id" gorm:"index"`
+	Sale            *Sale       `json:"sale,omitempty" gorm:"foreignKey:SaleID"`
+	SaleReturnID    *uint       `json:"sale_return_id"`
+	SaleReturn      *SaleReturn `json:"sale_return,omitempty" gorm:"foreignKey:SaleReturnID"`
+	Notes           string      `json:"notes"`
+	CreatedBy       *uint       `json:"created_by"` // nil for the expiry job
+	CreatedAt       time.Time   `json:"created_at"`
+}
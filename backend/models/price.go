@@ -0,0 +1,58 @@
+package models
+
+import (
+	"time"
+)
+
+// PriceChange sets the prices of a product or variant from EffectiveAt, in all stores or in one
+// store. Prices left nil are not changed; store changes only set the selling price
+type PriceChange struct {
+	ID               uint            `json:"id" gorm:"primaryKey"`
+	ProductID        uint            `json:"product_id" gorm:"not null;index"`
+	Product          *Product        `json:"product,omitempty" gorm:"foreignKey:ProductID"`
+	ProductVariantID *uint           `json:"product_variant_id"`
+	ProductVariant   *ProductVariant `json:"product_variant,omitempty" gorm:"foreignKey:ProductVariantID"`
+	StoreID          *uint           `json:"store_id"` // Nil for all stores
+	Store            *Store          `json:"store,omitempty" gorm:"foreignKey:StoreID"`
+	SellingPrice     *float64        `json:"selling_price"`
+	CostPrice        *float64        `json:"cost_price"`
+	EffectiveAt      time.Time       `json:"effective_at" gorm:"not null;index"`
+	Status           string          `json:"status" gorm:"default:scheduled;index"` // scheduled, applied, cancelled
+	AppliedAt        *time.Time      `json:"applied_at"`
+	Notes            string          `json:"notes"`
+	CreatedBy        uint            `json:"created_by"`
+	CreatedByUser    *User           `json:"created_by_user,omitempty" gorm:"foreignKey:CreatedBy"`
+	CreatedAt        time.Time       `json:"created_at"`
+	UpdatedAt        time.Time       `json:"updated_at"`
+}
+
+// StorePrice is a store's own selling price for a product or variant, set by a store price change.
+// It replaces the catalog price at that store
+type StorePrice struct {
+	ID               uint      `json:"id" gorm:"primaryKey"`
+	StoreID          uint      `json:"store_id" gorm:"not null;index"`
+	ProductID        uint      `json:"product_id" gorm:"not null;index"`
+	ProductVariantID *uint     `json:"product_variant_id"`
+	SellingPrice     float64   `json:"selling_price" gorm:"not null"`
+	CreatedAt        time.Time `json:"created_at"`
+	UpdatedAt        time.Time `json:"updated_at"`
+}
+
+// PriceHistory is one change of a product's, variant's or store's prices; CreatedAt is when it took effect
+type PriceHistory struct {
+	ID               uint            `json:"id" gorm:"primaryKey"`
+	ProductID        uint            `json:"product_id" gorm:"not null;index"`
+	ProductVariantID *uint           `json:"product_variant_id"`
+	ProductVariant   *ProductVariant `json:"product_variant,omitempty" gorm:"foreignKey:ProductVariantID"`
+	StoreID          *uint           `json:"store_id"` // Nil for catalog prices
+	Store            *Store          `json:"store,omitempty" gorm:"foreignKey:StoreID"`
+	OldSellingPrice  float64         `json:"old_selling_price"`
+	NewSellingPrice  float64         `json:"new_selling_price"`
+	OldCostPrice     float64         `json:"old_cost_price"`
+	NewCostPrice     float64         `json:"new_cost_price"`
+	Source           string          `json:"source" gorm:"not null"` // manual, import, price_change
+	PriceChangeID    *uint           `json:"price_change_id"`
+	CreatedBy        uint            `json:"created_by"`
+	CreatedByUser    *User           `json:"created_by_user,omitempty" gorm:"foreignKey:CreatedBy"`
+	CreatedAt        time.Time       `json:"created_at"`
+}
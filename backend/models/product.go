@@ -14,31 +14,43 @@ type Category struct {
 	Parent      *Category  `json:"parent,omitempty" gorm:"foreignKey:ParentID"`
 	Children    []Category `json:"children,omitempty" gorm:"foreignKey:ParentID"`
 	ImageURL    string     `json:"image_url"`
+	TaxClassID  *uint      `json:"tax_class_id"`
+	TaxClass    *TaxClass  `json:"tax_class,omitempty" gorm:"foreignKey:TaxClassID"`
 	Status      string     `json:"status" gorm:"default:active"` // active, inactive
 	CreatedAt   time.Time  `json:"created_at"`
 	UpdatedAt   time.Time  `json:"updated_at"`
 }
 
 type Product struct {
-	ID           uint             `json:"id" gorm:"primaryKey"`
-	Name         string           `json:"name" gorm:"not null"`
-	SKU          string           `json:"sku" gorm:"uniqueIndex;not null"`
-	Barcode      string           `json:"barcode" gorm:"uniqueIndex"`
-	CategoryID   *uint            `json:"category_id"`
-	Category     *Category        `json:"category,omitempty" gorm:"foreignKey:CategoryID"`
-	Description  string           `json:"description"`
-	Unit         string           `json:"unit" gorm:"default:pcs"`
-	CostPrice    float64          `json:"cost_price" gorm:"default:0"`
-	SellingPrice float64          `json:"selling_price" gorm:"default:0"`
-	MinStock     int              `json:"min_stock" gorm:"default:0"`
-	MaxStock     *int             `json:"max_stock"`
-	IsTrackable  bool             `json:"is_trackable" gorm:"default:true"`
-	IsActive     bool             `json:"is_active" gorm:"default:true"`
-	Images       json.RawMessage  `json:"images,omitempty"`
-	Attributes   json.RawMessage  `json:"attributes,omitempty"`
-	Variants     []ProductVariant `json:"variants,omitempty" gorm:"foreignKey:ProductID"`
-	CreatedAt    time.Time        `json:"created_at"`
-	UpdatedAt    time.Time        `json:"updated_at"`
+	ID           uint               `json:"id" gorm:"primaryKey"`
+	Name         string             `json:"name" gorm:"not null"`
+	SKU          string             `json:"sku" gorm:"uniqueIndex;not null"`
+	Barcode      string             `json:"barcode" gorm:"uniqueIndex"`
+	CategoryID   *uint              `json:"category_id"`
+	Category     *Category          `json:"category,omitempty" gorm:"foreignKey:CategoryID"`
+	TaxClassID   *uint              `json:"tax_class_id"` // Overrides the category tax class
+	TaxClass     *TaxClass          `json:"tax_class,omitempty" gorm:"foreignKey:TaxClassID"`
+	Description  string             `json:"description"`
+	Unit         string             `json:"unit" gorm:"default:pcs"` // Base unit stock is kept in
+	PurchaseUnit string             `json:"purchase_unit"`           // Unit purchase orders are offered in, empty for the base unit
+	SaleUnit     string             `json:"sale_unit"`               // Unit the POS offers, empty for the base unit
+	Units        []ProductUnit      `json:"units,omitempty" gorm:"foreignKey:ProductID"`
+	CostPrice    float64            `json:"cost_price" gorm:"default:0"`
+	SellingPrice float64            `json:"selling_price" gorm:"default:0"`
+	MinStock     int                `json:"min_stock" gorm:"default:0"`
+	MaxStock     *int               `json:"max_stock"`
+	IsTrackable  bool               `json:"is_trackable" gorm:"default:true"`
+	IsGiftCard   bool               `json:"is_gift_card" gorm:"default:false"`  // Selling it issues a gift card for the line amount
+	TrackLots    bool               `json:"track_lots" gorm:"default:false"`    // Stock is received by lot and expiry date and sold first-expired-first-out
+	IsSerialized bool               `json:"is_serialized" gorm:"default:false"` // Every unit has a serial number that is named when it is received, moved or sold
+	IsKit        bool               `json:"is_kit" gorm:"default:false"`        // Sold from its components, see Components
+	IsActive     bool               `json:"is_active" gorm:"default:true"`
+	Images       json.RawMessage    `json:"images,omitempty"`
+	Attributes   json.RawMessage    `json:"attributes,omitempty"`
+	Variants     []ProductVariant   `json:"variants,omitempty" gorm:"foreignKey:ProductID"`
+	Components   []ProductComponent `json:"components,omitempty" gorm:"foreignKey:ProductID"`
+	CreatedAt    time.Time          `json:"created_at"`
+	UpdatedAt    time.Time          `json:"updated_at"`
 }
 
 type ProductVariant struct {
@@ -55,3 +67,11 @@ type ProductVariant struct {
 	CreatedAt    time.Time       `json:"created_at"`
 	UpdatedAt    time.Time       `json:"updated_at"`
 }
+
+// CatalogDeletion is the tombstone of a hard-deleted catalog row, so offline terminals can drop it from their cache
+type CatalogDeletion struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	Entity    string    `json:"entity" gorm:"not null;index"` // categories, products, variants, product_units, product_components, store_prices
+	EntityID  uint      `json:"entity_id" gorm:"not null"`
+	DeletedAt time.Time `json:"deleted_at" gorm:"not null;index"`
+}
@@ -0,0 +1,43 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// RegisterSession is a cashier shift on a cash drawer, from opening float to closing count
+type RegisterSession struct {
+	ID                   uint            `json:"id" gorm:"primaryKey"`
+	StoreID              uint            `json:"store_id" gorm:"not null;index"`
+	Store                *Store          `json:"store,omitempty" gorm:"foreignKey:StoreID"`
+	CashierID            uint            `json:"cashier_id" gorm:"not null;index"`
+	Cashier              *User           `json:"cashier,omitempty" gorm:"foreignKey:CashierID"`
+	Status               string          `json:"status" gorm:"default:open"` // open, closed
+	OpeningFloat         float64         `json:"opening_float" gorm:"default:0"`
+	ExpectedCash         float64         `json:"expected_cash" gorm:"default:0"`
+	CountedCash          float64         `json:"counted_cash" gorm:"default:0"`
+	CashDifference       float64         `json:"cash_difference" gorm:"default:0"` // counted - expected
+	CountedDenominations json.RawMessage `json:"counted_denominations,omitempty"`  // [{"value":100000,"count":3}]
+	CountedByMethod      json.RawMessage `json:"counted_by_method,omitempty"`      // {"card":150000}
+	ZReport              json.RawMessage `json:"-" gorm:"type:jsonb"`              // Z report as it stood at close
+	OpenedAt             time.Time       `json:"opened_at"`
+	ClosedAt             *time.Time      `json:"closed_at"`
+	ClosedBy             *uint           `json:"closed_by"`
+	ClosedByUser         *User           `json:"closed_by_user,omitempty" gorm:"foreignKey:ClosedBy"`
+	Notes                string          `json:"notes"`
+	Movements            []CashMovement  `json:"movements,omitempty" gorm:"foreignKey:RegisterSessionID"`
+	CreatedAt            time.Time       `json:"created_at"`
+	UpdatedAt            time.Time       `json:"updated_at"`
+}
+
+// CashMovement is a pay-in or pay-out of cash that is not a sale
+type CashMovement struct {
+	ID                uint      `json:"id" gorm:"primaryKey"`
+	RegisterSessionID uint      `json:"register_session_id" gorm:"not null;index"`
+	Type              string    `json:"type" gorm:"not null"` // pay_in, pay_out
+	Amount            float64   `json:"amount" gorm:"not null"`
+	Reason            string    `json:"reason"`
+	CreatedBy         uint      `json:"created_by" gorm:"not null"`
+	CreatedByUser     *User     `json:"created_by_user,omitempty" gorm:"foreignKey:CreatedBy"`
+	CreatedAt         time.Time `json:"created_at"`
+}
@@ -1,52 +1,74 @@
 package models
 
 import (
+	"encoding/json"
 	"time"
 )
 
 type Customer struct {
-	ID            uint       `json:"id" gorm:"primaryKey"`
-	Name          string     `json:"name" gorm:"not null"`
-	Email         string     `json:"email" gorm:"uniqueIndex"`
-	Phone         string     `json:"phone"`
-	Address       string     `json:"address"`
-	DateOfBirth   *time.Time `json:"date_of_birth"`
-	Gender        string     `json:"gender"` // male, female, other
-	IsMember      bool       `json:"is_member" gorm:"default:false"`
-	LoyaltyPoints int        `json:"loyalty_points" gorm:"default:0"`
-	TotalSpent    float64    `json:"total_spent" gorm:"default:0"`
-	LastVisit     *time.Time `json:"last_visit"`
-	Status        string     `json:"status" gorm:"default:active"` // active, inactive
-	CreatedAt     time.Time  `json:"created_at"`
-	UpdatedAt     time.Time  `json:"updated_at"`
+	ID            uint         `json:"id" gorm:"primaryKey"`
+	Name          string       `json:"name" gorm:"not null"`
+	Email         string       `json:"email" gorm:"uniqueIndex"`
+	Phone         string       `json:"phone"`
+	Address       string       `json:"address"`
+	DateOfBirth   *time.Time   `json:"date_of_birth"`
+	Gender        string       `json:"gender"` // male, female, other
+	IsMember      bool         `json:"is_member" gorm:"default:false"`
+	LoyaltyPoints int          `json:"loyalty_points" gorm:"default:0"`
+	LoyaltyTierID *uint        `json:"loyalty_tier_id"` // Highest tier reached by TotalSpent, members only
+	LoyaltyTier   *LoyaltyTier `json:"loyalty_tier,omitempty" gorm:"foreignKey:LoyaltyTierID"`
+	TotalSpent    float64      `json:"total_spent" gorm:"default:0"`
+	CreditLimit   float64      `json:"credit_limit" gorm:"default:0"` // Maximum outstanding balance, 0 disables credit sales
+	Balance       float64      `json:"balance" gorm:"default:0"`      // Amount currently owed on account
+	LastVisit     *time.Time   `json:"last_visit"`
+	Status        string       `json:"status" gorm:"default:active"` // active, inactive
+	CreatedAt     time.Time    `json:"created_at"`
+	UpdatedAt     time.Time    `json:"updated_at"`
 }
 
 type Sale struct {
-	ID             uint          `json:"id" gorm:"primaryKey"`
-	SaleNumber     string        `json:"sale_number" gorm:"uniqueIndex;not null"`
-	StoreID        uint          `json:"store_id" gorm:"not null"`
-	Store          *Store        `json:"store,omitempty" gorm:"foreignKey:StoreID"`
-	CustomerID     *uint         `json:"customer_id"`
-	Customer       *Customer     `json:"customer,omitempty" gorm:"foreignKey:CustomerID"`
-	CashierID      uint          `json:"cashier_id" gorm:"not null"`
-	Cashier        *User         `json:"cashier,omitempty" gorm:"foreignKey:CashierID"`
-	DiscountID     *uint         `json:"discount_id"`
-	Discount       *Discount     `json:"discount,omitempty" gorm:"foreignKey:DiscountID"`
-	Subtotal       float64       `json:"subtotal" gorm:"default:0"`
-	TaxAmount      float64       `json:"tax_amount" gorm:"default:0"`
-	DiscountAmount float64       `json:"discount_amount" gorm:"default:0"`
-	TotalAmount    float64       `json:"total_amount" gorm:"default:0"`
-	PaidAmount     float64       `json:"paid_amount" gorm:"default:0"`
-	ChangeAmount   float64       `json:"change_amount" gorm:"default:0"`
-	PaymentStatus  string        `json:"payment_status" gorm:"default:pending"` // pending, paid, partial, refunded
-	SaleStatus     string        `json:"sale_status" gorm:"default:draft"`      // draft, completed, cancelled, refunded
-	PaymentMethod  string        `json:"payment_method" gorm:"default:cash"`    // cash, card, digital_wallet, credit, multiple
-	Notes          string        `json:"notes"`
-	Items          []SaleItem    `json:"items,omitempty" gorm:"foreignKey:SaleID"`
-	Payments       []SalePayment `json:"payments,omitempty" gorm:"foreignKey:SaleID"`
-	SaleDate       time.Time     `json:"sale_date" gorm:"default:CURRENT_TIMESTAMP"`
-	CreatedAt      time.Time     `json:"created_at"`
-	UpdatedAt      time.Time     `json:"updated_at"`
+	ID                uint             `json:"id" gorm:"primaryKey"`
+	SaleNumber        string           `json:"sale_number" gorm:"uniqueIndex;not null"`
+	ClientUUID        *string          `json:"client_uuid" gorm:"uniqueIndex"` // Idempotency key sent by the POS, retries return the same sale
+	StoreID           uint             `json:"store_id" gorm:"not null"`
+	Store             *Store           `json:"store,omitempty" gorm:"foreignKey:StoreID"`
+	CustomerID        *uint            `json:"customer_id"`
+	Customer          *Customer        `json:"customer,omitempty" gorm:"foreignKey:CustomerID"`
+	CashierID         uint             `json:"cashier_id" gorm:"not null"`
+	Cashier           *User            `json:"cashier,omitempty" gorm:"foreignKey:CashierID"`
+	RegisterSessionID *uint            `json:"register_session_id"`
+	RegisterSession   *RegisterSession `json:"register_session,omitempty" gorm:"foreignKey:RegisterSessionID"`
+	DiscountID        *uint            `json:"discount_id"` // First of DiscountIDs
+	Discount          *Discount        `json:"discount,omitempty" gorm:"foreignKey:DiscountID"`
+	DiscountIDs       json.RawMessage  `json:"discount_ids,omitempty" gorm:"type:jsonb"`           // Discounts selected at the till, e.g. [3,7]
+	DiscountUsages    []DiscountUsage  `json:"discount_usages,omitempty" gorm:"foreignKey:SaleID"` // Every discount applied, including automatic promotions
+	Subtotal          float64          `json:"subtotal" gorm:"default:0"`
+	TaxAmount         float64          `json:"tax_amount" gorm:"default:0"`
+	PricesIncludeTax  bool             `json:"prices_include_tax" gorm:"default:false"` // Tax is contained in the item prices instead of added on top
+	DiscountAmount    float64          `json:"discount_amount" gorm:"default:0"`
+	TotalAmount       float64          `json:"total_amount" gorm:"default:0"`
+	PaidAmount        float64          `json:"paid_amount" gorm:"default:0"`
+	ChangeAmount      float64          `json:"change_amount" gorm:"default:0"`
+	CreditAmount      float64          `json:"credit_amount" gorm:"default:0"`        // Part of the total charged to the customer's account
+	BalanceDue        float64          `json:"balance_due" gorm:"default:0"`          // Part of the credit amount not yet paid
+	PaymentStatus     string           `json:"payment_status" gorm:"default:pending"` // pending, paid, partial, unpaid, refunded, failed
+	SaleStatus        string           `json:"sale_status" gorm:"default:draft"`      // draft, pending, completed, cancelled, refunded
+	ReturnStatus      string           `json:"return_status"`                         // Empty until goods come back: partial, full
+	PaymentMethod     string           `json:"payment_method" gorm:"default:cash"`    // cash, card, digital_wallet, credit, multiple
+	PointsEarned      int              `json:"points_earned" gorm:"default:0"`
+	PointsRedeemed    int              `json:"points_redeemed" gorm:"default:0"`
+	StockReserved     bool             `json:"stock_reserved" gorm:"default:false"` // Draft holds its items in StoreInventory.ReservedQuantity
+	HeldUntil         *time.Time       `json:"held_until"`                          // Drafts are discarded after this
+	Notes             string           `json:"notes"`
+	VoidReason        string           `json:"void_reason"`
+	VoidedBy          *uint            `json:"voided_by"`
+	VoidedByUser      *User            `json:"voided_by_user,omitempty" gorm:"foreignKey:VoidedBy"`
+	VoidedAt          *time.Time       `json:"voided_at"`
+	Items             []SaleItem       `json:"items,omitempty" gorm:"foreignKey:SaleID"`
+	Payments          []SalePayment    `json:"payments,omitempty" gorm:"foreignKey:SaleID"`
+	SaleDate          time.Time        `json:"sale_date" gorm:"default:CURRENT_TIMESTAMP"`
+	CreatedAt         time.Time        `json:"created_at"`
+	UpdatedAt         time.Time        `json:"updated_at"`
 }
 
 type SaleItem struct {
@@ -56,20 +78,49 @@ type SaleItem struct {
 	Product          *Product        `json:"product,omitempty" gorm:"foreignKey:ProductID"`
 	ProductVariantID *uint           `json:"product_variant_id"`
 	ProductVariant   *ProductVariant `json:"product_variant,omitempty" gorm:"foreignKey:ProductVariantID"`
-	Quantity         float64         `json:"quantity" gorm:"not null"`
+	Quantity         float64         `json:"quantity" gorm:"not null"` // In the product's base unit
+	Unit             string          `json:"unit"`                     // Pack the line was rung up in, empty for the base unit
+	UnitQuantity     float64         `json:"unit_quantity"`            // Number of Unit packs, Quantity is worked out from it
 	UnitPrice        float64         `json:"unit_price" gorm:"not null"`
+	ListPrice        float64         `json:"list_price" gorm:"default:0"` // Catalog price at time of sale
 	DiscountAmount   float64         `json:"discount_amount" gorm:"default:0"`
-	TotalPrice       float64         `json:"total_price" gorm:"not null"` // (quantity * unit_price) - discount_amount
+	PromotionAmount  float64         `json:"promotion_amount" gorm:"default:0"` // Part of discount_amount given by automatic promotions
+	TotalPrice       float64         `json:"total_price" gorm:"not null"`       // (quantity * unit_price) - discount_amount
+	PriceOverrideBy  *uint           `json:"price_override_by"`                 // Manager who approved a price override
+	GiftCardCode     string          `json:"gift_card_code"`                    // Card loaded by a gift card line; empty issues a new card
+	GiftCardID       *uint           `json:"gift_card_id"`
+	SerialNumbers    json.RawMessage `json:"serial_numbers,omitempty" gorm:"type:jsonb"` // Units sold on a serialized line, e.g. ["IMEI1","IMEI2"]
+	TaxClassID       *uint           `json:"tax_class_id"`
+	TaxRate          float64         `json:"tax_rate" gorm:"default:0"`
+	TaxAmount        float64         `json:"tax_amount" gorm:"default:0"`
+	Taxes            []SaleItemTax   `json:"taxes,omitempty" gorm:"foreignKey:SaleItemID"`
 	CreatedAt        time.Time       `json:"created_at"`
 }
 
+// SaleItemReservation is stock a parked draft line holds, so the draft gives back exactly that:
+// the line's own product, or the components of a kit that was not assembled when it was parked
+type SaleItemReservation struct {
+	ID               uint      `json:"id" gorm:"primaryKey"`
+	SaleID           uint      `json:"sale_id" gorm:"not null;index"`
+	SaleItemID       uint      `json:"sale_item_id" gorm:"not null;index"`
+	ProductID        uint      `json:"product_id" gorm:"not null"`
+	ProductVariantID *uint     `json:"product_variant_id"`
+	Quantity         float64   `json:"quantity" gorm:"not null"`
+	CreatedAt        time.Time `json:"created_at"`
+}
+
 type SalePayment struct {
-	ID              uint      `json:"id" gorm:"primaryKey"`
-	SaleID          uint      `json:"sale_id" gorm:"not null"`
-	PaymentMethod   string    `json:"payment_method" gorm:"not null"` // cash, card, digital_wallet, credit
-	Amount          float64   `json:"amount" gorm:"not null"`
-	ReferenceNumber string    `json:"reference_number"`              // Card transaction ID, e-wallet ref, etc.
-	Status          string    `json:"status" gorm:"default:pending"` // pending, completed, failed
-	ProcessedAt     time.Time `json:"processed_at" gorm:"default:CURRENT_TIMESTAMP"`
-	CreatedAt       time.Time `json:"created_at"`
+	ID                uint       `json:"id" gorm:"primaryKey"`
+	SaleID            uint       `json:"sale_id" gorm:"not null"`
+	PaymentMethod     string     `json:"payment_method" gorm:"not null"` // cash, card, digital_wallet, credit, qris, gift_card; credit charges the customer account
+	Amount            float64    `json:"amount" gorm:"not null"`
+	ReferenceNumber   string     `json:"reference_number"`                // Card transaction ID, e-wallet ref, gift card code, etc.
+	GiftCardID        *uint      `json:"gift_card_id"`                    // Card redeemed by a gift_card payment
+	Status            string     `json:"status" gorm:"default:pending"`   // pending, completed, failed, cancelled, expired, refund_pending, refunded, refund_failed
+	Provider          string     `json:"provider"`                        // Payment provider confirming this payment, empty when confirmed at the till
+	ProviderReference string     `json:"provider_reference" gorm:"index"` // Transaction ID at the provider
+	PaymentPayload    string     `json:"payment_payload"`                 // QRIS string or terminal instructions
+	ExpiresAt         *time.Time `json:"expires_at"`                      // Pending payments are released after this
+	ProcessedAt       time.Time  `json:"processed_at" gorm:"default:CURRENT_TIMESTAMP"`
+	CreatedAt         time.Time  `json:"created_at"`
 }
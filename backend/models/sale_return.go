@@ -0,0 +1,60 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+type SaleReturn struct {
+	ID                uint               `json:"id" gorm:"primaryKey"`
+	ReturnNumber      string             `json:"return_number" gorm:"uniqueIndex;not null"`
+	SaleID            uint               `json:"sale_id" gorm:"not null;index"`
+	Sale              *Sale              `json:"sale,omitempty" gorm:"foreignKey:SaleID"`
+	StoreID           uint               `json:"store_id" gorm:"not null"`
+	Store             *Store             `json:"store,omitempty" gorm:"foreignKey:StoreID"`
+	CustomerID        *uint              `json:"customer_id"`
+	Customer          *Customer          `json:"customer,omitempty" gorm:"foreignKey:CustomerID"`
+	ProcessedBy       uint               `json:"processed_by" gorm:"not null"`
+	ProcessedByUser   *User              `json:"processed_by_user,omitempty" gorm:"foreignKey:ProcessedBy"`
+	RegisterSessionID *uint              `json:"register_session_id"` // Drawer the refund was paid from
+	RefundAmount      float64            `json:"refund_amount" gorm:"default:0"`
+	PointsReversed    int                `json:"points_reversed" gorm:"default:0"` // Earned points taken back
+	PointsRestored    int                `json:"points_restored" gorm:"default:0"` // Redeemed points given back
+	Reason            string             `json:"reason"`
+	Notes             string             `json:"notes"`
+	Items             []SaleReturnItem   `json:"items,omitempty" gorm:"foreignKey:SaleReturnID"`
+	Refunds           []SaleReturnRefund `json:"refunds,omitempty" gorm:"foreignKey:SaleReturnID"`
+	ReturnDate        time.Time          `json:"return_date" gorm:"default:CURRENT_TIMESTAMP"`
+	CreatedAt         time.Time          `json:"created_at"`
+	UpdatedAt         time.Time          `json:"updated_at"`
+}
+
+type SaleReturnItem struct {
+	ID               uint            `json:"id" gorm:"primaryKey"`
+	SaleReturnID     uint            `json:"sale_return_id" gorm:"not null"`
+	SaleItemID       uint            `json:"sale_item_id" gorm:"not null;index"`
+	SaleItem         *SaleItem       `json:"sale_item,omitempty" gorm:"foreignKey:SaleItemID"`
+	ProductID        uint            `json:"product_id" gorm:"not null"`
+	Product          *Product        `json:"product,omitempty" gorm:"foreignKey:ProductID"`
+	ProductVariantID *uint           `json:"product_variant_id"`
+	ProductVariant   *ProductVariant `json:"product_variant,omitempty" gorm:"foreignKey:ProductVariantID"`
+	Quantity         float64         `json:"quantity" gorm:"not null"`
+	UnitPrice        float64         `json:"unit_price" gorm:"not null"`
+	RefundAmount     float64         `json:"refund_amount" gorm:"not null"`
+	Condition        string          `json:"condition" gorm:"default:restock"` // restock, damaged
+	SerialNumbers    json.RawMessage `json:"serial_numbers,omitempty" gorm:"type:jsonb"`
+	Reason           string          `json:"reason"`
+	CreatedAt        time.Time       `json:"created_at"`
+}
+
+type SaleReturnRefund struct {
+	ID              uint      `json:"id" gorm:"primaryKey"`
+	SaleReturnID    uint      `json:"sale_return_id" gorm:"not null"`
+	PaymentMethod   string    `json:"payment_method" gorm:"not null"` // cash, card, digital_wallet, credit (taken off the balance due)
+	Amount          float64   `json:"amount" gorm:"not null"`
+	ReferenceNumber string    `json:"reference_number"`
+	SalePaymentID   *uint     `json:"sale_payment_id"`               // Provider payment refunded through its provider
+	Status          string    `json:"status" gorm:"default:pending"` // pending, completed, failed
+	ProcessedAt     time.Time `json:"processed_at" gorm:"default:CURRENT_TIMESTAMP"`
+	CreatedAt       time.Time `json:"created_at"`
+}
@@ -0,0 +1,55 @@
+package models
+
+import (
+	"time"
+)
+
+// SerialNumber is one unit of a serialized product, e.g. a phone by its IMEI. Its location
+// is empty while it is in transit, once it is sold and when it came back damaged
+type SerialNumber struct {
+	ID               uint                `json:"id" gorm:"primaryKey"`
+	SerialNumber     string              `json:"serial_number" gorm:"not null;uniqueIndex:idx_serial_numbers_serial_product,priority:1"`
+	ProductID        uint                `json:"product_id" gorm:"not null;uniqueIndex:idx_serial_numbers_serial_product,priority:2"`
+	Product          *Product            `json:"product,omitempty" gorm:"foreignKey:ProductID"`
+	ProductVariantID *uint               `json:"product_variant_id"`
+	ProductVariant   *ProductVariant     `json:"product_variant,omitempty" gorm:"foreignKey:ProductVariantID"`
+	Status           string              `json:"status" gorm:"default:in_stock;index"` // in_stock, in_transit, sold, returned
+	LocationType     string              `json:"location_type"`                        // warehouse, store
+	WarehouseID      *uint               `json:"warehouse_id"`
+	Warehouse        *Warehouse          `json:"warehouse,omitempty" gorm:"foreignKey:WarehouseID"`
+	StoreID          *uint               `json:"store_id"`
+	Store            *Store              `json:"store,omitempty" gorm:"foreignKey:StoreID"`
+	UnitCost         float64             `json:"unit_cost" gorm:"default:0"`
+	PurchaseOrderID  *uint               `json:"purchase_order_id"`
+	StockTransferID  *uint               `json:"stock_transfer_id"` // Transfer carrying it while in transit
+	SaleID           *uint               `json:"sale_id"`           // Last sale of the unit
+	Sale             *Sale               `json:"sale,omitempty" gorm:"foreignKey:SaleID"`
+	SaleItemID       *uint               `json:"sale_item_id" gorm:"index"`
+	CustomerID       *uint               `json:"customer_id"`
+	Customer         *Customer           `json:"customer,omitempty" gorm:"foreignKey:CustomerID"`
+	Events           []SerialNumberEvent `json:"events,omitempty" gorm:"foreignKey:SerialNumberID"`
+	CreatedAt        time.Time           `json:"created_at"`
+	UpdatedAt        time.Time           `json:"updated_at"`
+}
+
+// SerialNumberEvent is one step in the history of a serial number
+type SerialNumberEvent struct {
+	ID              uint       `json:"id" gorm:"primaryKey"`
+	SerialNumberID  uint       `json:"serial_number_id" gorm:"not null;index"`
+	Event           string     `json:"event" gorm:"not null"` // received, transfer_out, transfer_in, sold, voided, returned
+	Status          string     `json:"status"`                // Status after the event
+	LocationType    string     `json:"location_type"`
+	WarehouseID     *uint      `json:"warehouse_id"`
+	Warehouse       *Warehouse `json:"warehouse,omitempty" gorm:"foreignKey:WarehouseID"`
+	StoreID         *uint      `json:"store_id"`
+	Store           *Store     `json:"store,omitempty" gorm:"foreignKey:StoreID"`
+	ReferenceType   string     `json:"reference_type"` // purchase, transfer, sale, void, payment_release, return
+	ReferenceID     *uint      `json:"reference_id"`
+	ReferenceNumber string     `json:"reference_number"`
+	CustomerID      *uint      `json:"customer_id"`
+	Customer        *Customer  `json:"customer,omitempty" gorm:"foreignKey:CustomerID"`
+	Notes           string     `json:"notes"`
+	CreatedBy       uint       `json:"created_by"`
+	CreatedByUser   *User      `json:"created_by_user,omitempty" gorm:"foreignKey:CreatedBy"`
+	CreatedAt       time.Time  `json:"created_at"`
+}
@@ -0,0 +1,44 @@
+package models
+
+import (
+	"time"
+)
+
+// StockLot is the stock of one lot of a product at one warehouse or store. A lot moved to
+// another location gets a row there with the same lot number, expiry and received date
+type StockLot struct {
+	ID               uint            `json:"id" gorm:"primaryKey"`
+	ProductID        uint            `json:"product_id" gorm:"not null;index"`
+	Product          *Product        `json:"product,omitempty" gorm:"foreignKey:ProductID"`
+	ProductVariantID *uint           `json:"product_variant_id"`
+	ProductVariant   *ProductVariant `json:"product_variant,omitempty" gorm:"foreignKey:ProductVariantID"`
+	LotNumber        string          `json:"lot_number" gorm:"not null;index"`
+	ExpiryDate       *time.Time      `json:"expiry_date" gorm:"index"`
+	ReceivedDate     time.Time       `json:"received_date"`
+	LocationType     string          `json:"location_type" gorm:"not null"` // warehouse, store
+	LocationID       uint            `json:"location_id" gorm:"not null"`   // warehouse_id or store_id
+	WarehouseID      *uint           `json:"warehouse_id"`
+	Warehouse        *Warehouse      `json:"warehouse,omitempty" gorm:"foreignKey:WarehouseID"`
+	StoreID          *uint           `json:"store_id"`
+	Store            *Store          `json:"store,omitempty" gorm:"foreignKey:StoreID"`
+	Quantity         float64         `json:"quantity" gorm:"default:0"` // On hand at this location
+	UnitCost         float64         `json:"unit_cost" gorm:"default:0"`
+	PurchaseOrderID  *uint           `json:"purchase_order_id"` // Purchase order the lot was received on
+	PurchaseOrder    *PurchaseOrder  `json:"purchase_order,omitempty" gorm:"foreignKey:PurchaseOrderID"`
+	CreatedAt        time.Time       `json:"created_at"`
+	UpdatedAt        time.Time       `json:"updated_at"`
+}
+
+// StockLotMovement is one change of a lot's quantity; the lot trace is built from these
+type StockLotMovement struct {
+	ID            uint      `json:"id" gorm:"primaryKey"`
+	StockLotID    uint      `json:"stock_lot_id" gorm:"not null;index"`
+	StockLot      *StockLot `json:"stock_lot,omitempty" gorm:"foreignKey:StockLotID"`
+	Quantity      float64   `json:"quantity" gorm:"not null"`       // Positive for in, negative for out
+	ReferenceType string    `json:"reference_type" gorm:"not null"` // purchase, sale, transfer, return, void, payment_release, adjustment, import, assembly, disassembly
+	ReferenceID   *uint     `json:"reference_id"`
+	SaleItemID    *uint     `json:"sale_item_id" gorm:"index"` // Sale line that took the stock, so returns put it back in the same lot
+	Notes         string    `json:"notes"`
+	CreatedBy     uint      `json:"created_by"`
+	CreatedAt     time.Time `json:"created_at"`
+}
@@ -0,0 +1,31 @@
+package models
+
+import (
+	"time"
+)
+
+// TaxClass is a tax rate that can be assigned to products or categories, e.g. PPN 11% or exempt groceries
+type TaxClass struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	Name        string    `json:"name" gorm:"not null"`
+	Code        string    `json:"code" gorm:"uniqueIndex;not null"`
+	Rate        float64   `json:"rate" gorm:"default:0"` // Percentage, 0 for exempt
+	Description string    `json:"description"`
+	IsActive    bool      `json:"is_active" gorm:"default:true"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// SaleItemTax is one tax breakdown line of a sale item
+type SaleItemTax struct {
+	ID            uint      `json:"id" gorm:"primaryKey"`
+	SaleItemID    uint      `json:"sale_item_id" gorm:"not null;index"`
+	SaleID        uint      `json:"sale_id" gorm:"not null;index"`
+	TaxClassID    *uint     `json:"tax_class_id"` // nil when the store-wide tax_rate setting was used
+	TaxClass      *TaxClass `json:"tax_class,omitempty" gorm:"foreignKey:TaxClassID"`
+	TaxName       string    `json:"tax_name"`
+	TaxRate       float64   `json:"tax_rate"`
+	TaxableAmount float64   `json:"taxable_amount"` // Net of discounts and of the tax itself
+	TaxAmount     float64   `json:"tax_amount"`
+	CreatedAt     time.Time `json:"created_at"`
+}
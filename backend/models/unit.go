@@ -0,0 +1,29 @@
+package models
+
+import (
+	"time"
+)
+
+// UnitOfMeasure is a unit goods are counted in, e.g. pcs, dus or kg
+type UnitOfMeasure struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	Code        string    `json:"code" gorm:"uniqueIndex;not null"` // Used in Product.Unit and ProductUnit.Unit
+	Name        string    `json:"name" gorm:"not null"`
+	Description string    `json:"description"`
+	IsActive    bool      `json:"is_active" gorm:"default:true"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// ProductUnit is a pack a product is bought, moved or sold in besides its base unit,
+// e.g. 1 dus = 40 pcs. Stock is always kept in the base unit
+type ProductUnit struct {
+	ID               uint      `json:"id" gorm:"primaryKey"`
+	ProductID        uint      `json:"product_id" gorm:"not null;uniqueIndex:idx_product_units_product_unit,priority:1"`
+	Product          *Product  `json:"product,omitempty" gorm:"foreignKey:ProductID"`
+	Unit             string    `json:"unit" gorm:"not null;uniqueIndex:idx_product_units_product_unit,priority:2"`
+	ConversionFactor float64   `json:"conversion_factor" gorm:"not null"` // Base units in one of this unit
+	Barcode          string    `json:"barcode" gorm:"index"`              // Barcode printed on the pack
+	CreatedAt        time.Time `json:"created_at"`
+	UpdatedAt        time.Time `json:"updated_at"`
+}
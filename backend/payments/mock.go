@@ -0,0 +1,131 @@
+package payments
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// MockProvider is a local provider for development and testing.
+// Payments stay pending until a webhook signed with the secret confirms them
+type MockProvider struct {
+	secret   string
+	mu       sync.Mutex
+	payments map[string]*mockPayment
+}
+
+type mockPayment struct {
+	amount float64
+	status Status
+}
+
+// mockCallback is the webhook body, signed with HMAC-SHA256 in the X-Callback-Signature header
+type mockCallback struct {
+	ProviderReference string  `json:"provider_reference"`
+	Status            Status  `json:"status"`
+	Amount            float64 `json:"amount"`
+}
+
+func NewMockProvider(secret string) *MockProvider {
+	return &MockProvider{secret: secret, payments: map[string]*mockPayment{}}
+}
+
+func (p *MockProvider) Name() string {
+	return "mock"
+}
+
+func (p *MockProvider) Initiate(ctx context.Context, req InitiateRequest) (*Initiation, error) {
+	if req.Amount <= 0 {
+		return nil, errors.New("amount must be greater than zero")
+	}
+
+	reference := fmt.Sprintf("MOCK-%d", time.Now().UnixNano())
+	p.mu.Lock()
+	p.payments[reference] = &mockPayment{amount: req.Amount, status: StatusPending}
+	p.mu.Unlock()
+
+	payload := fmt.Sprintf("Pay %.0f on the EDC terminal", req.Amount)
+	if req.Method == "qris" {
+		payload = fmt.Sprintf("00020101021226MOCK%s5303360540%.0f6304", reference, req.Amount)
+	}
+
+	return &Initiation{
+		ProviderReference: reference,
+		Payload:           payload,
+		Status:            StatusPending,
+		ExpiresAt:         req.ExpiresAt,
+	}, nil
+}
+
+func (p *MockProvider) Status(ctx context.Context, providerReference string) (Status, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	payment, ok := p.payments[providerReference]
+	if !ok {
+		return "", fmt.Errorf("payment %s not found", providerReference)
+	}
+	return payment.status, nil
+}
+
+func (p *MockProvider) Cancel(ctx context.Context, providerReference string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	payment, ok := p.payments[providerReference]
+	if !ok {
+		// Lost on restart; nothing left to cancel
+		return nil
+	}
+	if payment.status == StatusCompleted {
+		return errors.New("payment already completed")
+	}
+	payment.status = StatusCancelled
+	return nil
+}
+
+func (p *MockProvider) Refund(ctx context.Context, providerReference string, amount float64) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if payment, ok := p.payments[providerReference]; ok && amount > payment.amount {
+		return errors.New("refund exceeds the paid amount")
+	}
+	return nil
+}
+
+func (p *MockProvider) ParseCallback(r *http.Request) (*Callback, error) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	mac := hmac.New(sha256.New, []byte(p.secret))
+	mac.Write(body)
+	expected := hex.EncodeToString(mac.Sum(nil))
+	if !hmac.Equal([]byte(expected), []byte(r.Header.Get("X-Callback-Signature"))) {
+		return nil, errors.New("invalid callback signature")
+	}
+
+	var callback mockCallback
+	if err := json.Unmarshal(body, &callback); err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	if payment, ok := p.payments[callback.ProviderReference]; ok {
+		payment.status = callback.Status
+	}
+	p.mu.Unlock()
+
+	return &Callback{
+		ProviderReference: callback.ProviderReference,
+		Status:            callback.Status,
+		Amount:            callback.Amount,
+	}, nil
+}
@@ -0,0 +1,78 @@
+package payments
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Status of a payment at the provider
+type Status string
+
+const (
+	StatusPending   Status = "pending"
+	StatusCompleted Status = "completed"
+	StatusFailed    Status = "failed"
+	StatusCancelled Status = "cancelled"
+	StatusExpired   Status = "expired"
+)
+
+// InitiateRequest asks a provider to start collecting a payment
+type InitiateRequest struct {
+	Reference string // Our own reference, e.g. the sale number and payment ID
+	Method    string // qris, card
+	Amount    float64
+	ExpiresAt time.Time
+}
+
+// Initiation is what the POS needs to let the customer pay
+type Initiation struct {
+	ProviderReference string
+	Payload           string // QRIS string to render, or terminal instructions for EDC
+	Status            Status
+	ExpiresAt         time.Time
+}
+
+// Callback is a verified payment notification sent by a provider to the webhook
+type Callback struct {
+	ProviderReference string
+	Status            Status
+	Amount            float64
+}
+
+// PaymentProvider is implemented by every payment gateway (QRIS acquirer, EDC integration, ...)
+type PaymentProvider interface {
+	Name() string
+	Initiate(ctx context.Context, req InitiateRequest) (*Initiation, error)
+	// Status polls the provider, for when a webhook was missed
+	Status(ctx context.Context, providerReference string) (Status, error)
+	Cancel(ctx context.Context, providerReference string) error
+	Refund(ctx context.Context, providerReference string, amount float64) error
+	// ParseCallback verifies and decodes a webhook request
+	ParseCallback(r *http.Request) (*Callback, error)
+}
+
+var (
+	mu        sync.RWMutex
+	providers = map[string]PaymentProvider{}
+)
+
+// Register makes a provider available under its name
+func Register(provider PaymentProvider) {
+	mu.Lock()
+	defer mu.Unlock()
+	providers[provider.Name()] = provider
+}
+
+// Get returns a registered provider
+func Get(name string) (PaymentProvider, error) {
+	mu.RLock()
+	defer mu.RUnlock()
+	provider, ok := providers[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown payment provider %s", name)
+	}
+	return provider, nil
+}
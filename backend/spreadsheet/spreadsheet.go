@@ -0,0 +1,60 @@
+package spreadsheet
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// Read parses an uploaded CSV or XLSX file into rows of cells, telling the two apart by the
+// file name and falling back to the zip signature of XLSX files
+func Read(data []byte, filename string) ([][]string, error) {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".xlsx":
+		return ReadXLSX(data)
+	case ".csv", ".txt":
+		return ReadCSV(bytes.NewReader(data))
+	}
+	if bytes.HasPrefix(data, []byte("PK\x03\x04")) {
+		return ReadXLSX(data)
+	}
+	return ReadCSV(bytes.NewReader(data))
+}
+
+// ReadCSV parses CSV with a comma or semicolon delimiter, as written by spreadsheet programs in
+// locales that use the comma as decimal separator. A UTF-8 byte order mark is skipped
+func ReadCSV(r io.Reader) ([][]string, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	data = bytes.TrimPrefix(data, []byte("\xEF\xBB\xBF"))
+
+	firstLine := data
+	if i := bytes.IndexByte(data, '\n'); i >= 0 {
+		firstLine = data[:i]
+	}
+
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = -1
+	if bytes.Count(firstLine, []byte(";")) > bytes.Count(firstLine, []byte(",")) {
+		reader.Comma = ';'
+	}
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("invalid CSV: %v", err)
+	}
+	return rows, nil
+}
+
+// WriteCSV writes rows as comma separated values
+func WriteCSV(w io.Writer, rows [][]string) error {
+	writer := csv.NewWriter(w)
+	if err := writer.WriteAll(rows); err != nil {
+		return err
+	}
+	return writer.Error()
+}
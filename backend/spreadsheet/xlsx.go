@@ -0,0 +1,311 @@
+package spreadsheet
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"path"
+	"strconv"
+	"strings"
+)
+
+const (
+	xlsxMainNS = "http://schemas.openxmlformats.org/spreadsheetml/2006/main"
+	xlsxRelsNS = "http://schemas.openxmlformats.org/officeDocument/2006/relationships"
+)
+
+// Limits of what ReadXLSX accepts, so a small crafted file cannot exhaust memory. Columns and
+// rows are the sheet size of Excel itself
+const (
+	xlsxMaxColumns  = 16384
+	xlsxMaxRows     = 1048576
+	xlsxMaxCells    = 2000000
+	xlsxMaxPartSize = 100 << 20 // Uncompressed size of one part of the archive
+)
+
+type xlsxWorkbook struct {
+	Sheets []struct {
+		Name string `xml:"name,attr"`
+		RID  string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+	} `xml:"sheets>sheet"`
+}
+
+type xlsxRelationships struct {
+	Relationships []struct {
+		ID     string `xml:"Id,attr"`
+		Target string `xml:"Target,attr"`
+	} `xml:"Relationship"`
+}
+
+// xlsxText is a shared or inline string: plain text or rich text runs
+type xlsxText struct {
+	Text string `xml:"t"`
+	Runs []struct {
+		Text string `xml:"t"`
+	} `xml:"r"`
+}
+
+func (t xlsxText) String() string {
+	if len(t.Runs) == 0 {
+		return t.Text
+	}
+	var b strings.Builder
+	for _, run := range t.Runs {
+		b.WriteString(run.Text)
+	}
+	return b.String()
+}
+
+type xlsxWorksheet struct {
+	Rows []struct {
+		Index int `xml:"r,attr"`
+		Cells []struct {
+			Ref    string   `xml:"r,attr"`
+			Type   string   `xml:"t,attr"`
+			Value  string   `xml:"v"`
+			Inline xlsxText `xml:"is"`
+		} `xml:"c"`
+	} `xml:"sheetData>row"`
+}
+
+// ReadXLSX reads the cells of the first worksheet of an XLSX workbook as text. Numbers come
+// back without exponent or float noise, so barcodes typed as numbers keep all their digits
+func ReadXLSX(data []byte) ([][]string, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid XLSX file: %v", err)
+	}
+	files := make(map[string]*zip.File, len(archive.File))
+	for _, file := range archive.File {
+		files[strings.TrimPrefix(file.Name, "/")] = file
+	}
+	decode := func(name string, v interface{}) error {
+		file, ok := files[name]
+		if !ok {
+			return fmt.Errorf("invalid XLSX file: %s is missing", name)
+		}
+		reader, err := file.Open()
+		if err != nil {
+			return err
+		}
+		defer reader.Close()
+		limited := &io.LimitedReader{R: reader, N: xlsxMaxPartSize}
+		if err := xml.NewDecoder(limited).Decode(v); err != nil {
+			if limited.N <= 0 {
+				return fmt.Errorf("invalid XLSX file: %s is larger than %d MB", name, xlsxMaxPartSize>>20)
+			}
+			return fmt.Errorf("invalid XLSX file: %s: %v", name, err)
+		}
+		return nil
+	}
+
+	var workbook xlsxWorkbook
+	if err := decode("xl/workbook.xml", &workbook); err != nil {
+		return nil, err
+	}
+	if len(workbook.Sheets) == 0 {
+		return nil, fmt.Errorf("invalid XLSX file: the workbook has no sheets")
+	}
+	var rels xlsxRelationships
+	if err := decode("xl/_rels/workbook.xml.rels", &rels); err != nil {
+		return nil, err
+	}
+	sheetPath := ""
+	for _, rel := range rels.Relationships {
+		if rel.ID == workbook.Sheets[0].RID {
+			sheetPath = rel.Target
+		}
+	}
+	if strings.HasPrefix(sheetPath, "/") {
+		sheetPath = strings.TrimPrefix(sheetPath, "/")
+	} else {
+		sheetPath = path.Join("xl", sheetPath)
+	}
+
+	var shared []string
+	if _, ok := files["xl/sharedStrings.xml"]; ok {
+		var sst struct {
+			Items []xlsxText `xml:"si"`
+		}
+		if err := decode("xl/sharedStrings.xml", &sst); err != nil {
+			return nil, err
+		}
+		for _, item := range sst.Items {
+			shared = append(shared, item.String())
+		}
+	}
+
+	var sheet xlsxWorksheet
+	if err := decode(sheetPath, &sheet); err != nil {
+		return nil, err
+	}
+
+	var rows [][]string
+	total := 0
+	for i, row := range sheet.Rows {
+		index := row.Index - 1
+		if row.Index == 0 {
+			index = len(rows)
+		}
+		if index < 0 || index >= xlsxMaxRows {
+			return nil, fmt.Errorf("invalid XLSX file: bad row number %d", row.Index)
+		}
+		// Empty rows are left out of the file; keep the numbering
+		total += max(index-len(rows), 0)
+		if total > xlsxMaxCells {
+			return nil, fmt.Errorf("invalid XLSX file: the sheet has more than %d cells", xlsxMaxCells)
+		}
+		for len(rows) < index {
+			rows = append(rows, nil)
+		}
+		var cells []string
+		for j, cell := range row.Cells {
+			col := j
+			if cell.Ref != "" {
+				col = columnIndex(cell.Ref)
+			}
+			if col < 0 || col >= xlsxMaxColumns {
+				return nil, fmt.Errorf("invalid XLSX file: bad cell reference %q in row %d", cell.Ref, i+1)
+			}
+			total += max(col+1-len(cells), 1)
+			if total > xlsxMaxCells {
+				return nil, fmt.Errorf("invalid XLSX file: the sheet has more than %d cells", xlsxMaxCells)
+			}
+			for len(cells) < col {
+				cells = append(cells, "")
+			}
+
+			var value string
+			switch cell.Type {
+			case "s":
+				n, err := strconv.Atoi(cell.Value)
+				if err != nil || n < 0 || n >= len(shared) {
+					return nil, fmt.Errorf("invalid XLSX file: bad shared string in row %d", i+1)
+				}
+				value = shared[n]
+			case "inlineStr":
+				value = cell.Inline.String()
+			case "b":
+				value = map[string]string{"1": "TRUE", "0": "FALSE"}[cell.Value]
+			case "str", "e":
+				value = cell.Value
+			default:
+				value = cleanNumber(cell.Value)
+			}
+			cells = append(cells[:col], value)
+		}
+		rows = append(rows, cells)
+	}
+	return rows, nil
+}
+
+// columnIndex turns the letters of a cell reference such as AB12 into a 0-based column, or -1
+// when the reference does not name a column within the sheet followed by a row number
+func columnIndex(ref string) int {
+	col, i := 0, 0
+	for ; i < len(ref) && ref[i] >= 'A' && ref[i] <= 'Z'; i++ {
+		col = col*26 + int(ref[i]-'A'+1)
+		if col > xlsxMaxColumns {
+			return -1
+		}
+	}
+	if i == 0 || i == len(ref) || ref[i] < '0' || ref[i] > '9' {
+		return -1
+	}
+	return col - 1
+}
+
+// columnName is the letter name of a 0-based column
+func columnName(col int) string {
+	name := ""
+	for col++; col > 0; col = (col - 1) / 26 {
+		name = string(rune('A'+(col-1)%26)) + name
+	}
+	return name
+}
+
+// cleanNumber rewrites a stored number the way a spreadsheet shows it: 8.992388001001E12
+// becomes 8992388001001 and 3500.0000000000005 becomes 3500
+func cleanNumber(value string) string {
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return value
+	}
+	if rounded := math.Round(f); math.Abs(f-rounded) < 1e-9 && math.Abs(f) < 1e15 {
+		return strconv.FormatFloat(rounded, 'f', -1, 64)
+	}
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// WriteXLSX writes a workbook with a single sheet. Cells may be strings, which are kept as
+// text, or numbers; nil leaves the cell empty
+func WriteXLSX(w io.Writer, sheetName string, rows [][]interface{}) error {
+	var sheet bytes.Buffer
+	sheet.WriteString(xml.Header)
+	fmt.Fprintf(&sheet, `<worksheet xmlns="%s"><sheetData>`, xlsxMainNS)
+	for i, row := range rows {
+		fmt.Fprintf(&sheet, `<row r="%d">`, i+1)
+		for j, value := range row {
+			ref := columnName(j) + strconv.Itoa(i+1)
+			switch v := value.(type) {
+			case nil:
+			case string:
+				if v == "" {
+					continue
+				}
+				fmt.Fprintf(&sheet, `<c r="%s" t="inlineStr"><is><t xml:space="preserve">`, ref)
+				if err := xml.EscapeText(&sheet, []byte(v)); err != nil {
+					return err
+				}
+				sheet.WriteString(`</t></is></c>`)
+			case float64:
+				fmt.Fprintf(&sheet, `<c r="%s"><v>%s</v></c>`, ref, strconv.FormatFloat(v, 'f', -1, 64))
+			case int:
+				fmt.Fprintf(&sheet, `<c r="%s"><v>%d</v></c>`, ref, v)
+			default:
+				return fmt.Errorf("unsupported cell value %T", value)
+			}
+		}
+		sheet.WriteString(`</row>`)
+	}
+	sheet.WriteString(`</sheetData></worksheet>`)
+
+	var name bytes.Buffer
+	if err := xml.EscapeText(&name, []byte(sheetName)); err != nil {
+		return err
+	}
+
+	parts := []struct {
+		name    string
+		content string
+	}{
+		{"[Content_Types].xml", xml.Header + `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+			`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+			`<Default Extension="xml" ContentType="application/xml"/>` +
+			`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+			`<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>` +
+			`</Types>`},
+		{"_rels/.rels", xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId1" Type="` + xlsxRelsNS + `/officeDocument" Target="xl/workbook.xml"/></Relationships>`},
+		{"xl/workbook.xml", xml.Header + `<workbook xmlns="` + xlsxMainNS + `" xmlns:r="` + xlsxRelsNS + `">` +
+			`<sheets><sheet name="` + name.String() + `" sheetId="1" r:id="rId1"/></sheets></workbook>`},
+		{"xl/_rels/workbook.xml.rels", xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId1" Type="` + xlsxRelsNS + `/worksheet" Target="worksheets/sheet1.xml"/></Relationships>`},
+		{"xl/worksheets/sheet1.xml", sheet.String()},
+	}
+
+	archive := zip.NewWriter(w)
+	for _, part := range parts {
+		file, err := archive.Create(part.name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(file, part.content); err != nil {
+			return err
+		}
+	}
+	return archive.Close()
+}